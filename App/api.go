@@ -0,0 +1,578 @@
+// Copyright 2016 Cory Robinson. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE.txt file.
+
+// api.go implements a JSON HTTP API over the invoice repository, for other
+// services that need invoice data. It is run headless with the serve
+// command. The endpoints mirror the Repository functions used by the GUI:
+//
+//	GET    /api/v1/invoices                list invoices, see invoiceFilter
+//	POST   /api/v1/invoices                add an invoice
+//	GET    /api/v1/invoices/{id}           get an invoice
+//	PUT    /api/v1/invoices/{id}           replace an invoice
+//	DELETE /api/v1/invoices/{id}           delete an invoice
+//	GET    /api/v1/invoices/{id}/items     line items of an invoice
+//	GET    /api/v1/vendors                 vendors and their invoice counts
+//	GET    /api/v1/vendors/{name}/invoices invoice table view of a vendor
+//	GET    /api/v1/counts                  invoice, vendor and paid counts
+//	GET    /api/v1/search?q=               invoices selected by a search query, see search.go
+//	GET    /api/v1/openapi.json            the OpenAPI document of the API
+//
+// Every request but for the OpenAPI document logs in with basic auth as a
+// user of users.go, and is made as that user; while the DB has no accounts,
+// requests without credentials are made as the open user.
+//
+// Lists are paginated with limit and offset, in the DB. The invoices listed
+// have only the fields of the invoices table, see invoicePageFields; the
+// line items and the parties are read per invoice. Every GET response has an
+// ETag, so clients can poll with If-None-Match, and PUT and DELETE honor
+// If-Match to detect concurrent changes.
+
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"gopkg.in/mgo.v2/bson"
+)
+
+// API pagination limits.
+const (
+	apiDefaultLimit = 50
+	apiMaxLimit     = 500
+)
+
+// InvoiceStore is the part of Repository the API uses.
+type InvoiceStore interface {
+	GetInvoicePage(filter bson.M, sort []string, skip, limit int) Invoices
+	CountInvoices(filter bson.M) int
+	GetInvoiceById(id int) Invoice
+	GetInvoiceByInvoiceNoAndVendor(num, vendor string) Invoice
+	GetTableLineItemView(num, vendor string) Items
+	GetInvoiceVendors() []string
+	CountInvoicesByVendorName(name string) int
+	InvoiceExists(num, vendor string) bool
+	AddInvoice(invoice Invoice) bool
+	UpdateInvoice(invoice Invoice) bool
+	DeleteInvoice(id int) string
+	CountPaidTrue() int
+	CountPaidFalse() int
+	RecordCount() int
+	CountVendors() int
+	Authorize(action Action) error
+	Authenticate(name, password string) (User, error)
+	As(u User) InvoiceStore
+}
+
+// APIServer serves the invoice API.
+type APIServer struct {
+	store InvoiceStore
+	mux   *http.ServeMux
+
+	// writes is held while an invoice is added, updated or deleted, as
+	// the repository assigns IDs and checks for duplicates non-atomically
+	writes sync.Mutex
+}
+
+// APIPage is a page of a list.
+type APIPage struct {
+	Total  int         `json:"total"`
+	Limit  int         `json:"limit"`
+	Offset int         `json:"offset"`
+	Items  interface{} `json:"items"`
+}
+
+// APIVendor is a vendor with its number of invoices.
+type APIVendor struct {
+	Name     string `json:"name"`
+	Invoices int    `json:"invoices"`
+}
+
+// APICounts are the counts shown in the all vendors profile.
+type APICounts struct {
+	Invoices int `json:"invoices"`
+	Vendors  int `json:"vendors"`
+	Paid     int `json:"paid"`
+	Unpaid   int `json:"unpaid"`
+}
+
+// apiError is the body of an error response.
+type apiError struct {
+	Error    string   `json:"error"`
+	Problems []string `json:"problems,omitempty"`
+}
+
+// NewAPIServer returns an API server over the store.
+func NewAPIServer(store InvoiceStore) *APIServer {
+	s := &APIServer{store: store, mux: http.NewServeMux()}
+
+	s.mux.HandleFunc("GET /api/v1/invoices", s.listInvoices)
+	s.mux.HandleFunc("POST /api/v1/invoices", s.addInvoice)
+	s.mux.HandleFunc("GET /api/v1/invoices/{id}", s.getInvoice)
+	s.mux.HandleFunc("PUT /api/v1/invoices/{id}", s.updateInvoice)
+	s.mux.HandleFunc("DELETE /api/v1/invoices/{id}", s.deleteInvoice)
+	s.mux.HandleFunc("GET /api/v1/invoices/{id}/items", s.getLineItems)
+	s.mux.HandleFunc("GET /api/v1/vendors", s.listVendors)
+	s.mux.HandleFunc("GET /api/v1/vendors/{name}/invoices", s.listVendorInvoices)
+	s.mux.HandleFunc("GET /api/v1/counts", s.getCounts)
+	s.mux.HandleFunc("GET /api/v1/search", s.search)
+	s.mux.HandleFunc("GET /api/v1/openapi.json", s.openAPI)
+
+	return s
+}
+
+// apiStoreKey is the context key of the store acting as the user of a
+// request, see storeFor.
+type apiStoreKey struct{}
+
+// ServeHTTP implements http.Handler, logging the request in first.
+func (s *APIServer) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if req.URL.Path != "/api/v1/openapi.json" {
+		name, password, _ := req.BasicAuth()
+		u, err := s.store.Authenticate(name, password)
+		switch {
+		case errors.Is(err, errWrongLogin) || errors.Is(err, errNoLogin):
+			w.Header().Set("WWW-Authenticate", `Basic realm="invoices", charset="UTF-8"`)
+			writeAPIError(w, http.StatusUnauthorized, err.Error(), nil)
+			return
+		case err != nil:
+			writeAPIError(w, http.StatusServiceUnavailable, "cannot reach the invoice database", nil)
+			return
+		}
+		req = req.WithContext(context.WithValue(req.Context(), apiStoreKey{}, s.store.As(u)))
+	}
+	s.mux.ServeHTTP(w, req)
+}
+
+// storeFor returns the store acting as the user the request logged in as.
+func (s *APIServer) storeFor(req *http.Request) InvoiceStore {
+	return req.Context().Value(apiStoreKey{}).(InvoiceStore)
+}
+
+// invoiceFilter selects the invoices of a list from the query parameters
+// vendor, paid (true or false), from and to (MM/DD/YYYY, inclusive) and q,
+// a text to find in the vendor, invoice number or purchase order.
+type invoiceFilter struct {
+	vendor   string
+	paid     *bool
+	from, to time.Time
+	text     string
+}
+
+// parseInvoiceFilter reads a filter from the query.
+func parseInvoiceFilter(query url.Values) (invoiceFilter, error) {
+	var paid *bool
+	if value := query.Get("paid"); value != "" {
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return invoiceFilter{}, fmt.Errorf("paid must be true or false")
+		}
+		paid = &b
+	}
+	return newInvoiceFilter(query.Get("vendor"), paid, query.Get("from"), query.Get("to"), query.Get("q"))
+}
+
+// newInvoiceFilter returns the filter for the parameters, which are
+// ignored when empty or nil.
+func newInvoiceFilter(vendor string, paid *bool, from, to, text string) (invoiceFilter, error) {
+	f := invoiceFilter{vendor: vendor, paid: paid, text: strings.ToLower(text)}
+
+	for _, p := range []struct {
+		name, value string
+		date        *time.Time
+	}{{"from", from, &f.from}, {"to", to, &f.to}} {
+		if p.value != "" {
+			date, err := time.Parse("01/02/2006", p.value)
+			if err != nil {
+				return f, fmt.Errorf("%s must be a date MM/DD/YYYY", p.name)
+			}
+			*p.date = date
+		}
+	}
+	return f, nil
+}
+
+// bson returns the MongoDB filter of the invoices selected. Dates are
+// compared by their date keys, see dateKey.
+func (f invoiceFilter) bson() bson.M {
+	var and []bson.M
+	if f.vendor != "" {
+		and = append(and, bson.M{"vendor": bson.RegEx{Pattern: "^" + regexp.QuoteMeta(f.vendor) + "$", Options: "i"}})
+	}
+	if f.paid != nil {
+		and = append(and, bson.M{"paid": *f.paid})
+	}
+	if !f.from.IsZero() || !f.to.IsZero() {
+		// invoices without a valid date have an empty key
+		cmp := bson.M{"$gt": ""}
+		if !f.from.IsZero() {
+			cmp["$gte"] = f.from.Format("2006-01-02")
+		}
+		if !f.to.IsZero() {
+			cmp["$lte"] = f.to.Format("2006-01-02")
+		}
+		and = append(and, bson.M{"datekey": cmp})
+	}
+	if f.text != "" {
+		and = append(and, bson.M{"$or": []bson.M{
+			{"vendor": searchRegex(f.text)},
+			{"invoiceno": searchRegex(f.text)},
+			{"purchaseorder": searchRegex(f.text)},
+		}})
+	}
+	if len(and) == 0 {
+		return bson.M{}
+	}
+	return bson.M{"$and": and}
+}
+
+// eachInvoicePage calls page with the invoices of the store selected by the
+// filter, by ID, apiMaxLimit at a time, until page returns an error. The
+// invoices have only the invoicePageFields.
+func eachInvoicePage(store InvoiceStore, filter bson.M, page func(Invoices) error) error {
+	lastID := 0
+	for {
+		invoices := store.GetInvoicePage(bson.M{"$and": []bson.M{filter, {"id": bson.M{"$gt": lastID}}}},
+			[]string{"id"}, 0, apiMaxLimit)
+		if len(invoices) == 0 {
+			return nil
+		}
+		if err := page(invoices); err != nil {
+			return err
+		}
+		if len(invoices) < apiMaxLimit {
+			return nil
+		}
+		lastID = invoices[len(invoices)-1].ID
+	}
+}
+
+// parsePage reads limit and offset from the query.
+func parsePage(query url.Values) (limit, offset int, err error) {
+	limit = apiDefaultLimit
+	if value := query.Get("limit"); value != "" {
+		if limit, err = strconv.Atoi(value); err != nil || limit < 1 || limit > apiMaxLimit {
+			return 0, 0, fmt.Errorf("limit must be from 1 to %d", apiMaxLimit)
+		}
+	}
+	if value := query.Get("offset"); value != "" {
+		if offset, err = strconv.Atoi(value); err != nil || offset < 0 {
+			return 0, 0, errors.New("offset must not be negative")
+		}
+	}
+	return limit, offset, nil
+}
+
+// writeInvoicePage writes the page asked for of the invoices of the store
+// selected by the filter, by ID. The page is read from the DB.
+func writeInvoicePage(w http.ResponseWriter, req *http.Request, store InvoiceStore, filter bson.M) {
+	limit, offset, err := parsePage(req.URL.Query())
+	if err != nil {
+		writeAPIError(w, http.StatusBadRequest, err.Error(), nil)
+		return
+	}
+
+	page := APIPage{Total: store.CountInvoices(filter), Limit: limit, Offset: offset}
+	invoices := store.GetInvoicePage(filter, []string{"id"}, offset, limit)
+	if invoices == nil {
+		invoices = Invoices{}
+	}
+	page.Items = invoices
+	writeAPIPage(w, req, page)
+}
+
+// writeAPIPage writes a page, with a Link header to the next page if there
+// is one.
+func writeAPIPage(w http.ResponseWriter, req *http.Request, page APIPage) {
+	if page.Offset+page.Limit < page.Total {
+		next := *req.URL
+		query := next.Query()
+		query.Set("offset", strconv.Itoa(page.Offset+page.Limit))
+		query.Set("limit", strconv.Itoa(page.Limit))
+		next.RawQuery = query.Encode()
+		w.Header().Set("Link", fmt.Sprintf("<%s>; rel=\"next\"", next.RequestURI()))
+	}
+	writeAPIJSON(w, req, http.StatusOK, page)
+}
+
+// listInvoices handles GET /api/v1/invoices.
+func (s *APIServer) listInvoices(w http.ResponseWriter, req *http.Request) {
+	filter, err := parseInvoiceFilter(req.URL.Query())
+	if err != nil {
+		writeAPIError(w, http.StatusBadRequest, err.Error(), nil)
+		return
+	}
+	writeInvoicePage(w, req, s.storeFor(req), filter.bson())
+}
+
+// lookupInvoice returns the invoice named by the id in the path, writing
+// the error response if there is none.
+func (s *APIServer) lookupInvoice(w http.ResponseWriter, req *http.Request) (Invoice, bool) {
+	id, err := strconv.Atoi(req.PathValue("id"))
+	if err != nil {
+		writeAPIError(w, http.StatusBadRequest, "invalid invoice id", nil)
+		return Invoice{}, false
+	}
+	invoice := s.storeFor(req).GetInvoiceById(id)
+	if invoice.ID != id || id == 0 {
+		writeAPIError(w, http.StatusNotFound, fmt.Sprintf("invoice %d not found", id), nil)
+		return Invoice{}, false
+	}
+	return invoice, true
+}
+
+// getInvoice handles GET /api/v1/invoices/{id}.
+func (s *APIServer) getInvoice(w http.ResponseWriter, req *http.Request) {
+	if invoice, ok := s.lookupInvoice(w, req); ok {
+		writeAPIJSON(w, req, http.StatusOK, invoice)
+	}
+}
+
+// getLineItems handles GET /api/v1/invoices/{id}/items.
+func (s *APIServer) getLineItems(w http.ResponseWriter, req *http.Request) {
+	if invoice, ok := s.lookupInvoice(w, req); ok {
+		items := s.storeFor(req).GetTableLineItemView(invoice.InvoiceNo, invoice.Vendor)
+		if items == nil {
+			items = Items{}
+		}
+		writeAPIJSON(w, req, http.StatusOK, items)
+	}
+}
+
+// readInvoice decodes and validates the invoice in a request body.
+func readInvoice(w http.ResponseWriter, req *http.Request) (Invoice, bool) {
+	var invoice Invoice
+	decoder := json.NewDecoder(http.MaxBytesReader(w, req.Body, 1<<20))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&invoice); err != nil {
+		writeAPIError(w, http.StatusBadRequest, fmt.Sprintf("invalid invoice: %v", err), nil)
+		return invoice, false
+	}
+	if problems := validateInvoice(invoice); len(problems) > 0 {
+		writeAPIError(w, http.StatusUnprocessableEntity, "invalid invoice", problems)
+		return invoice, false
+	}
+	return invoice, true
+}
+
+// addInvoice handles POST /api/v1/invoices. The ID of the invoice is
+// assigned by the repository.
+func (s *APIServer) addInvoice(w http.ResponseWriter, req *http.Request) {
+	invoice, ok := readInvoice(w, req)
+	if !ok {
+		return
+	}
+
+	s.writes.Lock()
+	defer s.writes.Unlock()
+
+	store := s.storeFor(req)
+	if !authorize(w, store, invoiceActions(invoice, nil)...) {
+		return
+	}
+	if store.InvoiceExists(invoice.InvoiceNo, invoice.Vendor) {
+		writeAPIError(w, http.StatusConflict,
+			fmt.Sprintf("invoice %s from %s already exists", invoice.InvoiceNo, invoice.Vendor), nil)
+		return
+	}
+	if !store.AddInvoice(invoice) {
+		writeAPIError(w, http.StatusInternalServerError, "failed to add invoice", nil)
+		return
+	}
+
+	invoice = store.GetInvoiceByInvoiceNoAndVendor(invoice.InvoiceNo, invoice.Vendor)
+	w.Header().Set("Location", fmt.Sprintf("/api/v1/invoices/%d", invoice.ID))
+	writeAPIJSON(w, req, http.StatusCreated, invoice)
+}
+
+// updateInvoice handles PUT /api/v1/invoices/{id}. The invoice is replaced
+// by the one in the body, except for its ID and attachments.
+func (s *APIServer) updateInvoice(w http.ResponseWriter, req *http.Request) {
+	s.writes.Lock()
+	defer s.writes.Unlock()
+
+	current, ok := s.lookupInvoice(w, req)
+	if !ok || !checkIfMatch(w, req, current) {
+		return
+	}
+	invoice, ok := readInvoice(w, req)
+	if !ok {
+		return
+	}
+	invoice.ID = current.ID
+	invoice.Attachments = current.Attachments // managed in the GUI, see attachments.go
+	store := s.storeFor(req)
+	if !authorize(w, store, invoiceActions(invoice, &current)...) {
+		return
+	}
+
+	if (invoice.InvoiceNo != current.InvoiceNo || invoice.Vendor != current.Vendor) &&
+		store.InvoiceExists(invoice.InvoiceNo, invoice.Vendor) {
+		writeAPIError(w, http.StatusConflict,
+			fmt.Sprintf("invoice %s from %s already exists", invoice.InvoiceNo, invoice.Vendor), nil)
+		return
+	}
+	if !store.UpdateInvoice(invoice) {
+		writeAPIError(w, http.StatusInternalServerError, "failed to update invoice", nil)
+		return
+	}
+	writeAPIJSON(w, req, http.StatusOK, invoice)
+}
+
+// deleteInvoice handles DELETE /api/v1/invoices/{id}.
+func (s *APIServer) deleteInvoice(w http.ResponseWriter, req *http.Request) {
+	s.writes.Lock()
+	defer s.writes.Unlock()
+
+	current, ok := s.lookupInvoice(w, req)
+	if !ok || !checkIfMatch(w, req, current) {
+		return
+	}
+
+	store := s.storeFor(req)
+	switch store.DeleteInvoice(current.ID) {
+	case "OK":
+		w.WriteHeader(http.StatusNoContent)
+	case "NOT FOUND":
+		writeAPIError(w, http.StatusNotFound, fmt.Sprintf("invoice %d not found", current.ID), nil)
+	case "FORBIDDEN":
+		authorize(w, store, ActionDelete)
+	default:
+		writeAPIError(w, http.StatusInternalServerError, "failed to delete invoice", nil)
+	}
+}
+
+// authorize writes a 403 response and returns false unless the user the
+// store acts as may take the actions, see users.go.
+func authorize(w http.ResponseWriter, store InvoiceStore, actions ...Action) bool {
+	for _, action := range actions {
+		if err := store.Authorize(action); err != nil {
+			writeAPIError(w, http.StatusForbidden, err.Error(), nil)
+			return false
+		}
+	}
+	return true
+}
+
+// listVendors handles GET /api/v1/vendors.
+func (s *APIServer) listVendors(w http.ResponseWriter, req *http.Request) {
+	store := s.storeFor(req)
+	names := store.GetInvoiceVendors()
+	sort.Strings(names)
+
+	vendors := make([]APIVendor, len(names))
+	for i, name := range names {
+		vendors[i] = APIVendor{Name: name, Invoices: store.CountInvoicesByVendorName(name)}
+	}
+	writeAPIJSON(w, req, http.StatusOK, vendors)
+}
+
+// listVendorInvoices handles GET /api/v1/vendors/{name}/invoices, the
+// vendor's invoices as listed by GET /api/v1/invoices.
+func (s *APIServer) listVendorInvoices(w http.ResponseWriter, req *http.Request) {
+	writeInvoicePage(w, req, s.storeFor(req), bson.M{"vendor": req.PathValue("name")})
+}
+
+// getCounts handles GET /api/v1/counts.
+func (s *APIServer) getCounts(w http.ResponseWriter, req *http.Request) {
+	store := s.storeFor(req)
+	writeAPIJSON(w, req, http.StatusOK, APICounts{
+		Invoices: store.RecordCount(),
+		Vendors:  store.CountVendors(),
+		Paid:     store.CountPaidTrue(),
+		Unpaid:   store.CountPaidFalse(),
+	})
+}
+
+// search handles GET /api/v1/search, listing the invoices selected by q in
+// the search syntax of search.go like GET /api/v1/invoices does.
+func (s *APIServer) search(w http.ResponseWriter, req *http.Request) {
+	q := strings.TrimSpace(req.URL.Query().Get("q"))
+	if q == "" {
+		writeAPIError(w, http.StatusBadRequest, "q is required", nil)
+		return
+	}
+	query, err := ParseSearch(q)
+	if err != nil {
+		writeAPIError(w, http.StatusBadRequest, "invalid q: "+err.Error(), nil)
+		return
+	}
+	writeInvoicePage(w, req, s.storeFor(req), query.Filter())
+}
+
+// openAPI handles GET /api/v1/openapi.json.
+func (s *APIServer) openAPI(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Write([]byte(apiOpenAPI))
+}
+
+// apiETag returns the entity tag of a JSON representation.
+func apiETag(data []byte) string {
+	sum := sha256.Sum256(data)
+	return `"` + hex.EncodeToString(sum[:12]) + `"`
+}
+
+// checkIfMatch checks the If-Match header of a request changing the
+// invoice, writing 412 Precondition Failed if the invoice has changed.
+func checkIfMatch(w http.ResponseWriter, req *http.Request, current Invoice) bool {
+	match := req.Header.Get("If-Match")
+	if match == "" || match == "*" {
+		return true
+	}
+	data, _ := json.Marshal(current)
+	etag := apiETag(append(data, '\n'))
+	for _, tag := range strings.Split(match, ",") {
+		if strings.TrimPrefix(strings.TrimSpace(tag), "W/") == etag {
+			return true
+		}
+	}
+	writeAPIError(w, http.StatusPreconditionFailed, "the invoice has been changed", nil)
+	return false
+}
+
+// writeAPIJSON writes v as the JSON response with its ETag. A GET with a
+// matching If-None-Match gets 304 Not Modified.
+func writeAPIJSON(w http.ResponseWriter, req *http.Request, status int, v interface{}) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		writeAPIError(w, http.StatusInternalServerError, err.Error(), nil)
+		return
+	}
+	data = append(data, '\n')
+
+	etag := apiETag(data)
+	w.Header().Set("ETag", etag)
+	if req.Method == http.MethodGet {
+		for _, tag := range strings.Split(req.Header.Get("If-None-Match"), ",") {
+			if tag = strings.TrimPrefix(strings.TrimSpace(tag), "W/"); tag == etag || tag == "*" {
+				w.WriteHeader(http.StatusNotModified)
+				return
+			}
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(data)
+}
+
+// writeAPIError writes an error response.
+func writeAPIError(w http.ResponseWriter, status int, message string, problems []string) {
+	data, _ := json.Marshal(apiError{Error: message, Problems: problems})
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(append(data, '\n'))
+}
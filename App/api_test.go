@@ -0,0 +1,510 @@
+// Copyright 2016 Cory Robinson. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE.txt file.
+
+package main
+
+import (
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"slices"
+	"strings"
+	"testing"
+
+	"gopkg.in/mgo.v2/bson"
+)
+
+// memStore is an InvoiceStore in memory, for testing the servers without
+// a DB. The actions in denied are not authorized. Without users, the store
+// is open, like a DB without accounts.
+type memStore struct {
+	invoices Invoices
+	nextID   int
+	denied   map[Action]bool
+	users    []User
+}
+
+// GetInvoicePage sorts by ID only, the order the invoices are added in.
+func (s *memStore) GetInvoicePage(filter bson.M, sort []string, skip, limit int) Invoices {
+	var invoices Invoices
+	for _, invoice := range s.invoices {
+		if matchFilter(invoice, filter) {
+			invoices = append(invoices, invoice)
+		}
+	}
+	if skip >= len(invoices) {
+		return nil
+	}
+	invoices = invoices[skip:]
+	if limit > 0 && limit < len(invoices) {
+		invoices = invoices[:limit]
+	}
+	return invoices
+}
+
+func (s *memStore) CountInvoices(filter bson.M) int {
+	return len(s.GetInvoicePage(filter, nil, 0, 0))
+}
+
+// matchFilter reports whether the invoice is selected by a MongoDB filter,
+// of the fields and operators the servers use.
+func matchFilter(invoice Invoice, filter bson.M) bool {
+	for field, cond := range filter {
+		switch field {
+		case "$and", "$or":
+			n := 0
+			for _, f := range cond.([]bson.M) {
+				if matchFilter(invoice, f) {
+					n++
+				}
+			}
+			if field == "$and" && n < len(cond.([]bson.M)) || field == "$or" && n == 0 {
+				return false
+			}
+			continue
+		case "$text":
+			if !matchText(invoice, cond.(bson.M)["$search"].(string)) {
+				return false
+			}
+			continue
+		}
+
+		// a condition on a field of the line items holds for any of them
+		var values []interface{}
+		switch field {
+		case "id":
+			values = append(values, invoice.ID)
+		case "vendor":
+			values = append(values, invoice.Vendor)
+		case "invoiceno":
+			values = append(values, invoice.InvoiceNo)
+		case "purchaseorder":
+			values = append(values, invoice.PurchaseOrder)
+		case "currency":
+			values = append(values, invoice.Currency)
+		case "paid":
+			values = append(values, invoice.Paid)
+		case "total":
+			values = append(values, invoice.Total)
+		case "datekey":
+			values = append(values, dateKey(invoice.Date))
+		case "duedatekey":
+			values = append(values, dateKey(invoice.DueDate))
+		case "lineitems.description":
+			for _, item := range invoice.LineItems {
+				values = append(values, item.Description)
+			}
+		case "lineitems.productid":
+			for _, item := range invoice.LineItems {
+				values = append(values, item.ProductID)
+			}
+		default:
+			panic("matchFilter: no field " + field)
+		}
+		if !slices.ContainsFunc(values, func(value interface{}) bool { return matchValue(value, cond) }) {
+			return false
+		}
+	}
+	return true
+}
+
+// matchText reports whether the phrases of a text search are all found as
+// whole words in the searchTextFields, as the text index finds them.
+func matchText(invoice Invoice, search string) bool {
+	text := []string{invoice.Vendor, invoice.InvoiceNo, invoice.PurchaseOrder}
+	for _, item := range invoice.LineItems {
+		text = append(text, item.Description, item.ProductID)
+	}
+	for _, phrase := range regexp.MustCompile(`"([^"]*)"`).FindAllStringSubmatch(search, -1) {
+		words := regexp.MustCompile(`(?i)\b` + regexp.QuoteMeta(phrase[1]) + `\b`)
+		if !slices.ContainsFunc(text, words.MatchString) {
+			return false
+		}
+	}
+	return true
+}
+
+// matchValue reports whether a value of a field meets the condition of a
+// MongoDB filter on it.
+func matchValue(value, cond interface{}) bool {
+	switch cond := cond.(type) {
+	case bson.RegEx:
+		return regexp.MustCompile("(?" + cond.Options + ")" + cond.Pattern).MatchString(value.(string))
+	case bson.M:
+		for op, bound := range cond {
+			if !compare(value, op, bound) {
+				return false
+			}
+		}
+		return true
+	default:
+		return value == cond
+	}
+}
+
+// compare reports whether value op bound holds, for the comparison
+// operators of MongoDB.
+func compare(value interface{}, op string, bound interface{}) bool {
+	var c int
+	switch value := value.(type) {
+	case int:
+		c = value - bound.(int)
+	case int64:
+		c = cmp.Compare(value, bound.(int64))
+	case string:
+		c = strings.Compare(value, bound.(string))
+	default:
+		panic(fmt.Sprintf("compare: %T", value))
+	}
+	switch op {
+	case "$gt":
+		return c > 0
+	case "$gte":
+		return c >= 0
+	case "$lt":
+		return c < 0
+	case "$lte":
+		return c <= 0
+	}
+	panic("compare: no operator " + op)
+}
+
+func (s *memStore) GetInvoiceById(id int) Invoice {
+	for _, invoice := range s.invoices {
+		if invoice.ID == id {
+			return invoice
+		}
+	}
+	return Invoice{}
+}
+
+func (s *memStore) GetInvoiceByInvoiceNoAndVendor(num, vendor string) Invoice {
+	for _, invoice := range s.invoices {
+		if invoice.InvoiceNo == num && invoice.Vendor == vendor {
+			return invoice
+		}
+	}
+	return Invoice{}
+}
+
+func (s *memStore) GetTableVendorView(name string) Invoices {
+	var invoices Invoices
+	for _, invoice := range s.invoices {
+		if invoice.Vendor == name {
+			invoices = append(invoices, invoice)
+		}
+	}
+	return invoices
+}
+
+func (s *memStore) GetTableLineItemView(num, vendor string) Items {
+	return s.GetInvoiceByInvoiceNoAndVendor(num, vendor).LineItems
+}
+
+func (s *memStore) GetInvoiceVendors() []string {
+	var names []string
+	for _, invoice := range s.invoices {
+		if !containsString(names, invoice.Vendor) {
+			names = append(names, invoice.Vendor)
+		}
+	}
+	return names
+}
+
+func (s *memStore) CountInvoicesByVendorName(name string) int {
+	return len(s.GetTableVendorView(name))
+}
+
+func (s *memStore) InvoiceExists(num, vendor string) bool {
+	return s.GetInvoiceByInvoiceNoAndVendor(num, vendor).ID != 0
+}
+
+func (s *memStore) AddInvoice(invoice Invoice) bool {
+	s.nextID++
+	invoice.ID = s.nextID
+	s.invoices = append(s.invoices, invoice)
+	return true
+}
+
+func (s *memStore) UpdateInvoice(invoice Invoice) bool {
+	for i := range s.invoices {
+		if s.invoices[i].ID == invoice.ID {
+			s.invoices[i] = invoice
+			return true
+		}
+	}
+	return false
+}
+
+func (s *memStore) DeleteInvoice(id int) string {
+	if s.denied[ActionDelete] {
+		return "FORBIDDEN"
+	}
+	for i := range s.invoices {
+		if s.invoices[i].ID == id {
+			s.invoices = append(s.invoices[:i], s.invoices[i+1:]...)
+			return "OK"
+		}
+	}
+	return "NOT FOUND"
+}
+
+func (s *memStore) countPaid(paid bool) int {
+	n := 0
+	for _, invoice := range s.invoices {
+		if invoice.Paid == paid {
+			n++
+		}
+	}
+	return n
+}
+
+func (s *memStore) CountPaidTrue() int  { return s.countPaid(true) }
+func (s *memStore) CountPaidFalse() int { return s.countPaid(false) }
+func (s *memStore) RecordCount() int    { return len(s.invoices) }
+func (s *memStore) CountVendors() int   { return len(s.GetInvoiceVendors()) }
+
+func (s *memStore) Authorize(action Action) error {
+	if s.denied[action] {
+		return &PermissionError{User: "test", Role: RoleViewer, Action: action}
+	}
+	return nil
+}
+
+func (s *memStore) Authenticate(name, password string) (User, error) {
+	if name == "" {
+		if len(s.users) > 0 {
+			return User{}, errNoLogin
+		}
+		return openUser(), nil
+	}
+	for _, u := range s.users {
+		if u.Name == name && u.checkPassword(password) {
+			return u, nil
+		}
+	}
+	return User{}, errWrongLogin
+}
+
+func (s *memStore) As(u User) InvoiceStore {
+	return memUserStore{s, u}
+}
+
+// memUserStore is a memStore acting as a user.
+type memUserStore struct {
+	*memStore
+	user User
+}
+
+func (s memUserStore) Authorize(action Action) error {
+	if !s.user.Role.may(action) {
+		return &PermissionError{User: s.user.Name, Role: s.user.Role, Action: action}
+	}
+	return s.memStore.Authorize(action)
+}
+
+func (s memUserStore) DeleteInvoice(id int) string {
+	if s.Authorize(ActionDelete) != nil {
+		return "FORBIDDEN"
+	}
+	return s.memStore.DeleteInvoice(id)
+}
+
+// testInvoices returns the invoices the tests start with.
+func testInvoices() *memStore {
+	s := &memStore{}
+	s.AddInvoice(Invoice{Vendor: "Niche Tools", InvoiceNo: "N-1", Date: "01/15/2018", Total: 2500, Currency: "USD",
+		LineItems: Items{{ProductID: "H1", Description: "hammer", Quantity: 2, Amount: 1250}}})
+	s.AddInvoice(Invoice{Vendor: "Niche Tools", InvoiceNo: "N-2", Date: "02/20/2018", Total: 900, Currency: "USD", Paid: true,
+		LineItems: Items{{ProductID: "S1", Description: "screws", Quantity: 3, Amount: 300}}})
+	s.AddInvoice(Invoice{Vendor: "Acme", InvoiceNo: "A-7", Date: "03/01/2018", PurchaseOrder: "PO-9", Total: 11000, Currency: "USD",
+		TaxTotal: 1000, LineItems: Items{{ProductID: "W1", Description: "wrench", Quantity: 1, Amount: 10000}}})
+	return s
+}
+
+func TestAPIAuthentication(t *testing.T) {
+	store := testInvoices()
+	for _, u := range []User{{Name: "vera", Role: RoleViewer}, {Name: "carl", Role: RoleClerk}} {
+		if err := u.setPassword("password-of-" + u.Name); err != nil {
+			t.Fatal(err)
+		}
+		store.users = append(store.users, u)
+	}
+	server := NewAPIServer(store)
+
+	const invoice = `{"vendor": "Acme", "invoiceno": "A-8", "date": "04/01/2018", "total": 100,
+		"items": [{"description": "nail", "quantity": 1, "amount": 100}]}`
+	tests := []struct {
+		name           string
+		method, path   string
+		user, password string
+		want           int
+	}{
+		{"no credentials", "GET", "/api/v1/invoices", "", "", http.StatusUnauthorized},
+		{"wrong password", "GET", "/api/v1/invoices", "vera", "password-of-carl", http.StatusUnauthorized},
+		{"unknown user", "GET", "/api/v1/counts", "mallory", "password-of-vera", http.StatusUnauthorized},
+		{"openapi", "GET", "/api/v1/openapi.json", "", "", http.StatusOK},
+		{"viewer reads", "GET", "/api/v1/invoices/1", "vera", "password-of-vera", http.StatusOK},
+		{"viewer adds", "POST", "/api/v1/invoices", "vera", "password-of-vera", http.StatusForbidden},
+		{"viewer deletes", "DELETE", "/api/v1/invoices/1", "vera", "password-of-vera", http.StatusForbidden},
+		{"clerk adds", "POST", "/api/v1/invoices", "carl", "password-of-carl", http.StatusCreated},
+		{"clerk deletes", "DELETE", "/api/v1/invoices/1", "carl", "password-of-carl", http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body := ""
+			if tt.method == "POST" {
+				body = invoice
+			}
+			req := httptest.NewRequest(tt.method, tt.path, strings.NewReader(body))
+			if tt.user != "" {
+				req.SetBasicAuth(tt.user, tt.password)
+			}
+			rec := httptest.NewRecorder()
+			server.ServeHTTP(rec, req)
+			if rec.Code != tt.want {
+				t.Errorf("%s %s as %q: status %d, want %d: %s", tt.method, tt.path, tt.user, rec.Code, tt.want, rec.Body)
+			}
+			if rec.Code == http.StatusUnauthorized && rec.Header().Get("WWW-Authenticate") == "" {
+				t.Error("401 without WWW-Authenticate")
+			}
+		})
+	}
+	if store.RecordCount() != 4 {
+		t.Errorf("%d invoices, want 4", store.RecordCount())
+	}
+}
+
+func TestAPIOpenWithoutUsers(t *testing.T) {
+	server := NewAPIServer(testInvoices())
+	rec := httptest.NewRecorder()
+	server.ServeHTTP(rec, httptest.NewRequest("DELETE", "/api/v1/invoices/2", nil))
+	if rec.Code != http.StatusNoContent {
+		t.Errorf("DELETE without users: status %d, want %d: %s", rec.Code, http.StatusNoContent, rec.Body)
+	}
+}
+
+func TestAPIListInvoices(t *testing.T) {
+	store := testInvoices()
+	for i := 0; i < 5; i++ {
+		store.AddInvoice(Invoice{Vendor: "Bolt Co", InvoiceNo: fmt.Sprintf("B-%d", i), Date: "05/01/2018", Total: 100})
+	}
+	server := NewAPIServer(store)
+
+	tests := []struct {
+		name  string
+		query string
+		total int
+		want  string
+		next  bool
+	}{
+		{"all", "", 8, "N-1,N-2,A-7,B-0,B-1,B-2,B-3,B-4", false},
+		{"vendor", "vendor=NICHE%20TOOLS", 2, "N-1,N-2", false},
+		{"vendor not a prefix", "vendor=Niche", 0, "", false},
+		{"unpaid", "paid=false&limit=2", 7, "N-1,A-7", true},
+		{"dates", "from=02/01/2018&to=03/01/2018", 2, "N-2,A-7", false},
+		{"text", "q=po-9", 1, "A-7", false},
+		{"text not a regexp", "q=.", 0, "", false},
+		{"page", "vendor=bolt%20co&limit=2&offset=2", 5, "B-2,B-3", true},
+		{"last page", "vendor=bolt%20co&limit=2&offset=4", 5, "B-4", false},
+		{"past the end", "offset=10", 8, "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			server.ServeHTTP(rec, httptest.NewRequest("GET", "/api/v1/invoices?"+tt.query, nil))
+			if rec.Code != http.StatusOK {
+				t.Fatalf("status %d: %s", rec.Code, rec.Body)
+			}
+			var page struct {
+				Total int
+				Items Invoices
+			}
+			if err := json.Unmarshal(rec.Body.Bytes(), &page); err != nil {
+				t.Fatal(err)
+			}
+			var nos []string
+			for _, invoice := range page.Items {
+				nos = append(nos, invoice.InvoiceNo)
+			}
+			if got := strings.Join(nos, ","); page.Total != tt.total || got != tt.want {
+				t.Errorf("got %d invoices %q, want %d %q", page.Total, got, tt.total, tt.want)
+			}
+			if next := rec.Header().Get("Link") != ""; next != tt.next {
+				t.Errorf("Link header %q, want one: %v", rec.Header().Get("Link"), tt.next)
+			}
+		})
+	}
+
+	for _, query := range []string{"paid=maybe", "from=2018-01-01", "limit=0", "offset=-1"} {
+		rec := httptest.NewRecorder()
+		server.ServeHTTP(rec, httptest.NewRequest("GET", "/api/v1/invoices?"+query, nil))
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("%s: status %d, want %d", query, rec.Code, http.StatusBadRequest)
+		}
+	}
+}
+
+func TestAPISearchAndVendorInvoices(t *testing.T) {
+	store := testInvoices()
+	for i := 0; i < 5; i++ {
+		store.AddInvoice(Invoice{Vendor: "Bolt Co", InvoiceNo: fmt.Sprintf("B-%d", i), Date: "05/01/2018", Total: 100,
+			LineItems: Items{{Description: "hammer"}}})
+	}
+	server := NewAPIServer(store)
+
+	tests := []struct {
+		name   string
+		target string
+		total  int
+		want   string
+		next   bool
+	}{
+		{"search", "search?q=hammer", 6, "N-1,B-0,B-1,B-2,B-3,B-4", false},
+		{"search fields", "search?q=vendor:niche%20paid:false%20hammer", 1, "N-1", false},
+		{"search whole words", "search?q=hamm", 0, "", false},
+		{"search range", "search?q=total:1..10", 6, "N-2,B-0,B-1,B-2,B-3,B-4", false},
+		{"search page", "search?q=hammer&limit=2&offset=2", 6, "B-1,B-2", true},
+		{"vendor", "vendors/Niche%20Tools/invoices", 2, "N-1,N-2", false},
+		{"vendor page", "vendors/Bolt%20Co/invoices?limit=2&offset=4", 5, "B-4", false},
+		{"unknown vendor", "vendors/Nobody/invoices", 0, "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			server.ServeHTTP(rec, httptest.NewRequest("GET", "/api/v1/"+tt.target, nil))
+			if rec.Code != http.StatusOK {
+				t.Fatalf("status %d: %s", rec.Code, rec.Body)
+			}
+			var page struct {
+				Total int
+				Items Invoices
+			}
+			if err := json.Unmarshal(rec.Body.Bytes(), &page); err != nil {
+				t.Fatal(err)
+			}
+			var nos []string
+			for _, invoice := range page.Items {
+				nos = append(nos, invoice.InvoiceNo)
+			}
+			if got := strings.Join(nos, ","); page.Total != tt.total || got != tt.want {
+				t.Errorf("got %d invoices %q, want %d %q", page.Total, got, tt.total, tt.want)
+			}
+			if next := rec.Header().Get("Link") != ""; next != tt.next {
+				t.Errorf("Link header %q, want one: %v", rec.Header().Get("Link"), tt.next)
+			}
+		})
+	}
+
+	for _, target := range []string{"search", "search?q=%22hammer", "search?q=hammer&limit=0"} {
+		rec := httptest.NewRecorder()
+		server.ServeHTTP(rec, httptest.NewRequest("GET", "/api/v1/"+target, nil))
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("%s: status %d, want %d", target, rec.Code, http.StatusBadRequest)
+		}
+	}
+}
@@ -0,0 +1,385 @@
+// Copyright 2016 Cory Robinson. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE.txt file.
+
+// attachments.go implements the files attached to an invoice, such as the
+// scanned original, the email it came with or its e-invoice XML. The
+// invoice record only lists the attachments; their content is kept in an
+// AttachmentStore under the SHA-256 of the content, so a file attached to
+// several invoices is stored once. The content is stored in GridFS, or in a
+// directory with a FileStore while the DB cannot be reached.
+
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// ATTACHMENTS is the GridFS prefix of the attachment content in the DB.
+const ATTACHMENTS = "attachments"
+
+// AttachmentStore keeps the content of attachments by its SHA-256.
+type AttachmentStore interface {
+	// Put stores data unless it is stored already.
+	Put(hash string, data []byte) error
+	Get(hash string) ([]byte, error)
+	Delete(hash string) error
+}
+
+// attachmentHash returns the hex SHA-256 that addresses data in a store.
+func attachmentHash(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// GridFSStore stores attachment content in GridFS, with the hash as the
+// file name.
+type GridFSStore struct{}
+
+// Put stores data in GridFS.
+func (s GridFSStore) Put(hash string, data []byte) error {
+	db := currentDB()
+	session, err := mgo.Dial(db.Server)
+	if err != nil {
+		return err
+	}
+	defer session.Close()
+
+	gfs := session.DB(db.Name).GridFS(ATTACHMENTS)
+	if n, err := gfs.Find(bson.M{"filename": hash}).Count(); err != nil || n > 0 {
+		return err
+	}
+
+	file, err := gfs.Create(hash)
+	if err != nil {
+		return err
+	}
+	_, err = file.Write(data)
+	if cerr := file.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// Get reads data from GridFS.
+func (s GridFSStore) Get(hash string) ([]byte, error) {
+	db := currentDB()
+	session, err := mgo.Dial(db.Server)
+	if err != nil {
+		return nil, err
+	}
+	defer session.Close()
+
+	file, err := session.DB(db.Name).GridFS(ATTACHMENTS).Open(hash)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	return io.ReadAll(file)
+}
+
+// Delete removes data from GridFS.
+func (s GridFSStore) Delete(hash string) error {
+	db := currentDB()
+	session, err := mgo.Dial(db.Server)
+	if err != nil {
+		return err
+	}
+	defer session.Close()
+
+	return session.DB(db.Name).GridFS(ATTACHMENTS).Remove(hash)
+}
+
+// FileStore stores attachment content in a directory, as files named by
+// the hash in subdirectories named by its first two characters.
+type FileStore struct {
+	Dir string
+}
+
+// path returns the name of the file holding the content with hash.
+func (s FileStore) path(hash string) (string, error) {
+	if len(hash) != sha256.Size*2 || strings.Trim(hash, "0123456789abcdef") != "" {
+		return "", fmt.Errorf("invalid attachment hash %q", hash)
+	}
+	return filepath.Join(s.Dir, hash[:2], hash), nil
+}
+
+// Put writes data to the store. The file is written under a temporary
+// name first, so a partly written file is never taken for the content.
+func (s FileStore) Put(hash string, data []byte) error {
+	name, err := s.path(hash)
+	if err != nil {
+		return err
+	}
+	if _, err := os.Stat(name); err == nil {
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(name), 0755); err != nil {
+		return err
+	}
+
+	if err := os.WriteFile(name+".tmp", data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(name+".tmp", name)
+}
+
+// Get reads data from the store.
+func (s FileStore) Get(hash string) ([]byte, error) {
+	name, err := s.path(hash)
+	if err != nil {
+		return nil, err
+	}
+	return os.ReadFile(name)
+}
+
+// Delete removes data from the store.
+func (s FileStore) Delete(hash string) error {
+	name, err := s.path(hash)
+	if err != nil {
+		return err
+	}
+	return os.Remove(name)
+}
+
+// attachmentStore returns GridFS if the DB can be reached, or else the
+// local FileStore. Content the FileStore has is still read from it once
+// the DB is back, as are the attachments of versions which only used
+// GridFS for a mongodb:// server.
+func (r Repository) attachmentStore() AttachmentStore {
+	if err := r.Ping(); err != nil {
+		return localAttachmentStore()
+	}
+	return fallbackStore{GridFSStore{}, localAttachmentStore()}
+}
+
+// localAttachmentStore returns the FileStore in the user's config directory.
+func localAttachmentStore() FileStore {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		dir = "."
+	}
+	return FileStore{Dir: filepath.Join(dir, "InvoiceViewer", ATTACHMENTS)}
+}
+
+// fallbackStore stores content in Primary, and reads the content Primary
+// does not have from Fallback.
+type fallbackStore struct {
+	Primary  AttachmentStore
+	Fallback AttachmentStore
+}
+
+// Put stores data in the primary store.
+func (s fallbackStore) Put(hash string, data []byte) error {
+	return s.Primary.Put(hash, data)
+}
+
+// Get reads data from the primary store, or else from the fallback store.
+func (s fallbackStore) Get(hash string) ([]byte, error) {
+	data, err := s.Primary.Get(hash)
+	if err != nil {
+		if fallback, ferr := s.Fallback.Get(hash); ferr == nil {
+			return fallback, nil
+		}
+	}
+	return data, err
+}
+
+// Delete removes data from both stores.
+func (s fallbackStore) Delete(hash string) error {
+	err := s.Primary.Delete(hash)
+	if ferr := s.Fallback.Delete(hash); ferr == nil {
+		return nil
+	}
+	return err
+}
+
+// AddAttachment stores data as an attachment of the invoice and adds it
+// to the invoice record.
+func (r Repository) AddAttachment(invoice *Invoice, name string, data []byte) (Attachment, error) {
+	attachment := newAttachment(name, data)
+	for _, a := range invoice.Attachments {
+		if a.Hash == attachment.Hash {
+			return a, fmt.Errorf("%s is already attached as %s", attachment.Name, a.Name)
+		}
+	}
+	if err := r.Authorize(ActionEdit); err != nil {
+		return attachment, err
+	}
+
+	if err := r.attachmentStore().Put(attachment.Hash, data); err != nil {
+		return attachment, err
+	}
+	invoice.Attachments = append(invoice.Attachments, attachment)
+	if !r.UpdateInvoice(*invoice) {
+		invoice.Attachments = invoice.Attachments[:len(invoice.Attachments)-1]
+		return attachment, fmt.Errorf("failed to update invoice %s", invoice.InvoiceNo)
+	}
+
+	return attachment, nil
+}
+
+// StoreAttachment stores data in the attachment store without adding it
+// to an invoice, for records that reference it later such as drafts.
+func (r Repository) StoreAttachment(name string, data []byte) (Attachment, error) {
+	attachment := newAttachment(name, data)
+	if err := r.Authorize(ActionAdd); err != nil {
+		return attachment, err
+	}
+	return attachment, r.attachmentStore().Put(attachment.Hash, data)
+}
+
+// newAttachment describes data as an attachment named name.
+func newAttachment(name string, data []byte) Attachment {
+	return Attachment{
+		Name:        filepath.Base(name),
+		ContentType: attachmentContentType(name, data),
+		Size:        int64(len(data)),
+		Hash:        attachmentHash(data),
+		Added:       time.Now().Format("01/02/2006"),
+	}
+}
+
+// GetAttachment returns the content of an attachment.
+func (r Repository) GetAttachment(attachment Attachment) ([]byte, error) {
+	data, err := r.attachmentStore().Get(attachment.Hash)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %v", attachment.Name, err)
+	}
+	return data, nil
+}
+
+// RemoveAttachment removes an attachment from the invoice record. Its
+// content is deleted unless another invoice or a draft has the same file
+// attached.
+func (r Repository) RemoveAttachment(invoice *Invoice, hash string) error {
+	var kept []Attachment
+	for _, a := range invoice.Attachments {
+		if a.Hash != hash {
+			kept = append(kept, a)
+		}
+	}
+	if len(kept) == len(invoice.Attachments) {
+		return nil
+	}
+
+	removed := invoice.Attachments
+	invoice.Attachments = kept
+	if !r.UpdateInvoice(*invoice) {
+		invoice.Attachments = removed
+		return fmt.Errorf("failed to update invoice %s", invoice.InvoiceNo)
+	}
+
+	if r.countAttachmentUses(hash) == 0 {
+		return r.attachmentStore().Delete(hash)
+	}
+	return nil
+}
+
+// countAttachmentUses returns the number of invoices and drafts with the
+// content attached.
+func (r Repository) countAttachmentUses(hash string) int {
+	db := currentDB()
+	session, err := mgo.Dial(db.Server)
+
+	if err != nil {
+		fmt.Println("Failed to establish connection to Mongo server:", err)
+		return -1 // unknown, keep the content
+	}
+
+	defer session.Close()
+
+	invoices, err := session.DB(db.Name).C(db.Collection).Find(bson.M{"attachments.hash": hash}).Count()
+	if err != nil {
+		fmt.Println("Failed to write results:", err)
+		return -1
+	}
+	drafts, err := session.DB(db.Name).C(DRAFTS).Find(bson.M{"invoice.attachments.hash": hash}).Count()
+	if err != nil {
+		fmt.Println("Failed to write results:", err)
+		return -1
+	}
+
+	return invoices + drafts
+}
+
+// attachmentContentType returns the MIME type of an attachment. The file
+// extension is trusted for the types the sniffer cannot tell apart.
+func attachmentContentType(name string, data []byte) string {
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".xml":
+		return "application/xml"
+	case ".eml":
+		return "message/rfc822"
+	case ".edi":
+		return "application/edi-x12"
+	case ".json":
+		return "application/json"
+	case ".csv":
+		return "text/csv"
+	}
+	return http.DetectContentType(data)
+}
+
+// attachmentFiles are the local copies of attachments written by
+// attachmentFile, by hash.
+var attachmentFiles struct {
+	sync.Mutex
+	names map[string]string
+}
+
+// attachmentFile returns the name of a local copy of the attachment, used
+// to open it with another application or to preview it. Each copy is a new
+// temporary file, so another user of the machine cannot plant it, and is
+// written once while the app runs.
+func (r Repository) attachmentFile(attachment Attachment) (string, error) {
+	attachmentFiles.Lock()
+	name, ok := attachmentFiles.names[attachment.Hash]
+	attachmentFiles.Unlock()
+	if ok {
+		if _, err := os.Stat(name); err == nil {
+			return name, nil
+		}
+	}
+
+	data, err := r.GetAttachment(attachment)
+	if err != nil {
+		return "", err
+	}
+
+	// the name ends in that of the attachment, for the applications
+	// which go by the extension
+	file, err := os.CreateTemp("", "InvoiceViewer-*-"+filepath.Base(attachment.Name))
+	if err != nil {
+		return "", err
+	}
+	_, err = file.Write(data)
+	if cerr := file.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(file.Name())
+		return "", err
+	}
+
+	attachmentFiles.Lock()
+	if attachmentFiles.names == nil {
+		attachmentFiles.names = map[string]string{}
+	}
+	attachmentFiles.names[attachment.Hash] = file.Name()
+	attachmentFiles.Unlock()
+	return file.Name(), nil
+}
@@ -0,0 +1,289 @@
+// Copyright 2016 Cory Robinson. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE.txt file.
+
+// attachmentsTab.go implements the Attachments tab of the details panel,
+// listing the files attached to the selected invoice with a preview of
+// the current one. Files are attached with the Add button or by dropping
+// them onto the tab.
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/therecipe/qt/core"
+	"github.com/therecipe/qt/gui"
+	"github.com/therecipe/qt/widgets"
+)
+
+// attachmentPreviewLimit is the number of bytes of a text attachment
+// shown in the preview.
+const attachmentPreviewLimit = 64 * 1024
+
+// createAttachmentsTab() sets up the Attachments tab of the details panel.
+func (w *MainWindow) createAttachmentsTab() *widgets.QWidget {
+	w.attachmentsPage = widgets.NewQWidget(nil, 0)
+	w.attachmentsPage.SetAcceptDrops(true)
+	w.attachmentsPage.ConnectDragEnterEvent(func(event *gui.QDragEnterEvent) {
+		if event.MimeData().HasUrls() {
+			event.AcceptProposedAction()
+		}
+	})
+	w.attachmentsPage.ConnectDropEvent(func(event *gui.QDropEvent) {
+		var names []string
+		for _, url := range event.MimeData().Urls() {
+			if url.IsLocalFile() {
+				names = append(names, url.ToLocalFile())
+			}
+		}
+		event.AcceptProposedAction()
+		w.attachFiles(names)
+	})
+
+	w.attachmentsList = widgets.NewQListWidget(nil)
+	w.attachmentsList.ConnectCurrentRowChanged(w.previewAttachment)
+	w.attachmentsList.ConnectItemDoubleClicked(func(*widgets.QListWidgetItem) { w.openAttachment() })
+
+	w.attachmentImage = widgets.NewQLabel(nil, 0)
+	w.attachmentImage.SetAlignment(core.Qt__AlignCenter)
+	w.attachmentImage.SetWordWrap(true)
+
+	w.attachmentText = widgets.NewQPlainTextEdit(nil)
+	w.attachmentText.SetReadOnly(true)
+	w.attachmentText.Hide()
+
+	addButton := widgets.NewQPushButton2("A&dd...", nil)
+	openButton := widgets.NewQPushButton2("&Open", nil)
+	saveButton := widgets.NewQPushButton2("Sa&ve As...", nil)
+	removeButton := widgets.NewQPushButton2("Re&move", nil)
+	addButton.ConnectClicked(func(bool) { w.addAttachments() })
+	openButton.ConnectClicked(func(bool) { w.openAttachment() })
+	saveButton.ConnectClicked(func(bool) { w.saveAttachment() })
+	removeButton.ConnectClicked(func(bool) { w.removeAttachment() })
+
+	buttons := widgets.NewQHBoxLayout()
+	buttons.AddWidget(addButton, 0, 0)
+	buttons.AddWidget(openButton, 0, 0)
+	buttons.AddWidget(saveButton, 0, 0)
+	buttons.AddWidget(removeButton, 0, 0)
+	buttons.AddStretch(1)
+
+	hint := widgets.NewQLabel2("Drop files here to attach them to the invoice.", nil, 0)
+	hint.SetEnabled(false)
+
+	layout := widgets.NewQVBoxLayout()
+	layout.AddWidget(w.attachmentsList, 1, 0)
+	layout.AddWidget(w.attachmentImage, 2, 0)
+	layout.AddWidget(w.attachmentText, 2, 0)
+	layout.AddLayout(buttons, 0)
+	layout.AddWidget(hint, 0, 0)
+	w.attachmentsPage.SetLayout(layout)
+	w.attachmentsPage.SetEnabled(false)
+
+	return w.attachmentsPage
+}
+
+// showAttachments() lists the attachments of the invoice.
+func (w *MainWindow) showAttachments(invoice Invoice) {
+	w.attachmentsInvoice = invoice
+	w.attachmentsPage.SetEnabled(true)
+
+	w.attachmentsList.Clear()
+	for _, a := range invoice.Attachments {
+		w.attachmentsList.AddItem(fmt.Sprintf("%v (%v, added %v)", a.Name, attachmentSize(a.Size), a.Added))
+	}
+	w.previewAttachment(-1)
+
+	title := "Attachments"
+	if len(invoice.Attachments) > 0 {
+		title = fmt.Sprintf("Attachments (%d)", len(invoice.Attachments))
+	}
+	w.detailsTabs.SetTabText(w.detailsTabs.IndexOf(w.attachmentsPage), title)
+}
+
+// clearAttachments() empties the Attachments tab while no invoice is
+// selected.
+func (w *MainWindow) clearAttachments() {
+	w.showAttachments(Invoice{})
+	w.attachmentsPage.SetEnabled(false)
+}
+
+// currentAttachment() returns the attachment selected in the list.
+func (w *MainWindow) currentAttachment() (attachment Attachment, ok bool) {
+	row := w.attachmentsList.CurrentRow()
+	if row < 0 || row >= len(w.attachmentsInvoice.Attachments) {
+		return attachment, false
+	}
+	return w.attachmentsInvoice.Attachments[row], true
+}
+
+// previewAttachment() shows the attachment in the given row: images are
+// scaled to fit, text such as XML is shown as is and other files, like
+// PDFs, are described.
+func (w *MainWindow) previewAttachment(row int) {
+	w.attachmentImage.Clear()
+	w.attachmentText.Clear()
+	w.attachmentText.Hide()
+	w.attachmentImage.Show()
+
+	if row < 0 || row >= len(w.attachmentsInvoice.Attachments) {
+		return
+	}
+	a := w.attachmentsInvoice.Attachments[row]
+
+	name, err := w.model.attachmentFile(a)
+	if err != nil {
+		w.attachmentImage.SetText(err.Error())
+		return
+	}
+
+	switch {
+	case strings.HasPrefix(a.ContentType, "image/"):
+		pixmap := gui.NewQPixmap3(name, "", 0)
+		if pixmap.IsNull() {
+			w.attachmentImage.SetText(fmt.Sprintf("%v\nThe image cannot be shown.", a.Name))
+			return
+		}
+		w.attachmentImage.SetPixmap(pixmap.Scaled2(300, 300, core.Qt__KeepAspectRatio, core.Qt__SmoothTransformation))
+	case attachmentIsText(a.ContentType):
+		data, err := os.ReadFile(name)
+		if err != nil {
+			w.attachmentImage.SetText(err.Error())
+			return
+		}
+		text := string(data[:min(len(data), attachmentPreviewLimit)])
+		if len(data) > attachmentPreviewLimit {
+			text += "\n..."
+		}
+		w.attachmentText.SetPlainText(text)
+		w.attachmentImage.Hide()
+		w.attachmentText.Show()
+	default:
+		w.attachmentImage.SetText(fmt.Sprintf("%v\n%v, %v\n\nDouble-click to open the file.",
+			a.Name, a.ContentType, attachmentSize(a.Size)))
+	}
+}
+
+// addAttachments() slot to choose files and attach them to the invoice.
+func (w *MainWindow) addAttachments() {
+	names := widgets.QFileDialog_GetOpenFileNames(w, "Add Attachments", "",
+		"Documents (*.pdf *.png *.jpg *.jpeg *.tif *.tiff *.xml *.eml);;All files (*)", "", 0)
+	w.attachFiles(names)
+}
+
+// attachFiles() attaches the named files to the invoice shown in the tab.
+func (w *MainWindow) attachFiles(names []string) {
+	if len(names) == 0 || w.attachmentsInvoice.InvoiceNo == "" {
+		return
+	}
+
+	var report []string
+	attached := 0
+	for _, name := range names {
+		data, err := os.ReadFile(name)
+		if err == nil {
+			_, err = w.model.AddAttachment(&w.attachmentsInvoice, name, data)
+		}
+		if err != nil {
+			report = append(report, fmt.Sprintf("%v: %v", name, err))
+			continue
+		}
+		attached++
+	}
+
+	w.showAttachments(w.attachmentsInvoice)
+	w.attachmentsList.SetCurrentRow(len(w.attachmentsInvoice.Attachments) - 1)
+	if len(report) > 0 {
+		widgets.QMessageBox_Warning(w, "Add Attachments", strings.Join(report, "\n"),
+			widgets.QMessageBox__Ok, widgets.QMessageBox__Ok)
+	}
+	w.StatusBar().ShowMessage(fmt.Sprintf("Attached %d files to invoice %v", attached, w.attachmentsInvoice.InvoiceNo), 5000)
+}
+
+// openAttachment() slot to open the selected attachment with the
+// application the desktop associates with its type.
+func (w *MainWindow) openAttachment() {
+	a, ok := w.currentAttachment()
+	if !ok {
+		return
+	}
+
+	name, err := w.model.attachmentFile(a)
+	if err == nil && !gui.QDesktopServices_OpenUrl(core.QUrl_FromLocalFile(name)) {
+		err = fmt.Errorf("no application to open %v", a.Name)
+	}
+	if err != nil {
+		widgets.QMessageBox_Warning(w, "Open Attachment", err.Error(),
+			widgets.QMessageBox__Ok, widgets.QMessageBox__Ok)
+	}
+}
+
+// saveAttachment() slot to save a copy of the selected attachment.
+func (w *MainWindow) saveAttachment() {
+	a, ok := w.currentAttachment()
+	if !ok {
+		return
+	}
+
+	name := widgets.QFileDialog_GetSaveFileName(w, "Save Attachment", a.Name, "All files (*)", "", 0)
+	if name == "" {
+		return
+	}
+
+	data, err := w.model.GetAttachment(a)
+	if err == nil {
+		err = os.WriteFile(name, data, 0644)
+	}
+	if err != nil {
+		widgets.QMessageBox_Critical(w, "Save Attachment", fmt.Sprintf("Failed to save attachment: %v", err),
+			widgets.QMessageBox__Ok, widgets.QMessageBox__Ok)
+		return
+	}
+
+	w.StatusBar().ShowMessage(fmt.Sprintf("Saved %v", name), 5000)
+}
+
+// removeAttachment() slot to remove the selected attachment from the
+// invoice after asking for confirmation.
+func (w *MainWindow) removeAttachment() {
+	a, ok := w.currentAttachment()
+	if !ok {
+		return
+	}
+
+	answer := widgets.QMessageBox_Question(w, "Remove Attachment",
+		fmt.Sprintf("Remove %v from invoice %v?", a.Name, w.attachmentsInvoice.InvoiceNo),
+		widgets.QMessageBox__Yes|widgets.QMessageBox__No, widgets.QMessageBox__No)
+	if answer != widgets.QMessageBox__Yes {
+		return
+	}
+
+	if err := w.model.RemoveAttachment(&w.attachmentsInvoice, a.Hash); err != nil {
+		widgets.QMessageBox_Warning(w, "Remove Attachment", err.Error(),
+			widgets.QMessageBox__Ok, widgets.QMessageBox__Ok)
+	}
+	w.showAttachments(w.attachmentsInvoice)
+}
+
+// attachmentIsText reports whether attachments of the MIME type can be
+// previewed as text.
+func attachmentIsText(contentType string) bool {
+	contentType = strings.TrimSpace(strings.Split(contentType, ";")[0])
+	return strings.HasPrefix(contentType, "text/") || strings.HasSuffix(contentType, "xml") ||
+		contentType == "application/json" || contentType == "application/edi-x12" ||
+		contentType == "message/rfc822"
+}
+
+// attachmentSize formats a file size for display.
+func attachmentSize(size int64) string {
+	switch {
+	case size >= 1<<20:
+		return fmt.Sprintf("%.1f MB", float64(size)/(1<<20))
+	case size >= 1<<10:
+		return fmt.Sprintf("%.1f KB", float64(size)/(1<<10))
+	}
+	return fmt.Sprintf("%d bytes", size)
+}
@@ -0,0 +1,282 @@
+// Copyright 2016 Cory Robinson. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE.txt file.
+
+// changes.go notifies the app of changes to the invoices, made by it, by
+// a second user or by a bot, so that the main window can update its views
+// in place. MongoDB change streams are used when the server has them, that
+// is when it runs as a replica set; otherwise the change log, a capped
+// collection every Repository write is logged to, is tailed instead.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// CHANGES is the name of the change log collection in DB
+const CHANGES = "changes"
+
+// changeLogSize is the size in bytes of the change log. Older changes are
+// dropped as new ones are logged.
+const changeLogSize = 1 << 20
+
+// watchRetry is how long WatchChanges waits before watching again after
+// losing the DB.
+const watchRetry = 5 * time.Second
+
+// The operations of a Change.
+const (
+	ChangeInsert = "insert"
+	ChangeUpdate = "update"
+	ChangeDelete = "delete"
+	ChangeReload = "reload" // anything else, i.e. the collection was dropped
+)
+
+// Change is a change to the invoices.
+type Change struct {
+	ObjectID bson.ObjectId `bson:"_id,omitempty"`
+	Op       string        `bson:"op"`
+	ID       int           `bson:"id"` // of the invoice, 0 if not known
+	Time     time.Time     `bson:"time"`
+	User     string        `bson:"user,omitempty"` // who made the change, see users.go
+}
+
+// changeLogOnce makes ensureChangeLog run once per collection.
+var changeLogOnce collectionOnce
+
+// ensureChangeLog creates the change log of the DB if it does not exist yet.
+func (r Repository) ensureChangeLog(session *mgo.Session, db dbSettings) {
+	changeLogOnce.Do(db, func() {
+		c := session.DB(db.Name).C(CHANGES)
+		err := c.Create(&mgo.CollectionInfo{Capped: true, MaxBytes: changeLogSize})
+		if err != nil && !isCollectionExists(err) {
+			fmt.Println("Failed to create change log:", err)
+		}
+	})
+}
+
+// isCollectionExists reports whether err is the error of creating a
+// collection which already exists.
+func isCollectionExists(err error) bool {
+	qerr, ok := err.(*mgo.QueryError)
+	return ok && (qerr.Code == 48 || qerr.Message == "collection already exists")
+}
+
+// logChange logs a change to the invoice with the id by the user.
+func (r Repository) logChange(session *mgo.Session, db dbSettings, op string, id int, user string) {
+	r.ensureChangeLog(session, db)
+	change := Change{Op: op, ID: id, Time: time.Now(), User: user}
+	if err := session.DB(db.Name).C(CHANGES).Insert(change); err != nil {
+		fmt.Println("Failed to log change:", err)
+	}
+}
+
+// WatchChanges calls changed from its goroutine for every change to the
+// invoices of the active profile, until ctx is done. If the DB is lost, it
+// waits for it to come back and goes on from the last change seen. It keeps
+// watching the same DB when another profile is switched to.
+func (r Repository) WatchChanges(ctx context.Context, changed func(change Change)) {
+	db := currentDB()
+	var pos watchPosition
+	for ctx.Err() == nil {
+		if err := r.watchChanges(ctx, db, &pos, changed); err != nil && ctx.Err() == nil {
+			fmt.Println("Failed to watch changes:", err)
+		}
+		select {
+		case <-ctx.Done():
+		case <-time.After(watchRetry):
+		}
+	}
+}
+
+// watchPosition is the last change seen by WatchChanges, to go on from
+// after losing the DB.
+type watchPosition struct {
+	resumeToken *bson.Raw     // of the last change stream event
+	lastLogged  bson.ObjectId // of the last change log entry
+}
+
+// watchChanges watches a change stream, or tails the change log if the
+// server has no change streams, from the position until ctx is done or the
+// DB is lost.
+func (r Repository) watchChanges(ctx context.Context, db dbSettings, pos *watchPosition, changed func(change Change)) error {
+	session, err := mgo.DialWithTimeout(db.Server, pingTimeout)
+	if err != nil {
+		return err
+	}
+	defer session.Close()
+
+	database := session.DB(db.Name)
+	stream, err := openChangeStream(database, db.Collection, pos.resumeToken)
+	if err != nil && pos.resumeToken != nil {
+		// the changes since are no longer kept by the server
+		pos.resumeToken = nil
+		changed(Change{Op: ChangeReload, Time: time.Now()})
+		stream, err = openChangeStream(database, db.Collection, nil)
+	}
+	if err != nil {
+		return r.tailChangeLog(ctx, session, db, pos, changed)
+	}
+
+	cursor := stream.Cursor.ID
+	defer database.Run(bson.D{{Name: "killCursors", Value: db.Collection}, {Name: "cursors", Value: []int64{cursor}}}, nil)
+
+	batch := stream.Cursor.FirstBatch
+	for ctx.Err() == nil {
+		for _, event := range batch {
+			changed(event.change())
+			token := event.ResumeToken
+			pos.resumeToken = &token
+		}
+
+		stream = changeStreamReply{}
+		err := database.Run(bson.D{
+			{Name: "getMore", Value: cursor},
+			{Name: "collection", Value: db.Collection},
+			{Name: "maxTimeMS", Value: 1000},
+		}, &stream)
+		if err != nil {
+			return err
+		}
+		batch = stream.Cursor.NextBatch
+	}
+	return nil
+}
+
+// openChangeStream opens a change stream of the collection, after the event
+// of the resume token if it is not nil. A change stream is opened with an
+// aggregate command and read with getMore commands, as the driver has no
+// API for it. Only the ID of the invoice changed is needed, so the
+// documents looked up for updates are projected to it.
+func openChangeStream(db *mgo.Database, collection string, resumeToken *bson.Raw) (changeStreamReply, error) {
+	options := bson.M{"fullDocument": "updateLookup"}
+	if resumeToken != nil {
+		options["resumeAfter"] = *resumeToken
+	}
+	var stream changeStreamReply
+	err := db.Run(bson.D{
+		{Name: "aggregate", Value: collection},
+		{Name: "pipeline", Value: []bson.M{
+			{"$changeStream": options},
+			// _id, the resume token, is kept
+			{"$project": bson.M{"operationType": 1, "documentKey": 1, "fullDocument.id": 1}},
+		}},
+		{Name: "cursor", Value: bson.M{}},
+	}, &stream)
+	return stream, err
+}
+
+// changeStreamReply is the reply to the commands reading a change stream.
+type changeStreamReply struct {
+	Cursor struct {
+		ID         int64         `bson:"id"`
+		FirstBatch []changeEvent `bson:"firstBatch"`
+		NextBatch  []changeEvent `bson:"nextBatch"`
+	} `bson:"cursor"`
+}
+
+// changeEvent is an event of a change stream.
+type changeEvent struct {
+	ResumeToken   bson.Raw `bson:"_id"`
+	OperationType string   `bson:"operationType"`
+	FullDocument  struct {
+		ID int `bson:"id"`
+	} `bson:"fullDocument"`
+}
+
+// change returns the change of the event. Deleted documents are only known
+// by their ObjectId, so the ID of a deleted invoice is not known.
+func (e changeEvent) change() Change {
+	change := Change{ID: e.FullDocument.ID, Time: time.Now()}
+	switch e.OperationType {
+	case "insert":
+		change.Op = ChangeInsert
+	case "update", "replace":
+		change.Op = ChangeUpdate
+	case "delete":
+		change.Op = ChangeDelete
+	default:
+		change.Op = ChangeReload
+	}
+	return change
+}
+
+// tailChangeLog tails the change log, from the last change logged at the
+// position, or else from the changes logged after it was called, until ctx
+// is done or the DB is lost.
+func (r Repository) tailChangeLog(ctx context.Context, session *mgo.Session, db dbSettings, pos *watchPosition, changed func(change Change)) error {
+	r.ensureChangeLog(session, db)
+	c := session.DB(db.Name).C(CHANGES)
+
+	if pos.lastLogged == "" {
+		var last Change
+		if err := c.Find(nil).Sort("-$natural").One(&last); err != nil && err != mgo.ErrNotFound {
+			return err
+		}
+		pos.lastLogged = last.ObjectID
+	}
+
+	for ctx.Err() == nil {
+		query := bson.M{}
+		if pos.lastLogged != "" {
+			query = bson.M{"_id": bson.M{"$gt": pos.lastLogged}}
+		}
+		iter := c.Find(query).Sort("$natural").Tail(time.Second)
+
+		for ctx.Err() == nil {
+			for {
+				// a new value each time, as decoding does not clear missing fields
+				var change Change
+				if !iter.Next(&change) {
+					break
+				}
+				changed(change)
+				pos.lastLogged = change.ObjectID
+			}
+			if iter.Err() != nil || !iter.Timeout() {
+				break
+			}
+		}
+		if err := iter.Close(); err != nil {
+			return err
+		}
+
+		// the cursor dies at once on an empty change log
+		select {
+		case <-ctx.Done():
+		case <-time.After(time.Second):
+		}
+	}
+	return nil
+}
+
+// changeQueue hands the changes seen by WatchChanges to the GUI thread.
+type changeQueue struct {
+	mu      sync.Mutex
+	changes []Change
+}
+
+// add queues a change, and reports whether the queue was empty, i.e.
+// whether the GUI thread has to be told.
+func (q *changeQueue) add(change Change) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.changes = append(q.changes, change)
+	return len(q.changes) == 1
+}
+
+// take returns the changes queued and empties the queue.
+func (q *changeQueue) take() []Change {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	changes := q.changes
+	q.changes = nil
+	return changes
+}
@@ -0,0 +1,461 @@
+// Copyright 2016 Cory Robinson. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE.txt file.
+
+// cii.go implements reading and writing UN/CEFACT Cross Industry Invoice
+// (CII D16B) documents, the XML syntax embedded in ZUGFeRD / Factur-X PDFs.
+// The mapping onto Invoice follows ubl.go: the seller is the vendor and the
+// buyer goes to Buyer. EN 16931 defines the same business rules for both
+// syntaxes, so problems are reported as UBLError with the same rule ids.
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CII namespaces and the EN 16931 guideline identifier written to exported
+// documents.
+const (
+	ciiRsmNS = "urn:un:unece:uncefact:data:standard:CrossIndustryInvoice:100"
+	ciiRamNS = "urn:un:unece:uncefact:data:standard:ReusableAggregateBusinessInformationEntity:100"
+	ciiUdtNS = "urn:un:unece:uncefact:data:standard:UnqualifiedDataType:100"
+	ciiQdtNS = "urn:un:unece:uncefact:data:standard:QualifiedDataType:100"
+
+	ciiGuidelineID = "urn:cen.eu:en16931:2017"
+)
+
+// Paths of the main CII elements below the root.
+const (
+	ciiGuideline   = "rsm:ExchangedDocumentContext/ram:GuidelineSpecifiedDocumentContextParameter/ram:ID"
+	ciiDocument    = "rsm:ExchangedDocument"
+	ciiTransaction = "rsm:SupplyChainTradeTransaction"
+	ciiLine        = ciiTransaction + "/ram:IncludedSupplyChainTradeLineItem"
+	ciiAgreement   = ciiTransaction + "/ram:ApplicableHeaderTradeAgreement"
+	ciiSettlement  = ciiTransaction + "/ram:ApplicableHeaderTradeSettlement"
+	ciiSummation   = ciiSettlement + "/ram:SpecifiedTradeSettlementHeaderMonetarySummation"
+)
+
+// ReadCII parses a Cross Industry Invoice, validates it and maps it onto an
+// Invoice. As with ReadUBL, err is only set if the document could not be
+// read at all.
+func ReadCII(r io.Reader) (Invoice, []UBLError, error) {
+	doc, err := parseXML(r)
+	if err != nil {
+		return Invoice{}, nil, err
+	}
+	if doc.Local() != "CrossIndustryInvoice" {
+		return Invoice{}, nil, fmt.Errorf("not a CII invoice: root element is %s", doc.Local())
+	}
+
+	errs := ValidateCII(doc)
+	invoice, mapErrs := ciiToInvoice(doc)
+
+	return invoice, append(errs, mapErrs...), nil
+}
+
+// ciiToInvoice maps a CII document onto an Invoice.
+func ciiToInvoice(doc *xmlNode) (Invoice, []UBLError) {
+	var errs []UBLError
+	var invoice Invoice
+
+	amount := func(path string) int64 {
+		value := doc.Value(path)
+		if value == "" {
+			return 0
+		}
+		cents, err := parseDecimalCents(value)
+		if err != nil {
+			errs = append(errs, UBLError{"MAP", path, err.Error()})
+		}
+		return cents
+	}
+	date := func(path string) string {
+		value := doc.Value(path)
+		if value == "" {
+			return ""
+		}
+		t, err := time.Parse("20060102", value)
+		if err != nil {
+			errs = append(errs, UBLError{"MAP", path, fmt.Sprintf("%q is not a valid date", value)})
+			return ""
+		}
+		return t.Format("01/02/2006")
+	}
+
+	invoice.InvoiceNo = doc.Value(ciiDocument + "/ram:ID")
+	invoice.CreditNote = doc.Value(ciiDocument+"/ram:TypeCode") == "381"
+	invoice.Date = date(ciiDocument + "/ram:IssueDateTime/udt:DateTimeString")
+	invoice.DueDate = date(ciiSettlement + "/ram:SpecifiedTradePaymentTerms/ram:DueDateDateTime/udt:DateTimeString")
+	invoice.Currency = doc.Value(ciiSettlement + "/ram:InvoiceCurrencyCode")
+	invoice.PurchaseOrder = doc.Value(ciiAgreement + "/ram:BuyerOrderReferencedDocument/ram:IssuerAssignedID")
+
+	seller := ciiParty(doc.Find(ciiAgreement + "/ram:SellerTradeParty"))
+	invoice.Vendor = seller.Name
+	invoice.Address = seller.Address
+	invoice.VendorIDs = seller.IDs
+	invoice.VendorIDs.BankAccount = doc.Value(ciiSettlement + "/ram:SpecifiedTradeSettlementPaymentMeans/ram:PayeePartyCreditorFinancialAccount/ram:IBANID")
+	if invoice.VendorIDs.BankAccount == "" {
+		invoice.VendorIDs.BankAccount = doc.Value(ciiSettlement + "/ram:SpecifiedTradeSettlementPaymentMeans/ram:PayeePartyCreditorFinancialAccount/ram:ProprietaryID")
+	}
+	invoice.Buyer = ciiParty(doc.Find(ciiAgreement + "/ram:BuyerTradeParty"))
+
+	// the tax total may be given in the accounting currency as well
+	for _, tax := range doc.FindAll(ciiSummation + "/ram:TaxTotalAmount") {
+		if id := tax.Attr("currencyID"); id == "" || id == invoice.Currency {
+			cents, err := parseDecimalCents(tax.Text)
+			if err != nil {
+				errs = append(errs, UBLError{"MAP", ciiSummation + "/ram:TaxTotalAmount", err.Error()})
+			}
+			invoice.TaxTotal = cents
+			break
+		}
+	}
+	invoice.Total = amount(ciiSummation + "/ram:GrandTotalAmount")
+	prepaid := amount(ciiSummation + "/ram:TotalPrepaidAmount")
+	invoice.Paid = invoice.Total != 0 && prepaid == invoice.Total
+
+	for i, line := range doc.FindAll(ciiLine) {
+		field := fmt.Sprintf("%s[%d]", ciiLine, i+1)
+		var item Item
+
+		item.ProductID = line.Value("ram:SpecifiedTradeProduct/ram:SellerAssignedID")
+		if item.ProductID == "" {
+			item.ProductID = line.Value("ram:SpecifiedTradeProduct/ram:GlobalID")
+		}
+		item.Description = line.Value("ram:SpecifiedTradeProduct/ram:Name")
+		if item.Description == "" {
+			item.Description = line.Value("ram:SpecifiedTradeProduct/ram:Description")
+		}
+
+		quantityPath := "ram:SpecifiedLineTradeDelivery/ram:BilledQuantity"
+		item.UnitCode = line.Find(quantityPath).Attr("unitCode")
+		quantity, err := strconv.ParseFloat(line.Value(quantityPath), 64)
+		if err != nil || quantity < 0 || quantity > math.MaxUint16 || quantity != math.Trunc(quantity) {
+			errs = append(errs, UBLError{"MAP", field + "/" + quantityPath,
+				fmt.Sprintf("%q is not a whole number quantity", line.Value(quantityPath))})
+		} else {
+			item.Quantity = uint16(quantity)
+		}
+
+		pricePath := "ram:SpecifiedLineTradeAgreement/ram:NetPriceProductTradePrice"
+		price, err := parseDecimalCents(line.Value(pricePath + "/ram:ChargeAmount"))
+		if err != nil {
+			errs = append(errs, UBLError{"MAP", field + "/" + pricePath + "/ram:ChargeAmount", err.Error()})
+		}
+		if base := line.Value(pricePath + "/ram:BasisQuantity"); base != "" {
+			if b, err := strconv.ParseFloat(base, 64); err == nil && b != 0 {
+				price = int64(math.Round(float64(price) / b))
+			}
+		}
+		item.Amount = price
+
+		taxPath := "ram:SpecifiedLineTradeSettlement/ram:ApplicableTradeTax"
+		item.TaxCategory = line.Value(taxPath + "/ram:CategoryCode")
+		if percent := line.Value(taxPath + "/ram:RateApplicablePercent"); percent != "" {
+			item.TaxPercent, _ = strconv.ParseFloat(percent, 64)
+		}
+
+		invoice.LineItems = append(invoice.LineItems, item)
+	}
+
+	return invoice, errs
+}
+
+// ciiParty maps a ram:SellerTradeParty or ram:BuyerTradeParty element onto
+// a Party.
+func ciiParty(party *xmlNode) Party {
+	if party == nil {
+		return Party{}
+	}
+
+	street := party.Value("ram:PostalTradeAddress/ram:LineOne")
+	for _, extra := range []string{"ram:LineTwo", "ram:LineThree"} {
+		if line := party.Value("ram:PostalTradeAddress/" + extra); line != "" {
+			street += ", " + line
+		}
+	}
+
+	ids := PartyIDs{
+		EndpointID:     party.Value("ram:URIUniversalCommunication/ram:URIID"),
+		EndpointScheme: party.Find("ram:URIUniversalCommunication/ram:URIID").Attr("schemeID"),
+		LegalID:        party.Value("ram:SpecifiedLegalOrganization/ram:ID"),
+	}
+	// VA is the VAT identifier, FC the local tax number
+	for _, registration := range party.FindAll("ram:SpecifiedTaxRegistration/ram:ID") {
+		if registration.Attr("schemeID") == "VA" || ids.TaxID == "" {
+			ids.TaxID = strings.TrimSpace(registration.Text)
+		}
+	}
+
+	return Party{
+		Name: party.Value("ram:Name"),
+		Address: Location{
+			Street:  street,
+			City:    party.Value("ram:PostalTradeAddress/ram:CityName"),
+			State:   party.Value("ram:PostalTradeAddress/ram:CountrySubDivisionName"),
+			Zipcode: party.Value("ram:PostalTradeAddress/ram:PostcodeCode"),
+			Country: party.Value("ram:PostalTradeAddress/ram:CountryID"),
+		},
+		IDs: ids,
+	}
+}
+
+// InvoiceToCII builds a CII document for the invoice using the EN 16931
+// (COMFORT) profile. The element order follows the CII schema.
+func InvoiceToCII(invoice Invoice) *xmlNode {
+	currency := invoice.Currency
+	if currency == "" {
+		currency = "USD"
+	}
+	money := func(cents int64) string { return centsString(cents) }
+	typeCode := "380"
+	if invoice.CreditNote {
+		typeCode = "381"
+	}
+
+	doc := &xmlNode{Name: "rsm:CrossIndustryInvoice"}
+	doc.Attrs = append(doc.Attrs,
+		xmlAttr("xmlns:rsm", ciiRsmNS),
+		xmlAttr("xmlns:ram", ciiRamNS),
+		xmlAttr("xmlns:udt", ciiUdtNS),
+		xmlAttr("xmlns:qdt", ciiQdtNS))
+
+	doc.Add("rsm:ExchangedDocumentContext", "").
+		Add("ram:GuidelineSpecifiedDocumentContextParameter", "").
+		Add("ram:ID", ciiGuidelineID)
+
+	document := doc.Add("rsm:ExchangedDocument", "")
+	document.Add("ram:ID", invoice.InvoiceNo)
+	document.Add("ram:TypeCode", typeCode)
+	document.Add("ram:IssueDateTime", "").Add("udt:DateTimeString", ciiDate(invoice.Date), "format", "102")
+
+	transaction := doc.Add("rsm:SupplyChainTradeTransaction", "")
+	for i, item := range invoice.LineItems {
+		line := transaction.Add("ram:IncludedSupplyChainTradeLineItem", "")
+		line.Add("ram:AssociatedDocumentLineDocument", "").Add("ram:LineID", strconv.Itoa(i+1))
+
+		product := line.Add("ram:SpecifiedTradeProduct", "")
+		product.AddValue("ram:SellerAssignedID", item.ProductID)
+		name := item.Description
+		if name == "" {
+			name = item.ProductID
+		}
+		product.Add("ram:Name", name)
+
+		line.Add("ram:SpecifiedLineTradeAgreement", "").
+			Add("ram:NetPriceProductTradePrice", "").
+			Add("ram:ChargeAmount", money(item.Amount))
+
+		unitCode := item.UnitCode
+		if unitCode == "" {
+			unitCode = "C62"
+		}
+		line.Add("ram:SpecifiedLineTradeDelivery", "").
+			Add("ram:BilledQuantity", strconv.Itoa(int(item.Quantity)), "unitCode", unitCode)
+
+		settlement := line.Add("ram:SpecifiedLineTradeSettlement", "")
+		category := item.TaxCategory
+		if category == "" {
+			category = "Z"
+		}
+		tax := settlement.Add("ram:ApplicableTradeTax", "")
+		tax.Add("ram:TypeCode", "VAT")
+		tax.Add("ram:CategoryCode", category)
+		if category != "O" {
+			tax.Add("ram:RateApplicablePercent", formatPercent(item.TaxPercent))
+		}
+		settlement.Add("ram:SpecifiedTradeSettlementLineMonetarySummation", "").
+			Add("ram:LineTotalAmount", money(int64(item.Quantity)*item.Amount))
+	}
+
+	agreement := transaction.Add("ram:ApplicableHeaderTradeAgreement", "")
+	addCIIParty(agreement, "ram:SellerTradeParty", Party{Name: invoice.Vendor, Address: invoice.Address, IDs: invoice.VendorIDs})
+	addCIIParty(agreement, "ram:BuyerTradeParty", invoice.Buyer)
+	if invoice.PurchaseOrder != "" {
+		agreement.Add("ram:BuyerOrderReferencedDocument", "").Add("ram:IssuerAssignedID", invoice.PurchaseOrder)
+	}
+
+	transaction.Add("ram:ApplicableHeaderTradeDelivery", "")
+
+	settlement := transaction.Add("ram:ApplicableHeaderTradeSettlement", "")
+	settlement.Add("ram:InvoiceCurrencyCode", currency)
+
+	subtotal := lineItemsTotal(invoice.LineItems)
+	var taxTotal int64
+	for _, s := range ublTaxSubtotals(invoice.LineItems) {
+		taxTotal += s.tax
+		tax := settlement.Add("ram:ApplicableTradeTax", "")
+		tax.Add("ram:CalculatedAmount", money(s.tax))
+		tax.Add("ram:TypeCode", "VAT")
+		if s.category == "E" || s.category == "AE" || s.category == "K" || s.category == "G" || s.category == "O" {
+			tax.Add("ram:ExemptionReasonCode", "VATEX-EU-"+s.category)
+		}
+		tax.Add("ram:BasisAmount", money(s.taxable))
+		tax.Add("ram:CategoryCode", s.category)
+		if s.category != "O" {
+			tax.Add("ram:RateApplicablePercent", formatPercent(s.percent))
+		}
+	}
+
+	if invoice.DueDate != "" {
+		settlement.Add("ram:SpecifiedTradePaymentTerms", "").
+			Add("ram:DueDateDateTime", "").
+			Add("udt:DateTimeString", ciiDate(invoice.DueDate), "format", "102")
+	}
+
+	payable := subtotal + taxTotal
+	summation := settlement.Add("ram:SpecifiedTradeSettlementHeaderMonetarySummation", "")
+	summation.Add("ram:LineTotalAmount", money(subtotal))
+	summation.Add("ram:TaxBasisTotalAmount", money(subtotal))
+	summation.Add("ram:TaxTotalAmount", money(taxTotal), "currencyID", currency)
+	summation.Add("ram:GrandTotalAmount", money(payable))
+	if invoice.Paid {
+		summation.Add("ram:TotalPrepaidAmount", money(payable))
+		payable = 0
+	}
+	summation.Add("ram:DuePayableAmount", money(payable))
+
+	return doc
+}
+
+// addCIIParty adds a trade party element for the party to parent.
+func addCIIParty(parent *xmlNode, name string, party Party) {
+	node := parent.Add(name, "")
+	node.Add("ram:Name", party.Name)
+	if party.IDs.LegalID != "" {
+		node.Add("ram:SpecifiedLegalOrganization", "").Add("ram:ID", party.IDs.LegalID)
+	}
+
+	address := node.Add("ram:PostalTradeAddress", "")
+	address.AddValue("ram:PostcodeCode", party.Address.Zipcode)
+	address.AddValue("ram:LineOne", party.Address.Street)
+	address.AddValue("ram:CityName", party.Address.City)
+	country := party.Address.Country
+	if country == "" {
+		country = "US"
+	}
+	address.Add("ram:CountryID", country)
+	address.AddValue("ram:CountrySubDivisionName", party.Address.State)
+
+	if party.IDs.EndpointID != "" {
+		node.Add("ram:URIUniversalCommunication", "").
+			Add("ram:URIID", party.IDs.EndpointID, "schemeID", party.IDs.EndpointScheme)
+	}
+	if party.IDs.TaxID != "" {
+		node.Add("ram:SpecifiedTaxRegistration", "").Add("ram:ID", party.IDs.TaxID, "schemeID", "VA")
+	}
+}
+
+// WriteCII writes the invoice as a CII document.
+func WriteCII(w io.Writer, invoice Invoice) error {
+	return InvoiceToCII(invoice).Write(w)
+}
+
+// ciiRules is the subset of the EN 16931 rules checked on CII documents,
+// matching ublRules. The line context is the trade line item.
+var ciiRules = []ublRule{
+	{"BR-01", "", ciiGuideline, "specification identifier is required", exists(ciiGuideline)},
+	{"BR-02", ciiDocument, "ram:ID", "invoice number is required", exists("ram:ID")},
+	{"BR-03", ciiDocument, "ram:IssueDateTime/udt:DateTimeString", "issue date is required",
+		exists("ram:IssueDateTime/udt:DateTimeString")},
+	{"BR-04", ciiDocument, "ram:TypeCode", "invoice type code is required", exists("ram:TypeCode")},
+	{"BR-05", ciiSettlement, "ram:InvoiceCurrencyCode", "invoice currency code is required", exists("ram:InvoiceCurrencyCode")},
+	{"BR-06", ciiAgreement + "/ram:SellerTradeParty", "ram:Name", "seller name is required", exists("ram:Name")},
+	{"BR-08", ciiAgreement + "/ram:SellerTradeParty", "ram:PostalTradeAddress",
+		"seller postal address is required", func(ctx *xmlNode) bool { return ctx.Find("ram:PostalTradeAddress") != nil }},
+	{"BR-09", ciiAgreement + "/ram:SellerTradeParty", "ram:PostalTradeAddress/ram:CountryID",
+		"seller country code is required", exists("ram:PostalTradeAddress/ram:CountryID")},
+	{"BR-07", ciiAgreement + "/ram:BuyerTradeParty", "ram:Name", "buyer name is required", exists("ram:Name")},
+	{"BR-10", ciiAgreement + "/ram:BuyerTradeParty", "ram:PostalTradeAddress",
+		"buyer postal address is required", func(ctx *xmlNode) bool { return ctx.Find("ram:PostalTradeAddress") != nil }},
+	{"BR-11", ciiAgreement + "/ram:BuyerTradeParty", "ram:PostalTradeAddress/ram:CountryID",
+		"buyer country code is required", exists("ram:PostalTradeAddress/ram:CountryID")},
+	{"BR-12", ciiSummation, "ram:LineTotalAmount", "sum of line net amounts is required", exists("ram:LineTotalAmount")},
+	{"BR-13", ciiSummation, "ram:TaxBasisTotalAmount", "total without VAT is required", exists("ram:TaxBasisTotalAmount")},
+	{"BR-14", ciiSummation, "ram:GrandTotalAmount", "total with VAT is required", exists("ram:GrandTotalAmount")},
+	{"BR-15", ciiSummation, "ram:DuePayableAmount", "amount due is required", exists("ram:DuePayableAmount")},
+	{"BR-16", "", ciiLine, "at least one invoice line is required", func(ctx *xmlNode) bool {
+		return len(ctx.FindAll(ciiLine)) > 0
+	}},
+	{"BR-CO-10", "", ciiSummation + "/ram:LineTotalAmount", "must equal the sum of the line net amounts", func(ctx *xmlNode) bool {
+		var sum float64
+		for _, line := range ctx.FindAll(ciiLine) {
+			sum += ublAmount(line, "ram:SpecifiedLineTradeSettlement/ram:SpecifiedTradeSettlementLineMonetarySummation/ram:LineTotalAmount")
+		}
+		return sameAmount(sum, ublAmount(ctx, ciiSummation+"/ram:LineTotalAmount"))
+	}},
+	{"BR-CO-15", "", ciiSummation + "/ram:GrandTotalAmount",
+		"must equal the total without VAT plus the VAT total", func(ctx *xmlNode) bool {
+			var tax float64
+			currency := ctx.Value(ciiSettlement + "/ram:InvoiceCurrencyCode")
+			for _, total := range ctx.FindAll(ciiSummation + "/ram:TaxTotalAmount") {
+				if id := total.Attr("currencyID"); id == "" || id == currency {
+					tax, _ = strconv.ParseFloat(total.Value(""), 64)
+				}
+			}
+			return sameAmount(ublAmount(ctx, ciiSummation+"/ram:TaxBasisTotalAmount")+tax,
+				ublAmount(ctx, ciiSummation+"/ram:GrandTotalAmount"))
+		}},
+	{"BR-CO-16", ciiSummation, "ram:DuePayableAmount",
+		"must equal the total with VAT minus the paid amount", func(ctx *xmlNode) bool {
+			return sameAmount(ublAmount(ctx, "ram:GrandTotalAmount")-ublAmount(ctx, "ram:TotalPrepaidAmount")+
+				ublAmount(ctx, "ram:RoundingAmount"), ublAmount(ctx, "ram:DuePayableAmount"))
+		}},
+	{"BR-CO-18", ciiSettlement, "ram:ApplicableTradeTax", "at least one VAT breakdown is required",
+		exists("ram:ApplicableTradeTax/ram:CalculatedAmount")},
+	{"BR-21", "line", "ram:AssociatedDocumentLineDocument/ram:LineID", "line identifier is required",
+		exists("ram:AssociatedDocumentLineDocument/ram:LineID")},
+	{"BR-22", "line", "ram:SpecifiedLineTradeDelivery/ram:BilledQuantity", "invoiced quantity is required",
+		exists("ram:SpecifiedLineTradeDelivery/ram:BilledQuantity")},
+	{"BR-23", "line", "ram:SpecifiedLineTradeDelivery/ram:BilledQuantity/@unitCode", "unit of measure is required",
+		func(ctx *xmlNode) bool {
+			return ctx.Find("ram:SpecifiedLineTradeDelivery/ram:BilledQuantity").Attr("unitCode") != ""
+		}},
+	{"BR-24", "line", "ram:SpecifiedLineTradeSettlement/ram:SpecifiedTradeSettlementLineMonetarySummation/ram:LineTotalAmount",
+		"line net amount is required",
+		exists("ram:SpecifiedLineTradeSettlement/ram:SpecifiedTradeSettlementLineMonetarySummation/ram:LineTotalAmount")},
+	{"BR-25", "line", "ram:SpecifiedTradeProduct/ram:Name", "item name is required", exists("ram:SpecifiedTradeProduct/ram:Name")},
+	{"BR-26", "line", "ram:SpecifiedLineTradeAgreement/ram:NetPriceProductTradePrice/ram:ChargeAmount",
+		"item net price is required", exists("ram:SpecifiedLineTradeAgreement/ram:NetPriceProductTradePrice/ram:ChargeAmount")},
+	{"BR-27", "line", "ram:SpecifiedLineTradeAgreement/ram:NetPriceProductTradePrice/ram:ChargeAmount",
+		"item net price must not be negative", func(ctx *xmlNode) bool {
+			return ublAmount(ctx, "ram:SpecifiedLineTradeAgreement/ram:NetPriceProductTradePrice/ram:ChargeAmount") >= 0
+		}},
+	{"BR-CO-04", "line", "ram:SpecifiedLineTradeSettlement/ram:ApplicableTradeTax/ram:CategoryCode",
+		"line VAT category is required", exists("ram:SpecifiedLineTradeSettlement/ram:ApplicableTradeTax/ram:CategoryCode")},
+}
+
+// ciiLinelessRules do not apply to the Factur-X MINIMUM and BASIC WL
+// profiles, which carry no invoice lines or buyer address.
+var ciiLinelessRules = map[string]bool{"BR-16": true, "BR-CO-10": true, "BR-10": true, "BR-11": true}
+
+// ValidateCII checks a CII document against ciiRules.
+func ValidateCII(doc *xmlNode) []UBLError {
+	guideline := doc.Value(ciiGuideline)
+	if !strings.HasSuffix(guideline, ":minimum") && !strings.HasSuffix(guideline, ":basicwl") {
+		return checkRules(doc, ciiRules, ciiLine)
+	}
+
+	var rules []ublRule
+	for _, rule := range ciiRules {
+		if rule.context != "line" && !ciiLinelessRules[rule.id] {
+			rules = append(rules, rule)
+		}
+	}
+	return checkRules(doc, rules, ciiLine)
+}
+
+// ciiDate converts a MM/DD/YYYY date to the CII format 102, YYYYMMDD.
+// Dates in other formats are returned unchanged.
+func ciiDate(date string) string {
+	if t, err := time.Parse("01/02/2006", date); err == nil {
+		return t.Format("20060102")
+	}
+	return date
+}
@@ -0,0 +1,114 @@
+// Copyright 2016 Cory Robinson. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE.txt file.
+
+// columnsDialog.go implements the Columns dialog of the invoices table,
+// where the user picks the columns shown and their order. The columns are
+// set by the main window, see MainWindow.configureColumns().
+
+package main
+
+import (
+	"github.com/therecipe/qt/core"
+	"github.com/therecipe/qt/widgets"
+)
+
+type ColumnsDialog struct {
+	widgets.QDialog
+
+	columnsList *widgets.QListWidget
+
+	upButton     *widgets.QPushButton
+	downButton   *widgets.QPushButton
+	okButton     *widgets.QPushButton
+	cancelButton *widgets.QPushButton
+}
+
+// initWith() initializes the dialog layout with the keys of the columns
+// shown, listed first and checked, followed by the other columns.
+func (d *ColumnsDialog) initWith(parent *widgets.QWidget, keys []string) {
+	d.columnsList = widgets.NewQListWidget(nil)
+	d.columnsList.SetDragDropMode(widgets.QAbstractItemView__InternalMove)
+
+	shown := map[string]bool{}
+	for _, key := range keys {
+		if column, ok := invoiceColumn(key); ok {
+			d.addColumn(column, true)
+			shown[key] = true
+		}
+	}
+	for _, column := range invoiceColumns {
+		if !shown[column.key] {
+			d.addColumn(column, false)
+		}
+	}
+	d.columnsList.SetCurrentRow(0)
+
+	d.upButton = widgets.NewQPushButton2("Move &Up", nil)
+	d.downButton = widgets.NewQPushButton2("Move &Down", nil)
+	d.upButton.ConnectClicked(func(bool) { d.moveColumn(-1) })
+	d.downButton.ConnectClicked(func(bool) { d.moveColumn(1) })
+
+	moveLayout := widgets.NewQVBoxLayout()
+	moveLayout.AddWidget(d.upButton, 0, 0)
+	moveLayout.AddWidget(d.downButton, 0, 0)
+	moveLayout.AddStretch(1)
+
+	listLayout := widgets.NewQHBoxLayout()
+	listLayout.AddWidget(d.columnsList, 1, 0)
+	listLayout.AddLayout(moveLayout, 0)
+
+	buttonBox := widgets.NewQDialogButtonBox(nil)
+	d.okButton = widgets.NewQPushButton2("&OK", nil)
+	d.cancelButton = widgets.NewQPushButton2("&Cancel", nil)
+	d.okButton.SetDefault(true)
+	d.okButton.ConnectClicked(func(bool) { d.Accept() })
+	d.cancelButton.ConnectClicked(func(bool) { d.Reject() })
+	buttonBox.AddButton(d.okButton, widgets.QDialogButtonBox__AcceptRole)
+	buttonBox.AddButton(d.cancelButton, widgets.QDialogButtonBox__RejectRole)
+
+	layout := widgets.NewQVBoxLayout()
+	layout.AddWidget(widgets.NewQLabel2("Check the columns to show, and drag them into order:", nil, 0), 0, 0)
+	layout.AddLayout(listLayout, 1)
+	layout.AddWidget(buttonBox, 0, 0)
+	d.SetLayout(layout)
+
+	d.SetWindowTitle("Invoice Columns")
+}
+
+// addColumn() adds a column to the list, checked if it is shown.
+func (d *ColumnsDialog) addColumn(column tableColumn[Invoice], shown bool) {
+	d.columnsList.AddItem(column.title)
+	item := d.columnsList.Item(d.columnsList.Count() - 1)
+	item.SetData(int(core.Qt__UserRole), core.NewQVariant14(column.key))
+	item.SetFlags(item.Flags() | core.Qt__ItemIsUserCheckable)
+	if shown {
+		item.SetCheckState(core.Qt__Checked)
+	} else {
+		item.SetCheckState(core.Qt__Unchecked)
+	}
+}
+
+// moveColumn() moves the current column up or down the list by offset.
+func (d *ColumnsDialog) moveColumn(offset int) {
+	row := d.columnsList.CurrentRow()
+	to := row + offset
+	if row < 0 || to < 0 || to >= d.columnsList.Count() {
+		return
+	}
+	item := d.columnsList.TakeItem(row)
+	d.columnsList.InsertItem(to, item)
+	d.columnsList.SetCurrentRow(to)
+}
+
+// keys() returns the keys of the columns checked, in their order.
+func (d *ColumnsDialog) keys() []string {
+	var keys []string
+	for row := 0; row < d.columnsList.Count(); row++ {
+		item := d.columnsList.Item(row)
+		if item.CheckState() == core.Qt__Checked {
+			keys = append(keys, item.Data(int(core.Qt__UserRole)).ToString())
+		}
+	}
+	return keys
+}
@@ -0,0 +1,872 @@
+// Copyright 2016 Cory Robinson. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE.txt file.
+
+// commands.go implements the command line mode of the app. If the app is
+// started with a known command as its first argument, that command is run
+// instead of the GUI, e.g.
+//
+//	InvoiceViewer.lex import -map "vendor=Supplier" invoices.csv
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// commands maps a command name to the function implementing it. Each
+// function gets the remaining arguments and returns the exit code.
+var commands = map[string]func(args []string) int{
+	"import":  importCommand,
+	"export":  exportCommand,
+	"pdf":     pdfCommand,
+	"ubl":     ublCommand,
+	"facturx": facturxCommand,
+	"x12":     x12Command,
+	"inbox":   inboxCommand,
+	"extract": extractCommand,
+	"email":   emailCommand,
+	"serve":   serveCommand,
+	"ctl":     ctlCommand,
+}
+
+// runCommand runs the command named by args[0]. ok is false if args does
+// not name a command, in which case the GUI should be started.
+func runCommand(args []string) (code int, ok bool) {
+	if len(args) == 0 {
+		return 0, false
+	}
+	command, ok := commands[args[0]]
+	if !ok {
+		return 0, false
+	}
+	return command(args[1:]), true
+}
+
+// isCommand reports whether argv runs a command or invoicectl rather than
+// the GUI.
+func isCommand(argv []string) bool {
+	if isCtl(argv) {
+		return true
+	}
+	if len(argv) < 2 {
+		return false
+	}
+	_, ok := commands[argv[1]]
+	return ok
+}
+
+// importCommand imports invoices from a CSV file. The file is parsed and
+// validated first; invoices are only added if no row has errors.
+func importCommand(args []string) int {
+	flags := flag.NewFlagSet("import", flag.ContinueOnError)
+	mapSpec := flags.String("map", "", "column mapping, e.g. \"vendor=Supplier,invoiceno=Inv No\"")
+	delimiter := flags.String("delimiter", ",", "CSV field delimiter")
+	dryRun := flags.Bool("dry-run", false, "validate and preview only, do not add invoices")
+	flags.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: import [flags] file.csv")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if flags.NArg() != 1 || len([]rune(*delimiter)) != 1 {
+		flags.Usage()
+		return 2
+	}
+
+	file, err := os.Open(flags.Arg(0))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	defer file.Close()
+
+	header, rows, err := ReadCSV(file, []rune(*delimiter)[0])
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Failed to read CSV:", err)
+		return 1
+	}
+	mapping, err := ParseMappingSpec(*mapSpec, header)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+
+	var r Repository
+	preview := ParseCSVInvoices(rows, mapping)
+	preview.CheckExisting(r)
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "VENDOR\tINVOICE NO.\tDATE\tLINES\tTOTAL")
+	for _, invoice := range preview.Invoices {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%d\t%s\n", invoice.Vendor, invoice.InvoiceNo,
+			invoice.Date, len(invoice.LineItems), formatCents(invoice.Total))
+	}
+	tw.Flush()
+
+	for _, e := range preview.Errors {
+		fmt.Fprintln(os.Stderr, e)
+	}
+	if len(preview.Errors) > 0 {
+		fmt.Fprintf(os.Stderr, "%d errors, nothing was imported\n", len(preview.Errors))
+		return 1
+	}
+	if *dryRun {
+		return 0
+	}
+
+	count, err := preview.Commit(r)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	fmt.Printf("Imported %d invoices\n", count)
+
+	return 0
+}
+
+// exportCommand exports invoices to a file, or to stdout if no file is
+// given. By default every invoice is exported.
+func exportCommand(args []string) int {
+	flags := flag.NewFlagSet("export", flag.ContinueOnError)
+	format := flags.String("format", "", "export format: "+strings.Join(exportFormats, ", ")+" (default from file extension)")
+	vendor := flags.String("vendor", "", "only export invoices from this vendor")
+	flags.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: export [flags] [file]")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if flags.NArg() > 1 {
+		flags.Usage()
+		return 2
+	}
+
+	name := flags.Arg(0)
+	if *format == "" {
+		*format = exportFormatForFile(name)
+	}
+
+	var r Repository
+	var invoices Invoices
+	if *vendor != "" {
+		invoices = r.GetInvoicesByVendor(*vendor)
+	} else {
+		invoices = r.GetInvoices()
+	}
+
+	out := os.Stdout
+	if name != "" {
+		file, err := os.Create(name)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		defer file.Close()
+		out = file
+	}
+
+	if err := ExportInvoices(out, invoices, *format); err != nil {
+		fmt.Fprintln(os.Stderr, "Failed to export:", err)
+		return 1
+	}
+
+	return 0
+}
+
+// pdfCommand renders invoices to PDF files, one file per invoice. Invoices
+// are picked by invoice number; with no invoice numbers every invoice (of
+// the vendor, if given) is rendered.
+func pdfCommand(args []string) int {
+	flags := flag.NewFlagSet("pdf", flag.ContinueOnError)
+	templateFile := flags.String("template", "", "PDF template JSON file (default "+PDFTEMPLATE+" if it exists)")
+	logo := flags.String("logo", "", "logo image, overrides the template logo")
+	outDir := flags.String("out", ".", "directory to write the PDF files to")
+	vendor := flags.String("vendor", "", "only render invoices from this vendor")
+	facturX := flags.Bool("facturx", false, "attach the invoice as Factur-X / ZUGFeRD XML")
+	flags.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: pdf [flags] [invoiceno ...]")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	template, err := LoadPDFTemplate(*templateFile)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Failed to load template:", err)
+		return 1
+	}
+	if *logo != "" {
+		template.Logo = *logo
+	}
+	if *facturX {
+		template.FacturX = true
+	}
+
+	var r Repository
+	var invoices Invoices
+	if *vendor != "" {
+		invoices = r.GetInvoicesByVendor(*vendor)
+	} else {
+		invoices = r.GetInvoices()
+	}
+
+	if flags.NArg() > 0 {
+		invoices = pickInvoices(invoices, flags.Args())
+	}
+
+	if err := os.MkdirAll(*outDir, 0755); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	code := 0
+	for _, invoice := range invoices {
+		name := filepath.Join(*outDir, pdfFileName(invoice))
+		if err := WriteInvoicePDF(name, invoice, template); err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to render invoice %v: %v\n", invoice.InvoiceNo, err)
+			code = 1
+			continue
+		}
+		fmt.Println(name)
+	}
+	if len(invoices) == 0 {
+		code = 1
+	}
+
+	return code
+}
+
+// ublCommand validates, imports or exports UBL 2.1 / Peppol BIS 3.0
+// invoice documents:
+//
+//	ubl validate file.xml ...
+//	ubl import [-force] file.xml ...
+//	ubl export [-force] [-out dir] [-vendor name] [invoiceno ...]
+func ublCommand(args []string) int {
+	usage := func() int {
+		fmt.Fprintln(os.Stderr, "usage: ubl validate|import|export [flags] [args]")
+		return 2
+	}
+	if len(args) == 0 {
+		return usage()
+	}
+
+	flags := flag.NewFlagSet("ubl "+args[0], flag.ContinueOnError)
+	force := flags.Bool("force", false, "import or export documents even if they fail business rules")
+	outDir := flags.String("out", ".", "directory to write exported documents to")
+	vendor := flags.String("vendor", "", "only export invoices from this vendor")
+	if err := flags.Parse(args[1:]); err != nil {
+		return 2
+	}
+
+	var r Repository
+	switch args[0] {
+	case "validate", "import":
+		if flags.NArg() == 0 {
+			return usage()
+		}
+		return importEInvoices(r, args[0] == "import", flags.Args(), ReadUBLFile, *force)
+
+	case "export":
+		var invoices Invoices
+		if *vendor != "" {
+			invoices = r.GetInvoicesByVendor(*vendor)
+		} else {
+			invoices = r.GetInvoices()
+		}
+		if flags.NArg() > 0 {
+			invoices = pickInvoices(invoices, flags.Args())
+		}
+		if err := os.MkdirAll(*outDir, 0755); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+
+		code := 0
+		for _, invoice := range invoices {
+			name := filepath.Join(*outDir, ublFileName(invoice))
+			errs := CheckUBL(invoice)
+			for _, e := range errs {
+				fmt.Fprintf(os.Stderr, "%v: %v\n", name, e)
+			}
+			if len(errs) > 0 {
+				code = 1
+				if !*force {
+					fmt.Fprintf(os.Stderr, "%v: not exported\n", name)
+					continue
+				}
+			}
+			if err := WriteUBLFile(name, invoice); err != nil {
+				fmt.Fprintf(os.Stderr, "Failed to export invoice %v: %v\n", invoice.InvoiceNo, err)
+				code = 1
+				continue
+			}
+			fmt.Println(name)
+		}
+		if len(invoices) == 0 {
+			code = 1
+		}
+		return code
+	}
+
+	return usage()
+}
+
+// facturxCommand validates, imports or extracts the invoices attached to
+// ZUGFeRD / Factur-X PDF files.
+func facturxCommand(args []string) int {
+	usage := func() int {
+		fmt.Fprintln(os.Stderr, "usage: facturx validate|import|extract [flags] file.pdf ...")
+		return 2
+	}
+	if len(args) == 0 {
+		return usage()
+	}
+
+	flags := flag.NewFlagSet("facturx "+args[0], flag.ContinueOnError)
+	force := flags.Bool("force", false, "import invoices even if they fail business rules")
+	outDir := flags.String("out", ".", "directory to write extracted XML files to")
+	if err := flags.Parse(args[1:]); err != nil {
+		return 2
+	}
+	if flags.NArg() == 0 {
+		return usage()
+	}
+
+	var r Repository
+	switch args[0] {
+	case "validate", "import":
+		return importEInvoices(r, args[0] == "import", flags.Args(), ReadFacturXFile, *force)
+
+	case "extract":
+		if err := os.MkdirAll(*outDir, 0755); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+
+		code := 0
+		for _, name := range flags.Args() {
+			out, err := extractFacturXFile(name, *outDir)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "%v: %v\n", name, err)
+				code = 1
+				continue
+			}
+			fmt.Println(out)
+		}
+		return code
+	}
+
+	return usage()
+}
+
+// extractFacturXFile writes the XML attached to a Factur-X PDF to dir,
+// named after the PDF, and returns the name of the XML file.
+func extractFacturXFile(name, dir string) (string, error) {
+	data, err := os.ReadFile(name)
+	if err != nil {
+		return "", err
+	}
+	attachment, err := ExtractFacturXML(data)
+	if err != nil {
+		return "", err
+	}
+
+	out := filepath.Join(dir, strings.TrimSuffix(filepath.Base(name), filepath.Ext(name))+".xml")
+	return out, os.WriteFile(out, attachment.Data, 0644)
+}
+
+// importEInvoices reads each e-invoice file and reports its business rule
+// errors. If add is set the invoices are also added to the repository,
+// skipping those with errors unless force is set, and duplicates.
+func importEInvoices(r Repository, add bool, names []string,
+	read func(name string) (Invoice, []UBLError, error), force bool) int {
+	code := 0
+	for _, name := range names {
+		invoice, errs, err := read(name)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%v: %v\n", name, err)
+			code = 1
+			continue
+		}
+		for _, e := range errs {
+			fmt.Fprintf(os.Stderr, "%v: %v\n", name, e)
+		}
+		if len(errs) > 0 {
+			code = 1
+		}
+		if !add {
+			continue
+		}
+
+		if len(errs) > 0 && !force {
+			fmt.Fprintf(os.Stderr, "%v: not imported\n", name)
+			continue
+		}
+		if !addImportedInvoice(r, name, invoice) {
+			code = 1
+		}
+	}
+	return code
+}
+
+// addImportedInvoice adds an invoice read from the named file, unless it
+// is invalid or already exists, and reports the outcome.
+func addImportedInvoice(r Repository, name string, invoice Invoice) bool {
+	if msgs := validateInvoice(invoice); len(msgs) > 0 {
+		fmt.Fprintf(os.Stderr, "%v: not imported: %v\n", name, strings.Join(msgs, "; "))
+		return false
+	}
+	if r.InvoiceExists(invoice.InvoiceNo, invoice.Vendor) {
+		fmt.Fprintf(os.Stderr, "%v: invoice %v from %v already exists\n", name, invoice.InvoiceNo, invoice.Vendor)
+		return false
+	}
+	if !r.AddInvoice(invoice) {
+		fmt.Fprintf(os.Stderr, "%v: failed to add invoice\n", name)
+		return false
+	}
+	fmt.Printf("%v: imported invoice %v from %v\n", name, invoice.InvoiceNo, invoice.Vendor)
+	return true
+}
+
+// x12Command validates, imports, acknowledges or exports X12 810 EDI
+// invoices.
+func x12Command(args []string) int {
+	usage := func() int {
+		fmt.Fprintln(os.Stderr, "usage: x12 validate|import|ack|export [flags] [args]")
+		return 2
+	}
+	if len(args) == 0 {
+		return usage()
+	}
+
+	flags := flag.NewFlagSet("x12 "+args[0], flag.ContinueOnError)
+	ackDir := flags.String("ack", "", "import: write 997 acknowledgments to this directory")
+	out := flags.String("out", "", "ack: directory for the 997 files (default .); export: output file (default stdout)")
+	sender := flags.String("sender", "ZZ:INVOICEVIEWER", "export: interchange sender as qualifier:id")
+	receiver := flags.String("receiver", "", "export: interchange receiver as qualifier:id; ack: overrides the original sender")
+	control := flags.Int("control", int(time.Now().Unix()%1000000000), "interchange and group control number")
+	test := flags.Bool("test", false, "mark the interchange as test data")
+	vendor := flags.String("vendor", "", "export: only export invoices from this vendor")
+	if err := flags.Parse(args[1:]); err != nil {
+		return 2
+	}
+
+	config := X12Config{ControlNumber: *control, Test: *test}
+	config.ReceiverQualifier, config.ReceiverID = parseX12ID(*receiver)
+
+	var r Repository
+	switch args[0] {
+	case "validate", "import", "ack":
+		if flags.NArg() == 0 {
+			return usage()
+		}
+		dir := *ackDir
+		if args[0] == "ack" {
+			dir = *out
+			if dir == "" {
+				dir = "."
+			}
+		}
+
+		code := 0
+		for _, name := range flags.Args() {
+			interchanges, err := ReadX12File(name)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "%v: %v\n", name, err)
+				code = 1
+				continue
+			}
+
+			for i, ic := range interchanges {
+				for _, group := range ic.Groups {
+					if len(group.Codes) > 0 {
+						fmt.Fprintf(os.Stderr, "%v: group %v: error codes %v\n", name, group.ControlNumber, strings.Join(group.Codes, ","))
+						code = 1
+					}
+					for _, t := range group.Transactions {
+						for _, e := range t.Errors {
+							fmt.Fprintf(os.Stderr, "%v: transaction set %v: %v\n", name, t.ControlNumber, e)
+						}
+						if len(t.Codes) > 0 {
+							fmt.Fprintf(os.Stderr, "%v: transaction set %v: error codes %v\n", name, t.ControlNumber, strings.Join(t.Codes, ","))
+						}
+						if len(t.Errors) > 0 || len(t.Codes) > 0 {
+							code = 1
+						}
+					}
+				}
+
+				if args[0] == "import" {
+					for _, invoice := range ic.Invoices() {
+						if !addImportedInvoice(r, name, invoice) {
+							code = 1
+						}
+					}
+				}
+
+				if dir != "" && args[0] != "validate" {
+					ackName, err := writeX12AckFile(dir, name, i, ic, config)
+					if err != nil {
+						fmt.Fprintf(os.Stderr, "%v: %v\n", name, err)
+						code = 1
+						continue
+					}
+					fmt.Println(ackName)
+					config.ControlNumber = (config.ControlNumber + 1) % 1000000000
+				}
+			}
+		}
+		return code
+
+	case "export":
+		if config.ReceiverID == "" {
+			fmt.Fprintln(os.Stderr, "x12 export: -receiver is required")
+			return 2
+		}
+		config.SenderQualifier, config.SenderID = parseX12ID(*sender)
+
+		var invoices Invoices
+		if *vendor != "" {
+			invoices = r.GetInvoicesByVendor(*vendor)
+		} else {
+			invoices = r.GetInvoices()
+		}
+		if flags.NArg() > 0 {
+			invoices = pickInvoices(invoices, flags.Args())
+		}
+		if len(invoices) == 0 {
+			fmt.Fprintln(os.Stderr, "No invoices to export")
+			return 1
+		}
+
+		w := os.Stdout
+		if *out != "" {
+			file, err := os.Create(*out)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				return 1
+			}
+			defer file.Close()
+			w = file
+		}
+		if err := WriteX12Invoices(w, invoices, config); err != nil {
+			fmt.Fprintln(os.Stderr, "Failed to export:", err)
+			return 1
+		}
+		return 0
+	}
+
+	return usage()
+}
+
+// writeX12AckFile writes the 997 for interchange i of the named file to
+// dir and returns the name of the 997 file.
+func writeX12AckFile(dir, name string, i int, ic *X12Interchange, config X12Config) (string, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", err
+	}
+	base := strings.TrimSuffix(filepath.Base(name), filepath.Ext(name))
+	if i > 0 {
+		base = fmt.Sprintf("%s-%d", base, i+1)
+	}
+	ackName := filepath.Join(dir, base+"-997.edi")
+
+	file, err := os.Create(ackName)
+	if err != nil {
+		return "", err
+	}
+	err = WriteX12Acknowledgment(file, ic, config)
+	if cerr := file.Close(); err == nil {
+		err = cerr
+	}
+	return ackName, err
+}
+
+// parseX12ID splits an interchange id given as qualifier:id. The
+// qualifier defaults to ZZ, mutually defined.
+func parseX12ID(s string) (qualifier, id string) {
+	if i := strings.Index(s, ":"); i >= 0 {
+		return s[:i], s[i+1:]
+	}
+	if s == "" {
+		return "", ""
+	}
+	return "ZZ", s
+}
+
+// inboxCommand watches an inbox folder and imports the files dropped into
+// it until interrupted, or processes the files in it once with -once.
+func inboxCommand(args []string) int {
+	flags := flag.NewFlagSet("inbox", flag.ContinueOnError)
+	interval := flags.Duration("interval", inboxInterval, "time between scans of the folder")
+	once := flags.Bool("once", false, "process the files in the folder once and exit")
+	flags.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: inbox [flags] dir")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return 2
+	}
+
+	inbox := NewInbox(flags.Arg(0), *interval)
+	failed := false
+	inbox.Processed = func(result InboxResult) {
+		if result.Failed() {
+			failed = true
+			fmt.Fprintf(os.Stderr, "%v: failed, moved to %v\n", result.File, result.MovedTo)
+			for _, problem := range result.Problems {
+				fmt.Fprintf(os.Stderr, "  %v\n", problem)
+			}
+			return
+		}
+		fmt.Printf("%v: imported %d invoices (%v)\n", result.File, result.Imported, result.Format)
+	}
+
+	if *once {
+		if info, err := os.Stat(inbox.Dir); err != nil || !info.IsDir() {
+			fmt.Fprintln(os.Stderr, "Not a directory:", inbox.Dir)
+			return 1
+		}
+		inbox.Scan()
+		if failed {
+			return 1
+		}
+		return 0
+	}
+
+	if err := inbox.Start(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	fmt.Printf("Watching %v, press Ctrl+C to stop\n", inbox.Dir)
+
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt)
+	<-interrupt
+	inbox.Stop()
+
+	return 0
+}
+
+// extractCommand prints the text of PDF invoices, or the draft invoices
+// extracted from them as JSON, to write and test extraction templates.
+func extractCommand(args []string) int {
+	flags := flag.NewFlagSet("extract", flag.ContinueOnError)
+	templatesPath := flags.String("templates", "", "extraction templates file (default "+EXTRACTIONTEMPLATES+" if it exists)")
+	textOnly := flags.Bool("text", false, "print the extracted text only")
+	flags.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: extract [flags] file.pdf...")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if flags.NArg() == 0 {
+		flags.Usage()
+		return 2
+	}
+
+	templates, err := LoadExtractionTemplates(*templatesPath)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	code := 0
+	for _, name := range flags.Args() {
+		if *textOnly {
+			data, err := os.ReadFile(name)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				code = 1
+				continue
+			}
+			pages, err := ExtractPDFText(data)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "%v: %v\n", name, err)
+				code = 1
+				continue
+			}
+			fmt.Print(strings.Join(pages, "\f"))
+			continue
+		}
+
+		result, err := ExtractPDFInvoice(name, templates)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%v: %v\n", name, err)
+			code = 1
+			continue
+		}
+		fmt.Fprintf(os.Stderr, "%v: %v template\n", name, result.Template)
+		for _, problem := range result.Problems {
+			fmt.Fprintf(os.Stderr, "%v: %v\n", name, problem)
+			code = 1
+		}
+		data, _ := json.MarshalIndent(result.Invoice, "", "  ")
+		fmt.Println(string(data))
+	}
+
+	return code
+}
+
+// emailCommand queues the invoices attached to emails as drafts. Each
+// source is an .eml file, an mbox archive or a Maildir directory.
+func emailCommand(args []string) int {
+	flags := flag.NewFlagSet("email", flag.ContinueOnError)
+	templatesPath := flags.String("templates", "", "extraction templates file (default "+EXTRACTIONTEMPLATES+" if it exists)")
+	dryRun := flags.Bool("dry-run", false, "report what would be queued without queuing it")
+	flags.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: email [flags] file.eml|archive.mbox|maildir...")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if flags.NArg() == 0 {
+		flags.Usage()
+		return 2
+	}
+
+	templates, err := LoadExtractionTemplates(*templatesPath)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	var r Repository
+	importer := NewEmailImporter(r, templates)
+	importer.DryRun = *dryRun
+
+	code, queued := 0, 0
+	for _, source := range flags.Args() {
+		emails, err := ReadEmails(source)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%v: %v\n", source, err)
+			code = 1
+		}
+		for _, email := range emails {
+			result := importer.Import(email)
+			queued += result.Drafts
+			if result.Skipped != "" {
+				fmt.Fprintf(os.Stderr, "%v: %v: skipped, %v\n", email.FromString(), email.Subject, result.Skipped)
+			} else {
+				fmt.Fprintf(os.Stderr, "%v: %v: %d drafts\n", email.FromString(), email.Subject, result.Drafts)
+			}
+			for _, problem := range result.Problems {
+				fmt.Fprintf(os.Stderr, "    %v\n", problem)
+			}
+		}
+	}
+
+	if *dryRun {
+		fmt.Printf("%d draft invoices would be queued\n", queued)
+	} else {
+		fmt.Printf("%d draft invoices queued for review\n", queued)
+	}
+	return code
+}
+
+// serveCommand serves the JSON API of api.go, and the gRPC service of
+// grpcServer.go with -grpc, until interrupted.
+func serveCommand(args []string) int {
+	flags := flag.NewFlagSet("serve", flag.ContinueOnError)
+	addr := flags.String("addr", "localhost:8080", "address to serve the JSON API on")
+	grpcAddr := flags.String("grpc", "", "address to serve the gRPC service on, i.e. localhost:9090")
+	flags.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: serve [flags]")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if flags.NArg() != 0 {
+		flags.Usage()
+		return 2
+	}
+
+	var r Repository
+	server := &http.Server{
+		Addr:              *addr,
+		Handler:           NewAPIServer(r),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	errs := make(chan error, 2)
+	go func() { errs <- server.ListenAndServe() }()
+	fmt.Printf("Serving the API on http://%v/api/v1/, press Ctrl+C to stop\n", *addr)
+
+	if *grpcAddr != "" {
+		lis, err := net.Listen("tcp", *grpcAddr)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			server.Close()
+			return 1
+		}
+		grpcServer := NewGRPCServer(r)
+		defer grpcServer.GracefulStop()
+		go func() { errs <- grpcServer.Serve(lis) }()
+		fmt.Printf("Serving the gRPC service on %v\n", *grpcAddr)
+	}
+
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt)
+	select {
+	case err := <-errs:
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	case <-interrupt:
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := server.Shutdown(ctx); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	return 0
+}
+
+// pickInvoices returns the invoices with the given invoice numbers, and
+// reports the numbers that were not found.
+func pickInvoices(invoices Invoices, numbers []string) Invoices {
+	wanted := map[string]bool{}
+	for _, num := range numbers {
+		wanted[num] = true
+	}
+
+	var picked Invoices
+	found := map[string]bool{}
+	for _, invoice := range invoices {
+		if wanted[invoice.InvoiceNo] {
+			picked = append(picked, invoice)
+			found[invoice.InvoiceNo] = true
+		}
+	}
+	for _, num := range numbers {
+		if !found[num] {
+			fmt.Fprintln(os.Stderr, "No invoice", num)
+		}
+	}
+
+	return picked
+}
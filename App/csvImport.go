@@ -0,0 +1,496 @@
+// Copyright 2016 Cory Robinson. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE.txt file.
+
+// csvImport.go implements importing invoices from CSV files. Each CSV row
+// holds one line item; the columns of the file are mapped onto the fields
+// of Invoice, Location and Item, and rows sharing the same vendor and
+// invoice number are grouped into a single invoice. Rows are validated and
+// any errors are reported per row before anything is written to the DB.
+
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// importFields lists the fields a CSV column can be mapped onto. The names
+// follow the json tags of Invoice, Location and Item.
+var importFields = []string{
+	"vendor", "street", "city", "state", "zipcode",
+	"invoiceno", "date", "purchaseorder", "total", "taxtotal", "currency", "paid",
+	"productid", "description", "quantity", "amount",
+}
+
+// importFieldAliases are other common header names that are recognized
+// when guessing a mapping. Keys are normalized with normalizeHeader.
+var importFieldAliases = map[string]string{
+	"supplier":      "vendor",
+	"vendorname":    "vendor",
+	"address":       "street",
+	"zip":           "zipcode",
+	"postalcode":    "zipcode",
+	"invoice":       "invoiceno",
+	"invoicenumber": "invoiceno",
+	"invoicedate":   "date",
+	"po":            "purchaseorder",
+	"ponumber":      "purchaseorder",
+	"invoicetotal":  "total",
+	"tax":           "taxtotal",
+	"salestax":      "taxtotal",
+	"taxamount":     "taxtotal",
+	"status":        "paid",
+	"product":       "productid",
+	"sku":           "productid",
+	"item":          "description",
+	"qty":           "quantity",
+	"price":         "amount",
+	"unitprice":     "amount",
+}
+
+// ColumnMapping maps an import field name to the index of a CSV column.
+// Fields that are not mapped are simply absent.
+type ColumnMapping map[string]int
+
+// RowError describes a problem with a single row of an import file.
+// Row is the 1-based record number in the file, counting the header.
+type RowError struct {
+	Row   int
+	Field string
+	Msg   string
+}
+
+func (e RowError) Error() string {
+	if e.Field == "" {
+		return fmt.Sprintf("row %d: %s", e.Row, e.Msg)
+	}
+	return fmt.Sprintf("row %d: %s: %s", e.Row, e.Field, e.Msg)
+}
+
+// ImportPreview holds the result of parsing an import file: the grouped
+// invoices, the file rows each invoice was built from, and every error
+// found while parsing and validating.
+type ImportPreview struct {
+	Invoices Invoices
+	Rows     [][]int
+	Errors   []RowError
+}
+
+// ReadCSV reads a whole CSV file and splits off the header row.
+func ReadCSV(r io.Reader, delimiter rune) ([]string, [][]string, error) {
+	reader := csv.NewReader(r)
+	reader.Comma = delimiter
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	records, err := reader.ReadAll()
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(records) == 0 {
+		return nil, nil, fmt.Errorf("file is empty")
+	}
+
+	return records[0], records[1:], nil
+}
+
+// normalizeHeader lowercases a header name and strips everything that is
+// not a letter or digit, so "Invoice No." and "invoiceno" compare equal.
+func normalizeHeader(name string) string {
+	var b strings.Builder
+	for _, c := range strings.ToLower(name) {
+		if (c >= 'a' && c <= 'z') || (c >= '0' && c <= '9') {
+			b.WriteRune(c)
+		}
+	}
+	return b.String()
+}
+
+// GuessMapping maps the CSV header names onto import fields by name.
+func GuessMapping(header []string) ColumnMapping {
+	mapping := ColumnMapping{}
+	for i, name := range header {
+		key := normalizeHeader(name)
+		if alias, ok := importFieldAliases[key]; ok {
+			key = alias
+		}
+		for _, field := range importFields {
+			if key == field {
+				if _, taken := mapping[field]; !taken {
+					mapping[field] = i
+				}
+				break
+			}
+		}
+	}
+	return mapping
+}
+
+// ParseMappingSpec builds a ColumnMapping from a spec such as
+// "vendor=Supplier,invoiceno=Inv No,amount=4". A column is referenced by
+// its header name or by its 0-based index. Fields that are not in the
+// spec keep the mapping guessed from the header.
+func ParseMappingSpec(spec string, header []string) (ColumnMapping, error) {
+	mapping := GuessMapping(header)
+	if strings.TrimSpace(spec) == "" {
+		return mapping, nil
+	}
+
+	for _, pair := range strings.Split(spec, ",") {
+		parts := strings.SplitN(pair, "=", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("bad mapping %q, want field=column", pair)
+		}
+		field := strings.ToLower(strings.TrimSpace(parts[0]))
+		column := strings.TrimSpace(parts[1])
+
+		if !isImportField(field) {
+			return nil, fmt.Errorf("unknown field %q", field)
+		}
+
+		index := -1
+		for i, name := range header {
+			if name == column {
+				index = i
+				break
+			}
+		}
+		if index < 0 {
+			if n, err := strconv.Atoi(column); err == nil && n >= 0 && n < len(header) {
+				index = n
+			}
+		}
+		if index < 0 {
+			return nil, fmt.Errorf("no column %q for field %q", column, field)
+		}
+		mapping[field] = index
+	}
+
+	return mapping, nil
+}
+
+// isImportField reports whether name is one of importFields.
+func isImportField(name string) bool {
+	for _, field := range importFields {
+		if field == name {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseCSVInvoices turns CSV rows into invoices using the given mapping.
+// Rows with the same vendor and invoice number are grouped into one
+// invoice, each row contributing one line item.
+func ParseCSVInvoices(rows [][]string, mapping ColumnMapping) *ImportPreview {
+	preview := &ImportPreview{}
+
+	for _, field := range []string{"vendor", "invoiceno"} {
+		if _, ok := mapping[field]; !ok {
+			preview.Errors = append(preview.Errors, RowError{1, field, "column is not mapped"})
+		}
+	}
+	if len(preview.Errors) > 0 {
+		return preview
+	}
+
+	groups := map[string]int{} // vendor+invoiceno --> index in preview.Invoices
+	totals := map[int]bool{}   // invoices with a total given in the file
+	taxes := map[int]bool{}    // invoices with a tax total given in the file
+
+	for i, record := range rows {
+		rowNo := i + 2 // 1-based, after the header
+		get := func(field string) string {
+			col, ok := mapping[field]
+			if !ok || col >= len(record) {
+				return ""
+			}
+			return strings.TrimSpace(record[col])
+		}
+
+		vendor := get("vendor")
+		invoiceNo := get("invoiceno")
+		if vendor == "" && invoiceNo == "" && isBlankRecord(record) {
+			continue
+		}
+		if vendor == "" {
+			preview.Errors = append(preview.Errors, RowError{rowNo, "vendor", "is empty"})
+			continue
+		}
+		if invoiceNo == "" {
+			preview.Errors = append(preview.Errors, RowError{rowNo, "invoiceno", "is empty"})
+			continue
+		}
+
+		key := vendor + "\x00" + invoiceNo
+		index, seen := groups[key]
+		if !seen {
+			index = len(preview.Invoices)
+			groups[key] = index
+			preview.Invoices = append(preview.Invoices, Invoice{Vendor: vendor, InvoiceNo: invoiceNo})
+			preview.Rows = append(preview.Rows, nil)
+		}
+		invoice := &preview.Invoices[index]
+		preview.Rows[index] = append(preview.Rows[index], rowNo)
+
+		// invoice level fields come from the first row that sets them;
+		// later rows must agree.
+		setField := func(field, value string, current *string) {
+			if value == "" {
+				return
+			}
+			if *current == "" {
+				*current = value
+			} else if *current != value {
+				preview.Errors = append(preview.Errors, RowError{rowNo, field,
+					fmt.Sprintf("%q conflicts with %q on an earlier row", value, *current)})
+			}
+		}
+		setField("street", get("street"), &invoice.Address.Street)
+		setField("city", get("city"), &invoice.Address.City)
+		setField("state", get("state"), &invoice.Address.State)
+		setField("zipcode", get("zipcode"), &invoice.Address.Zipcode)
+		setField("purchaseorder", get("purchaseorder"), &invoice.PurchaseOrder)
+		setField("currency", strings.ToUpper(get("currency")), &invoice.Currency)
+
+		if s := get("date"); s != "" {
+			date, err := normalizeDate(s)
+			if err != nil {
+				preview.Errors = append(preview.Errors, RowError{rowNo, "date", err.Error()})
+			} else {
+				setField("date", date, &invoice.Date)
+			}
+		}
+
+		// amounts are compared in cents, as rows may format them differently
+		setCents := func(field string, current *int64, set map[int]bool) {
+			s := get(field)
+			if s == "" {
+				return
+			}
+			cents, err := parseCents(s)
+			if err != nil {
+				preview.Errors = append(preview.Errors, RowError{rowNo, field, err.Error()})
+			} else if !set[index] {
+				*current = cents
+				set[index] = true
+			} else if *current != cents {
+				preview.Errors = append(preview.Errors, RowError{rowNo, field,
+					fmt.Sprintf("%s conflicts with %s on an earlier row", s, formatCents(*current))})
+			}
+		}
+		setCents("total", &invoice.Total, totals)
+		setCents("taxtotal", &invoice.TaxTotal, taxes)
+
+		if s := get("paid"); s != "" {
+			paid, err := parsePaid(s)
+			if err != nil {
+				preview.Errors = append(preview.Errors, RowError{rowNo, "paid", err.Error()})
+			} else if paid {
+				invoice.Paid = true
+			}
+		}
+
+		item, hasItem, errs := parseLineItem(rowNo, get)
+		preview.Errors = append(preview.Errors, errs...)
+		if hasItem {
+			invoice.LineItems = append(invoice.LineItems, item)
+		}
+	}
+
+	for i := range preview.Invoices {
+		invoice := &preview.Invoices[i]
+		if invoice.Currency == "" {
+			invoice.Currency = "USD"
+		}
+		if !totals[i] {
+			invoice.Total = lineItemsTotal(invoice.LineItems) + invoice.TaxTotal
+		}
+		for _, msg := range validateInvoice(*invoice) {
+			preview.Errors = append(preview.Errors, RowError{preview.Rows[i][0], "", msg})
+		}
+	}
+
+	return preview
+}
+
+// parseLineItem reads the line item columns of one row. hasItem is false
+// when the row carries no line item at all.
+func parseLineItem(rowNo int, get func(string) string) (item Item, hasItem bool, errs []RowError) {
+	item.ProductID = get("productid")
+	item.Description = get("description")
+	quantity := get("quantity")
+	amount := get("amount")
+
+	if item.ProductID == "" && item.Description == "" && quantity == "" && amount == "" {
+		return item, false, nil
+	}
+
+	if quantity == "" {
+		item.Quantity = 1
+	} else if q, err := strconv.ParseUint(quantity, 10, 16); err != nil {
+		errs = append(errs, RowError{rowNo, "quantity", fmt.Sprintf("%q is not a valid quantity", quantity)})
+	} else {
+		item.Quantity = uint16(q)
+	}
+
+	if amount == "" {
+		errs = append(errs, RowError{rowNo, "amount", "is empty"})
+	} else if a, err := parseCents(amount); err != nil {
+		errs = append(errs, RowError{rowNo, "amount", err.Error()})
+	} else {
+		item.Amount = a
+	}
+
+	return item, true, errs
+}
+
+// isBlankRecord reports whether every column of a CSV record is empty.
+func isBlankRecord(record []string) bool {
+	for _, value := range record {
+		if strings.TrimSpace(value) != "" {
+			return false
+		}
+	}
+	return true
+}
+
+// validateInvoice checks an invoice for problems that would make it unfit
+// to store and returns a message for each one.
+func validateInvoice(invoice Invoice) []string {
+	var msgs []string
+
+	if invoice.Vendor == "" {
+		msgs = append(msgs, "vendor is empty")
+	}
+	if invoice.InvoiceNo == "" {
+		msgs = append(msgs, "invoice number is empty")
+	}
+	if invoice.Date == "" {
+		msgs = append(msgs, fmt.Sprintf("invoice %s has no date", invoice.InvoiceNo))
+	}
+	for i, item := range invoice.LineItems {
+		if item.Quantity == 0 {
+			msgs = append(msgs, fmt.Sprintf("invoice %s line %d has zero quantity", invoice.InvoiceNo, i+1))
+		}
+	}
+	if len(invoice.LineItems) > 0 {
+		if sum := lineItemsTotal(invoice.LineItems) + invoice.TaxTotal; sum != invoice.Total {
+			msgs = append(msgs, fmt.Sprintf("invoice %s total %s does not match line items plus tax %s",
+				invoice.InvoiceNo, formatCents(invoice.Total), formatCents(sum)))
+		}
+	}
+
+	return msgs
+}
+
+// CheckExisting adds an error for each previewed invoice whose vendor and
+// invoice number are already in the DB.
+func (p *ImportPreview) CheckExisting(r Repository) {
+	for i, invoice := range p.Invoices {
+		if r.InvoiceExists(invoice.InvoiceNo, invoice.Vendor) {
+			p.Errors = append(p.Errors, RowError{p.Rows[i][0], "invoiceno",
+				fmt.Sprintf("invoice %s from %s already exists", invoice.InvoiceNo, invoice.Vendor)})
+		}
+	}
+}
+
+// Commit adds the previewed invoices to the DB. Nothing is written if the
+// preview has errors.
+func (p *ImportPreview) Commit(r Repository) (int, error) {
+	if len(p.Errors) > 0 {
+		return 0, fmt.Errorf("import has %d errors, nothing was added", len(p.Errors))
+	}
+
+	for i, invoice := range p.Invoices {
+		if !r.AddInvoice(invoice) {
+			return i, fmt.Errorf("failed to add invoice %s from %s", invoice.InvoiceNo, invoice.Vendor)
+		}
+	}
+
+	return len(p.Invoices), nil
+}
+
+// lineItemsTotal sums quantity times unit price over the line items.
+func lineItemsTotal(items Items) int64 {
+	var total int64
+	for _, item := range items {
+		total += int64(item.Quantity) * item.Amount
+	}
+	return total
+}
+
+// parseCents parses a money string such as "$1,957.33" or "12.5" into
+// integer cents.
+func parseCents(s string) (int64, error) {
+	value := strings.TrimSpace(s)
+	value = strings.NewReplacer("$", "", ",", "", " ", "").Replace(value)
+
+	negative := false
+	if strings.HasPrefix(value, "-") {
+		negative = true
+		value = value[1:]
+	}
+
+	whole, frac := value, ""
+	if i := strings.Index(value, "."); i >= 0 {
+		whole, frac = value[:i], value[i+1:]
+	}
+	if len(frac) > 2 {
+		return 0, fmt.Errorf("%q has more than two decimal places", s)
+	}
+	frac += strings.Repeat("0", 2-len(frac))
+	if whole == "" {
+		whole = "0"
+	}
+
+	cents, err := strconv.ParseInt(whole+frac, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("%q is not a valid amount", s)
+	}
+	if negative {
+		cents = -cents
+	}
+
+	return cents, nil
+}
+
+// formatCents formats integer cents as a dollar string, i.e. 7420 --> $74.20
+func formatCents(cents int64) string {
+	sign := ""
+	if cents < 0 {
+		sign = "-"
+		cents = -cents
+	}
+	return fmt.Sprintf("%s$%d.%02d", sign, cents/100, cents%100)
+}
+
+// parsePaid parses the paid/status column.
+func parsePaid(s string) (bool, error) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "paid", "yes", "y", "true", "t", "1":
+		return true, nil
+	case "not paid", "unpaid", "no", "n", "false", "f", "0":
+		return false, nil
+	}
+	return false, fmt.Errorf("%q is not a valid paid status", s)
+}
+
+// importDateLayouts are the date formats accepted on import.
+var importDateLayouts = []string{"01/02/2006", "1/2/2006", "2006-01-02", "01/02/06", "1/2/06"}
+
+// normalizeDate parses a date in one of importDateLayouts and returns it
+// in the MM/DD/YYYY form used throughout the DB.
+func normalizeDate(s string) (string, error) {
+	for _, layout := range importDateLayouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t.Format("01/02/2006"), nil
+		}
+	}
+	return "", fmt.Errorf("%q is not a valid date", s)
+}
@@ -0,0 +1,77 @@
+// Copyright 2016 Cory Robinson. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE.txt file.
+
+package main
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestCSVRoundTrip(t *testing.T) {
+	invoices := Invoices{
+		{Vendor: "Acme", InvoiceNo: "A-7", Date: "03/01/2018", PurchaseOrder: "PO-9", Total: 11000, TaxTotal: 1000,
+			Currency: "USD", LineItems: Items{{ProductID: "W-1", Description: "widget", Quantity: 4, Amount: 2500}}},
+		{Vendor: "Niche Tools", InvoiceNo: "N-1", Date: "01/05/2018", Total: 1000, Currency: "USD", Paid: true,
+			LineItems: Items{{Description: "hammer", Quantity: 2, Amount: 500}}},
+	}
+
+	var csv bytes.Buffer
+	if err := exportCSV(&csv, invoices); err != nil {
+		t.Fatalf("exportCSV: %v", err)
+	}
+	header, rows, err := ReadCSV(&csv, ',')
+	if err != nil {
+		t.Fatalf("ReadCSV: %v", err)
+	}
+	preview := ParseCSVInvoices(rows, GuessMapping(header))
+	if len(preview.Errors) > 0 {
+		t.Fatalf("ParseCSVInvoices: %v", preview.Errors)
+	}
+	if !reflect.DeepEqual(preview.Invoices, invoices) {
+		t.Errorf("imported\n%+v\nwant\n%+v", preview.Invoices, invoices)
+	}
+}
+
+func TestParseCSVTaxTotal(t *testing.T) {
+	tests := []struct {
+		name      string
+		csv       string
+		total     int64
+		wantError string
+	}{
+		{"total from lines and tax", "vendor,invoiceno,date,tax,qty,price\nAcme,A-1,03/01/2018,1.50,2,10.00\n", 2150, ""},
+		{"total given", "vendor,invoiceno,date,total,taxtotal,amount\nAcme,A-1,03/01/2018,21.50,1.50,20.00\n", 2150, ""},
+		{"tax missing", "vendor,invoiceno,date,total,amount\nAcme,A-1,03/01/2018,21.50,20.00\n", 0, "does not match"},
+		{"tax conflicts", "vendor,invoiceno,date,taxtotal,amount\nAcme,A-1,03/01/2018,1.50,10.00\nAcme,A-1,,1.00,10.00\n", 0, "conflicts"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			header, rows, err := ReadCSV(strings.NewReader(tt.csv), ',')
+			if err != nil {
+				t.Fatalf("ReadCSV: %v", err)
+			}
+			preview := ParseCSVInvoices(rows, GuessMapping(header))
+			var errs []string
+			for _, e := range preview.Errors {
+				errs = append(errs, e.Error())
+			}
+			got := strings.Join(errs, "; ")
+			if tt.wantError != "" {
+				if !strings.Contains(got, tt.wantError) {
+					t.Errorf("errors = %q, want %q", got, tt.wantError)
+				}
+				return
+			}
+			if got != "" {
+				t.Fatalf("errors = %q", got)
+			}
+			if preview.Invoices[0].Total != tt.total {
+				t.Errorf("total = %d, want %d", preview.Invoices[0].Total, tt.total)
+			}
+		})
+	}
+}
@@ -0,0 +1,1013 @@
+// Copyright 2016 Cory Robinson. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE.txt file.
+
+// ctl.go implements invoicectl, the command line tool for scripting invoice
+// operations. It is the app itself run under the name invoicectl (make a
+// link to it with that name), or run with the ctl command, e.g.
+//
+//	invoicectl list -vendor "Niche Electronics" -paid=false -format csv
+//	InvoiceViewer.lex ctl paid 12 13
+//
+// Every subcommand prints as a table, JSON or CSV with -format, and exits
+// with 1 if it fails and 2 if it is used wrongly.
+
+package main
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+)
+
+// ctlFormats are the output formats of invoicectl.
+var ctlFormats = []string{"table", "json", "csv"}
+
+// ctlCommands maps an invoicectl subcommand to the function implementing
+// it, like commands.
+var ctlCommands = map[string]func(args []string) int{
+	"list":    ctlList,
+	"show":    ctlShow,
+	"search":  ctlSearch,
+	"add":     ctlAdd,
+	"update":  ctlUpdate,
+	"delete":  ctlDelete,
+	"paid":    ctlPaid,
+	"counts":  ctlCounts,
+	"profile": ctlProfile,
+	"user":    ctlUser,
+	"key":     ctlKey,
+}
+
+// ctlUsage is printed for invoicectl without a known subcommand.
+const ctlUsage = `usage: invoicectl command [flags] [args]
+
+commands:
+  list    list invoices
+  show    show invoices with their line items
+  search  find invoices by a search query
+  add     add an invoice from flags, or invoices as JSON from stdin
+  update  change an invoice from flags, or from JSON on stdin
+  delete  delete invoices
+  paid    mark invoices paid, or not paid with -unpaid
+  counts  print the number of invoices, vendors and paid invoices
+  profile list, add, change, remove or switch the connection profiles
+  user    list, add, change or remove the user accounts
+  key     manage the keys encrypting invoice fields, and re-encrypt them
+
+Every command works on the database of the active profile, or the profile
+named with -profile before the command or by $INVOICE_PROFILE. Changes are
+made as the user named by $INVOICE_USER with $INVOICE_PASSWORD, or else as
+the user mapped to the OS account.
+
+Run invoicectl command -h for the flags of a command.`
+
+// runCtl runs invoicectl if the app was started under that name. ok is
+// false otherwise.
+func runCtl(argv []string) (code int, ok bool) {
+	if !isCtl(argv) {
+		return 0, false
+	}
+	return ctlCommand(argv[1:]), true
+}
+
+// isCtl reports whether the app was started as invoicectl.
+func isCtl(argv []string) bool {
+	name := strings.TrimSuffix(filepath.Base(argv[0]), filepath.Ext(argv[0]))
+	return name == "invoicectl"
+}
+
+// ctlCommand runs the invoicectl subcommand named by args[0].
+func ctlCommand(args []string) int {
+	if len(args) == 0 || args[0] == "-h" || args[0] == "-help" || args[0] == "help" {
+		fmt.Fprintln(os.Stderr, ctlUsage)
+		return 2
+	}
+	command, ok := ctlCommands[args[0]]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "invoicectl: unknown command %q\n\n%s\n", args[0], ctlUsage)
+		return 2
+	}
+	return command(args[1:])
+}
+
+// newCtlFlags returns the flag set of a subcommand with the -format flag.
+func newCtlFlags(name, usage string) (*flag.FlagSet, *string) {
+	flags := flag.NewFlagSet(name, flag.ContinueOnError)
+	format := flags.String("format", "table", "output format: "+strings.Join(ctlFormats, ", "))
+	flags.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: invoicectl %s [flags] %s\n", name, usage)
+		flags.PrintDefaults()
+	}
+	return flags, format
+}
+
+// parseCtlFlags parses the flags of a subcommand and checks the format and
+// the number of arguments, which is at least minArgs and at most maxArgs
+// (-1 for any number).
+func parseCtlFlags(flags *flag.FlagSet, format *string, args []string, minArgs, maxArgs int) bool {
+	if err := flags.Parse(args); err != nil {
+		return false
+	}
+	if !containsString(ctlFormats, *format) {
+		fmt.Fprintf(os.Stderr, "invoicectl: unknown format %q\n", *format)
+		return false
+	}
+	if flags.NArg() < minArgs || maxArgs >= 0 && flags.NArg() > maxArgs {
+		flags.Usage()
+		return false
+	}
+	return true
+}
+
+// containsString reports whether list contains s.
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// writeCtl writes a result in the format: v as JSON, or the header and
+// rows as a table or CSV.
+func writeCtl(w io.Writer, format string, v interface{}, header []string, rows [][]string) error {
+	switch format {
+	case "json":
+		data, err := json.MarshalIndent(v, "", "  ")
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintln(w, string(data))
+		return err
+	case "csv":
+		cw := csv.NewWriter(w)
+		cw.Write(header)
+		cw.WriteAll(rows)
+		return cw.Error()
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, strings.ToUpper(strings.Join(header, "\t")))
+	for _, row := range rows {
+		fmt.Fprintln(tw, strings.Join(row, "\t"))
+	}
+	return tw.Flush()
+}
+
+// writeCtlInvoices writes a list of invoices, one row per invoice.
+func writeCtlInvoices(format string, invoices Invoices) int {
+	if invoices == nil {
+		invoices = Invoices{}
+	}
+	amount := formatCents
+	if format == "csv" {
+		amount = centsString // plain decimals like the CSV export
+	}
+	rows := make([][]string, len(invoices))
+	for i, invoice := range invoices {
+		rows[i] = []string{strconv.Itoa(invoice.ID), invoice.Vendor, invoice.InvoiceNo, invoice.Date,
+			amount(invoice.Total), strconv.FormatBool(invoice.Paid)}
+	}
+	header := []string{"id", "vendor", "invoice no.", "date", "total", "paid"}
+	if err := writeCtl(os.Stdout, format, invoices, header, rows); err != nil {
+		fmt.Fprintln(os.Stderr, "invoicectl:", err)
+		return 1
+	}
+	return 0
+}
+
+// ctlList lists the invoices selected by the filter flags, without their
+// line items.
+func ctlList(args []string) int {
+	flags, format := newCtlFlags("list", "")
+	vendor := flags.String("vendor", "", "only invoices from this vendor")
+	paid := flags.String("paid", "", "only paid (true) or not paid (false) invoices")
+	from := flags.String("from", "", "only invoices from this date on, MM/DD/YYYY")
+	to := flags.String("to", "", "only invoices up to this date, MM/DD/YYYY")
+	text := flags.String("q", "", "only invoices with this text in the vendor, invoice number or purchase order")
+	if !parseCtlFlags(flags, format, args, 0, 0) {
+		return 2
+	}
+
+	var paidOnly *bool
+	if *paid != "" {
+		b, err := strconv.ParseBool(*paid)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "invoicectl: -paid must be true or false")
+			return 2
+		}
+		paidOnly = &b
+	}
+	filter, err := newInvoiceFilter(*vendor, paidOnly, *from, *to, *text)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "invoicectl:", err)
+		return 2
+	}
+
+	var r Repository
+	var invoices Invoices
+	eachInvoicePage(r, filter.bson(), func(page Invoices) error {
+		invoices = append(invoices, page...)
+		return nil
+	})
+	return writeCtlInvoices(*format, invoices)
+}
+
+// ctlSearch lists the invoices selected by a query in the search syntax of
+// search.go, without their line items. The arguments are joined by spaces, so phrases have to be
+// quoted inside an argument, i.e. 'item:"claw hammer"'.
+func ctlSearch(args []string) int {
+	flags, format := newCtlFlags("search", "query...")
+	if !parseCtlFlags(flags, format, args, 1, -1) {
+		return 2
+	}
+	query, err := ParseSearch(strings.Join(flags.Args(), " "))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "invoicectl:", err)
+		return 2
+	}
+
+	var r Repository
+	var invoices Invoices
+	eachInvoicePage(r, query.Filter(), func(page Invoices) error {
+		invoices = append(invoices, page...)
+		return nil
+	})
+	return writeCtlInvoices(*format, invoices)
+}
+
+// ctlLookup returns the invoices with the IDs, reporting those not found.
+func ctlLookup(r Repository, ids []string) (Invoices, bool) {
+	var invoices Invoices
+	ok := true
+	for _, arg := range ids {
+		id, err := strconv.Atoi(arg)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "invoicectl: invalid invoice id %q\n", arg)
+			ok = false
+			continue
+		}
+		invoice := r.GetInvoiceById(id)
+		if id == 0 || invoice.ID != id {
+			fmt.Fprintf(os.Stderr, "invoicectl: invoice %d not found\n", id)
+			ok = false
+			continue
+		}
+		invoices = append(invoices, invoice)
+	}
+	return invoices, ok
+}
+
+// ctlShow prints invoices with their line items. As CSV the invoices are
+// written like the flat CSV export, one row per line item.
+func ctlShow(args []string) int {
+	flags, format := newCtlFlags("show", "id...")
+	if !parseCtlFlags(flags, format, args, 1, -1) {
+		return 2
+	}
+
+	var r Repository
+	invoices, ok := ctlLookup(r, flags.Args())
+
+	var err error
+	switch *format {
+	case "json":
+		err = writeCtl(os.Stdout, "json", invoices, nil, nil)
+	case "csv":
+		err = ExportInvoices(os.Stdout, invoices, "csv")
+	default:
+		for i, invoice := range invoices {
+			if i > 0 {
+				fmt.Println()
+			}
+			if err = writeCtlInvoice(os.Stdout, invoice); err != nil {
+				break
+			}
+		}
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "invoicectl:", err)
+		return 1
+	}
+	if !ok {
+		return 1
+	}
+	return 0
+}
+
+// writeCtlInvoice writes an invoice and its line items as text.
+func writeCtlInvoice(w io.Writer, invoice Invoice) error {
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintf(tw, "ID:\t%d\n", invoice.ID)
+	fmt.Fprintf(tw, "Vendor:\t%s\n", invoice.Vendor)
+	fmt.Fprintf(tw, "Address:\t%s, %s, %s %s\n", invoice.Address.Street, invoice.Address.City,
+		invoice.Address.State, invoice.Address.Zipcode)
+	fmt.Fprintf(tw, "Invoice No.:\t%s\n", invoice.InvoiceNo)
+	fmt.Fprintf(tw, "Date:\t%s\n", invoice.Date)
+	fmt.Fprintf(tw, "Purchase Order:\t%s\n", invoice.PurchaseOrder)
+	fmt.Fprintf(tw, "Total:\t%s %s\n", formatCents(invoice.Total), invoice.Currency)
+	fmt.Fprintf(tw, "Paid:\t%t\n", invoice.Paid)
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+
+	rows := make([][]string, len(invoice.LineItems))
+	for i, item := range invoice.LineItems {
+		rows[i] = []string{item.ProductID, item.Description, strconv.Itoa(int(item.Quantity)), formatCents(item.Amount)}
+	}
+	fmt.Fprintln(w)
+	return writeCtl(w, "table", nil, []string{"product id", "description", "quantity", "unit price"}, rows)
+}
+
+// ctlItems is a flag collecting line items given as
+// "description,quantity,unit price[,product id]".
+type ctlItems Items
+
+// String implements flag.Value.
+func (items *ctlItems) String() string {
+	return ""
+}
+
+// Set implements flag.Value.
+func (items *ctlItems) Set(value string) error {
+	fields := strings.Split(value, ",")
+	if len(fields) < 3 || len(fields) > 4 {
+		return errors.New(`want "description,quantity,unit price[,product id]"`)
+	}
+	quantity, err := strconv.ParseUint(strings.TrimSpace(fields[1]), 10, 16)
+	if err != nil {
+		return fmt.Errorf("invalid quantity %q", fields[1])
+	}
+	amount, err := parseCents(fields[2])
+	if err != nil {
+		return err
+	}
+	item := Item{Description: strings.TrimSpace(fields[0]), Quantity: uint16(quantity), Amount: amount}
+	if len(fields) == 4 {
+		item.ProductID = strings.TrimSpace(fields[3])
+	}
+	*items = append(*items, item)
+	return nil
+}
+
+// ctlInvoiceFlags are the flags setting the fields of an invoice, for add
+// and update.
+type ctlInvoiceFlags struct {
+	vendor, invoiceNo, date, purchaseOrder, total, tax, currency string
+	street, city, state, zipcode                                 string
+	paid                                                         bool
+	items                                                        ctlItems
+	json                                                         bool
+}
+
+// define adds the flags to the flag set.
+func (f *ctlInvoiceFlags) define(flags *flag.FlagSet) {
+	flags.StringVar(&f.vendor, "vendor", "", "vendor name")
+	flags.StringVar(&f.invoiceNo, "invoiceno", "", "invoice number")
+	flags.StringVar(&f.date, "date", "", "invoice date")
+	flags.StringVar(&f.purchaseOrder, "po", "", "purchase order")
+	flags.StringVar(&f.total, "total", "", "total, i.e. 74.20 (default line items plus tax)")
+	flags.StringVar(&f.tax, "tax", "", "tax included in the total")
+	flags.StringVar(&f.currency, "currency", "", "currency code (default USD for add)")
+	flags.StringVar(&f.street, "street", "", "vendor street address")
+	flags.StringVar(&f.city, "city", "", "vendor city")
+	flags.StringVar(&f.state, "state", "", "vendor state")
+	flags.StringVar(&f.zipcode, "zip", "", "vendor zip code")
+	flags.BoolVar(&f.paid, "paid", false, "invoice is paid")
+	flags.Var(&f.items, "item", `line item "description,quantity,unit price[,product id]", repeatable; replaces the line items on update`)
+	flags.BoolVar(&f.json, "json", false, "read the invoice as JSON from stdin, the flags are applied on top")
+}
+
+// apply sets the fields of the invoice whose flags were given.
+func (f *ctlInvoiceFlags) apply(flags *flag.FlagSet, invoice *Invoice) error {
+	var err error
+	flags.Visit(func(fl *flag.Flag) {
+		if err != nil {
+			return
+		}
+		switch fl.Name {
+		case "vendor":
+			invoice.Vendor = f.vendor
+		case "invoiceno":
+			invoice.InvoiceNo = f.invoiceNo
+		case "date":
+			invoice.Date, err = normalizeDate(f.date)
+		case "po":
+			invoice.PurchaseOrder = f.purchaseOrder
+		case "tax":
+			invoice.TaxTotal, err = parseCents(f.tax)
+		case "currency":
+			invoice.Currency = f.currency
+		case "street":
+			invoice.Address.Street = f.street
+		case "city":
+			invoice.Address.City = f.city
+		case "state":
+			invoice.Address.State = f.state
+		case "zip":
+			invoice.Address.Zipcode = f.zipcode
+		case "paid":
+			invoice.Paid = f.paid
+		case "item":
+			invoice.LineItems = Items(f.items)
+		}
+	})
+	if err != nil {
+		return err
+	}
+
+	// the total last, as its default depends on the items and tax
+	switch {
+	case f.isSet(flags, "total"):
+		invoice.Total, err = parseCents(f.total)
+	case f.isSet(flags, "item") || f.isSet(flags, "tax"):
+		invoice.Total = lineItemsTotal(invoice.LineItems) + invoice.TaxTotal
+	}
+	return err
+}
+
+// isSet reports whether the flag was given.
+func (f *ctlInvoiceFlags) isSet(flags *flag.FlagSet, name string) bool {
+	set := false
+	flags.Visit(func(fl *flag.Flag) {
+		if fl.Name == name {
+			set = true
+		}
+	})
+	return set
+}
+
+// readCtlInvoices reads an invoice, or an array of invoices, as JSON.
+func readCtlInvoices(r io.Reader) (Invoices, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	data = []byte(strings.TrimSpace(string(data)))
+	if strings.HasPrefix(string(data), "[") {
+		var invoices Invoices
+		err = json.Unmarshal(data, &invoices)
+		return invoices, err
+	}
+	var invoice Invoice
+	err = json.Unmarshal(data, &invoice)
+	return Invoices{invoice}, err
+}
+
+// ctlAdd adds an invoice from the flags, or the invoices read as JSON from
+// stdin. Nothing is added if any invoice is invalid or exists already.
+func ctlAdd(args []string) int {
+	flags, format := newCtlFlags("add", "")
+	var f ctlInvoiceFlags
+	f.define(flags)
+	if !parseCtlFlags(flags, format, args, 0, 0) {
+		return 2
+	}
+
+	invoices := Invoices{{Currency: "USD"}}
+	if f.json {
+		var err error
+		if invoices, err = readCtlInvoices(os.Stdin); err != nil {
+			fmt.Fprintln(os.Stderr, "invoicectl: invalid JSON:", err)
+			return 1
+		}
+	}
+
+	var r Repository
+	var problems []string
+	for i := range invoices {
+		if err := f.apply(flags, &invoices[i]); err != nil {
+			fmt.Fprintln(os.Stderr, "invoicectl:", err)
+			return 2
+		}
+		problems = append(problems, validateInvoice(invoices[i])...)
+		if r.InvoiceExists(invoices[i].InvoiceNo, invoices[i].Vendor) {
+			problems = append(problems, fmt.Sprintf("invoice %s from %s already exists", invoices[i].InvoiceNo, invoices[i].Vendor))
+		}
+	}
+	if len(problems) > 0 {
+		for _, problem := range problems {
+			fmt.Fprintln(os.Stderr, "invoicectl:", problem)
+		}
+		fmt.Fprintln(os.Stderr, "invoicectl: nothing was added")
+		return 1
+	}
+
+	var added Invoices
+	for _, invoice := range invoices {
+		if !r.AddInvoice(invoice) {
+			fmt.Fprintf(os.Stderr, "invoicectl: failed to add invoice %s from %s\n", invoice.InvoiceNo, invoice.Vendor)
+			writeCtlInvoices(*format, added)
+			return 1
+		}
+		added = append(added, r.GetInvoiceByInvoiceNoAndVendor(invoice.InvoiceNo, invoice.Vendor))
+	}
+	return writeCtlInvoices(*format, added)
+}
+
+// ctlUpdate changes the fields of an invoice given by the flags, or read as
+// JSON from stdin. Fields missing from the JSON are left as they are.
+func ctlUpdate(args []string) int {
+	flags, format := newCtlFlags("update", "id")
+	var f ctlInvoiceFlags
+	f.define(flags)
+	if !parseCtlFlags(flags, format, args, 1, 1) {
+		return 2
+	}
+
+	var r Repository
+	found, ok := ctlLookup(r, flags.Args())
+	if !ok {
+		return 1
+	}
+	current := found[0]
+
+	invoice := current
+	if f.json {
+		if err := json.NewDecoder(os.Stdin).Decode(&invoice); err != nil {
+			fmt.Fprintln(os.Stderr, "invoicectl: invalid JSON:", err)
+			return 1
+		}
+		invoice.ID = current.ID
+	}
+	if err := f.apply(flags, &invoice); err != nil {
+		fmt.Fprintln(os.Stderr, "invoicectl:", err)
+		return 2
+	}
+
+	problems := validateInvoice(invoice)
+	if (invoice.InvoiceNo != current.InvoiceNo || invoice.Vendor != current.Vendor) &&
+		r.InvoiceExists(invoice.InvoiceNo, invoice.Vendor) {
+		problems = append(problems, fmt.Sprintf("invoice %s from %s already exists", invoice.InvoiceNo, invoice.Vendor))
+	}
+	if len(problems) > 0 {
+		for _, problem := range problems {
+			fmt.Fprintln(os.Stderr, "invoicectl:", problem)
+		}
+		return 1
+	}
+
+	if !r.UpdateInvoice(invoice) {
+		fmt.Fprintf(os.Stderr, "invoicectl: failed to update invoice %d\n", invoice.ID)
+		return 1
+	}
+	return writeCtlInvoices(*format, Invoices{invoice})
+}
+
+// ctlDelete deletes the invoices with the IDs.
+func ctlDelete(args []string) int {
+	flags := flag.NewFlagSet("delete", flag.ContinueOnError)
+	flags.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: invoicectl delete id...")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if flags.NArg() == 0 {
+		flags.Usage()
+		return 2
+	}
+
+	var r Repository
+	code := 0
+	for _, arg := range flags.Args() {
+		id, err := strconv.Atoi(arg)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "invoicectl: invalid invoice id %q\n", arg)
+			code = 1
+			continue
+		}
+		switch r.DeleteInvoice(id) {
+		case "OK":
+		case "NOT FOUND":
+			fmt.Fprintf(os.Stderr, "invoicectl: invoice %d not found\n", id)
+			code = 1
+		case "FORBIDDEN":
+			fmt.Fprintf(os.Stderr, "invoicectl: %v\n", r.Authorize(ActionDelete))
+			code = 1
+		default:
+			fmt.Fprintf(os.Stderr, "invoicectl: failed to delete invoice %d\n", id)
+			code = 1
+		}
+	}
+	return code
+}
+
+// ctlPaid marks the invoices with the IDs paid, or not paid with -unpaid.
+func ctlPaid(args []string) int {
+	flags, format := newCtlFlags("paid", "id...")
+	unpaid := flags.Bool("unpaid", false, "mark the invoices not paid")
+	if !parseCtlFlags(flags, format, args, 1, -1) {
+		return 2
+	}
+
+	var r Repository
+	invoices, ok := ctlLookup(r, flags.Args())
+	var changed Invoices
+	for _, invoice := range invoices {
+		invoice.Paid = !*unpaid
+		if !r.UpdateInvoice(invoice) {
+			fmt.Fprintf(os.Stderr, "invoicectl: failed to update invoice %d\n", invoice.ID)
+			ok = false
+			continue
+		}
+		changed = append(changed, invoice)
+	}
+
+	if code := writeCtlInvoices(*format, changed); code != 0 || !ok {
+		return 1
+	}
+	return 0
+}
+
+// ctlCounts prints the number of invoices, vendors and paid invoices.
+func ctlCounts(args []string) int {
+	flags, format := newCtlFlags("counts", "")
+	if !parseCtlFlags(flags, format, args, 0, 0) {
+		return 2
+	}
+
+	var r Repository
+	counts := APICounts{
+		Invoices: r.RecordCount(),
+		Vendors:  r.CountVendors(),
+		Paid:     r.CountPaidTrue(),
+		Unpaid:   r.CountPaidFalse(),
+	}
+	row := []string{strconv.Itoa(counts.Invoices), strconv.Itoa(counts.Vendors),
+		strconv.Itoa(counts.Paid), strconv.Itoa(counts.Unpaid)}
+	if err := writeCtl(os.Stdout, *format, counts, []string{"invoices", "vendors", "paid", "unpaid"}, [][]string{row}); err != nil {
+		fmt.Fprintln(os.Stderr, "invoicectl:", err)
+		return 1
+	}
+	return 0
+}
+
+// ctlProfile lists, adds, changes, removes or switches the connection
+// profiles, see profiles.go.
+func ctlProfile(args []string) int {
+	usage := func() int {
+		fmt.Fprintln(os.Stderr, "usage: invoicectl profile list|show|add|update|remove|use [flags] [name]")
+		return 2
+	}
+	if len(args) == 0 {
+		return usage()
+	}
+
+	flags, format := newCtlFlags("profile "+args[0], "[name]")
+	name := flags.String("name", "", "update: new name of the profile")
+	backend := flags.String("backend", "", "add, update: kind of DB server: "+strings.Join(backends, ", "))
+	uri := flags.String("uri", "", "add, update: URL of the server, without the password")
+	database := flags.String("db", "", "add, update: name of the database")
+	collection := flags.String("collection", "", "add, update: name of the invoices collection")
+	credentials := flags.String("credentials", "", "add, update: where the password is, env:VARIABLE or file:path")
+	maxArgs := 1
+	if args[0] == "list" {
+		maxArgs = 0
+	}
+	if !parseCtlFlags(flags, format, args[1:], 0, maxArgs) {
+		return 2
+	}
+
+	ps, err := readProfiles()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "invoicectl:", err)
+		return 1
+	}
+	arg := flags.Arg(0)
+	if arg == "" && args[0] != "list" && args[0] != "show" {
+		return usage()
+	}
+
+	switch args[0] {
+	case "list", "show":
+		list := ps.Profiles
+		if arg != "" {
+			p, ok := ps.find(arg)
+			if !ok {
+				fmt.Fprintf(os.Stderr, "invoicectl: there is no profile named %s\n", arg)
+				return 1
+			}
+			list = []ConnectionProfile{p}
+		} else if args[0] == "show" {
+			list = []ConnectionProfile{ps.active()}
+		}
+		return writeCtlProfiles(*format, ps, list)
+	case "add", "update":
+		p := ConnectionProfile{Name: arg, Backend: backends[0], Collection: defaultCollection}
+		if args[0] == "update" {
+			var ok bool
+			if p, ok = ps.find(arg); !ok {
+				fmt.Fprintf(os.Stderr, "invoicectl: there is no profile named %s\n", arg)
+				return 1
+			}
+		} else if _, ok := ps.find(arg); ok {
+			fmt.Fprintf(os.Stderr, "invoicectl: there is a profile named %s already\n", arg)
+			return 1
+		}
+		old := p.Name
+		flags.Visit(func(f *flag.Flag) {
+			switch f.Name {
+			case "name":
+				p.Name = *name
+			case "backend":
+				p.Backend = *backend
+			case "uri":
+				p.URI = *uri
+			case "db":
+				p.Database = *database
+			case "collection":
+				p.Collection = *collection
+			case "credentials":
+				p.Credentials = *credentials
+			}
+		})
+		if args[0] == "add" {
+			old = ""
+		}
+		ps, err = ps.save(old, p)
+	case "remove":
+		ps, err = ps.remove(arg)
+	case "use":
+		ps, err = ps.use(arg)
+	default:
+		return usage()
+	}
+	if err == nil {
+		err = writeProfiles(ps)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "invoicectl:", err)
+		return 1
+	}
+	return 0
+}
+
+// writeCtlProfiles writes connection profiles, one row per profile.
+func writeCtlProfiles(format string, ps Profiles, list []ConnectionProfile) int {
+	active := ps.active().Name
+	rows := make([][]string, len(list))
+	for i, p := range list {
+		mark := ""
+		if p.Name == active {
+			mark = "*"
+		}
+		rows[i] = []string{mark, p.Name, p.Backend, p.URI, p.Database, p.Collection, p.Credentials}
+	}
+	header := []string{"active", "name", "backend", "uri", "database", "collection", "credentials"}
+	if err := writeCtl(os.Stdout, format, list, header, rows); err != nil {
+		fmt.Fprintln(os.Stderr, "invoicectl:", err)
+		return 1
+	}
+	return 0
+}
+
+// ctlUser lists, adds, changes or removes the user accounts, see users.go.
+// Passwords are read from the first line of stdin, never from flags.
+func ctlUser(args []string) int {
+	usage := func() int {
+		fmt.Fprintln(os.Stderr, "usage: invoicectl user list|add|update|passwd|remove [flags] [name]")
+		return 2
+	}
+	if len(args) == 0 {
+		return usage()
+	}
+
+	flags, format := newCtlFlags("user "+args[0], "[name]")
+	name := flags.String("name", "", "update: new name of the user")
+	role := flags.String("role", "", "add, update: viewer, clerk, approver or admin")
+	osUser := flags.String("osuser", "", "add, update: OS account logging in as the user without a password")
+	password := flags.Bool("password", false, "add, update: read a password from stdin (passwd always does)")
+	disabled := flags.String("disabled", "", "update: true to stop the user from logging in, false to let them again")
+	maxArgs := 1
+	if args[0] == "list" {
+		maxArgs = 0
+	}
+	if !parseCtlFlags(flags, format, args[1:], 0, maxArgs) {
+		return 2
+	}
+	arg := flags.Arg(0)
+	if arg == "" && args[0] != "list" {
+		return usage()
+	}
+
+	var r Repository
+	users, err := r.GetUsers()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "invoicectl:", err)
+		return 1
+	}
+	var u User
+	found := false
+	for _, user := range users {
+		if user.Name == arg {
+			u, found = user, true
+		}
+	}
+
+	switch args[0] {
+	case "list":
+		rows := make([][]string, len(users))
+		for i, user := range users {
+			rows[i] = []string{user.Name, string(user.Role), user.OSUser,
+				strconv.FormatBool(len(user.PasswordHash) > 0), strconv.FormatBool(user.Disabled)}
+		}
+		if users == nil {
+			users = []User{}
+		}
+		header := []string{"name", "role", "os user", "password", "disabled"}
+		if err := writeCtl(os.Stdout, *format, users, header, rows); err != nil {
+			fmt.Fprintln(os.Stderr, "invoicectl:", err)
+			return 1
+		}
+		return 0
+	case "add":
+		if found {
+			fmt.Fprintf(os.Stderr, "invoicectl: there is a user named %s already\n", arg)
+			return 1
+		}
+		u = User{Name: arg, Role: RoleViewer}
+	case "update", "passwd", "remove":
+		if !found {
+			fmt.Fprintf(os.Stderr, "invoicectl: there is no user named %s\n", arg)
+			return 1
+		}
+	default:
+		return usage()
+	}
+
+	if args[0] == "remove" {
+		err = r.DeleteUser(arg)
+	} else {
+		flags.Visit(func(f *flag.Flag) {
+			switch f.Name {
+			case "name":
+				u.Name = *name
+			case "role":
+				u.Role = Role(*role)
+			case "osuser":
+				u.OSUser = *osUser
+			case "disabled":
+				u.Disabled, err = strconv.ParseBool(*disabled)
+			}
+		})
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "invoicectl: -disabled must be true or false")
+			return 2
+		}
+		if *password || args[0] == "passwd" {
+			err = setCtlPassword(&u)
+		}
+		if err == nil {
+			old := arg
+			if args[0] == "add" {
+				old = ""
+			}
+			err = r.SaveUser(old, u)
+		}
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "invoicectl:", err)
+		return 1
+	}
+	return 0
+}
+
+// setCtlPassword sets the password of the user to the first line of stdin.
+func setCtlPassword(u *User) error {
+	line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && err != io.EOF {
+		return err
+	}
+	return u.setPassword(strings.TrimRight(line, "\r\n"))
+}
+
+// ctlKey lists, creates, rotates or removes the master keys of the
+// keyfile, and re-encrypts the invoices with the active key, see
+// encryption.go.
+func ctlKey(args []string) int {
+	usage := func() int {
+		fmt.Fprintln(os.Stderr, "usage: invoicectl key list|init|rotate|reencrypt|remove [flags] [id]")
+		return 2
+	}
+	if len(args) == 0 {
+		return usage()
+	}
+
+	flags, format := newCtlFlags("key "+args[0], "[id]")
+	maxArgs := 0
+	if args[0] == "remove" {
+		maxArgs = 1
+	}
+	if !parseCtlFlags(flags, format, args[1:], maxArgs, maxArgs) {
+		return 2
+	}
+
+	kr, ok, err := readKeyring()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "invoicectl:", err)
+		return 1
+	}
+	if !ok && args[0] != "init" && args[0] != "list" {
+		fmt.Fprintln(os.Stderr, "invoicectl: there is no keyfile, run invoicectl key init first")
+		return 1
+	}
+
+	var r Repository
+	if args[0] == "init" || args[0] == "rotate" || args[0] == "remove" {
+		if err := r.Authorize(ActionManageKeys); err != nil {
+			fmt.Fprintln(os.Stderr, "invoicectl:", err)
+			return 1
+		}
+	}
+	switch args[0] {
+	case "list":
+		return writeCtlKeys(*format, kr)
+	case "init":
+		if ok {
+			fmt.Fprintln(os.Stderr, "invoicectl: there is a keyfile already, use invoicectl key rotate for a new key")
+			return 1
+		}
+		kr, err = kr.rotate()
+	case "rotate":
+		kr, err = kr.rotate()
+	case "reencrypt":
+		n, err := r.ReencryptInvoices()
+		fmt.Printf("%d invoices and drafts re-encrypted\n", n)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "invoicectl:", err)
+			return 1
+		}
+		return 0
+	case "remove":
+		id := flags.Arg(0)
+		var counts map[string]int
+		if counts, err = r.CountEncrypted(); err == nil {
+			kr, err = kr.remove(id, counts)
+		}
+	default:
+		return usage()
+	}
+	if err == nil {
+		err = writeKeyring(kr)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "invoicectl:", err)
+		return 1
+	}
+	if args[0] != "remove" {
+		fmt.Println("active key:", kr.Active)
+	}
+	return 0
+}
+
+// writeCtlKeys writes the master keys, without the keys themselves, with
+// the number of invoices and drafts encrypted with each if the DB can be
+// reached.
+func writeCtlKeys(format string, kr Keyring) int {
+	type keyInfo struct {
+		ID        string `json:"id"`
+		Created   string `json:"created"`
+		Active    bool   `json:"active"`
+		Documents int    `json:"documents"`
+	}
+	var r Repository
+	counts, err := r.CountEncrypted()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "warning:", err)
+	}
+
+	infos := []keyInfo{}
+	rows := [][]string{}
+	for _, k := range kr.Keys {
+		info := keyInfo{ID: k.ID, Created: k.Created, Active: k.ID == kr.Active, Documents: counts[k.ID]}
+		infos = append(infos, info)
+		mark := ""
+		if info.Active {
+			mark = "*"
+		}
+		rows = append(rows, []string{mark, info.ID, info.Created, strconv.Itoa(info.Documents)})
+	}
+	if n := counts[""]; n > 0 {
+		infos = append(infos, keyInfo{ID: "", Documents: n})
+		rows = append(rows, []string{"", "(plain)", "", strconv.Itoa(n)})
+	}
+	header := []string{"active", "id", "created", "documents"}
+	if err := writeCtl(os.Stdout, format, infos, header, rows); err != nil {
+		fmt.Fprintln(os.Stderr, "invoicectl:", err)
+		return 1
+	}
+	return 0
+}
@@ -16,6 +16,7 @@ package main
 
 import (
 	"fmt"
+	"os"
 	"strconv"
 	"strings"
 	//"time"
@@ -44,6 +45,7 @@ type Dialog struct {
 	purchaseOrderLabel *widgets.QLabel
 	totalLabel         *widgets.QLabel
 	currencyLabel      *widgets.QLabel
+	noteLabel          *widgets.QLabel
 
 	vendorEditor        *widgets.QLineEdit
 	streetEditor        *widgets.QLineEdit
@@ -62,7 +64,11 @@ type Dialog struct {
 	resetButton  *widgets.QPushButton
 	closeButton  *widgets.QPushButton
 
-	mwin MainWindow
+	// set when the dialog is prefilled from a PDF or a draft, see prefill()
+	draft      Invoice
+	sourceFile string
+
+	submitted bool // an invoice was added
 }
 
 // init() initializes dialog with default button functionality.
@@ -143,11 +149,15 @@ func (d *Dialog) createCounterGroupBox() *widgets.QGroupBox {
 	d.counterIdLabel = widgets.NewQLabel2("7", nil, 0)
 	d.dateTimeLabel = widgets.NewQLabel2("05/25/2018 7:01 AM CST", nil, 0)
 	d.hashLabel = widgets.NewQLabel2("hncw98e57towg4fn", nil, 0)
+	d.noteLabel = widgets.NewQLabel(nil, 0)
+	d.noteLabel.SetWordWrap(true)
+	d.noteLabel.Hide()
 
 	layout := widgets.NewQGridLayout2()
 	layout.AddWidget(d.dateTimeLabel, 0, 0, 0)
 	layout.AddWidget(d.hashLabel, 1, 0, 0)
 	layout.AddWidget(d.counterIdLabel, 0, 1, 0)
+	layout.AddWidget3(d.noteLabel, 2, 0, 1, 2, 0)
 	box.SetLayout(layout)
 
 	return box
@@ -236,13 +246,13 @@ func (d *Dialog) createRightGroupBox() *widgets.QGroupBox {
 	d.dateEditor = widgets.NewQLineEdit(nil)
 	d.purchaseOrderEditor = widgets.NewQLineEdit(nil)
 	d.totalEditor = widgets.NewQLineEdit(nil)
-	d.currencyEditor = widgets.NewQLineEdit2("USD", nil)
+	d.currencyEditor = widgets.NewQLineEdit2(newCurrency, nil)
 
 	d.invoiceNoEditor.SetPlaceholderText("123456789")
 	d.dateEditor.SetPlaceholderText("MM/DD/YYY")
 	d.purchaseOrderEditor.SetPlaceholderText("ab-987654321-yz")
 	d.totalEditor.SetPlaceholderText("123.45")
-	d.currencyEditor.SetText("USD")
+	d.currencyEditor.SetText(newCurrency)
 
 	layout := widgets.NewQGridLayout2()
 	layout.AddWidget(d.invoiceNoLabel, 0, 0, 0)
@@ -281,7 +291,9 @@ func (d *Dialog) createButtonBox() *widgets.QDialogButtonBox {
 	return box
 }
 
-// submit() slot for submitting new invoice to DB.
+// submit() slot for submitting new invoice to DB. The fields the form does
+// not show, such as the due date, buyer and tax categories, are kept from
+// the draft the dialog was prefilled with.
 func (d *Dialog) submit() {
 	var (
 		liProductID   string
@@ -289,11 +301,9 @@ func (d *Dialog) submit() {
 		liQuantity    uint16
 		//liPrice       int64
 		total  int64
-		paid   bool
 		price  string
 		stotal string
 
-		item  Item
 		items Items
 
 		r Repository
@@ -317,6 +327,11 @@ func (d *Dialog) submit() {
 			fmt.Println("Failed to convert string to int64: ", err)
 		}
 
+		// the row of a prefilled line item keeps its unit and tax
+		var item Item
+		if i < len(d.draft.LineItems) {
+			item = d.draft.LineItems[i]
+		}
 		item.ProductID = liProductID
 		item.Description = liDescription
 		item.Quantity = liQuantity
@@ -325,12 +340,6 @@ func (d *Dialog) submit() {
 		items = append(items, item)
 	}
 
-	address := Location{d.streetEditor.Text(),
-		d.cityEditor.Text(),
-		d.stateEditor.Text(),
-		d.zipcodeEditor.Text(),
-	}
-
 	stotal = d.totalEditor.Text()
 	splitTotal := strings.Split(stotal, ".")
 	stotal = strings.Join(splitTotal, "")
@@ -339,23 +348,38 @@ func (d *Dialog) submit() {
 		fmt.Println("Failed to convert string to int64: ", err)
 	}
 
-	paid = false
-
-	invoice := Invoice{r.maxID(),
-		d.vendorEditor.Text(),
-		address,
-		items,
-		d.invoiceNoEditor.Text(),
-		d.dateEditor.Text(),
-		d.purchaseOrderEditor.Text(),
-		total,
-		d.currencyEditor.Text(),
-		paid,
+	invoice := d.draft
+	invoice.ID = r.maxID()
+	invoice.Vendor = d.vendorEditor.Text()
+	invoice.Address.Street = d.streetEditor.Text()
+	invoice.Address.City = d.cityEditor.Text()
+	invoice.Address.State = d.stateEditor.Text()
+	invoice.Address.Zipcode = d.zipcodeEditor.Text()
+	invoice.LineItems = items
+	invoice.InvoiceNo = d.invoiceNoEditor.Text()
+	invoice.Date = d.dateEditor.Text()
+	invoice.PurchaseOrder = d.purchaseOrderEditor.Text()
+	invoice.Total = total
+	invoice.Currency = d.currencyEditor.Text()
+
+	// add invoice to db and reset the dialog, the main window sees the new
+	// invoice through its change notifications. If it cannot be added, the
+	// dialog stays as it is to try again.
+	if _, err := r.authorizeInvoice(invoice, nil); err != nil {
+		widgets.QMessageBox_Warning(d, "Add Invoice", fmt.Sprintf("Failed to add the invoice: %v", err),
+			widgets.QMessageBox__Ok, widgets.QMessageBox__Ok)
+		return
+	}
+	if !r.AddInvoice(invoice) {
+		widgets.QMessageBox_Warning(d, "Add Invoice",
+			"Failed to add the invoice. Check that the invoice database can be reached and try again.",
+			widgets.QMessageBox__Ok, widgets.QMessageBox__Ok)
+		return
+	}
+	d.submitted = true
+	if d.sourceFile != "" {
+		d.attachSourceFile(r, invoice)
 	}
-
-	// add invoice to db then update MainWindow data items and reset the dialog
-	r.AddInvoice(invoice)
-	d.mwin.setVendorView()
 	d.reset()
 	d.Accepted()
 }
@@ -374,6 +398,10 @@ func (d *Dialog) reset() {
 	d.purchaseOrderEditor.Clear()
 	d.totalEditor.Clear()
 	d.currencyEditor.Clear()
+	d.noteLabel.Clear()
+	d.noteLabel.Hide()
+	d.draft = Invoice{}
+	d.sourceFile = ""
 
 	d.vendorEditor.SetPlaceholderText("Vendor Name")
 	d.streetEditor.SetPlaceholderText("123 Main St.")
@@ -384,5 +412,55 @@ func (d *Dialog) reset() {
 	d.dateEditor.SetPlaceholderText("MM/DD/YYY")
 	d.purchaseOrderEditor.SetPlaceholderText("ab-987654321-yz")
 	d.totalEditor.SetPlaceholderText("123.45")
-	d.currencyEditor.SetText("USD")
+	d.currencyEditor.SetText(newCurrency)
+}
+
+// prefill() fills the form with an invoice read from a PDF file or a
+// draft for review, with a note on where it came from and any problems
+// found. Set sourceFile to attach the file when the invoice is submitted.
+func (d *Dialog) prefill(invoice Invoice, title, note string) {
+	d.draft = invoice
+
+	d.vendorEditor.SetText(invoice.Vendor)
+	d.streetEditor.SetText(invoice.Address.Street)
+	d.cityEditor.SetText(invoice.Address.City)
+	d.stateEditor.SetText(invoice.Address.State)
+	d.zipcodeEditor.SetText(invoice.Address.Zipcode)
+	d.invoiceNoEditor.SetText(invoice.InvoiceNo)
+	d.dateEditor.SetText(invoice.Date)
+	d.purchaseOrderEditor.SetText(invoice.PurchaseOrder)
+	d.totalEditor.SetText(dialogAmount(invoice.Total))
+	d.currencyEditor.SetText(invoice.Currency)
+
+	d.lineItemsTable.ClearContentsDefault()
+	d.lineItemsTable.SetRowCount(max(len(invoice.LineItems), 1))
+	for i, item := range invoice.LineItems {
+		values := []string{item.ProductID, item.Description, strconv.Itoa(int(item.Quantity)), dialogAmount(item.Amount)}
+		for j, value := range values {
+			d.lineItemsTable.SetItem(i, j, widgets.NewQTableWidgetItem2(value, 0))
+		}
+	}
+
+	d.noteLabel.SetText(note)
+	d.noteLabel.Show()
+	d.SetWindowTitle(title)
+}
+
+// attachSourceFile() attaches the PDF the dialog was prefilled from to the
+// invoice just added.
+func (d *Dialog) attachSourceFile(r Repository, invoice Invoice) {
+	data, err := os.ReadFile(d.sourceFile)
+	if err == nil {
+		invoice = r.GetInvoiceByInvoiceNoAndVendor(invoice.InvoiceNo, invoice.Vendor)
+		_, err = r.AddAttachment(&invoice, d.sourceFile, data)
+	}
+	if err != nil {
+		fmt.Println("Failed to attach the PDF:", err)
+	}
+}
+
+// dialogAmount formats integer cents the way the form expects amounts,
+// i.e. 7420 --> 74.20
+func dialogAmount(cents int64) string {
+	return strings.Replace(formatCents(cents), "$", "", 1)
 }
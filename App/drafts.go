@@ -0,0 +1,134 @@
+// Copyright 2016 Cory Robinson. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE.txt file.
+
+// drafts.go implements the queue of draft invoices: invoices read from
+// sources that need a review before they are added, such as email. A
+// draft keeps the invoice as read, with its attachments already in the
+// attachment store, and the problems found. Reviewing a draft opens it in
+// the Add Invoice dialog; the draft is deleted once the invoice is added.
+
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// DRAFTS is the name of the collection of draft invoices in DB.
+const DRAFTS = "drafts"
+
+// Draft is an invoice waiting for review.
+type Draft struct {
+	ID       bson.ObjectId `bson:"_id" json:"id"`
+	Invoice  Invoice       `json:"invoice"`
+	Source   string        `json:"source"`   // where the draft came from, i.e. the email
+	Format   string        `json:"format"`   // format or extraction template the invoice was read with
+	Problems []string      `json:"problems"` // found when reading the invoice
+	Received string        `json:"received"` // MM/DD/YYYY
+	AddedBy  string        `json:"addedby,omitempty"`
+}
+
+// AddDraft adds a draft invoice to the queue.
+func (r Repository) AddDraft(draft Draft) error {
+	db := currentDB()
+	user, err := r.authorize(ActionAdd)
+	if err != nil {
+		return err
+	}
+	draft.AddedBy = user.Name
+
+	session, err := mgo.Dial(db.Server)
+	if err != nil {
+		return err
+	}
+	defer session.Close()
+
+	if draft.ID == "" {
+		draft.ID = bson.NewObjectId()
+	}
+	if draft.Received == "" {
+		draft.Received = time.Now().Format("01/02/2006")
+	}
+	return session.DB(db.Name).C(DRAFTS).Insert(draft)
+}
+
+// GetDrafts returns the draft invoices, oldest first.
+func (r Repository) GetDrafts() []Draft {
+	db := currentDB()
+	session, err := mgo.Dial(db.Server)
+
+	if err != nil {
+		fmt.Println("Failed to establish connection to Mongo server:", err)
+	}
+
+	defer session.Close()
+
+	c := session.DB(db.Name).C(DRAFTS)
+	var results []Draft
+
+	if err := c.Find(nil).Sort("_id").All(&results); err != nil {
+		fmt.Println("Failed to write results:", err)
+	}
+
+	return results
+}
+
+// CountDrafts returns the number of draft invoices.
+func (r Repository) CountDrafts() int {
+	db := currentDB()
+	session, err := mgo.Dial(db.Server)
+
+	if err != nil {
+		fmt.Println("Failed to establish connection to Mongo server:", err)
+	}
+
+	defer session.Close()
+
+	c := session.DB(db.Name).C(DRAFTS)
+	var result int
+
+	result, err = c.Find(nil).Count()
+	if err != nil {
+		fmt.Println("Failed to write results:", err)
+	}
+
+	return result
+}
+
+// DeleteDraft removes a draft from the queue, and the content of its
+// attachments that nothing else refers to.
+func (r Repository) DeleteDraft(draft Draft) error {
+	db := currentDB()
+	if err := r.Authorize(ActionAdd); err != nil {
+		return err
+	}
+
+	session, err := mgo.Dial(db.Server)
+	if err != nil {
+		return err
+	}
+	defer session.Close()
+
+	if err := session.DB(db.Name).C(DRAFTS).RemoveId(draft.ID); err != nil {
+		return err
+	}
+
+	for _, attachment := range draft.Invoice.Attachments {
+		if r.countAttachmentUses(attachment.Hash) == 0 {
+			if err := r.attachmentStore().Delete(attachment.Hash); err != nil {
+				fmt.Println("Failed to delete attachment:", err)
+			}
+		}
+	}
+	return nil
+}
+
+// AttachmentSeen reports whether an invoice or a draft has the content
+// with hash attached, i.e. an email that was read before.
+func (r Repository) AttachmentSeen(hash string) bool {
+	return r.countAttachmentUses(hash) != 0
+}
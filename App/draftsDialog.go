@@ -0,0 +1,154 @@
+// Copyright 2016 Cory Robinson. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE.txt file.
+
+// draftsDialog.go implements the File > Review Drafts dialog listing the
+// draft invoices waiting for review, see drafts.go. Reviewing a draft
+// opens it in the Add Invoice dialog, and the draft is deleted once the
+// invoice has been submitted.
+
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/therecipe/qt/widgets"
+)
+
+type DraftsDialog struct {
+	widgets.QDialog
+
+	draftsTable *widgets.QTableWidget
+
+	reviewButton *widgets.QPushButton
+	deleteButton *widgets.QPushButton
+	closeButton  *widgets.QPushButton
+
+	drafts []Draft
+	added  int // number of invoices added from drafts
+
+	model Repository
+}
+
+// initWith() initializes the dialog layout and lists the drafts.
+func (d *DraftsDialog) initWith(parent *widgets.QWidget) {
+	d.draftsTable = widgets.NewQTableWidget2(0, 6, nil)
+	d.draftsTable.SetHorizontalHeaderLabels(
+		[]string{"Received", "Vendor", "Invoice No", "Total", "Source", "Problems"})
+	d.draftsTable.SetSelectionBehavior(widgets.QAbstractItemView__SelectRows)
+	d.draftsTable.SetSelectionMode(widgets.QAbstractItemView__SingleSelection)
+	d.draftsTable.SetEditTriggers(widgets.QAbstractItemView__NoEditTriggers)
+	d.draftsTable.HorizontalHeader().SetSectionResizeMode2(4, widgets.QHeaderView__Stretch)
+	d.draftsTable.ConnectCellDoubleClicked(func(row, column int) { d.review() })
+
+	buttonBox := widgets.NewQDialogButtonBox(nil)
+	d.reviewButton = widgets.NewQPushButton2("&Review...", nil)
+	d.deleteButton = widgets.NewQPushButton2("&Delete", nil)
+	d.closeButton = widgets.NewQPushButton2("&Close", nil)
+	d.reviewButton.SetDefault(true)
+	d.reviewButton.ConnectClicked(func(bool) { d.review() })
+	d.deleteButton.ConnectClicked(func(bool) { d.delete() })
+	d.closeButton.ConnectClicked(func(bool) { d.Accept() })
+	buttonBox.AddButton(d.reviewButton, widgets.QDialogButtonBox__ActionRole)
+	buttonBox.AddButton(d.deleteButton, widgets.QDialogButtonBox__ActionRole)
+	buttonBox.AddButton(d.closeButton, widgets.QDialogButtonBox__RejectRole)
+
+	layout := widgets.NewQVBoxLayout()
+	layout.AddWidget(d.draftsTable, 0, 0)
+	layout.AddWidget(buttonBox, 0, 0)
+	d.SetLayout(layout)
+
+	d.showDrafts()
+
+	d.Resize2(850, 400)
+	d.SetWindowTitle("Review Drafts")
+}
+
+// showDrafts() fills the table with the drafts in the queue.
+func (d *DraftsDialog) showDrafts() {
+	d.drafts = d.model.GetDrafts()
+
+	d.draftsTable.ClearContents()
+	d.draftsTable.SetRowCount(len(d.drafts))
+	for i, draft := range d.drafts {
+		values := []string{
+			draft.Received,
+			draft.Invoice.Vendor,
+			draft.Invoice.InvoiceNo,
+			formatCents(draft.Invoice.Total),
+			draft.Source,
+			strings.Join(draft.Problems, "; "),
+		}
+		for j, value := range values {
+			item := widgets.NewQTableWidgetItem2(value, 0)
+			item.SetToolTip(value)
+			d.draftsTable.SetItem(i, j, item)
+		}
+	}
+	d.draftsTable.ResizeColumnsToContents()
+
+	hasDrafts := len(d.drafts) > 0
+	d.reviewButton.SetEnabled(hasDrafts)
+	d.deleteButton.SetEnabled(hasDrafts)
+	if hasDrafts {
+		d.draftsTable.SelectRow(0)
+	}
+}
+
+// currentDraft() returns the selected draft.
+func (d *DraftsDialog) currentDraft() (Draft, bool) {
+	row := d.draftsTable.CurrentRow()
+	if row < 0 || row >= len(d.drafts) {
+		return Draft{}, false
+	}
+	return d.drafts[row], true
+}
+
+// review() opens the selected draft in the Add Invoice dialog, and deletes
+// it once the invoice has been added.
+func (d *DraftsDialog) review() {
+	draft, ok := d.currentDraft()
+	if !ok {
+		return
+	}
+
+	note := fmt.Sprintf("%v, read as %v. Check every field before submitting.", draft.Source, draft.Format)
+	if len(draft.Problems) > 0 {
+		note += "\n" + strings.Join(draft.Problems, "\n")
+	}
+
+	dialog := NewDialog(nil, 0)
+	dialog.initWith(d.QWidget_PTR())
+	dialog.prefill(draft.Invoice, "Review Draft", note)
+	dialog.Exec()
+
+	if dialog.submitted {
+		if err := d.model.DeleteDraft(draft); err != nil {
+			fmt.Println("Failed to delete draft:", err)
+		}
+		d.added++
+		d.showDrafts()
+	}
+}
+
+// delete() removes the selected draft from the queue after asking.
+func (d *DraftsDialog) delete() {
+	draft, ok := d.currentDraft()
+	if !ok {
+		return
+	}
+
+	answer := widgets.QMessageBox_Question(d, "Delete Draft",
+		fmt.Sprintf("Delete the draft from %v?\nIts attachments are deleted as well.", draft.Source),
+		widgets.QMessageBox__Yes|widgets.QMessageBox__No, widgets.QMessageBox__No)
+	if answer != widgets.QMessageBox__Yes {
+		return
+	}
+
+	if err := d.model.DeleteDraft(draft); err != nil {
+		widgets.QMessageBox_Warning(d, "Delete Draft", fmt.Sprintf("Failed to delete the draft: %v", err),
+			widgets.QMessageBox__Ok, widgets.QMessageBox__Ok)
+	}
+	d.showDrafts()
+}
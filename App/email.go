@@ -0,0 +1,511 @@
+// Copyright 2016 Cory Robinson. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE.txt file.
+
+// email.go reads invoices sent as email attachments. Messages are read
+// from .eml files, mbox archives or Maildir directories. Every attachment
+// that may hold an invoice is read with the importers of formats.go, or
+// for a PDF without Factur-X XML with the extraction templates of
+// extraction.go. Each invoice found is queued as a draft with the email
+// and the attachment attached to it; the sender is matched to a known
+// vendor where the attachment does not name one.
+//
+// An email is only read once: messages whose content is already attached
+// to an invoice or a draft are skipped.
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// Email is an email message with its attachments.
+type Email struct {
+	From        *mail.Address // nil if the sender cannot be parsed
+	Subject     string
+	Date        string // MM/DD/YYYY, "" if unknown
+	Raw         []byte
+	Attachments []PDFAttachment
+}
+
+// EmailResult is the outcome of reading the invoices of one email.
+type EmailResult struct {
+	Email    *Email
+	Drafts   int      // number of drafts queued
+	Skipped  string   // why the email was skipped, if it was
+	Problems []string // problems of the attachments
+}
+
+// emailInvoiceExts are the extensions of attachments that may hold an
+// invoice.
+var emailInvoiceExts = map[string]bool{".pdf": true, ".xml": true, ".edi": true, ".x12": true, ".json": true, ".csv": true}
+
+// emailSecondLevel are the second level domains of country domains that
+// are not the name of the sender, as in acme.co.uk.
+var emailSecondLevel = map[string]bool{"co": true, "com": true, "net": true, "org": true, "ac": true, "gov": true}
+
+// emailWordDecoder decodes RFC 2047 encoded words in headers.
+var emailWordDecoder = &mime.WordDecoder{}
+
+// mboxFrom matches the "From " line starting a message in an mbox archive
+// and mboxQuoted a line of a message that was escaped for it.
+var (
+	mboxFrom   = regexp.MustCompile(`(?m)^From .*\r?\n`)
+	mboxQuoted = regexp.MustCompile(`(?m)^>(>*From )`)
+)
+
+// ReadEmails reads the messages of an .eml file, an mbox archive or a
+// Maildir directory.
+func ReadEmails(name string) ([]*Email, error) {
+	info, err := os.Stat(name)
+	if err != nil {
+		return nil, err
+	}
+	if info.IsDir() {
+		return readMaildir(name)
+	}
+
+	data, err := os.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+	if bytes.HasPrefix(data, []byte("From ")) {
+		return readMbox(data)
+	}
+	email, err := ParseEmail(data)
+	if err != nil {
+		return nil, err
+	}
+	return []*Email{email}, nil
+}
+
+// readMbox splits an mbox archive into its messages. Both the mboxo and
+// mboxrd escaping of "From " lines is undone.
+func readMbox(data []byte) ([]*Email, error) {
+	starts := mboxFrom.FindAllIndex(data, -1)
+
+	var emails []*Email
+	for i, start := range starts {
+		end := len(data)
+		if i+1 < len(starts) {
+			end = starts[i+1][0]
+		}
+		raw := mboxQuoted.ReplaceAll(data[start[1]:end], []byte("$1"))
+
+		email, err := ParseEmail(raw)
+		if err != nil {
+			return emails, fmt.Errorf("message %d: %v", i+1, err)
+		}
+		emails = append(emails, email)
+	}
+	return emails, nil
+}
+
+// readMaildir reads the messages in the new and cur folders of a Maildir,
+// in the order of their file names.
+func readMaildir(dir string) ([]*Email, error) {
+	var names []string
+	for _, folder := range []string{"new", "cur"} {
+		entries, err := os.ReadDir(filepath.Join(dir, folder))
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return nil, err
+		}
+		for _, entry := range entries {
+			if !entry.IsDir() && !strings.HasPrefix(entry.Name(), ".") {
+				names = append(names, filepath.Join(dir, folder, entry.Name()))
+			}
+		}
+	}
+	if names == nil {
+		if _, err := os.Stat(filepath.Join(dir, "cur")); err != nil {
+			return nil, fmt.Errorf("%s is not a Maildir", dir)
+		}
+	}
+	sort.Slice(names, func(i, j int) bool { return filepath.Base(names[i]) < filepath.Base(names[j]) })
+
+	var emails []*Email
+	for _, name := range names {
+		data, err := os.ReadFile(name)
+		if err != nil {
+			return emails, err
+		}
+		email, err := ParseEmail(data)
+		if err != nil {
+			return emails, fmt.Errorf("%s: %v", name, err)
+		}
+		emails = append(emails, email)
+	}
+	return emails, nil
+}
+
+// ParseEmail parses a message and collects its attachments, including
+// those of attached messages.
+func ParseEmail(raw []byte) (*Email, error) {
+	msg, err := mail.ReadMessage(bytes.NewReader(raw))
+	if err != nil {
+		return nil, err
+	}
+
+	email := &Email{Raw: raw}
+	parser := mail.AddressParser{WordDecoder: emailWordDecoder}
+	if from, err := parser.Parse(msg.Header.Get("From")); err == nil {
+		email.From = from
+	}
+	email.Subject = decodeEmailHeader(msg.Header.Get("Subject"))
+	if date, err := msg.Header.Date(); err == nil {
+		email.Date = date.Format("01/02/2006")
+	}
+
+	err = email.readPart(headerFields(msg.Header), msg.Body, 0)
+	return email, err
+}
+
+// headerFields returns the header fields of a message the way multipart
+// parts have them.
+func headerFields(header mail.Header) map[string][]string {
+	return map[string][]string(header)
+}
+
+// emailMaxDepth limits the nesting of multiparts and attached messages.
+const emailMaxDepth = 10
+
+// readPart adds the attachments in a part of the message.
+func (email *Email) readPart(header map[string][]string, body io.Reader, depth int) error {
+	get := func(key string) string {
+		if values := header[key]; len(values) > 0 {
+			return values[0]
+		}
+		return ""
+	}
+
+	mediaType, params, err := mime.ParseMediaType(get("Content-Type"))
+	if err != nil {
+		mediaType, params = "text/plain", nil
+	}
+
+	if strings.HasPrefix(mediaType, "multipart/") && depth < emailMaxDepth {
+		reader := multipart.NewReader(body, params["boundary"])
+		for {
+			part, err := reader.NextRawPart()
+			if err == io.EOF {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+			if err := email.readPart(part.Header, part, depth+1); err != nil {
+				return err
+			}
+		}
+	}
+
+	data, err := io.ReadAll(decodeTransferEncoding(get("Content-Transfer-Encoding"), body))
+	if err != nil {
+		return err
+	}
+
+	if mediaType == "message/rfc822" && depth < emailMaxDepth {
+		if msg, err := mail.ReadMessage(bytes.NewReader(data)); err == nil {
+			return email.readPart(headerFields(msg.Header), msg.Body, depth+1)
+		}
+	}
+
+	name := ""
+	if _, dispParams, err := mime.ParseMediaType(get("Content-Disposition")); err == nil {
+		name = dispParams["filename"]
+	}
+	if name == "" {
+		name = params["name"]
+	}
+	if name == "" {
+		return nil // the text of the message
+	}
+	email.Attachments = append(email.Attachments, PDFAttachment{Name: decodeEmailHeader(name), Data: data})
+	return nil
+}
+
+// decodeTransferEncoding decodes a part's content transfer encoding.
+func decodeTransferEncoding(encoding string, body io.Reader) io.Reader {
+	switch strings.ToLower(strings.TrimSpace(encoding)) {
+	case "base64":
+		// line breaks are skipped by the decoder, other junk is not
+		return base64.NewDecoder(base64.StdEncoding, &base64Filter{bufio.NewReader(body)})
+	case "quoted-printable":
+		return quotedprintable.NewReader(body)
+	}
+	return body
+}
+
+// base64Filter drops the characters that are not base64 from a reader.
+type base64Filter struct {
+	r *bufio.Reader
+}
+
+// Read implements io.Reader.
+func (f *base64Filter) Read(p []byte) (int, error) {
+	n := 0
+	for n < len(p) {
+		c, err := f.r.ReadByte()
+		if err != nil {
+			if n > 0 && err == io.EOF {
+				return n, nil
+			}
+			return n, err
+		}
+		if c >= 'A' && c <= 'Z' || c >= 'a' && c <= 'z' || c >= '0' && c <= '9' || c == '+' || c == '/' || c == '=' {
+			p[n] = c
+			n++
+		}
+	}
+	return n, nil
+}
+
+// decodeEmailHeader decodes RFC 2047 encoded words, leaving the header as
+// it is if they cannot be decoded.
+func decodeEmailHeader(s string) string {
+	decoded, err := emailWordDecoder.DecodeHeader(s)
+	if err != nil {
+		return s
+	}
+	return decoded
+}
+
+// FromString returns the sender for display.
+func (email *Email) FromString() string {
+	if email.From == nil {
+		return "unknown sender"
+	}
+	return email.From.String()
+}
+
+// FileName returns a file name for the message when it is attached to
+// an invoice, made from its subject.
+func (email *Email) FileName() string {
+	name := strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) || r == '-' || r == '_' || r == ' ' {
+			return r
+		}
+		return '_'
+	}, strings.TrimSpace(email.Subject))
+	if runes := []rune(name); len(runes) > 60 {
+		name = string(runes[:60])
+	}
+	if name == "" {
+		name = "email"
+	}
+	return name + ".eml"
+}
+
+// normalizeVendorName reduces a vendor name to lower case letters and
+// digits, dropping common company suffixes, to compare names loosely.
+func normalizeVendorName(name string) string {
+	fields := strings.FieldsFunc(strings.ToLower(name), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	for len(fields) > 1 {
+		switch fields[len(fields)-1] {
+		case "inc", "llc", "ltd", "co", "corp", "corporation", "company", "gmbh", "ag", "sa", "plc":
+			fields = fields[:len(fields)-1]
+			continue
+		}
+		break
+	}
+	return strings.Join(fields, "")
+}
+
+// MatchVendor returns the known vendor an email address belongs to, or ""
+// if there is none. The display name is compared with the vendor names
+// first, then the domain of the address, i.e. billing@niche-electronics.com
+// is matched to "Niche Electronics".
+func MatchVendor(from *mail.Address, vendors []string) string {
+	if from == nil {
+		return ""
+	}
+
+	name := normalizeVendorName(from.Name)
+	domain := ""
+	if at := strings.LastIndex(from.Address, "@"); at >= 0 {
+		labels := strings.Split(strings.ToLower(from.Address[at+1:]), ".")
+		if n := len(labels); n >= 3 && len(labels[n-1]) == 2 && emailSecondLevel[labels[n-2]] {
+			domain = normalizeVendorName(labels[n-3]) // acme.co.uk
+		} else if n >= 2 {
+			domain = normalizeVendorName(labels[n-2])
+		}
+	}
+
+	for _, vendor := range vendors {
+		v := normalizeVendorName(vendor)
+		if v != "" && name != "" && (name == v || len(v) >= 4 && strings.Contains(name, v)) {
+			return vendor
+		}
+	}
+	for _, vendor := range vendors {
+		v := normalizeVendorName(vendor)
+		if v != "" && len(domain) >= 4 && (domain == v || strings.HasPrefix(v, domain)) {
+			return vendor
+		}
+	}
+	return ""
+}
+
+// isEmailInvoiceAttachment reports whether an attachment may hold an
+// invoice.
+func isEmailInvoiceAttachment(attachment PDFAttachment) bool {
+	return emailInvoiceExts[strings.ToLower(filepath.Ext(attachment.Name))] ||
+		bytes.HasPrefix(attachment.Data, []byte("%PDF-"))
+}
+
+// EmailImporter queues the invoices of emails as drafts.
+type EmailImporter struct {
+	Repository Repository
+	Templates  []ExtractionTemplate
+	DryRun     bool // read and report only, queue nothing
+
+	vendors []string
+}
+
+// NewEmailImporter returns an importer using the known vendors of the
+// repository to match senders.
+func NewEmailImporter(r Repository, templates []ExtractionTemplate) *EmailImporter {
+	return &EmailImporter{Repository: r, Templates: templates, vendors: r.GetInvoiceVendors()}
+}
+
+// Import reads the invoices of an email and queues them as drafts.
+func (im *EmailImporter) Import(email *Email) EmailResult {
+	result := EmailResult{Email: email}
+
+	var candidates []PDFAttachment
+	for _, attachment := range email.Attachments {
+		if isEmailInvoiceAttachment(attachment) {
+			candidates = append(candidates, attachment)
+		}
+	}
+	if len(candidates) == 0 {
+		result.Skipped = "no invoice attachments"
+		return result
+	}
+
+	emailAttachment := newAttachment(email.FileName(), email.Raw)
+	if !im.DryRun && im.Repository.AttachmentSeen(emailAttachment.Hash) {
+		result.Skipped = "already read"
+		return result
+	}
+
+	vendor := MatchVendor(email.From, im.vendors)
+	source := fmt.Sprintf("Email from %s: %s", email.FromString(), email.Subject)
+
+	var drafts []Draft
+	for _, attachment := range candidates {
+		format, invoices, problems, err := im.read(attachment)
+		if err != nil {
+			// still queued, so the attachment is not lost
+			invoices = Invoices{{}}
+			problems = []string{err.Error()}
+		}
+		for i := range invoices {
+			draft := Draft{
+				Invoice:  invoices[i],
+				Source:   source + " (" + attachment.Name + ")",
+				Format:   format,
+				Problems: append([]string(nil), problems...),
+				Received: email.Date,
+			}
+			im.matchVendor(&draft, vendor)
+			if draft.Invoice.InvoiceNo != "" && im.Repository.InvoiceExists(draft.Invoice.InvoiceNo, draft.Invoice.Vendor) {
+				draft.Problems = append(draft.Problems, fmt.Sprintf("invoice %s of %s already exists", draft.Invoice.InvoiceNo, draft.Invoice.Vendor))
+			}
+			drafts = append(drafts, draft)
+		}
+		for _, problem := range problems {
+			result.Problems = append(result.Problems, attachment.Name+": "+problem)
+		}
+	}
+
+	if im.DryRun {
+		result.Drafts = len(drafts)
+		return result
+	}
+
+	stored, err := im.Repository.StoreAttachment(email.FileName(), email.Raw)
+	if err != nil {
+		result.Skipped = fmt.Sprintf("failed to store the email: %v", err)
+		return result
+	}
+	for _, attachment := range candidates {
+		file, err := im.Repository.StoreAttachment(attachment.Name, attachment.Data)
+		if err != nil {
+			result.Skipped = fmt.Sprintf("failed to store %s: %v", attachment.Name, err)
+			return result
+		}
+		for i := range drafts {
+			if strings.HasSuffix(drafts[i].Source, "("+attachment.Name+")") {
+				drafts[i].Invoice.Attachments = []Attachment{stored, file}
+			}
+		}
+	}
+
+	for _, draft := range drafts {
+		if err := im.Repository.AddDraft(draft); err != nil {
+			result.Problems = append(result.Problems, fmt.Sprintf("failed to queue draft: %v", err))
+			continue
+		}
+		result.Drafts++
+	}
+	return result
+}
+
+// read reads the invoices of an attachment. A PDF without Factur-X XML is
+// read with the extraction templates.
+func (im *EmailImporter) read(attachment PDFAttachment) (string, Invoices, []string, error) {
+	format, invoices, problems, err := ReadInvoicesData(attachment.Name, attachment.Data)
+	if format != "Factur-X" || err == nil {
+		return format, invoices, problems, err
+	}
+
+	pages, err := ExtractPDFText(attachment.Data)
+	if err != nil {
+		return "PDF", nil, nil, err
+	}
+	text := strings.Join(pages, "\n")
+	if strings.TrimSpace(text) == "" {
+		return "PDF", nil, nil, errors.New("the PDF has no text, it may be a scanned document")
+	}
+	extracted := ExtractInvoice(text, im.Templates)
+	return "PDF, " + extracted.Template + " template", Invoices{extracted.Invoice}, extracted.Problems, nil
+}
+
+// matchVendor sets the vendor of a draft to the vendor the sender was
+// matched to, unless the invoice names a known vendor itself.
+func (im *EmailImporter) matchVendor(draft *Draft, vendor string) {
+	invoice := &draft.Invoice
+	if vendor == "" || normalizeVendorName(invoice.Vendor) == normalizeVendorName(vendor) {
+		return
+	}
+	for _, known := range im.vendors {
+		if normalizeVendorName(invoice.Vendor) == normalizeVendorName(known) {
+			return
+		}
+	}
+	if invoice.Vendor != "" {
+		draft.Problems = append(draft.Problems, fmt.Sprintf("vendor %q replaced by %q, the vendor of the sender", invoice.Vendor, vendor))
+	}
+	invoice.Vendor = vendor
+}
@@ -0,0 +1,467 @@
+// Copyright 2016 Cory Robinson. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE.txt file.
+
+// encryption.go implements the encryption at rest of the sensitive fields
+// of invoices: the addresses, tax and legal IDs and bank accounts of the
+// vendor and the buyer. There is no collection of vendors; their details
+// are those kept on their invoices.
+//
+// The fields are encrypted with AES-256-GCM by a data key of their own for
+// every document, and the data key is kept on the document encrypted by a
+// master key from the keyfile, keys.json in the config directory of the app
+// or $INVOICE_KEYFILE. Rotating the master key adds a new one for documents
+// written from then on; the re-encrypt command moves the documents written
+// before onto it. Without a keyfile, invoices are written in plain.
+//
+// Invoices are encrypted as they are written to the DB and decrypted as
+// they are read, by the GetBSON and SetBSON methods mgo calls, so that the
+// repository and everything using it sees them in plain. The encrypted
+// fields cannot be searched or sorted by the DB.
+
+package main
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// KEYFILE is the name of the file of the master keys.
+const KEYFILE = "keys.json"
+
+// encryptedPrefix starts the value of an encrypted field, followed by the
+// nonce and sealed value in base64.
+const encryptedPrefix = "enc1:"
+
+// MasterKey is a key of the keyfile, which encrypts the data keys.
+type MasterKey struct {
+	ID      string `json:"id"`
+	Key     []byte `json:"key"` // 32 bytes, base64 in the file
+	Created string `json:"created"`
+}
+
+// Keyring is the content of the keyfile: the master keys, and the ID of the
+// one new documents are encrypted with.
+type Keyring struct {
+	Active string      `json:"active"`
+	Keys   []MasterKey `json:"keys"`
+}
+
+// find returns the key with the ID.
+func (kr Keyring) find(id string) (MasterKey, bool) {
+	for _, k := range kr.Keys {
+		if k.ID == id {
+			return k, true
+		}
+	}
+	return MasterKey{}, false
+}
+
+// rotate returns the keyring with a new key, which is active.
+func (kr Keyring) rotate() (Keyring, error) {
+	k := MasterKey{Key: make([]byte, 32), Created: time.Now().UTC().Format(time.RFC3339)}
+	id := make([]byte, 4)
+	if _, err := io.ReadFull(rand.Reader, k.Key); err != nil {
+		return kr, err
+	}
+	if _, err := io.ReadFull(rand.Reader, id); err != nil {
+		return kr, err
+	}
+	k.ID = hex.EncodeToString(id)
+
+	kr.Keys = append(append([]MasterKey(nil), kr.Keys...), k)
+	kr.Active = k.ID
+	return kr, nil
+}
+
+// remove returns the keyring without the key with the ID. The active key
+// cannot be removed, nor a key documents are still encrypted with, by the
+// counts of CountEncrypted.
+func (kr Keyring) remove(id string, counts map[string]int) (Keyring, error) {
+	if _, ok := kr.find(id); !ok {
+		return kr, fmt.Errorf("there is no key %s", id)
+	}
+	if id == kr.Active {
+		return kr, errors.New("the active key cannot be removed, rotate it first")
+	}
+	if n := counts[id]; n > 0 {
+		return kr, fmt.Errorf("%d invoices and drafts are encrypted with key %s, run the key reencrypt command first", n, id)
+	}
+	var kept []MasterKey
+	for _, k := range kr.Keys {
+		if k.ID != id {
+			kept = append(kept, k)
+		}
+	}
+	kr.Keys = kept
+	return kr, nil
+}
+
+// keyfilePath returns the path of the keyfile.
+func keyfilePath() (string, error) {
+	if name := os.Getenv("INVOICE_KEYFILE"); name != "" {
+		return name, nil
+	}
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "InvoiceViewer", KEYFILE), nil
+}
+
+// readKeyring reads the keyfile. ok is false if there is none.
+func readKeyring() (kr Keyring, ok bool, err error) {
+	name, err := keyfilePath()
+	if err != nil {
+		return kr, false, err
+	}
+	data, err := os.ReadFile(name)
+	if os.IsNotExist(err) {
+		return kr, false, nil
+	}
+	if err != nil {
+		return kr, false, err
+	}
+	if err := json.Unmarshal(data, &kr); err != nil {
+		return kr, false, fmt.Errorf("%s: %v", name, err)
+	}
+	for _, k := range kr.Keys {
+		if len(k.Key) != 32 {
+			return kr, false, fmt.Errorf("%s: key %s is not 32 bytes long", name, k.ID)
+		}
+	}
+	if _, found := kr.find(kr.Active); !found {
+		return kr, false, fmt.Errorf("%s: there is no active key %q", name, kr.Active)
+	}
+	return kr, true, nil
+}
+
+// writeKeyring writes the keyfile, readable by the user only.
+func writeKeyring(kr Keyring) error {
+	name, err := keyfilePath()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(name), 0700); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(kr, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(name, append(data, '\n'), 0600); err != nil {
+		return err
+	}
+	masterKeys.forget()
+	return nil
+}
+
+// masterKeys caches the keyfile. It is read again for a key it lacks, i.e. one
+// rotated in by invoicectl while the app runs.
+var masterKeys keyCache
+
+type keyCache struct {
+	mu     sync.Mutex
+	loaded bool
+	ring   Keyring
+	ok     bool
+}
+
+// forget makes the cache read the keyfile again.
+func (c *keyCache) forget() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.loaded = false
+}
+
+// load returns the keyring, reading the keyfile the first time.
+func (c *keyCache) load(reload bool) (Keyring, bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.loaded || reload {
+		ring, ok, err := readKeyring()
+		if err != nil {
+			return ring, false, err
+		}
+		c.ring, c.ok, c.loaded = ring, ok, true
+	}
+	return c.ring, c.ok, nil
+}
+
+// active returns the key new documents are encrypted with. ok is false if
+// there is no keyfile.
+func (c *keyCache) active() (k MasterKey, ok bool, err error) {
+	ring, ok, err := c.load(false)
+	if err != nil || !ok {
+		return k, false, err
+	}
+	k, _ = ring.find(ring.Active)
+	return k, true, nil
+}
+
+// key returns the key with the ID.
+func (c *keyCache) key(id string) (MasterKey, error) {
+	for _, reload := range []bool{false, true} {
+		ring, _, err := c.load(reload)
+		if err != nil {
+			return MasterKey{}, err
+		}
+		if k, ok := ring.find(id); ok {
+			return k, nil
+		}
+	}
+	return MasterKey{}, fmt.Errorf("key %s is not in the keyfile", id)
+}
+
+// sealValue encrypts plaintext with AES-GCM, the nonce put in front.
+func sealValue(key, plaintext, additional []byte) ([]byte, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, gcm.NonceSize(), gcm.NonceSize()+len(plaintext)+gcm.Overhead())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+	return gcm.Seal(nonce, nonce, plaintext, additional), nil
+}
+
+// openValue decrypts what sealValue encrypted.
+func openValue(key, sealed, additional []byte) ([]byte, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(sealed) < gcm.NonceSize() {
+		return nil, errors.New("the encrypted value is cut short")
+	}
+	nonce, ciphertext := sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():]
+	return gcm.Open(nil, nonce, ciphertext, additional)
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// Envelope is the data key of a document, encrypted by the master key
+// with the ID.
+type Envelope struct {
+	KeyID   string `bson:"keyid"`
+	DataKey []byte `bson:"datakey"`
+}
+
+// sensitiveField is a field of an invoice kept encrypted.
+type sensitiveField struct {
+	path  string // in the DB, which the encryption is bound to
+	value *string
+}
+
+// sensitiveFields returns the fields of the invoice kept encrypted.
+func sensitiveFields(invoice *Invoice) []sensitiveField {
+	party := func(addressPath, idsPath string, address *Location, ids *PartyIDs) []sensitiveField {
+		return []sensitiveField{
+			{addressPath + ".street", &address.Street},
+			{addressPath + ".city", &address.City},
+			{addressPath + ".state", &address.State},
+			{addressPath + ".zipcode", &address.Zipcode},
+			{idsPath + ".taxid", &ids.TaxID},
+			{idsPath + ".legalid", &ids.LegalID},
+			{idsPath + ".bankaccount", &ids.BankAccount},
+		}
+	}
+	return append(party("address", "vendorids", &invoice.Address, &invoice.VendorIDs),
+		party("buyer.address", "buyer.ids", &invoice.Buyer.Address, &invoice.Buyer.IDs)...)
+}
+
+// invoiceDocument is an invoice as kept in the DB. It is a type of its own
+// so that mgo marshals it without the methods of Invoice.
+type invoiceDocument Invoice
+
+// sealedInvoice is an invoice as kept in the DB with its data key.
+type sealedInvoice struct {
+	Invoice invoiceDocument `bson:",inline"`
+	Crypt   *Envelope       `bson:"crypt,omitempty"`
+}
+
+// GetBSON returns the invoice to be written to the DB, its sensitive fields
+// encrypted by a new data key if there is a keyfile.
+func (invoice Invoice) GetBSON() (interface{}, error) {
+	master, ok, err := masterKeys.active()
+	if err != nil {
+		return nil, fmt.Errorf("invoice %d not written: %v", invoice.ID, err)
+	}
+	if !ok {
+		return sealedInvoice{Invoice: invoiceDocument(invoice)}, nil
+	}
+
+	dataKey := make([]byte, 32)
+	if _, err := io.ReadFull(rand.Reader, dataKey); err != nil {
+		return nil, err
+	}
+	envelope := &Envelope{KeyID: master.ID}
+	if envelope.DataKey, err = sealValue(master.Key, dataKey, []byte(master.ID)); err != nil {
+		return nil, err
+	}
+	for _, field := range sensitiveFields(&invoice) {
+		if *field.value == "" {
+			continue
+		}
+		sealed, err := sealValue(dataKey, []byte(*field.value), []byte(field.path))
+		if err != nil {
+			return nil, err
+		}
+		*field.value = encryptedPrefix + base64.StdEncoding.EncodeToString(sealed)
+	}
+	return sealedInvoice{Invoice: invoiceDocument(invoice), Crypt: envelope}, nil
+}
+
+// SetBSON reads an invoice from the DB, decrypting its sensitive fields.
+func (invoice *Invoice) SetBSON(raw bson.Raw) error {
+	var doc sealedInvoice
+	if err := raw.Unmarshal(&doc); err != nil {
+		return err
+	}
+	*invoice = Invoice(doc.Invoice)
+
+	var dataKey []byte
+	for _, field := range sensitiveFields(invoice) {
+		if !strings.HasPrefix(*field.value, encryptedPrefix) {
+			continue
+		}
+		if dataKey == nil {
+			var err error
+			if dataKey, err = openDataKey(doc.Crypt); err != nil {
+				return fmt.Errorf("invoice %d: %v", invoice.ID, err)
+			}
+		}
+		sealed, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(*field.value, encryptedPrefix))
+		if err == nil {
+			var value []byte
+			value, err = openValue(dataKey, sealed, []byte(field.path))
+			*field.value = string(value)
+		}
+		if err != nil {
+			return fmt.Errorf("invoice %d: cannot decrypt %s: %v", invoice.ID, field.path, err)
+		}
+	}
+	return nil
+}
+
+// openDataKey returns the data key of a document.
+func openDataKey(envelope *Envelope) ([]byte, error) {
+	if envelope == nil {
+		return nil, errors.New("encrypted fields were read without their data key")
+	}
+	master, err := masterKeys.key(envelope.KeyID)
+	if err != nil {
+		return nil, err
+	}
+	dataKey, err := openValue(master.Key, envelope.DataKey, []byte(envelope.KeyID))
+	if err != nil {
+		return nil, fmt.Errorf("cannot decrypt the data key with key %s: %v", envelope.KeyID, err)
+	}
+	return dataKey, nil
+}
+
+// CountEncrypted returns the number of invoices and drafts encrypted with
+// each master key, "" for those in plain.
+func (r Repository) CountEncrypted() (map[string]int, error) {
+	db := currentDB()
+	session, err := mgo.Dial(db.Server)
+	if err != nil {
+		return nil, err
+	}
+	defer session.Close()
+
+	counts := map[string]int{}
+	for _, c := range []struct{ name, field string }{{db.Collection, "crypt.keyid"}, {DRAFTS, "invoice.crypt.keyid"}} {
+		var results []struct {
+			ID    string `bson:"_id"`
+			Count int    `bson:"count"`
+		}
+		pipeline := []bson.M{{"$group": bson.M{"_id": bson.M{"$ifNull": []interface{}{"$" + c.field, ""}}, "count": bson.M{"$sum": 1}}}}
+		if err := session.DB(db.Name).C(c.name).Pipe(pipeline).All(&results); err != nil {
+			return nil, err
+		}
+		for _, result := range results {
+			counts[result.ID] += result.Count
+		}
+	}
+	return counts, nil
+}
+
+// ReencryptInvoices writes the invoices and drafts not encrypted with the
+// active master key again, so that they are, and returns how many were
+// written. The keys they were encrypted with can be removed afterwards.
+// Neither the invoices nor the change log record it as a change.
+func (r Repository) ReencryptInvoices() (int, error) {
+	db := currentDB()
+	if _, err := r.authorize(ActionManageKeys); err != nil {
+		return 0, err
+	}
+	master, ok, err := masterKeys.active()
+	if err != nil {
+		return 0, err
+	}
+	if !ok {
+		return 0, errors.New("there is no keyfile, run the key init command first")
+	}
+
+	session, err := mgo.Dial(db.Server)
+	if err != nil {
+		return 0, err
+	}
+	defer session.Close()
+
+	n := 0
+	invoices := session.DB(db.Name).C(db.Collection)
+	iter := invoices.Find(bson.M{"crypt.keyid": bson.M{"$ne": master.ID}}).Iter()
+	for {
+		var invoice Invoice
+		if !iter.Next(&invoice) {
+			break
+		}
+		if err := invoices.Update(bson.M{"id": invoice.ID}, invoice); err != nil {
+			iter.Close()
+			return n, err
+		}
+		n++
+	}
+	if err := iter.Close(); err != nil {
+		return n, err
+	}
+
+	drafts := session.DB(db.Name).C(DRAFTS)
+	iter = drafts.Find(bson.M{"invoice.crypt.keyid": bson.M{"$ne": master.ID}}).Iter()
+	for {
+		var draft Draft
+		if !iter.Next(&draft) {
+			break
+		}
+		if err := drafts.UpdateId(draft.ID, draft); err != nil {
+			iter.Close()
+			return n, err
+		}
+		n++
+	}
+	return n, iter.Close()
+}
@@ -0,0 +1,255 @@
+// Copyright 2016 Cory Robinson. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE.txt file.
+
+package main
+
+import (
+	"bytes"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"gopkg.in/mgo.v2/bson"
+)
+
+// useTestKeyfile makes the app use a keyfile of the test, with one key.
+func useTestKeyfile(t *testing.T) Keyring {
+	t.Setenv("INVOICE_KEYFILE", filepath.Join(t.TempDir(), KEYFILE))
+	t.Cleanup(masterKeys.forget)
+	kr, err := Keyring{}.rotate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := writeKeyring(kr); err != nil {
+		t.Fatalf("writeKeyring: %v", err)
+	}
+	return kr
+}
+
+// sensitiveInvoice returns an invoice with every sensitive field set.
+func sensitiveInvoice() Invoice {
+	invoice := peppolInvoice()
+	invoice.ID = 7
+	invoice.Address.State = "Skane"
+	invoice.VendorIDs.LegalID = "556677-8899"
+	invoice.VendorIDs.BankAccount = "SE4550000000058398257466"
+	invoice.Buyer.Address.Street = "2 Main St"
+	invoice.Buyer.Address.State = "Skane"
+	invoice.Buyer.Address.Zipcode = "22100"
+	invoice.Buyer.IDs.TaxID = "SE112233445501"
+	invoice.Buyer.IDs.LegalID = "112233-4455"
+	invoice.Buyer.IDs.BankAccount = "SE3550000000054910000003"
+	invoice.Attachments = []Attachment{} // as read back from the DB
+	return invoice
+}
+
+func TestSealValue(t *testing.T) {
+	key := bytes.Repeat([]byte{1}, 32)
+	sealed, err := sealValue(key, []byte("SE556677889901"), []byte("vendorids.taxid"))
+	if err != nil {
+		t.Fatalf("sealValue: %v", err)
+	}
+	if bytes.Contains(sealed, []byte("SE556677889901")) {
+		t.Errorf("sealed value %q contains the plaintext", sealed)
+	}
+	again, err := sealValue(key, []byte("SE556677889901"), []byte("vendorids.taxid"))
+	if err != nil {
+		t.Fatalf("sealValue: %v", err)
+	}
+	if bytes.Equal(sealed, again) {
+		t.Errorf("the same value was sealed twice with the same nonce")
+	}
+
+	tampered := append([]byte(nil), sealed...)
+	tampered[len(tampered)-1] ^= 1
+	tests := []struct {
+		name              string
+		key, sealed, path []byte
+		want              string
+		wantError         bool
+	}{
+		{"round trip", key, sealed, []byte("vendorids.taxid"), "SE556677889901", false},
+		{"wrong key", bytes.Repeat([]byte{2}, 32), sealed, []byte("vendorids.taxid"), "", true},
+		{"other field", key, sealed, []byte("buyer.ids.taxid"), "", true},
+		{"tampered", key, tampered, []byte("vendorids.taxid"), "", true},
+		{"cut short", key, sealed[:8], []byte("vendorids.taxid"), "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := openValue(tt.key, tt.sealed, tt.path)
+			if tt.wantError {
+				if err == nil {
+					t.Errorf("openValue = %q, want an error", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("openValue: %v", err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("openValue = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestInvoiceEncryption(t *testing.T) {
+	kr := useTestKeyfile(t)
+	invoice := sensitiveInvoice()
+
+	data, err := bson.Marshal(invoice)
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+	var doc struct {
+		Vendor  string   `bson:"vendor"`
+		Address Location `bson:"address"`
+		Buyer   Party    `bson:"buyer"`
+		Crypt   Envelope `bson:"crypt"`
+	}
+	if err := bson.Unmarshal(data, &doc); err != nil {
+		t.Fatalf("Unmarshal: %v", err)
+	}
+	if doc.Crypt.KeyID != kr.Active {
+		t.Errorf("encrypted with key %q, want %q", doc.Crypt.KeyID, kr.Active)
+	}
+	if doc.Vendor != invoice.Vendor {
+		t.Errorf("vendor = %q, want it in plain", doc.Vendor)
+	}
+	for _, value := range []string{doc.Address.Street, doc.Address.City, doc.Buyer.Address.Zipcode, doc.Buyer.IDs.BankAccount} {
+		if !strings.HasPrefix(value, encryptedPrefix) {
+			t.Errorf("sensitive field %q is not encrypted", value)
+		}
+	}
+
+	var got Invoice
+	if err := bson.Unmarshal(data, &got); err != nil {
+		t.Fatalf("Unmarshal: %v", err)
+	}
+	if !reflect.DeepEqual(got, invoice) {
+		t.Errorf("read back\n%+v\nwant\n%+v", got, invoice)
+	}
+}
+
+func TestInvoiceEncryptionTampered(t *testing.T) {
+	useTestKeyfile(t)
+	data, err := bson.Marshal(sensitiveInvoice())
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+
+	// swapping two encrypted fields is caught as they are bound to their paths
+	var doc bson.M
+	if err := bson.Unmarshal(data, &doc); err != nil {
+		t.Fatalf("Unmarshal: %v", err)
+	}
+	address := doc["address"].(bson.M)
+	address["street"], address["city"] = address["city"], address["street"]
+	if data, err = bson.Marshal(doc); err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+	var invoice Invoice
+	err = bson.Unmarshal(data, &invoice)
+	if err == nil || !strings.Contains(err.Error(), "cannot decrypt address.street") {
+		t.Errorf("Unmarshal: got %v, want an error decrypting address.street", err)
+	}
+}
+
+func TestKeyRotation(t *testing.T) {
+	kr := useTestKeyfile(t)
+	invoice := sensitiveInvoice()
+	old, err := bson.Marshal(invoice)
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+
+	// invoices written before the rotation are still read with the old key
+	rotated, err := kr.rotate()
+	if err != nil {
+		t.Fatalf("rotate: %v", err)
+	}
+	if rotated.Active == kr.Active || len(rotated.Keys) != 2 {
+		t.Fatalf("rotated keyring = %+v", rotated)
+	}
+	if err := writeKeyring(rotated); err != nil {
+		t.Fatalf("writeKeyring: %v", err)
+	}
+	written, err := bson.Marshal(invoice)
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+	for _, data := range [][]byte{old, written} {
+		var got Invoice
+		if err := bson.Unmarshal(data, &got); err != nil {
+			t.Fatalf("Unmarshal: %v", err)
+		}
+		if !reflect.DeepEqual(got, invoice) {
+			t.Errorf("read back\n%+v\nwant\n%+v", got, invoice)
+		}
+	}
+	var doc struct {
+		Crypt Envelope `bson:"crypt"`
+	}
+	if err := bson.Unmarshal(written, &doc); err != nil || doc.Crypt.KeyID != rotated.Active {
+		t.Errorf("written with key %q (%v), want the new key %q", doc.Crypt.KeyID, err, rotated.Active)
+	}
+
+	// and no longer once the old key is removed
+	removed, err := rotated.remove(kr.Active, nil)
+	if err != nil {
+		t.Fatalf("remove: %v", err)
+	}
+	if err := writeKeyring(removed); err != nil {
+		t.Fatalf("writeKeyring: %v", err)
+	}
+	var got Invoice
+	if err := bson.Unmarshal(old, &got); err == nil || !strings.Contains(err.Error(), "is not in the keyfile") {
+		t.Errorf("Unmarshal: got %v, want the old key missing", err)
+	}
+}
+
+func TestKeyringRemove(t *testing.T) {
+	kr, err := Keyring{}.rotate()
+	if err == nil {
+		kr, err = kr.rotate()
+	}
+	if err != nil {
+		t.Fatalf("rotate: %v", err)
+	}
+	old := kr.Keys[0].ID
+
+	tests := []struct {
+		name      string
+		id        string
+		counts    map[string]int
+		wantError string
+	}{
+		{"unused", old, map[string]int{kr.Active: 3, "": 1}, ""},
+		{"no counts", old, nil, ""},
+		{"in use", old, map[string]int{old: 2, kr.Active: 3}, "2 invoices and drafts are encrypted with key " + old},
+		{"active", kr.Active, nil, "the active key cannot be removed"},
+		{"unknown", "00000000", nil, "there is no key 00000000"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := kr.remove(tt.id, tt.counts)
+			if tt.wantError != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantError) {
+					t.Errorf("remove: got %v, want an error containing %q", err, tt.wantError)
+				}
+				if len(got.Keys) != 2 {
+					t.Errorf("keys = %d after a refused remove, want 2", len(got.Keys))
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("remove: %v", err)
+			}
+			if _, ok := got.find(tt.id); ok || len(got.Keys) != 1 || got.Active != kr.Active {
+				t.Errorf("keyring = %+v, want only the active key", got)
+			}
+		})
+	}
+}
@@ -0,0 +1,246 @@
+// Copyright 2016 Cory Robinson. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE.txt file.
+
+// export.go implements exporting invoices and their line items to files.
+// The supported formats are:
+//
+//	csv      - flat CSV, one row per line item with the invoice fields
+//	           repeated on every row. Uses the same columns as the CSV
+//	           import, so exported files can be imported again.
+//	csv-hl   - header+lines CSV. "H" rows hold the invoice fields and are
+//	           followed by one "L" row per line item.
+//	json     - the invoices as a JSON array, using the json tags on Invoice.
+//	xlsx     - an Excel workbook with an Invoices sheet and a Line Items sheet.
+
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/xuri/excelize/v2"
+)
+
+// exportFormats lists the supported export formats.
+var exportFormats = []string{"csv", "csv-hl", "json", "xlsx"}
+
+// exportFormatFilters are the file dialog filters for each export format.
+var exportFormatFilters = map[string]string{
+	"csv":    "CSV files (*.csv)",
+	"csv-hl": "CSV files (*.csv)",
+	"json":   "JSON files (*.json)",
+	"xlsx":   "Excel workbooks (*.xlsx)",
+}
+
+// exportFormatForFile guesses the export format from a file extension.
+func exportFormatForFile(name string) string {
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".json":
+		return "json"
+	case ".xlsx":
+		return "xlsx"
+	}
+	return "csv"
+}
+
+// ExportInvoices writes the invoices to w in the given format.
+func ExportInvoices(w io.Writer, invoices Invoices, format string) error {
+	switch format {
+	case "csv":
+		return exportCSV(w, invoices)
+	case "csv-hl":
+		return exportCSVHeaderLines(w, invoices)
+	case "json":
+		return exportJSON(w, invoices)
+	case "xlsx":
+		return exportXLSX(w, invoices)
+	}
+	return fmt.Errorf("unknown export format %q", format)
+}
+
+// centsString formats integer cents as a plain decimal, i.e. 7420 --> 74.20
+func centsString(cents int64) string {
+	return strings.Replace(formatCents(cents), "$", "", 1)
+}
+
+// invoiceRecord returns the invoice level columns of the flat CSV export.
+func invoiceRecord(invoice Invoice) []string {
+	return []string{
+		invoice.Vendor,
+		invoice.Address.Street,
+		invoice.Address.City,
+		invoice.Address.State,
+		invoice.Address.Zipcode,
+		invoice.InvoiceNo,
+		invoice.Date,
+		invoice.PurchaseOrder,
+		centsString(invoice.Total),
+		centsString(invoice.TaxTotal),
+		invoice.Currency,
+		strconv.FormatBool(invoice.Paid),
+	}
+}
+
+// exportCSV writes the flat CSV export.
+func exportCSV(w io.Writer, invoices Invoices) error {
+	writer := csv.NewWriter(w)
+	if err := writer.Write(importFields); err != nil {
+		return err
+	}
+
+	for _, invoice := range invoices {
+		record := invoiceRecord(invoice)
+		if len(invoice.LineItems) == 0 {
+			writer.Write(append(record, "", "", "", ""))
+		}
+		for _, item := range invoice.LineItems {
+			writer.Write(append(record[:len(record):len(record)],
+				item.ProductID,
+				item.Description,
+				strconv.Itoa(int(item.Quantity)),
+				centsString(item.Amount),
+			))
+		}
+	}
+
+	writer.Flush()
+	return writer.Error()
+}
+
+// exportCSVHeaderLines writes the header+lines CSV export. The layout is
+//
+//	H,id,vendor,street,city,state,zipcode,invoiceno,date,purchaseorder,total,taxtotal,currency,paid
+//	L,id,line,productid,description,quantity,amount
+func exportCSVHeaderLines(w io.Writer, invoices Invoices) error {
+	writer := csv.NewWriter(w)
+
+	for _, invoice := range invoices {
+		id := strconv.Itoa(invoice.ID)
+		writer.Write(append([]string{"H", id}, invoiceRecord(invoice)...))
+		for i, item := range invoice.LineItems {
+			writer.Write([]string{"L", id,
+				strconv.Itoa(i + 1),
+				item.ProductID,
+				item.Description,
+				strconv.Itoa(int(item.Quantity)),
+				centsString(item.Amount),
+			})
+		}
+	}
+
+	writer.Flush()
+	return writer.Error()
+}
+
+// exportJSON writes the invoices as an indented JSON array.
+func exportJSON(w io.Writer, invoices Invoices) error {
+	if invoices == nil {
+		invoices = Invoices{}
+	}
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(invoices)
+}
+
+// exportXLSX writes a workbook with one sheet for invoices and one sheet
+// for line items. Money columns are written as numbers, not text, so they
+// can be summed in Excel.
+func exportXLSX(w io.Writer, invoices Invoices) error {
+	const invoiceSheet = "Invoices"
+	const lineItemSheet = "Line Items"
+
+	f := excelize.NewFile()
+	defer f.Close()
+
+	if err := f.SetSheetName("Sheet1", invoiceSheet); err != nil {
+		return err
+	}
+	if _, err := f.NewSheet(lineItemSheet); err != nil {
+		return err
+	}
+
+	money, err := f.NewStyle(&excelize.Style{NumFmt: 2}) // 0.00
+	if err != nil {
+		return err
+	}
+	bold, err := f.NewStyle(&excelize.Style{Font: &excelize.Font{Bold: true}})
+	if err != nil {
+		return err
+	}
+
+	setRow := func(sheet string, row int, values []interface{}) error {
+		cell, err := excelize.CoordinatesToCellName(1, row)
+		if err != nil {
+			return err
+		}
+		return f.SetSheetRow(sheet, cell, &values)
+	}
+
+	invoiceHeader := []interface{}{"ID", "Vendor", "Street", "City", "State", "Zipcode",
+		"Invoice No.", "Date", "Purchase Order", "Total", "Tax Total", "Currency", "Paid"}
+	lineItemHeader := []interface{}{"Invoice ID", "Vendor", "Invoice No.", "Line",
+		"Product ID", "Description", "Quantity", "Unit Price", "Amount"}
+	if err := setRow(invoiceSheet, 1, invoiceHeader); err != nil {
+		return err
+	}
+	if err := setRow(lineItemSheet, 1, lineItemHeader); err != nil {
+		return err
+	}
+	f.SetRowStyle(invoiceSheet, 1, 1, bold)
+	f.SetRowStyle(lineItemSheet, 1, 1, bold)
+
+	lineRow := 2
+	for i, invoice := range invoices {
+		err := setRow(invoiceSheet, i+2, []interface{}{
+			invoice.ID,
+			invoice.Vendor,
+			invoice.Address.Street,
+			invoice.Address.City,
+			invoice.Address.State,
+			invoice.Address.Zipcode,
+			invoice.InvoiceNo,
+			invoice.Date,
+			invoice.PurchaseOrder,
+			float64(invoice.Total) / 100,
+			float64(invoice.TaxTotal) / 100,
+			invoice.Currency,
+			invoice.Paid,
+		})
+		if err != nil {
+			return err
+		}
+
+		for j, item := range invoice.LineItems {
+			err := setRow(lineItemSheet, lineRow, []interface{}{
+				invoice.ID,
+				invoice.Vendor,
+				invoice.InvoiceNo,
+				j + 1,
+				item.ProductID,
+				item.Description,
+				int(item.Quantity),
+				float64(item.Amount) / 100,
+				float64(int64(item.Quantity)*item.Amount) / 100,
+			})
+			if err != nil {
+				return err
+			}
+			lineRow++
+		}
+	}
+
+	if len(invoices) > 0 {
+		f.SetCellStyle(invoiceSheet, "J2", fmt.Sprintf("K%d", len(invoices)+1), money)
+	}
+	if lineRow > 2 {
+		f.SetCellStyle(lineItemSheet, "H2", fmt.Sprintf("I%d", lineRow-1), money)
+	}
+
+	return f.Write(w)
+}
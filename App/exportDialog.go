@@ -0,0 +1,102 @@
+// Copyright 2016 Cory Robinson. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE.txt file.
+
+// exportDialog.go implements the File > Export dialog, where the user picks
+// which invoices to export and the file format. The export itself is done
+// by the main window, see MainWindow.exportInvoices().
+
+package main
+
+import (
+	"github.com/therecipe/qt/widgets"
+)
+
+// export scopes offered by the dialog.
+const (
+	exportSelected = "selected"
+	exportList     = "list"
+	exportAll      = "all"
+)
+
+// exportFormatNames are the names shown in the format combobox, in the
+// same order as exportFormats.
+var exportFormatNames = []string{"CSV (flat)", "CSV (header + lines)", "JSON", "Excel (XLSX)"}
+
+type ExportDialog struct {
+	widgets.QDialog
+
+	selectedButton *widgets.QRadioButton
+	listButton     *widgets.QRadioButton
+	allButton      *widgets.QRadioButton
+
+	formatView *widgets.QComboBox
+
+	exportButton *widgets.QPushButton
+	closeButton  *widgets.QPushButton
+}
+
+// initWith() initializes the dialog layout. hasSelection tells whether an
+// invoice is selected in the main window.
+func (d *ExportDialog) initWith(parent *widgets.QWidget, hasSelection bool) {
+	scopeBox := widgets.NewQGroupBox2("EXPORT:", nil)
+
+	d.selectedButton = widgets.NewQRadioButton2("Selected invoice", nil)
+	d.listButton = widgets.NewQRadioButton2("Invoices in the current list", nil)
+	d.allButton = widgets.NewQRadioButton2("All invoices", nil)
+
+	d.selectedButton.SetEnabled(hasSelection)
+	if hasSelection {
+		d.selectedButton.SetChecked(true)
+	} else {
+		d.listButton.SetChecked(true)
+	}
+
+	scopeLayout := widgets.NewQVBoxLayout()
+	scopeLayout.AddWidget(d.selectedButton, 0, 0)
+	scopeLayout.AddWidget(d.listButton, 0, 0)
+	scopeLayout.AddWidget(d.allButton, 0, 0)
+	scopeBox.SetLayout(scopeLayout)
+
+	formatBox := widgets.NewQGroupBox2("FORMAT:", nil)
+
+	d.formatView = widgets.NewQComboBox(nil)
+	d.formatView.AddItems(exportFormatNames)
+
+	formatLayout := widgets.NewQVBoxLayout()
+	formatLayout.AddWidget(d.formatView, 0, 0)
+	formatBox.SetLayout(formatLayout)
+
+	buttonBox := widgets.NewQDialogButtonBox(nil)
+	d.exportButton = widgets.NewQPushButton2("&Export...", nil)
+	d.closeButton = widgets.NewQPushButton2("&Close", nil)
+	d.exportButton.SetDefault(true)
+	d.exportButton.ConnectClicked(func(bool) { d.Accept() })
+	d.closeButton.ConnectClicked(func(bool) { d.Reject() })
+	buttonBox.AddButton(d.exportButton, widgets.QDialogButtonBox__AcceptRole)
+	buttonBox.AddButton(d.closeButton, widgets.QDialogButtonBox__RejectRole)
+
+	layout := widgets.NewQVBoxLayout()
+	layout.AddWidget(scopeBox, 0, 0)
+	layout.AddWidget(formatBox, 0, 0)
+	layout.AddWidget(buttonBox, 0, 0)
+	d.SetLayout(layout)
+
+	d.SetWindowTitle("Export Invoices")
+}
+
+// scope() returns which invoices were chosen for export.
+func (d *ExportDialog) scope() string {
+	switch {
+	case d.selectedButton.IsChecked():
+		return exportSelected
+	case d.allButton.IsChecked():
+		return exportAll
+	}
+	return exportList
+}
+
+// format() returns the chosen export format.
+func (d *ExportDialog) format() string {
+	return exportFormats[d.formatView.CurrentIndex()]
+}
@@ -0,0 +1,392 @@
+// Copyright 2016 Cory Robinson. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE.txt file.
+
+// extraction.go turns the text of a PDF invoice into a draft Invoice with
+// extraction templates. A template is written for the PDFs of one vendor:
+// it is chosen when its match expression is found in the text, and its
+// rules find the fields by regular expressions, optionally searching only
+// after an anchor such as "Invoice No:". Line items are read from the
+// lines between a start and an end expression. A generic template for
+// common invoice labels is used when no vendor template matches.
+//
+// Extracted invoices are drafts: they are opened in the Add Invoice dialog
+// for review and are never added without it.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// EXTRACTIONTEMPLATES is the template file used if it exists in the
+// working directory and no other file is given.
+const EXTRACTIONTEMPLATES = "extractionTemplates.json"
+
+// ExtractionTemplate holds the rules to extract the invoices of a vendor.
+type ExtractionTemplate struct {
+	Name   string                    `json:"name"`
+	Match  string                    `json:"match"`  // regexp found in the text of the vendor's invoices
+	Fields map[string]ExtractionRule `json:"fields"` // by field name, see extractionFields
+	Lines  ExtractionLines           `json:"lines"`
+}
+
+// ExtractionRule finds the value of a field. Pattern is matched against
+// the text after the first match of Anchor, or after its last match if
+// Last is set, or against the whole text without an anchor. The value is
+// the first group of the pattern, or the whole match without groups.
+// Value is used as is instead, for fields that are the same on every
+// invoice of the vendor. An optional field that is not found is not a
+// problem.
+type ExtractionRule struct {
+	Anchor   string `json:"anchor,omitempty"`
+	Pattern  string `json:"pattern,omitempty"` // defaults to the field's pattern in extractionFields
+	Last     bool   `json:"last,omitempty"`
+	Layout   string `json:"layout,omitempty"` // date layout in Go notation, i.e. "02.01.2006"
+	Value    string `json:"value,omitempty"`
+	Optional bool   `json:"optional,omitempty"`
+}
+
+// ExtractionLines finds the line items. Every line of text between the
+// first match of Start and the following match of End is matched against
+// Pattern, whose named groups productid, description, quantity and amount
+// (unit price) or total (line amount) give the item. Lines that do not
+// match are skipped.
+type ExtractionLines struct {
+	Start   string `json:"start,omitempty"`
+	End     string `json:"end,omitempty"`
+	Pattern string `json:"pattern,omitempty"`
+}
+
+// ExtractionResult is the draft invoice extracted from a PDF.
+type ExtractionResult struct {
+	Template string   // name of the template used
+	Invoice  Invoice  // draft, to be reviewed
+	Problems []string // fields not found or invalid
+}
+
+// extractionAmount matches an amount such as "$1,234.56" or "-12.00".
+const extractionAmount = `-?\$?\s?\d[\d,]*\.\d{2}`
+
+// extractionFields are the fields a template can extract, with the
+// pattern used if a rule gives none.
+var extractionFields = map[string]string{
+	"vendor":        `\S[^\n]*`,
+	"street":        `\S[^\n]*`,
+	"city":          `\S[^\n,]*`,
+	"state":         `[A-Z]{2}`,
+	"zipcode":       `\d{5}(?:-\d{4})?`,
+	"invoiceno":     `[A-Za-z0-9][A-Za-z0-9/_.-]*`,
+	"date":          `\d{1,2}/\d{1,2}/\d{2,4}|\d{4}-\d{2}-\d{2}|\d{1,2}\.\d{1,2}\.\d{4}|[A-Z][a-z]+\.? \d{1,2}, \d{4}|\d{1,2} [A-Z][a-z]+ \d{4}`,
+	"purchaseorder": `[A-Za-z0-9][A-Za-z0-9/_.-]*`,
+	"total":         extractionAmount,
+	"taxtotal":      extractionAmount,
+	"currency":      `[A-Z]{3}`,
+}
+
+// extractionDateLayouts are the date formats tried for dates without a
+// layout, besides importDateLayouts.
+var extractionDateLayouts = []string{"2006-01-02", "02.01.2006", "January 2, 2006", "Jan 2, 2006", "Jan. 2, 2006", "2 January 2006"}
+
+// genericExtractionTemplate finds the fields by the labels most invoices
+// use, and the line items by lines ending in a quantity and two amounts.
+// The purchase order is optional, so it is only looked for on the line of
+// its label.
+var genericExtractionTemplate = ExtractionTemplate{
+	Name: "generic",
+	Fields: map[string]ExtractionRule{
+		"vendor":        {Anchor: `(?i)\b(vendor|supplier|remit to|from)\s*:`},
+		"invoiceno":     {Anchor: `(?i)\binvoice\s*(no\.?|number|#)\s*:?`},
+		"date":          {Anchor: `(?i)\b(invoice\s+)?date\s*:?`},
+		"purchaseorder": {Anchor: `(?i)\b(purchase\s+order|p\.\s?o\.|po\b)[ \t]*(no\.?|number|#)?[ \t]*:?`, Pattern: `^[ \t]*([A-Za-z0-9][A-Za-z0-9/_.-]*)`, Optional: true},
+		"total":         {Anchor: `(?i)\b(total|amount\s+due|balance\s+due)\b`, Last: true},
+		"taxtotal":      {Anchor: `(?i)\b(sales\s+)?tax\b[^\n\d$]*`, Pattern: `^(` + extractionAmount + `)`, Optional: true},
+		"currency":      {Anchor: `(?i)\b(currency|total)\b\s*:?`, Pattern: `\b(USD|EUR|GBP|CAD|AUD|CHF|JPY|MXN)\b`, Last: true, Optional: true},
+	},
+	Lines: ExtractionLines{
+		Start:   `(?i)\bdescription\b`,
+		End:     `(?i)\b(sub\s?total|total)\b`,
+		Pattern: `^\s*(?P<productid>\S+)\s+(?P<description>.+?)\s{2,}(?P<quantity>\d+)\s+(?P<amount>` + extractionAmount + `)\s+(?P<total>` + extractionAmount + `)\s*$`,
+	},
+}
+
+// LoadExtractionTemplates reads vendor templates from a JSON file holding
+// an array of templates. The generic template is added last. An empty
+// path loads EXTRACTIONTEMPLATES if it exists.
+func LoadExtractionTemplates(path string) ([]ExtractionTemplate, error) {
+	generic := []ExtractionTemplate{genericExtractionTemplate}
+	if path == "" {
+		if _, err := os.Stat(EXTRACTIONTEMPLATES); err != nil {
+			return generic, nil
+		}
+		path = EXTRACTIONTEMPLATES
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return generic, err
+	}
+	var templates []ExtractionTemplate
+	if err := json.Unmarshal(data, &templates); err != nil {
+		return generic, fmt.Errorf("%v: %v", path, err)
+	}
+
+	for _, template := range templates {
+		if err := template.check(); err != nil {
+			return generic, fmt.Errorf("%v: template %q: %v", path, template.Name, err)
+		}
+	}
+
+	return append(templates, generic...), nil
+}
+
+// check reports unknown fields and invalid expressions.
+func (t ExtractionTemplate) check() error {
+	expressions := []string{t.Match, t.Lines.Start, t.Lines.End, t.Lines.Pattern}
+	for field, rule := range t.Fields {
+		if _, ok := extractionFields[field]; !ok {
+			return fmt.Errorf("unknown field %q", field)
+		}
+		expressions = append(expressions, rule.Anchor, rule.Pattern)
+	}
+	for _, expr := range expressions {
+		if _, err := regexp.Compile(expr); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ExtractInvoice extracts a draft invoice from the text of a PDF with the
+// first template that matches it. Templates without a match expression
+// match any text.
+func ExtractInvoice(text string, templates []ExtractionTemplate) ExtractionResult {
+	for _, template := range templates {
+		if template.Match != "" {
+			if re, err := regexp.Compile(template.Match); err != nil || !re.MatchString(text) {
+				continue
+			}
+		}
+		return template.extract(text)
+	}
+	return genericExtractionTemplate.extract(text)
+}
+
+// extract applies the template to the text.
+func (t ExtractionTemplate) extract(text string) ExtractionResult {
+	result := ExtractionResult{Template: t.Name}
+	invoice := &result.Invoice
+
+	var fields []string
+	for field := range t.Fields {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+
+	values := map[string]string{}
+	for _, field := range fields {
+		rule := t.Fields[field]
+		value, err := rule.find(text, extractionFields[field])
+		if err != nil {
+			if rule.Optional {
+				continue
+			}
+			result.Problems = append(result.Problems, fmt.Sprintf("%s: %v", field, err))
+			continue
+		}
+		values[field] = value
+	}
+
+	invoice.Vendor = values["vendor"]
+	invoice.Address = Location{
+		Street:  values["street"],
+		City:    values["city"],
+		State:   values["state"],
+		Zipcode: values["zipcode"],
+	}
+	invoice.InvoiceNo = values["invoiceno"]
+	invoice.PurchaseOrder = values["purchaseorder"]
+	invoice.Currency = values["currency"]
+	if invoice.Currency == "" {
+		invoice.Currency = "USD"
+	}
+
+	if date := values["date"]; date != "" {
+		normalized, err := extractionDate(date, t.Fields["date"].Layout)
+		if err != nil {
+			result.Problems = append(result.Problems, fmt.Sprintf("date: %v", err))
+		}
+		invoice.Date = normalized
+	}
+	for field, amount := range map[string]*int64{"total": &invoice.Total, "taxtotal": &invoice.TaxTotal} {
+		if values[field] == "" {
+			continue
+		}
+		cents, err := parseCents(values[field])
+		if err != nil {
+			result.Problems = append(result.Problems, fmt.Sprintf("%s: %v", field, err))
+		}
+		*amount = cents
+	}
+
+	items, problems := t.Lines.extract(text)
+	invoice.LineItems = items
+	result.Problems = append(result.Problems, problems...)
+
+	if invoice.Total == 0 && len(items) > 0 {
+		invoice.Total = lineItemsTotal(items) + invoice.TaxTotal
+	}
+	result.Problems = append(result.Problems, validateInvoice(*invoice)...)
+
+	return result
+}
+
+// find returns the value of the rule in the text.
+func (rule ExtractionRule) find(text, defaultPattern string) (string, error) {
+	if rule.Value != "" {
+		return rule.Value, nil
+	}
+
+	if rule.Anchor != "" {
+		anchors := regexp.MustCompile(rule.Anchor).FindAllStringIndex(text, -1)
+		if len(anchors) == 0 {
+			return "", fmt.Errorf("anchor %q not found", rule.Anchor)
+		}
+		anchor := anchors[0]
+		if rule.Last {
+			anchor = anchors[len(anchors)-1]
+		}
+		text = text[anchor[1]:]
+	}
+
+	pattern := rule.Pattern
+	if pattern == "" {
+		pattern = defaultPattern
+	}
+	match := regexp.MustCompile(pattern).FindStringSubmatch(text)
+	if match == nil {
+		return "", fmt.Errorf("nothing matches %q", pattern)
+	}
+	for _, group := range match[1:] {
+		if group != "" {
+			return strings.TrimSpace(group), nil
+		}
+	}
+	return strings.TrimSpace(match[0]), nil
+}
+
+// extract returns the line items found in the text.
+func (l ExtractionLines) extract(text string) (Items, []string) {
+	if l.Pattern == "" {
+		return nil, nil
+	}
+	if l.Start != "" {
+		loc := regexp.MustCompile(l.Start).FindStringIndex(text)
+		if loc == nil {
+			return nil, []string{fmt.Sprintf("line items: start %q not found", l.Start)}
+		}
+		// the line holding the start, usually the table header, is skipped
+		text = text[loc[1]:]
+		if i := strings.IndexByte(text, '\n'); i >= 0 {
+			text = text[i+1:]
+		}
+	}
+	if l.End != "" {
+		if loc := regexp.MustCompile(l.End).FindStringIndex(text); loc != nil {
+			text = text[:loc[0]]
+		}
+	}
+
+	re := regexp.MustCompile(l.Pattern)
+	var items Items
+	var problems []string
+	for _, line := range strings.Split(text, "\n") {
+		match := re.FindStringSubmatch(line)
+		if match == nil {
+			continue
+		}
+		get := func(name string) string {
+			if i := re.SubexpIndex(name); i > 0 {
+				return strings.TrimSpace(match[i])
+			}
+			return ""
+		}
+
+		item := Item{ProductID: get("productid"), Description: get("description"), Quantity: 1}
+		if quantity := get("quantity"); quantity != "" {
+			q, err := strconv.ParseUint(strings.ReplaceAll(quantity, ",", ""), 10, 16)
+			if err != nil {
+				problems = append(problems, fmt.Sprintf("line %q: %q is not a valid quantity", strings.TrimSpace(line), quantity))
+				continue
+			}
+			item.Quantity = uint16(q)
+		}
+
+		var err error
+		if amount := get("amount"); amount != "" {
+			item.Amount, err = parseCents(amount)
+		} else if total := get("total"); total != "" && item.Quantity > 0 {
+			var cents int64
+			cents, err = parseCents(total)
+			item.Amount = cents / int64(item.Quantity)
+		}
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("line %q: %v", strings.TrimSpace(line), err))
+			continue
+		}
+		items = append(items, item)
+	}
+
+	if len(items) == 0 {
+		problems = append(problems, "no line items found")
+	}
+	return items, problems
+}
+
+// extractionDate parses a date with the layout, or any known layout if
+// layout is empty, and returns it as MM/DD/YYYY.
+func extractionDate(s, layout string) (string, error) {
+	if layout != "" {
+		t, err := time.Parse(layout, s)
+		if err != nil {
+			return "", fmt.Errorf("%q does not have the layout %q", s, layout)
+		}
+		return t.Format("01/02/2006"), nil
+	}
+
+	if date, err := normalizeDate(s); err == nil {
+		return date, nil
+	}
+	for _, layout := range extractionDateLayouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t.Format("01/02/2006"), nil
+		}
+	}
+	return "", fmt.Errorf("%q is not a valid date", s)
+}
+
+// ExtractPDFInvoice reads a PDF file and extracts a draft invoice from its
+// text with the templates.
+func ExtractPDFInvoice(name string, templates []ExtractionTemplate) (ExtractionResult, error) {
+	data, err := os.ReadFile(name)
+	if err != nil {
+		return ExtractionResult{}, err
+	}
+	pages, err := ExtractPDFText(data)
+	if err != nil {
+		return ExtractionResult{}, err
+	}
+
+	text := strings.Join(pages, "\n")
+	if strings.TrimSpace(text) == "" {
+		return ExtractionResult{}, fmt.Errorf("%s has no text, it may be a scanned document", name)
+	}
+	return ExtractInvoice(text, templates), nil
+}
@@ -0,0 +1,134 @@
+// Copyright 2016 Cory Robinson. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE.txt file.
+
+// facturx.go implements ZUGFeRD 2 / Factur-X hybrid invoices: a PDF with
+// the invoice data attached as a CII XML file. Reading extracts the XML
+// from the PDF and maps it with ReadCII. When writing, the CII XML and the
+// Factur-X XMP metadata are attached to the PDF rendered by pdf.go; the
+// PDF itself is not made PDF/A-3 conformant.
+
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/jung-kurt/gofpdf"
+)
+
+// facturXFileName is the name of the XML attached to exported PDFs.
+const facturXFileName = "factur-x.xml"
+
+// facturXNames are the attachment names used by the ZUGFeRD 2, Factur-X
+// and XRechnung specifications, lower case.
+var facturXNames = []string{facturXFileName, "zugferd-invoice.xml", "xrechnung.xml"}
+
+// ExtractFacturXML returns the CII XML attached to a Factur-X PDF. If no
+// attachment has a standard name, the first XML attachment with a
+// CrossIndustryInvoice root is used.
+func ExtractFacturXML(data []byte) (PDFAttachment, error) {
+	attachments, err := ReadPDFAttachments(data)
+	if err != nil {
+		return PDFAttachment{}, err
+	}
+
+	for _, name := range facturXNames {
+		for _, attachment := range attachments {
+			if strings.ToLower(attachment.Name) == name {
+				return attachment, nil
+			}
+		}
+	}
+	for _, attachment := range attachments {
+		if root := xmlRootName(attachment.Data); root == "CrossIndustryInvoice" {
+			return attachment, nil
+		} else if root == "CrossIndustryDocument" {
+			return PDFAttachment{}, errors.New("ZUGFeRD 1.0 documents are not supported")
+		}
+	}
+
+	return PDFAttachment{}, errors.New("no Factur-X / ZUGFeRD invoice attached to the PDF")
+}
+
+// ReadFacturX reads the invoice attached to a Factur-X PDF, see ReadCII.
+func ReadFacturX(data []byte) (Invoice, []UBLError, error) {
+	attachment, err := ExtractFacturXML(data)
+	if err != nil {
+		return Invoice{}, nil, err
+	}
+	return ReadCII(bytes.NewReader(attachment.Data))
+}
+
+// ReadFacturXFile reads the invoice attached to a Factur-X PDF file.
+func ReadFacturXFile(name string) (Invoice, []UBLError, error) {
+	data, err := os.ReadFile(name)
+	if err != nil {
+		return Invoice{}, nil, err
+	}
+	return ReadFacturX(data)
+}
+
+// ReadEInvoiceFile reads an electronic invoice in any supported format:
+// a Factur-X / ZUGFeRD PDF, a UBL document or a CII document.
+func ReadEInvoiceFile(name string) (Invoice, []UBLError, error) {
+	data, err := os.ReadFile(name)
+	if err != nil {
+		return Invoice{}, nil, err
+	}
+
+	if bytes.HasPrefix(data, []byte("%PDF-")) || strings.EqualFold(filepath.Ext(name), ".pdf") {
+		return ReadFacturX(data)
+	}
+	if xmlRootName(data) == "CrossIndustryInvoice" {
+		return ReadCII(bytes.NewReader(data))
+	}
+	return ReadUBL(bytes.NewReader(data))
+}
+
+// xmlRootName returns the local name of the root element of an XML
+// document, or "" if it cannot be parsed.
+func xmlRootName(data []byte) string {
+	doc, err := parseXML(bytes.NewReader(data))
+	if err != nil {
+		return ""
+	}
+	return doc.Local()
+}
+
+// embedFacturX attaches the invoice as CII XML to the PDF and adds the
+// Factur-X XMP metadata describing the attachment.
+func embedFacturX(pdf *gofpdf.Fpdf, invoice Invoice) error {
+	var xml bytes.Buffer
+	if err := WriteCII(&xml, invoice); err != nil {
+		return err
+	}
+
+	pdf.SetAttachments([]gofpdf.Attachment{{
+		Content:     xml.Bytes(),
+		Filename:    facturXFileName,
+		Description: "Factur-X invoice",
+	}})
+	pdf.SetXmpMetadata([]byte(fmt.Sprintf(facturXXMP, facturXFileName)))
+
+	return nil
+}
+
+// facturXXMP is the XMP metadata identifying a Factur-X PDF, with the name
+// of the attached XML filled in.
+const facturXXMP = `<?xpacket begin="` + "\ufeff" + `" id="W5M0MpCehiHzreSzNTczkc9d"?>
+<x:xmpmeta xmlns:x="adobe:ns:meta/">
+  <rdf:RDF xmlns:rdf="http://www.w3.org/1999/02/22-rdf-syntax-ns#">
+    <rdf:Description rdf:about="" xmlns:fx="urn:factur-x:pdfa:CrossIndustryDocument:invoice:1p0#">
+      <fx:DocumentType>INVOICE</fx:DocumentType>
+      <fx:DocumentFileName>%s</fx:DocumentFileName>
+      <fx:Version>1.0</fx:Version>
+      <fx:ConformanceLevel>EN 16931</fx:ConformanceLevel>
+    </rdf:Description>
+  </rdf:RDF>
+</x:xmpmeta>
+<?xpacket end="w"?>`
@@ -0,0 +1,183 @@
+// Copyright 2016 Cory Robinson. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE.txt file.
+
+// formats.go detects the format of an invoice file and reads it with the
+// matching importer. It is used where files of any supported format are
+// dropped in, such as the inbox folder. Every importer returns the
+// invoices of the file along with its problems; a file with problems
+// should not be imported at all.
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// invoiceFormat is a file format invoices can be imported from.
+type invoiceFormat struct {
+	name  string
+	match func(name string, data []byte) bool
+	read  func(data []byte) (Invoices, []string, error)
+}
+
+// invoiceFormats are the importable formats, in the order they are tried.
+var invoiceFormats = []invoiceFormat{
+	{"Factur-X", func(name string, data []byte) bool { return bytes.HasPrefix(data, []byte("%PDF-")) }, readFacturXInvoices},
+	{"X12", func(name string, data []byte) bool {
+		return bytes.HasPrefix(bytes.TrimLeft(data, "\ufeff \t\r\n"), []byte("ISA"))
+	}, readX12Invoices},
+	{"UBL", func(name string, data []byte) bool {
+		root := xmlRootName(data)
+		return root == "Invoice" || root == "CreditNote"
+	}, readUBLInvoices},
+	{"CII", func(name string, data []byte) bool { return xmlRootName(data) == "CrossIndustryInvoice" }, readCIIInvoices},
+	{"JSON", func(name string, data []byte) bool { return strings.EqualFold(filepath.Ext(name), ".json") }, readJSONInvoices},
+	{"CSV", func(name string, data []byte) bool { return strings.EqualFold(filepath.Ext(name), ".csv") }, readCSVInvoices},
+}
+
+// ReadInvoicesFile reads the invoices in a file of any importable format
+// and returns the name of the format. Besides the format's own checks,
+// every invoice is checked with validateInvoice.
+func ReadInvoicesFile(name string) (format string, invoices Invoices, problems []string, err error) {
+	data, err := os.ReadFile(name)
+	if err != nil {
+		return "", nil, nil, err
+	}
+	return ReadInvoicesData(name, data)
+}
+
+// ReadInvoicesData is like ReadInvoicesFile for the content of a file
+// that has been read already, such as an email attachment.
+func ReadInvoicesData(name string, data []byte) (format string, invoices Invoices, problems []string, err error) {
+	for _, f := range invoiceFormats {
+		if !f.match(name, data) {
+			continue
+		}
+		invoices, problems, err = f.read(data)
+		return f.name, invoices, problems, err
+	}
+
+	return "", nil, nil, fmt.Errorf("unknown invoice file format")
+}
+
+// ublProblems converts the business rule errors of an e-invoice to
+// problems and adds those found by validateInvoice.
+func ublProblems(invoice Invoice, errs []UBLError) []string {
+	problems := make([]string, len(errs))
+	for i, e := range errs {
+		problems[i] = e.Error()
+	}
+	return append(problems, validateInvoice(invoice)...)
+}
+
+// validateInvoices returns the problems validateInvoice finds in the
+// invoices.
+func validateInvoices(invoices Invoices) []string {
+	var problems []string
+	for _, invoice := range invoices {
+		problems = append(problems, validateInvoice(invoice)...)
+	}
+	return problems
+}
+
+// readFacturXInvoices reads the invoice attached to a Factur-X PDF.
+func readFacturXInvoices(data []byte) (Invoices, []string, error) {
+	invoice, errs, err := ReadFacturX(data)
+	if err != nil {
+		return nil, nil, err
+	}
+	return Invoices{invoice}, ublProblems(invoice, errs), nil
+}
+
+// readUBLInvoices reads a UBL document.
+func readUBLInvoices(data []byte) (Invoices, []string, error) {
+	invoice, errs, err := ReadUBL(bytes.NewReader(data))
+	if err != nil {
+		return nil, nil, err
+	}
+	return Invoices{invoice}, ublProblems(invoice, errs), nil
+}
+
+// readCIIInvoices reads a CII document.
+func readCIIInvoices(data []byte) (Invoices, []string, error) {
+	invoice, errs, err := ReadCII(bytes.NewReader(data))
+	if err != nil {
+		return nil, nil, err
+	}
+	return Invoices{invoice}, ublProblems(invoice, errs), nil
+}
+
+// readX12Invoices reads the 810 transaction sets of X12 interchanges.
+// Transaction sets that are not 810s are problems too.
+func readX12Invoices(data []byte) (Invoices, []string, error) {
+	interchanges, err := ReadX12(bytes.NewReader(data))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var invoices Invoices
+	var problems []string
+	for _, ic := range interchanges {
+		for _, group := range ic.Groups {
+			if len(group.Codes) > 0 {
+				problems = append(problems, fmt.Sprintf("group %s: error codes %s",
+					group.ControlNumber, strings.Join(group.Codes, ",")))
+			}
+			for _, t := range group.Transactions {
+				for _, e := range t.Errors {
+					problems = append(problems, fmt.Sprintf("transaction set %s: %v", t.ControlNumber, e))
+				}
+				if len(t.Codes) > 0 {
+					problems = append(problems, fmt.Sprintf("transaction set %s: error codes %s",
+						t.ControlNumber, strings.Join(t.Codes, ",")))
+				}
+			}
+		}
+		invoices = append(invoices, ic.Invoices()...)
+	}
+
+	return invoices, append(problems, validateInvoices(invoices)...), nil
+}
+
+// readJSONInvoices reads invoices in the format written by the JSON
+// export, or a single invoice object.
+func readJSONInvoices(data []byte) (Invoices, []string, error) {
+	var invoices Invoices
+	if trimmed := bytes.TrimSpace(data); bytes.HasPrefix(trimmed, []byte("{")) {
+		var invoice Invoice
+		if err := json.Unmarshal(trimmed, &invoice); err != nil {
+			return nil, nil, err
+		}
+		return Invoices{invoice}, validateInvoice(invoice), nil
+	}
+	if err := json.Unmarshal(data, &invoices); err != nil {
+		return nil, nil, err
+	}
+	return invoices, validateInvoices(invoices), nil
+}
+
+// readCSVInvoices reads a comma separated file with the columns mapped
+// by their header names. ParseCSVInvoices validates the invoices itself.
+func readCSVInvoices(data []byte) (Invoices, []string, error) {
+	header, rows, err := ReadCSV(bytes.NewReader(data), ',')
+	if err != nil {
+		return nil, nil, err
+	}
+	mapping, err := ParseMappingSpec("", header)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	preview := ParseCSVInvoices(rows, mapping)
+	problems := make([]string, len(preview.Errors))
+	for i, e := range preview.Errors {
+		problems[i] = e.Error()
+	}
+	return preview.Invoices, problems, nil
+}
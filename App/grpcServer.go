@@ -0,0 +1,396 @@
+// Copyright 2016 Cory Robinson. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE.txt file.
+
+// grpcServer.go implements the gRPC invoice service of rpc/invoicepb over
+// the invoice repository, the typed counterpart of the JSON API in api.go.
+// It is served next to the JSON API with serve -grpc, and logs in the same
+// way. Go clients use the rpc/invoiceclient package.
+
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/airpaio/goinvoice/rpc/invoicepb"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// GRPCServer implements invoicepb.InvoiceServiceServer.
+type GRPCServer struct {
+	invoicepb.UnimplementedInvoiceServiceServer
+
+	store InvoiceStore
+
+	// writes is held while an invoice is added, updated or deleted, see
+	// APIServer
+	writes sync.Mutex
+}
+
+// NewGRPCServer returns a gRPC server with the invoice service over the
+// store registered. Every call logs in like a request to the JSON API, with
+// basic auth credentials in the authorization metadata, and is made as
+// that user.
+func NewGRPCServer(store InvoiceStore, opts ...grpc.ServerOption) *grpc.Server {
+	s := &GRPCServer{store: store}
+	opts = append(opts, grpc.ChainUnaryInterceptor(s.logInUnary), grpc.ChainStreamInterceptor(s.logInStream))
+	server := grpc.NewServer(opts...)
+	invoicepb.RegisterInvoiceServiceServer(server, s)
+	return server
+}
+
+// logIn returns the context of a call with the store acting as the user
+// the call logged in as, see storeFor.
+func (s *GRPCServer) logIn(ctx context.Context) (context.Context, error) {
+	var name, password string
+	md, _ := metadata.FromIncomingContext(ctx)
+	if values := md.Get("authorization"); len(values) > 0 {
+		var ok bool
+		if name, password, ok = parseBasicAuth(values[0]); !ok {
+			return ctx, status.Error(codes.Unauthenticated, "authorization must be basic auth")
+		}
+	}
+
+	u, err := s.store.Authenticate(name, password)
+	switch {
+	case errors.Is(err, errWrongLogin) || errors.Is(err, errNoLogin):
+		return ctx, status.Error(codes.Unauthenticated, err.Error())
+	case err != nil:
+		return ctx, status.Error(codes.Unavailable, "cannot reach the invoice database")
+	}
+	return context.WithValue(ctx, apiStoreKey{}, s.store.As(u)), nil
+}
+
+// parseBasicAuth returns the user name and password of a basic auth
+// authorization value.
+func parseBasicAuth(value string) (name, password string, ok bool) {
+	encoded, ok := strings.CutPrefix(value, "Basic ")
+	if !ok {
+		return "", "", false
+	}
+	decoded, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return "", "", false
+	}
+	return strings.Cut(string(decoded), ":")
+}
+
+// logInUnary logs in the unary calls, see logIn.
+func (s *GRPCServer) logInUnary(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	ctx, err := s.logIn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return handler(ctx, req)
+}
+
+// loggedInStream is a server stream with the context of logIn.
+type loggedInStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (ss loggedInStream) Context() context.Context {
+	return ss.ctx
+}
+
+// logInStream logs in the streaming calls, see logIn.
+func (s *GRPCServer) logInStream(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	ctx, err := s.logIn(ss.Context())
+	if err != nil {
+		return err
+	}
+	return handler(srv, loggedInStream{ss, ctx})
+}
+
+// storeFor returns the store acting as the user the call logged in as.
+func (s *GRPCServer) storeFor(ctx context.Context) InvoiceStore {
+	return ctx.Value(apiStoreKey{}).(InvoiceStore)
+}
+
+// lookupInvoice returns the invoice with the ID, or a NotFound error.
+func lookupInvoice(store InvoiceStore, id int64) (Invoice, error) {
+	invoice := store.GetInvoiceById(int(id))
+	if id == 0 || invoice.ID != int(id) {
+		return Invoice{}, status.Errorf(codes.NotFound, "invoice %d not found", id)
+	}
+	return invoice, nil
+}
+
+// GetInvoice implements invoicepb.InvoiceServiceServer.
+func (s *GRPCServer) GetInvoice(ctx context.Context, req *invoicepb.GetInvoiceRequest) (*invoicepb.Invoice, error) {
+	store := s.storeFor(ctx)
+	invoice, err := lookupInvoice(store, req.GetId())
+	if err != nil {
+		return nil, err
+	}
+	return invoiceToProto(invoice), nil
+}
+
+// ListInvoices implements invoicepb.InvoiceServiceServer. The invoices are
+// streamed without their line items, see eachInvoicePage.
+func (s *GRPCServer) ListInvoices(req *invoicepb.ListInvoicesRequest, stream invoicepb.InvoiceService_ListInvoicesServer) error {
+	store := s.storeFor(stream.Context())
+	filter, err := newInvoiceFilter(req.GetVendor(), req.Paid, req.GetFrom(), req.GetTo(), req.GetQuery())
+	if err != nil {
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	return eachInvoicePage(store, filter.bson(), func(invoices Invoices) error {
+		for _, invoice := range invoices {
+			if err := stream.Send(invoiceToProto(invoice)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// SearchInvoices implements invoicepb.InvoiceServiceServer. The invoices
+// are streamed without their line items, see eachInvoicePage.
+func (s *GRPCServer) SearchInvoices(req *invoicepb.SearchInvoicesRequest, stream invoicepb.InvoiceService_SearchInvoicesServer) error {
+	store := s.storeFor(stream.Context())
+	if strings.TrimSpace(req.GetQuery()) == "" {
+		return status.Error(codes.InvalidArgument, "query is required")
+	}
+	query, err := ParseSearch(req.GetQuery())
+	if err != nil {
+		return status.Error(codes.InvalidArgument, "invalid query: "+err.Error())
+	}
+
+	return eachInvoicePage(store, query.Filter(), func(invoices Invoices) error {
+		for _, invoice := range invoices {
+			if err := stream.Send(invoiceToProto(invoice)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// ListLineItems implements invoicepb.InvoiceServiceServer.
+func (s *GRPCServer) ListLineItems(ctx context.Context, req *invoicepb.ListLineItemsRequest) (*invoicepb.ListLineItemsResponse, error) {
+	store := s.storeFor(ctx)
+	invoice, err := lookupInvoice(store, req.GetId())
+	if err != nil {
+		return nil, err
+	}
+	items := store.GetTableLineItemView(invoice.InvoiceNo, invoice.Vendor)
+	return &invoicepb.ListLineItemsResponse{Items: itemsToProto(items)}, nil
+}
+
+// ListVendors implements invoicepb.InvoiceServiceServer.
+func (s *GRPCServer) ListVendors(ctx context.Context, req *invoicepb.ListVendorsRequest) (*invoicepb.ListVendorsResponse, error) {
+	store := s.storeFor(ctx)
+	names := store.GetInvoiceVendors()
+	sort.Strings(names)
+
+	resp := &invoicepb.ListVendorsResponse{}
+	for _, name := range names {
+		resp.Vendors = append(resp.Vendors, &invoicepb.Vendor{
+			Name:         name,
+			InvoiceCount: int64(store.CountInvoicesByVendorName(name)),
+		})
+	}
+	return resp, nil
+}
+
+// GetCounts implements invoicepb.InvoiceServiceServer.
+func (s *GRPCServer) GetCounts(ctx context.Context, req *invoicepb.GetCountsRequest) (*invoicepb.Counts, error) {
+	store := s.storeFor(ctx)
+	return &invoicepb.Counts{
+		Invoices: int64(store.RecordCount()),
+		Vendors:  int64(store.CountVendors()),
+		Paid:     int64(store.CountPaidTrue()),
+		Unpaid:   int64(store.CountPaidFalse()),
+	}, nil
+}
+
+// validInvoice converts and validates the invoice of a request.
+func validInvoice(pb *invoicepb.Invoice) (Invoice, error) {
+	if pb == nil {
+		return Invoice{}, status.Error(codes.InvalidArgument, "invoice is required")
+	}
+	for _, item := range pb.GetItems() {
+		if item.GetQuantity() > math.MaxUint16 {
+			return Invoice{}, status.Errorf(codes.InvalidArgument, "quantity %d of %s is too large", item.GetQuantity(), item.GetDescription())
+		}
+	}
+	invoice := invoiceFromProto(pb)
+	if problems := validateInvoice(invoice); len(problems) > 0 {
+		return invoice, status.Error(codes.InvalidArgument, "invalid invoice: "+strings.Join(problems, "; "))
+	}
+	return invoice, nil
+}
+
+// AddInvoice implements invoicepb.InvoiceServiceServer.
+func (s *GRPCServer) AddInvoice(ctx context.Context, req *invoicepb.AddInvoiceRequest) (*invoicepb.Invoice, error) {
+	invoice, err := validInvoice(req.GetInvoice())
+	if err != nil {
+		return nil, err
+	}
+
+	s.writes.Lock()
+	defer s.writes.Unlock()
+
+	store := s.storeFor(ctx)
+	if err := authorizeRPC(store, invoiceActions(invoice, nil)...); err != nil {
+		return nil, err
+	}
+	if store.InvoiceExists(invoice.InvoiceNo, invoice.Vendor) {
+		return nil, status.Errorf(codes.AlreadyExists, "invoice %s from %s already exists", invoice.InvoiceNo, invoice.Vendor)
+	}
+	if !store.AddInvoice(invoice) {
+		return nil, status.Error(codes.Internal, "failed to add invoice")
+	}
+	return invoiceToProto(store.GetInvoiceByInvoiceNoAndVendor(invoice.InvoiceNo, invoice.Vendor)), nil
+}
+
+// UpdateInvoice implements invoicepb.InvoiceServiceServer. The attachments,
+// vendor IDs and buyer of the invoice are kept, as the message has none.
+func (s *GRPCServer) UpdateInvoice(ctx context.Context, req *invoicepb.UpdateInvoiceRequest) (*invoicepb.Invoice, error) {
+	invoice, err := validInvoice(req.GetInvoice())
+	if err != nil {
+		return nil, err
+	}
+
+	s.writes.Lock()
+	defer s.writes.Unlock()
+
+	store := s.storeFor(ctx)
+	current, err := lookupInvoice(store, req.GetInvoice().GetId())
+	if err != nil {
+		return nil, err
+	}
+	invoice.Attachments = current.Attachments
+	invoice.VendorIDs = current.VendorIDs
+	invoice.Buyer = current.Buyer
+	if err := authorizeRPC(store, invoiceActions(invoice, &current)...); err != nil {
+		return nil, err
+	}
+
+	if (invoice.InvoiceNo != current.InvoiceNo || invoice.Vendor != current.Vendor) &&
+		store.InvoiceExists(invoice.InvoiceNo, invoice.Vendor) {
+		return nil, status.Errorf(codes.AlreadyExists, "invoice %s from %s already exists", invoice.InvoiceNo, invoice.Vendor)
+	}
+	if !store.UpdateInvoice(invoice) {
+		return nil, status.Error(codes.Internal, "failed to update invoice")
+	}
+	return invoiceToProto(invoice), nil
+}
+
+// DeleteInvoice implements invoicepb.InvoiceServiceServer.
+func (s *GRPCServer) DeleteInvoice(ctx context.Context, req *invoicepb.DeleteInvoiceRequest) (*invoicepb.DeleteInvoiceResponse, error) {
+	s.writes.Lock()
+	defer s.writes.Unlock()
+
+	store := s.storeFor(ctx)
+	switch store.DeleteInvoice(int(req.GetId())) {
+	case "OK":
+		return &invoicepb.DeleteInvoiceResponse{}, nil
+	case "NOT FOUND":
+		return nil, status.Errorf(codes.NotFound, "invoice %d not found", req.GetId())
+	case "FORBIDDEN":
+		return nil, authorizeRPC(store, ActionDelete)
+	default:
+		return nil, status.Error(codes.Internal, "failed to delete invoice")
+	}
+}
+
+// authorizeRPC returns a PermissionDenied error unless the user the store
+// acts as may take the actions, see users.go.
+func authorizeRPC(store InvoiceStore, actions ...Action) error {
+	for _, action := range actions {
+		if err := store.Authorize(action); err != nil {
+			return status.Error(codes.PermissionDenied, err.Error())
+		}
+	}
+	return nil
+}
+
+// invoiceToProto converts an invoice to its message.
+func invoiceToProto(invoice Invoice) *invoicepb.Invoice {
+	return &invoicepb.Invoice{
+		Id:     int64(invoice.ID),
+		Vendor: invoice.Vendor,
+		Address: &invoicepb.Location{
+			Street:  invoice.Address.Street,
+			City:    invoice.Address.City,
+			State:   invoice.Address.State,
+			Zipcode: invoice.Address.Zipcode,
+			Country: invoice.Address.Country,
+		},
+		Items:         itemsToProto(invoice.LineItems),
+		InvoiceNo:     invoice.InvoiceNo,
+		Date:          invoice.Date,
+		PurchaseOrder: invoice.PurchaseOrder,
+		Total:         invoice.Total,
+		Currency:      invoice.Currency,
+		Paid:          invoice.Paid,
+		DueDate:       invoice.DueDate,
+		TaxTotal:      invoice.TaxTotal,
+		CreditNote:    invoice.CreditNote,
+	}
+}
+
+// itemsToProto converts line items to their messages.
+func itemsToProto(items Items) []*invoicepb.Item {
+	pbs := make([]*invoicepb.Item, len(items))
+	for i, item := range items {
+		pbs[i] = &invoicepb.Item{
+			ProductId:   item.ProductID,
+			Description: item.Description,
+			Quantity:    uint32(item.Quantity),
+			Amount:      item.Amount,
+			UnitCode:    item.UnitCode,
+			TaxCategory: item.TaxCategory,
+			TaxPercent:  item.TaxPercent,
+		}
+	}
+	return pbs
+}
+
+// invoiceFromProto converts a message to an invoice.
+func invoiceFromProto(pb *invoicepb.Invoice) Invoice {
+	invoice := Invoice{
+		ID:     int(pb.GetId()),
+		Vendor: pb.GetVendor(),
+		Address: Location{
+			Street:  pb.GetAddress().GetStreet(),
+			City:    pb.GetAddress().GetCity(),
+			State:   pb.GetAddress().GetState(),
+			Zipcode: pb.GetAddress().GetZipcode(),
+			Country: pb.GetAddress().GetCountry(),
+		},
+		InvoiceNo:     pb.GetInvoiceNo(),
+		Date:          pb.GetDate(),
+		PurchaseOrder: pb.GetPurchaseOrder(),
+		Total:         pb.GetTotal(),
+		Currency:      pb.GetCurrency(),
+		Paid:          pb.GetPaid(),
+		DueDate:       pb.GetDueDate(),
+		TaxTotal:      pb.GetTaxTotal(),
+		CreditNote:    pb.GetCreditNote(),
+	}
+	for _, item := range pb.GetItems() {
+		invoice.LineItems = append(invoice.LineItems, Item{
+			ProductID:   item.GetProductId(),
+			Description: item.GetDescription(),
+			Quantity:    uint16(item.GetQuantity()),
+			Amount:      item.GetAmount(),
+			UnitCode:    item.GetUnitCode(),
+			TaxCategory: item.GetTaxCategory(),
+			TaxPercent:  item.GetTaxPercent(),
+		})
+	}
+	return invoice
+}
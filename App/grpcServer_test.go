@@ -0,0 +1,257 @@
+// Copyright 2016 Cory Robinson. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE.txt file.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/airpaio/goinvoice/rpc/invoiceclient"
+	"github.com/airpaio/goinvoice/rpc/invoicepb"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+// dialTestServer serves the invoice service over the store on an
+// in-process listener and returns a client of it.
+func dialTestServer(t *testing.T, store InvoiceStore, opts ...grpc.DialOption) *invoiceclient.Client {
+	t.Helper()
+	lis := bufconn.Listen(1 << 20)
+	server := NewGRPCServer(store)
+	go server.Serve(lis)
+	t.Cleanup(server.Stop)
+
+	client, err := invoiceclient.DialListener(lis, opts...)
+	if err != nil {
+		t.Fatalf("DialListener: %v", err)
+	}
+	t.Cleanup(func() { client.Close() })
+	return client
+}
+
+// invoiceNos returns the invoice numbers of the invoices.
+func invoiceNos(invoices []*invoicepb.Invoice) string {
+	var nos []string
+	for _, invoice := range invoices {
+		nos = append(nos, invoice.GetInvoiceNo())
+	}
+	return strings.Join(nos, ",")
+}
+
+func TestGRPCListInvoices(t *testing.T) {
+	client := dialTestServer(t, testInvoices())
+	ctx := context.Background()
+
+	tests := []struct {
+		name   string
+		filter invoiceclient.Filter
+		want   string
+	}{
+		{"all", invoiceclient.Filter{}, "N-1,N-2,A-7"},
+		{"vendor", invoiceclient.Filter{Vendor: "niche tools"}, "N-1,N-2"},
+		{"unpaid", invoiceclient.Filter{Paid: invoiceclient.Bool(false)}, "N-1,A-7"},
+		{"dates", invoiceclient.Filter{From: "02/01/2018", To: "03/01/2018"}, "N-2,A-7"},
+		{"text", invoiceclient.Filter{Query: "po-9"}, "A-7"},
+		{"none", invoiceclient.Filter{Vendor: "Nobody"}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			invoices, err := client.Invoices(ctx, tt.filter)
+			if err != nil {
+				t.Fatalf("Invoices: %v", err)
+			}
+			if got := invoiceNos(invoices); got != tt.want {
+				t.Errorf("Invoices = %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	if _, err := client.Invoices(ctx, invoiceclient.Filter{From: "2018-01-01"}); status.Code(err) != codes.InvalidArgument {
+		t.Errorf("Invoices with a bad date: got %v, want InvalidArgument", err)
+	}
+}
+
+func TestGRPCListInvoicesInPages(t *testing.T) {
+	store := &memStore{}
+	for i := 0; i < apiMaxLimit+3; i++ {
+		store.AddInvoice(Invoice{Vendor: "Bolt Co", InvoiceNo: fmt.Sprint(i), Date: "05/01/2018", Total: 100})
+	}
+	client := dialTestServer(t, store)
+
+	invoices, err := client.Invoices(context.Background(), invoiceclient.Filter{})
+	if err != nil {
+		t.Fatalf("Invoices: %v", err)
+	}
+	if len(invoices) != apiMaxLimit+3 {
+		t.Fatalf("Invoices: got %d, want %d", len(invoices), apiMaxLimit+3)
+	}
+	for i, invoice := range invoices {
+		if invoice.GetId() != int64(i+1) {
+			t.Fatalf("invoice %d has ID %d", i, invoice.GetId())
+		}
+	}
+}
+
+func TestGRPCReadInvoices(t *testing.T) {
+	client := dialTestServer(t, testInvoices())
+	ctx := context.Background()
+
+	invoice, err := client.Invoice(ctx, 3)
+	if err != nil {
+		t.Fatalf("Invoice: %v", err)
+	}
+	if invoice.GetInvoiceNo() != "A-7" || invoice.GetTaxTotal() != 1000 || invoice.GetTotal() != 11000 {
+		t.Errorf("Invoice(3) = %v", invoice)
+	}
+	if _, err := client.Invoice(ctx, 42); status.Code(err) != codes.NotFound {
+		t.Errorf("Invoice(42): got %v, want NotFound", err)
+	}
+
+	items, err := client.LineItems(ctx, 1)
+	if err != nil || len(items) != 1 || items[0].GetDescription() != "hammer" || items[0].GetQuantity() != 2 {
+		t.Errorf("LineItems(1) = %v, %v", items, err)
+	}
+
+	found, err := client.Search(ctx, `vendor:niche paid:false "hammer"`)
+	if err != nil || invoiceNos(found) != "N-1" {
+		t.Errorf("Search = %q, %v, want N-1", invoiceNos(found), err)
+	}
+	if _, err := client.Search(ctx, " "); status.Code(err) != codes.InvalidArgument {
+		t.Errorf("empty Search: got %v, want InvalidArgument", err)
+	}
+
+	vendors, err := client.Vendors(ctx)
+	if err != nil {
+		t.Fatalf("Vendors: %v", err)
+	}
+	var names []string
+	for _, v := range vendors {
+		names = append(names, fmt.Sprintf("%s:%d", v.GetName(), v.GetInvoiceCount()))
+	}
+	if got := strings.Join(names, ","); got != "Acme:1,Niche Tools:2" {
+		t.Errorf("Vendors = %q", got)
+	}
+
+	counts, err := client.Counts(ctx)
+	if err != nil || counts.GetInvoices() != 3 || counts.GetVendors() != 2 || counts.GetPaid() != 1 || counts.GetUnpaid() != 2 {
+		t.Errorf("Counts = %v, %v", counts, err)
+	}
+}
+
+func TestGRPCWriteInvoices(t *testing.T) {
+	store := testInvoices()
+	client := dialTestServer(t, store)
+	ctx := context.Background()
+
+	added, err := client.Add(ctx, &invoicepb.Invoice{Vendor: "Acme", InvoiceNo: "A-8", Date: "04/01/2018", Total: 500,
+		Items: []*invoicepb.Item{{Description: "nails", Quantity: 5, Amount: 100}}})
+	if err != nil {
+		t.Fatalf("Add: %v", err)
+	}
+	if added.GetId() != 4 {
+		t.Errorf("Add: ID = %d, want 4", added.GetId())
+	}
+
+	added.Paid = true
+	if _, err := client.Update(ctx, added); err != nil {
+		t.Fatalf("Update: %v", err)
+	}
+	if !store.GetInvoiceById(4).Paid {
+		t.Error("Update did not mark the invoice paid")
+	}
+
+	if err := client.Delete(ctx, 4); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if err := client.Delete(ctx, 4); status.Code(err) != codes.NotFound {
+		t.Errorf("Delete again: got %v, want NotFound", err)
+	}
+}
+
+func TestGRPCErrors(t *testing.T) {
+	store := testInvoices()
+	client := dialTestServer(t, store)
+	ctx := context.Background()
+
+	valid := func() *invoicepb.Invoice {
+		return &invoicepb.Invoice{Vendor: "Acme", InvoiceNo: "A-9", Date: "04/01/2018", Total: 100,
+			Items: []*invoicepb.Item{{Description: "nail", Quantity: 1, Amount: 100}}}
+	}
+	tests := []struct {
+		name   string
+		change func(*invoicepb.Invoice)
+		denied Action
+		want   codes.Code
+	}{
+		{"no vendor", func(pb *invoicepb.Invoice) { pb.Vendor = "" }, "", codes.InvalidArgument},
+		{"wrong total", func(pb *invoicepb.Invoice) { pb.Total = 99 }, "", codes.InvalidArgument},
+		{"zero quantity", func(pb *invoicepb.Invoice) { pb.Items[0].Quantity = 0 }, "", codes.InvalidArgument},
+		{"huge quantity", func(pb *invoicepb.Invoice) { pb.Items[0].Quantity = 70000 }, "", codes.InvalidArgument},
+		{"duplicate", func(pb *invoicepb.Invoice) { pb.InvoiceNo = "A-7" }, "", codes.AlreadyExists},
+		{"not a clerk", func(pb *invoicepb.Invoice) {}, ActionAdd, codes.PermissionDenied},
+		{"not an approver", func(pb *invoicepb.Invoice) { pb.Paid = true }, ActionPay, codes.PermissionDenied},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store.denied = map[Action]bool{tt.denied: true}
+			pb := valid()
+			tt.change(pb)
+			if _, err := client.Add(ctx, pb); status.Code(err) != tt.want {
+				t.Errorf("Add: got %v, want %v", err, tt.want)
+			}
+		})
+	}
+
+	store.denied = map[Action]bool{ActionDelete: true}
+	if err := client.Delete(ctx, 1); status.Code(err) != codes.PermissionDenied {
+		t.Errorf("Delete: got %v, want PermissionDenied", err)
+	}
+	if store.RecordCount() != 3 {
+		t.Errorf("%d invoices after the failed writes, want 3", store.RecordCount())
+	}
+}
+
+func TestGRPCLogin(t *testing.T) {
+	store := testInvoices()
+	for _, u := range []User{{Name: "vera", Role: RoleViewer}, {Name: "carl", Role: RoleClerk}} {
+		if err := u.setPassword("password-of-" + u.Name); err != nil {
+			t.Fatal(err)
+		}
+		store.users = append(store.users, u)
+	}
+	ctx := context.Background()
+	invoice := &invoicepb.Invoice{Vendor: "Acme", InvoiceNo: "A-9", Date: "04/01/2018", Total: 100,
+		Items: []*invoicepb.Item{{Description: "nail", Quantity: 1, Amount: 100}}}
+
+	tests := []struct {
+		name           string
+		user, password string
+		read, add      codes.Code
+	}{
+		{"no login", "", "", codes.Unauthenticated, codes.Unauthenticated},
+		{"wrong password", "vera", "password-of-carl", codes.Unauthenticated, codes.Unauthenticated},
+		{"viewer", "vera", "password-of-vera", codes.OK, codes.PermissionDenied},
+		{"clerk", "carl", "password-of-carl", codes.OK, codes.OK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var opts []grpc.DialOption
+			if tt.user != "" {
+				opts = append(opts, invoiceclient.WithLogin(tt.user, tt.password))
+			}
+			client := dialTestServer(t, store, opts...)
+			if _, err := client.Invoices(ctx, invoiceclient.Filter{}); status.Code(err) != tt.read {
+				t.Errorf("Invoices: got %v, want %v", err, tt.read)
+			}
+			if _, err := client.Add(ctx, invoice); status.Code(err) != tt.add {
+				t.Errorf("Add: got %v, want %v", err, tt.add)
+			}
+		})
+	}
+}
@@ -0,0 +1,268 @@
+// Copyright 2016 Cory Robinson. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE.txt file.
+
+// importWizard.go implements the File > Import wizard. The wizard walks
+// through choosing a CSV file, mapping its columns onto invoice fields and
+// previewing the grouped invoices along with any row errors. Invoices are
+// only added to the DB when the preview has no errors.
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/therecipe/qt/widgets"
+)
+
+// wizard page ids, in the order the pages are added.
+const (
+	importFilePage = iota
+	importMappingPage
+	importPreviewPage
+)
+
+type ImportWizard struct {
+	widgets.QWizard
+
+	_ func() `constructor:"init"`
+
+	_ func() `slot:"browse"`
+
+	fileEditor      *widgets.QLineEdit
+	delimiterEditor *widgets.QLineEdit
+	browseButton    *widgets.QPushButton
+
+	mappingTable  *widgets.QTableWidget
+	mappingCombos []*widgets.QComboBox
+
+	previewTable *widgets.QTableWidget
+	errorsView   *widgets.QPlainTextEdit
+	summaryLabel *widgets.QLabel
+
+	header   []string
+	rows     [][]string
+	preview  *ImportPreview
+	imported int
+
+	model Repository
+}
+
+// init() initializes the wizard with its default slots.
+func (w *ImportWizard) init() {
+	w.ConnectBrowse(w.browse)
+	w.ConnectValidateCurrentPage(w.validateCurrentPage)
+}
+
+// initWith() initializes the wizard pages.
+func (w *ImportWizard) initWith(parent *widgets.QWidget) {
+	w.AddPage(w.createFilePage())
+	w.AddPage(w.createMappingPage())
+	w.AddPage(w.createPreviewPage())
+
+	w.SetWindowTitle("Import Invoices")
+	w.Resize2(750, 500)
+}
+
+// createFilePage() creates the page for choosing the CSV file.
+func (w *ImportWizard) createFilePage() *widgets.QWizardPage {
+	page := widgets.NewQWizardPage(nil)
+	page.SetTitle("Choose File")
+	page.SetSubTitle("Select a CSV file with one line item per row.")
+
+	w.fileEditor = widgets.NewQLineEdit(nil)
+	w.fileEditor.SetPlaceholderText("invoices.csv")
+	w.browseButton = widgets.NewQPushButton2("&Browse...", nil)
+	w.browseButton.ConnectClicked(func(bool) { w.browse() })
+
+	w.delimiterEditor = widgets.NewQLineEdit2(",", nil)
+	w.delimiterEditor.SetMaxLength(1)
+	w.delimiterEditor.SetFixedWidth(27)
+
+	layout := widgets.NewQGridLayout2()
+	layout.AddWidget(widgets.NewQLabel2("FILE:", nil, 0), 0, 0, 0)
+	layout.AddWidget(w.fileEditor, 0, 1, 0)
+	layout.AddWidget(w.browseButton, 0, 2, 0)
+	layout.AddWidget(widgets.NewQLabel2("DELIMITER:", nil, 0), 1, 0, 0)
+	layout.AddWidget(w.delimiterEditor, 1, 1, 0)
+	page.SetLayout(layout)
+
+	return page
+}
+
+// createMappingPage() creates the page for mapping CSV columns onto
+// invoice fields. The combo boxes are filled in once the file is read.
+func (w *ImportWizard) createMappingPage() *widgets.QWizardPage {
+	page := widgets.NewQWizardPage(nil)
+	page.SetTitle("Map Columns")
+	page.SetSubTitle("Choose the CSV column for each invoice field. Vendor and Invoice No. are required.")
+
+	w.mappingTable = widgets.NewQTableWidget2(len(importFields), 1, nil)
+	w.mappingTable.SetHorizontalHeaderLabels([]string{"CSV Column"})
+	w.mappingTable.SetVerticalHeaderLabels(importFields)
+	w.mappingTable.HorizontalHeader().SetSectionResizeMode2(0, widgets.QHeaderView__Stretch)
+
+	layout := widgets.NewQVBoxLayout()
+	layout.AddWidget(w.mappingTable, 0, 0)
+	page.SetLayout(layout)
+
+	return page
+}
+
+// createPreviewPage() creates the page previewing the grouped invoices
+// and listing row errors.
+func (w *ImportWizard) createPreviewPage() *widgets.QWizardPage {
+	page := widgets.NewQWizardPage(nil)
+	page.SetTitle("Preview")
+	page.SetSubTitle("Check the invoices below. Press Finish to add them.")
+
+	w.previewTable = widgets.NewQTableWidget2(0, 5, nil)
+	w.previewTable.SetHorizontalHeaderLabels([]string{"Vendor", "Invoice No.", "Date", "Lines", "Total"})
+	w.previewTable.SetEditTriggers(widgets.QAbstractItemView__NoEditTriggers)
+	w.previewTable.HorizontalHeader().SetSectionResizeMode2(0, widgets.QHeaderView__Stretch)
+
+	w.errorsView = widgets.NewQPlainTextEdit(nil)
+	w.errorsView.SetReadOnly(true)
+
+	w.summaryLabel = widgets.NewQLabel(nil, 0)
+
+	layout := widgets.NewQVBoxLayout()
+	layout.AddWidget(w.previewTable, 1, 0)
+	layout.AddWidget(w.summaryLabel, 0, 0)
+	layout.AddWidget(w.errorsView, 1, 0)
+	page.SetLayout(layout)
+
+	return page
+}
+
+// browse() slot to pick the CSV file with a file dialog.
+func (w *ImportWizard) browse() {
+	name := widgets.QFileDialog_GetOpenFileName(w, "Import Invoices", "",
+		"CSV files (*.csv);;All files (*)", "", 0)
+	if name != "" {
+		w.fileEditor.SetText(name)
+	}
+}
+
+// validateCurrentPage() is called when Next or Finish is pressed. It does
+// the work for the page being left and keeps the wizard on that page if
+// something went wrong.
+func (w *ImportWizard) validateCurrentPage() bool {
+	switch w.CurrentId() {
+	case importFilePage:
+		return w.readFile()
+	case importMappingPage:
+		w.showPreview()
+		return true
+	case importPreviewPage:
+		return w.commit()
+	}
+	return w.ValidateCurrentPageDefault()
+}
+
+// readFile() reads the chosen CSV file and fills in the mapping page.
+func (w *ImportWizard) readFile() bool {
+	delimiter := []rune(w.delimiterEditor.Text())
+	if len(delimiter) != 1 {
+		delimiter = []rune{','}
+	}
+
+	file, err := os.Open(w.fileEditor.Text())
+	if err != nil {
+		widgets.QMessageBox_Warning(w, "Import Invoices", err.Error(),
+			widgets.QMessageBox__Ok, widgets.QMessageBox__Ok)
+		return false
+	}
+	defer file.Close()
+
+	w.header, w.rows, err = ReadCSV(file, delimiter[0])
+	if err != nil {
+		widgets.QMessageBox_Warning(w, "Import Invoices", fmt.Sprintf("Failed to read CSV: %v", err),
+			widgets.QMessageBox__Ok, widgets.QMessageBox__Ok)
+		return false
+	}
+
+	guess := GuessMapping(w.header)
+	columns := append([]string{"<not mapped>"}, w.header...)
+
+	w.mappingCombos = make([]*widgets.QComboBox, len(importFields))
+	for i, field := range importFields {
+		combo := widgets.NewQComboBox(nil)
+		combo.AddItems(columns)
+		if col, ok := guess[field]; ok {
+			combo.SetCurrentIndex(col + 1)
+		}
+		w.mappingTable.SetCellWidget(i, 0, combo)
+		w.mappingCombos[i] = combo
+	}
+
+	return true
+}
+
+// mapping() returns the column mapping chosen on the mapping page.
+func (w *ImportWizard) mapping() ColumnMapping {
+	mapping := ColumnMapping{}
+	for i, combo := range w.mappingCombos {
+		if col := combo.CurrentIndex() - 1; col >= 0 {
+			mapping[importFields[i]] = col
+		}
+	}
+	return mapping
+}
+
+// showPreview() parses the rows with the chosen mapping and fills in the
+// preview page.
+func (w *ImportWizard) showPreview() {
+	w.preview = ParseCSVInvoices(w.rows, w.mapping())
+	w.preview.CheckExisting(w.model)
+
+	w.previewTable.SetRowCount(len(w.preview.Invoices))
+	for i, invoice := range w.preview.Invoices {
+		w.previewTable.SetItem(i, 0, widgets.NewQTableWidgetItem2(invoice.Vendor, 0))
+		w.previewTable.SetItem(i, 1, widgets.NewQTableWidgetItem2(invoice.InvoiceNo, 0))
+		w.previewTable.SetItem(i, 2, widgets.NewQTableWidgetItem2(invoice.Date, 0))
+		w.previewTable.SetItem(i, 3, widgets.NewQTableWidgetItem2(fmt.Sprint(len(invoice.LineItems)), 0))
+		w.previewTable.SetItem(i, 4, widgets.NewQTableWidgetItem2(formatCents(invoice.Total), 0))
+	}
+	w.previewTable.ResizeColumnsToContents()
+
+	errs := make([]string, len(w.preview.Errors))
+	for i, e := range w.preview.Errors {
+		errs[i] = e.Error()
+	}
+	w.errorsView.SetPlainText(strings.Join(errs, "\n"))
+
+	w.summaryLabel.SetText(fmt.Sprintf("%d invoices from %d rows, %d errors",
+		len(w.preview.Invoices), len(w.rows), len(w.preview.Errors)))
+	if len(w.preview.Errors) > 0 {
+		w.summaryLabel.SetStyleSheet("QLabel { color: red; }")
+	} else {
+		w.summaryLabel.SetStyleSheet("")
+	}
+	w.errorsView.SetVisible(len(w.preview.Errors) > 0)
+}
+
+// commit() adds the previewed invoices to the DB.
+func (w *ImportWizard) commit() bool {
+	if w.preview == nil {
+		return false
+	}
+	if len(w.preview.Errors) > 0 {
+		widgets.QMessageBox_Warning(w, "Import Invoices",
+			"Fix the errors listed in the preview before importing.",
+			widgets.QMessageBox__Ok, widgets.QMessageBox__Ok)
+		return false
+	}
+
+	count, err := w.preview.Commit(w.model)
+	w.imported = count
+	if err != nil {
+		widgets.QMessageBox_Critical(w, "Import Invoices", err.Error(),
+			widgets.QMessageBox__Ok, widgets.QMessageBox__Ok)
+		return false
+	}
+
+	return true
+}
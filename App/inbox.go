@@ -0,0 +1,243 @@
+// Copyright 2016 Cory Robinson. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE.txt file.
+
+// inbox.go implements the inbox folder: files dropped into a directory are
+// picked up in the background, read with ReadInvoicesFile and, if they
+// have no problems, added to the repository. A file is imported all or
+// nothing; a file holding a single invoice is attached to it. Afterwards it is moved to the processed or failed subfolder;
+// failed files get an error report next to them.
+//
+// The folder is polled rather than watched for events, so it also works
+// on network shares. Files are only picked up once they have not been
+// modified for a moment, which skips files that are still being copied.
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Subfolders of the inbox for the files that were processed.
+const (
+	INBOXPROCESSED = "processed"
+	INBOXFAILED    = "failed"
+)
+
+// inboxInterval is the default time between scans of the inbox, and
+// inboxSettle how long a file must be unchanged before it is picked up.
+const (
+	inboxInterval = 5 * time.Second
+	inboxSettle   = 2 * time.Second
+)
+
+// InboxResult is the outcome of processing one file of the inbox.
+type InboxResult struct {
+	File     string   // name of the file in the inbox
+	Format   string   // format of the file, "" if it is unknown
+	Imported int      // number of invoices added
+	Problems []string // why the file failed
+	MovedTo  string   // where the file was moved to
+}
+
+// Failed reports whether the file was moved to the failed folder.
+func (r InboxResult) Failed() bool {
+	return len(r.Problems) > 0
+}
+
+// Inbox watches a directory for invoice files.
+type Inbox struct {
+	Dir      string
+	Interval time.Duration // time between scans of Dir
+
+	// Processed is called, from the watching goroutine, for every file
+	// that was processed.
+	Processed func(result InboxResult)
+
+	repository Repository
+	stop       chan struct{}
+	done       sync.WaitGroup
+}
+
+// NewInbox returns an inbox for dir, scanned every interval, or every
+// inboxInterval if interval is not positive.
+func NewInbox(dir string, interval time.Duration) *Inbox {
+	if interval <= 0 {
+		interval = inboxInterval
+	}
+	return &Inbox{Dir: dir, Interval: interval}
+}
+
+// Start starts watching the inbox in the background.
+func (in *Inbox) Start() error {
+	if info, err := os.Stat(in.Dir); err != nil {
+		return err
+	} else if !info.IsDir() {
+		return fmt.Errorf("%s is not a directory", in.Dir)
+	}
+	if in.stop != nil {
+		return nil // already running
+	}
+
+	in.stop = make(chan struct{})
+	in.done.Add(1)
+	go func(stop chan struct{}) {
+		defer in.done.Done()
+		ticker := time.NewTicker(in.Interval)
+		defer ticker.Stop()
+		for {
+			in.Scan()
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+			}
+		}
+	}(in.stop)
+
+	return nil
+}
+
+// Stop stops watching the inbox and waits for a scan in progress.
+func (in *Inbox) Stop() {
+	if in.stop == nil {
+		return
+	}
+	close(in.stop)
+	in.done.Wait()
+	in.stop = nil
+}
+
+// Running reports whether the inbox is being watched.
+func (in *Inbox) Running() bool {
+	return in.stop != nil
+}
+
+// Scan processes the files in the inbox once.
+func (in *Inbox) Scan() []InboxResult {
+	entries, err := os.ReadDir(in.Dir)
+	if err != nil {
+		fmt.Println("Failed to read inbox:", err)
+		return nil
+	}
+
+	var results []InboxResult
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || strings.HasPrefix(name, ".") || strings.HasPrefix(name, "~") ||
+			strings.HasSuffix(name, ".tmp") || strings.HasSuffix(name, ".part") {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil || time.Since(info.ModTime()) < inboxSettle {
+			continue
+		}
+
+		result := in.process(name)
+		if in.Processed != nil {
+			in.Processed(result)
+		}
+		results = append(results, result)
+	}
+
+	return results
+}
+
+// process imports one file and moves it out of the inbox.
+func (in *Inbox) process(name string) InboxResult {
+	result := InboxResult{File: name}
+	path := filepath.Join(in.Dir, name)
+
+	format, invoices, problems, err := ReadInvoicesFile(path)
+	result.Format = format
+	switch {
+	case err != nil:
+		result.Problems = []string{err.Error()}
+	case len(problems) > 0:
+		result.Problems = problems
+	case len(invoices) == 0:
+		result.Problems = []string{"no invoices found"}
+	}
+
+	if !result.Failed() {
+		for _, invoice := range invoices {
+			if in.repository.InvoiceExists(invoice.InvoiceNo, invoice.Vendor) {
+				result.Problems = append(result.Problems,
+					fmt.Sprintf("invoice %s from %s already exists", invoice.InvoiceNo, invoice.Vendor))
+			}
+		}
+	}
+
+	if !result.Failed() {
+		for _, invoice := range invoices {
+			if !in.repository.AddInvoice(invoice) {
+				result.Problems = append(result.Problems,
+					fmt.Sprintf("failed to add invoice %s from %s, %d of %d invoices were added",
+						invoice.InvoiceNo, invoice.Vendor, result.Imported, len(invoices)))
+				break
+			}
+			result.Imported++
+		}
+		if result.Imported == 1 {
+			in.attachOriginal(path, invoices[0])
+		}
+	}
+
+	folder := INBOXPROCESSED
+	if result.Failed() {
+		folder = INBOXFAILED
+	}
+	moved, err := moveToFolder(path, filepath.Join(in.Dir, folder))
+	if err != nil {
+		// leaving the file would import it again on the next scan
+		result.Problems = append(result.Problems, fmt.Sprintf("failed to move file: %v", err))
+		return result
+	}
+	result.MovedTo = moved
+
+	if result.Failed() {
+		report := fmt.Sprintf("%s\nFormat: %s\nProcessed: %s\n\n%s\n", name, format,
+			time.Now().Format("01/02/2006 3:04 PM"), strings.Join(result.Problems, "\n"))
+		if err := os.WriteFile(moved+".errors.txt", []byte(report), 0644); err != nil {
+			fmt.Println("Failed to write inbox error report:", err)
+		}
+	}
+
+	return result
+}
+
+// attachOriginal attaches the file an invoice was imported from to the
+// invoice, so the original PDF or XML is kept with the record.
+func (in *Inbox) attachOriginal(path string, invoice Invoice) {
+	data, err := os.ReadFile(path)
+	if err == nil {
+		invoice = in.repository.GetInvoiceByInvoiceNoAndVendor(invoice.InvoiceNo, invoice.Vendor)
+		_, err = in.repository.AddAttachment(&invoice, path, data)
+	}
+	if err != nil {
+		fmt.Println("Failed to attach the original file:", err)
+	}
+}
+
+// moveToFolder moves a file into folder, creating it if needed. If a file
+// of that name is already there, a timestamp is added to the name.
+func moveToFolder(path, folder string) (string, error) {
+	if err := os.MkdirAll(folder, 0755); err != nil {
+		return "", err
+	}
+
+	name := filepath.Base(path)
+	target := filepath.Join(folder, name)
+	if _, err := os.Stat(target); err == nil {
+		ext := filepath.Ext(name)
+		target = filepath.Join(folder, fmt.Sprintf("%s-%s%s", strings.TrimSuffix(name, ext),
+			time.Now().Format("20060102-150405.000"), ext))
+	}
+
+	return target, os.Rename(path, target)
+}
@@ -0,0 +1,211 @@
+// Copyright 2016 Cory Robinson. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE.txt file.
+
+// invoicePager.go fetches the rows of the invoices table a page at a time,
+// letting the DB filter and sort them, so that the table opens as quickly
+// with 100k invoices as with 10. The Qt side is InvoiceTableModel.
+
+package main
+
+import (
+	"gopkg.in/mgo.v2/bson"
+)
+
+// invoicePageSize is the number of invoices fetched at a time.
+const invoicePageSize = 200
+
+// PageStore is the part of Repository the pager uses.
+type PageStore interface {
+	CountInvoices(filter bson.M) int
+	GetInvoicePage(filter bson.M, sort []string, skip, limit int) Invoices
+}
+
+// invoicePager holds the invoices of the table fetched so far. The query
+// of a pager is set on the GUI thread; firstRows may then run in a
+// goroutine, as it only reads the query.
+type invoicePager struct {
+	store   PageStore
+	columns []tableColumn[Invoice]
+	filter  bson.M
+
+	sortKey    string // of the column sorted by, "" for the order of the IDs
+	descending bool
+
+	count int // number of invoices selected by the filter
+	rows  Invoices
+}
+
+// newInvoicePager returns a pager listing every invoice of the store.
+func newInvoicePager(store PageStore) *invoicePager {
+	return &invoicePager{store: store, columns: invoiceColumnsOf(defaultInvoiceColumns, false), filter: bson.M{}}
+}
+
+// invoiceTableFilter returns the filter of the invoices of a vendor, or of
+// all vendors for "", found by a search.
+func invoiceTableFilter(vendor string, search SearchQuery) bson.M {
+	var and []bson.M
+	if vendor != "" {
+		and = append(and, bson.M{"vendor": vendor})
+	}
+	if !search.IsEmpty() {
+		and = append(and, search.Filter())
+	}
+	switch len(and) {
+	case 0:
+		return bson.M{}
+	case 1:
+		return and[0]
+	}
+	return bson.M{"$and": and}
+}
+
+// clone returns a pager with the same store, query and order, and none of
+// the rows, to change the query of and run it in the background.
+func (p *invoicePager) clone() *invoicePager {
+	return &invoicePager{
+		store:      p.store,
+		columns:    p.columns,
+		filter:     p.filter,
+		sortKey:    p.sortKey,
+		descending: p.descending,
+	}
+}
+
+// setQuery lists the invoices selected by the filter in the columns. The
+// sort order is kept if its column is.
+func (p *invoicePager) setQuery(columns []tableColumn[Invoice], filter bson.M) {
+	p.columns = columns
+	if p.sortColumn() < 0 {
+		p.sortKey, p.descending = "", false
+	}
+	p.filter = filter
+}
+
+// setSort sorts the invoices by a column. The order is kept for a column
+// the DB cannot sort by.
+func (p *invoicePager) setSort(column int, descending bool) {
+	switch {
+	case column < 0 || column >= len(p.columns):
+		p.sortKey, p.descending = "", descending
+	case p.columns[column].sort != "":
+		p.sortKey, p.descending = p.columns[column].key, descending
+	}
+}
+
+// sortColumn returns the column sorted by, or -1 for the order of the IDs.
+func (p *invoicePager) sortColumn() int {
+	if p.sortKey == "" {
+		return -1
+	}
+	for i, column := range p.columns {
+		if column.key == p.sortKey && column.sort != "" {
+			return i
+		}
+	}
+	return -1
+}
+
+// sort returns the sort fields of the current order. The ID comes last to
+// keep the order of equal values the same from one page to the next.
+func (p *invoicePager) sort() []string {
+	prefix := ""
+	if p.descending {
+		prefix = "-"
+	}
+	column := p.sortColumn()
+	if column < 0 {
+		return []string{prefix + "id"}
+	}
+	return []string{prefix + p.columns[column].sort, prefix + "id"}
+}
+
+// canFetchMore reports whether some of the invoices selected have not been
+// fetched yet.
+func (p *invoicePager) canFetchMore() bool {
+	return len(p.rows) < p.count
+}
+
+// nextPage returns the next page of invoices without adding it to the
+// rows, see append.
+func (p *invoicePager) nextPage() Invoices {
+	if !p.canFetchMore() {
+		return nil
+	}
+	return p.store.GetInvoicePage(p.filter, p.sort(), len(p.rows), invoicePageSize)
+}
+
+// append adds a page returned by nextPage to the rows.
+func (p *invoicePager) append(page Invoices) {
+	p.rows = append(p.rows, page...)
+	if len(page) < invoicePageSize {
+		// the last page, or invoices were deleted since the count
+		p.count = len(p.rows)
+	}
+}
+
+// firstRows counts the invoices selected and fetches the first n of them,
+// at least a page; a refresh fetches as many as are shown, to keep the place
+// in a long list. It leaves the pager alone, so it may run in the
+// background, see setRows.
+func (p *invoicePager) firstRows(n int) (count int, rows Invoices) {
+	count = p.store.CountInvoices(p.filter)
+	limit := max(n, invoicePageSize)
+	rows = p.store.GetInvoicePage(p.filter, p.sort(), 0, limit)
+	if len(rows) < limit {
+		count = len(rows)
+	}
+	return count, rows
+}
+
+// setRows replaces the invoices fetched by those of firstRows.
+func (p *invoicePager) setRows(count int, rows Invoices) {
+	p.count, p.rows = count, rows
+}
+
+// rowOf returns the row of the invoice with the id, or -1 if it has not
+// been fetched.
+func (p *invoicePager) rowOf(id int) int {
+	for row, invoice := range p.rows {
+		if invoice.ID == id {
+			return row
+		}
+	}
+	return -1
+}
+
+// replace sets the invoice of a row to the invoice queried again, and
+// reports whether it keeps its place in the sort order. If not, the rows
+// have to be fetched again.
+func (p *invoicePager) replace(row int, invoice Invoice) bool {
+	old := p.rows[row]
+	p.rows[row] = invoice
+	if p.sortColumn() < 0 {
+		return true
+	}
+	column := p.columns[p.sortColumn()]
+	return compareValues(column.cell(old).value, column.cell(invoice).value) == 0
+}
+
+// remove drops a row, of an invoice deleted or no longer selected.
+func (p *invoicePager) remove(row int) {
+	p.rows = append(p.rows[:row], p.rows[row+1:]...)
+	p.count--
+}
+
+// cell returns a cell of the table.
+func (p *invoicePager) cell(row, column int) tableCell {
+	if row < 0 || row >= len(p.rows) || column < 0 || column >= len(p.columns) {
+		return tableCell{}
+	}
+	return p.columns[column].cell(p.rows[row])
+}
+
+// invoice returns the invoice of a row, with only the invoicePageFields
+// filled in.
+func (p *invoicePager) invoice(row int) (Invoice, bool) {
+	if row < 0 || row >= len(p.rows) {
+		return Invoice{}, false
+	}
+	return p.rows[row], true
+}
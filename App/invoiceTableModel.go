@@ -0,0 +1,313 @@
+// Copyright 2016 Cory Robinson. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE.txt file.
+
+// invoiceTableModel.go implements the model of the invoices table. The
+// model is made once and kept by the table; changing the vendor, the search
+// or the sort order resets it with a new query, and scrolling to the end of
+// the table appends the next page of invoices, see invoicePager.go. The
+// queries run in the background, see loader.go. Changes to the invoices
+// made meanwhile are applied in place, see applyChanges.
+
+package main
+
+import (
+	"context"
+
+	"github.com/therecipe/qt/core"
+	"gopkg.in/mgo.v2/bson"
+)
+
+type InvoiceTableModel struct {
+	core.QAbstractTableModel
+
+	_ func() `constructor:"init"`
+
+	pager    *invoicePager
+	pending  *invoicePager // of the query resetting the model, if running
+	fetching bool          // a query is running, see load
+
+	// load runs a query in the background and calls done with its error
+	// on the GUI thread, see MainWindow.load
+	load func(kind string, run func(ctx context.Context) error, done func(err error))
+
+	// reset is called after the model was reset with a new query
+	reset func()
+}
+
+// init() connects the model to its pager over the repository.
+func (m *InvoiceTableModel) init() {
+	m.pager = newInvoicePager(Repository{})
+
+	m.ConnectRowCount(m.rowCount)
+	m.ConnectColumnCount(m.columnCount)
+	m.ConnectData(m.data)
+	m.ConnectHeaderData(m.headerData)
+	m.ConnectCanFetchMore(m.canFetchMore)
+	m.ConnectFetchMore(m.fetchMore)
+	m.ConnectSort(m.sort)
+}
+
+// setQuery() lists the invoices selected by the filter in the columns.
+func (m *InvoiceTableModel) setQuery(columns []tableColumn[Invoice], filter bson.M) {
+	next := m.latest().clone()
+	next.setQuery(columns, filter)
+	m.query(next, 0)
+}
+
+// setView() lists the invoices selected by the filter in the columns,
+// sorted by the column with the key, i.e. of a saved view.
+func (m *InvoiceTableModel) setView(columns []tableColumn[Invoice], filter bson.M, sortKey string, descending bool) {
+	next := m.latest().clone()
+	next.sortKey, next.descending = sortKey, descending
+	next.setQuery(columns, filter)
+	m.query(next, 0)
+}
+
+// sortOrder() returns the key of the column sorted by, "" for none, and
+// the order, of the query asked for last.
+func (m *InvoiceTableModel) sortOrder() (key string, descending bool) {
+	latest := m.latest()
+	return latest.sortKey, latest.descending
+}
+
+// sortIndicator() returns the column sorted by, -1 for none, and the order
+// shown, for the header.
+func (m *InvoiceTableModel) sortIndicator() (int, core.Qt__SortOrder) {
+	if m.pager.descending {
+		return m.pager.sortColumn(), core.Qt__DescendingOrder
+	}
+	return m.pager.sortColumn(), core.Qt__AscendingOrder
+}
+
+// filter() returns the filter of the invoices shown.
+func (m *InvoiceTableModel) filter() bson.M {
+	return m.pager.filter
+}
+
+// columns() returns the columns shown.
+func (m *InvoiceTableModel) columns() []tableColumn[Invoice] {
+	return m.pager.columns
+}
+
+// latest() returns the pager of the query resetting the model if one is
+// running, or else the pager shown, so that a new query builds on the one
+// asked for last.
+func (m *InvoiceTableModel) latest() *invoicePager {
+	if m.pending != nil {
+		return m.pending
+	}
+	return m.pager
+}
+
+// query() runs the query of a new pager in the background, fetching at
+// least rows rows, and resets the model with it once it is done. The rows
+// shown are kept until then. The query has to be set up before, as the
+// pager is only read meanwhile, i.e. by latest().
+func (m *InvoiceTableModel) query(next *invoicePager, rows int) {
+	m.fetching = true
+	m.pending = next
+	var count int
+	var found Invoices
+	m.load("invoices", func(ctx context.Context) error {
+		count, found = next.firstRows(rows)
+		return nil
+	}, func(err error) {
+		m.fetching = false
+		m.pending = nil
+		if err != nil {
+			// the rows shown are kept, and paged on once the DB is back
+			return
+		}
+		next.setRows(count, found)
+		m.BeginResetModel()
+		m.pager = next
+		m.EndResetModel()
+		if m.reset != nil {
+			m.reset()
+		}
+	})
+}
+
+// refresh() runs the query again, fetching as many rows as are shown, to
+// show changes to the invoices.
+func (m *InvoiceTableModel) refresh() {
+	m.query(m.latest().clone(), len(m.pager.rows))
+}
+
+// applyChanges() updates the table for changes to the invoices. Deleted
+// invoices are removed, and updated invoices are queried again and changed
+// in place, or removed if the query no longer selects them. Anything else,
+// i.e. a new invoice, whose row is not known, refreshes the table.
+func (m *InvoiceTableModel) applyChanges(changes []Change) {
+	if m.pending != nil {
+		m.refresh()
+		return
+	}
+
+	var updated []int
+	for _, change := range changes {
+		switch {
+		case change.Op == ChangeUpdate && change.ID != 0:
+			updated = append(updated, change.ID)
+		case change.Op == ChangeDelete && change.ID != 0:
+			if row := m.pager.rowOf(change.ID); row >= 0 {
+				m.removeRow(row)
+			}
+		default:
+			m.refresh()
+			return
+		}
+	}
+	if len(updated) == 0 {
+		return
+	}
+
+	pager := m.pager
+	store, sort := pager.store, pager.sort()
+	filter := bson.M{"$and": []bson.M{pager.filter, {"id": bson.M{"$in": updated}}}}
+	var found Invoices
+	m.load("invoice-changes", func(ctx context.Context) error {
+		found = store.GetInvoicePage(filter, sort, 0, len(updated))
+		return nil
+	}, func(err error) {
+		if err != nil || m.pager != pager || m.pending != nil {
+			// reset meanwhile
+			return
+		}
+		invoices := make(map[int]Invoice, len(found))
+		for _, invoice := range found {
+			invoices[invoice.ID] = invoice
+		}
+		root := core.NewQModelIndex()
+		for _, id := range updated {
+			row := pager.rowOf(id)
+			invoice, selected := invoices[id]
+			switch {
+			case row >= 0 && selected:
+				if !pager.replace(row, invoice) {
+					m.refresh()
+					return
+				}
+				m.DataChanged(m.Index(row, 0, root), m.Index(row, len(pager.columns)-1, root),
+					[]int{int(core.Qt__DisplayRole)})
+			case row >= 0:
+				m.removeRow(row)
+			case selected:
+				// selected now, somewhere in the list
+				m.refresh()
+				return
+			}
+		}
+	})
+}
+
+// removeRow() removes a row of the table.
+func (m *InvoiceTableModel) removeRow(row int) {
+	m.BeginRemoveRows(core.NewQModelIndex(), row, row)
+	m.pager.remove(row)
+	m.EndRemoveRows()
+}
+
+// rowOf() returns the row of the invoice with the id, or -1 if it is not
+// listed.
+func (m *InvoiceTableModel) rowOf(id int) int {
+	return m.pager.rowOf(id)
+}
+
+// invoice() returns the invoice of a row, with only the fields shown in
+// the table filled in.
+func (m *InvoiceTableModel) invoice(row int) (Invoice, bool) {
+	return m.pager.invoice(row)
+}
+
+// fetchAll() fetches the invoices not fetched yet, i.e. to print the list.
+// Unlike the other queries of the model, it waits for them.
+func (m *InvoiceTableModel) fetchAll() {
+	root := core.NewQModelIndex()
+	for m.pager.canFetchMore() {
+		first := len(m.pager.rows)
+		page := m.pager.nextPage()
+		if len(page) == 0 {
+			m.pager.append(page)
+			return
+		}
+		m.BeginInsertRows(root, first, first+len(page)-1)
+		m.pager.append(page)
+		m.EndInsertRows()
+	}
+}
+
+func (m *InvoiceTableModel) rowCount(parent *core.QModelIndex) int {
+	if parent.IsValid() {
+		return 0
+	}
+	return len(m.pager.rows)
+}
+
+func (m *InvoiceTableModel) columnCount(parent *core.QModelIndex) int {
+	if parent.IsValid() {
+		return 0
+	}
+	return len(m.pager.columns)
+}
+
+func (m *InvoiceTableModel) data(index *core.QModelIndex, role int) *core.QVariant {
+	return cellData(m.pager.cell(index.Row(), index.Column()), role)
+}
+
+func (m *InvoiceTableModel) headerData(section int, orientation core.Qt__Orientation, role int) *core.QVariant {
+	if role != int(core.Qt__DisplayRole) || orientation != core.Qt__Horizontal {
+		return m.HeaderDataDefault(section, orientation, role)
+	}
+	if section < 0 || section >= len(m.pager.columns) {
+		return core.NewQVariant()
+	}
+	return core.NewQVariant14(m.pager.columns[section].title)
+}
+
+func (m *InvoiceTableModel) canFetchMore(parent *core.QModelIndex) bool {
+	return !parent.IsValid() && !m.fetching && m.pager.canFetchMore()
+}
+
+// fetchMore() fetches the next page of invoices in the background and
+// appends it to the table.
+func (m *InvoiceTableModel) fetchMore(parent *core.QModelIndex) {
+	if !m.canFetchMore(parent) {
+		return
+	}
+
+	// the goroutine only gets copies, the pager stays with the GUI thread
+	pager := m.pager
+	store, filter, sort, first := pager.store, pager.filter, pager.sort(), len(pager.rows)
+	var page Invoices
+	m.fetching = true
+	m.load("invoices", func(ctx context.Context) error {
+		page = store.GetInvoicePage(filter, sort, first, invoicePageSize)
+		return nil
+	}, func(err error) {
+		m.fetching = false
+		if err != nil {
+			return
+		}
+		if len(pager.rows) != first {
+			// fetched meanwhile by fetchAll
+			return
+		}
+		if len(page) == 0 {
+			pager.append(page)
+			return
+		}
+		m.BeginInsertRows(core.NewQModelIndex(), first, first+len(page)-1)
+		pager.append(page)
+		m.EndInsertRows()
+	})
+}
+
+// sort() sorts the invoices by a column in the DB and lists them again
+// from the first page.
+func (m *InvoiceTableModel) sort(column int, order core.Qt__SortOrder) {
+	next := m.latest().clone()
+	next.setSort(column, order == core.Qt__DescendingOrder)
+	m.query(next, 0)
+}
@@ -0,0 +1,100 @@
+// Copyright 2016 Cory Robinson. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE.txt file.
+
+// invoiceViews.go implements the saved views of the invoices table, see
+// the Views tool bar of MainWindow. The views are kept in the settings
+// file as JSON, along with the columns shown.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// invoiceView is a saved view of the invoices table: the invoices listed,
+// the columns shown and the sort order.
+type invoiceView struct {
+	Name       string   `json:"name"`
+	Vendor     string   `json:"vendor,omitempty"` // "" for all invoices
+	Search     string   `json:"search,omitempty"`
+	Columns    []string `json:"columns"`
+	Sort       string   `json:"sort,omitempty"` // key of the column sorted by
+	Descending bool     `json:"descending,omitempty"`
+}
+
+// parseInvoiceViews returns the views saved in the settings as data. Views
+// which cannot be read are dropped.
+func parseInvoiceViews(data string) []invoiceView {
+	if strings.TrimSpace(data) == "" {
+		return nil
+	}
+	var views []invoiceView
+	if err := json.Unmarshal([]byte(data), &views); err != nil {
+		fmt.Println("Failed to read saved views:", err)
+		return nil
+	}
+	var kept []invoiceView
+	for _, view := range views {
+		if view.Name = strings.TrimSpace(view.Name); view.Name != "" {
+			kept = append(kept, view)
+		}
+	}
+	return kept
+}
+
+// formatInvoiceViews returns the views to save in the settings.
+func formatInvoiceViews(views []invoiceView) string {
+	data, err := json.Marshal(views)
+	if err != nil {
+		fmt.Println("Failed to save views:", err)
+		return "[]"
+	}
+	return string(data)
+}
+
+// findInvoiceView returns the view with the name, ignoring case.
+func findInvoiceView(views []invoiceView, name string) (invoiceView, bool) {
+	for _, view := range views {
+		if strings.EqualFold(view.Name, name) {
+			return view, true
+		}
+	}
+	return invoiceView{}, false
+}
+
+// saveInvoiceView returns the views with the view added, or replacing the
+// view of the same name, sorted by name.
+func saveInvoiceView(views []invoiceView, view invoiceView) []invoiceView {
+	saved := append([]invoiceView{view}, deleteInvoiceView(views, view.Name)...)
+	sort.SliceStable(saved, func(i, j int) bool {
+		return strings.ToLower(saved[i].Name) < strings.ToLower(saved[j].Name)
+	})
+	return saved
+}
+
+// deleteInvoiceView returns the views without the view with the name.
+func deleteInvoiceView(views []invoiceView, name string) []invoiceView {
+	var kept []invoiceView
+	for _, view := range views {
+		if !strings.EqualFold(view.Name, name) {
+			kept = append(kept, view)
+		}
+	}
+	return kept
+}
+
+// parseColumnKeys returns the column keys saved in the settings as a comma
+// separated list.
+func parseColumnKeys(s string) []string {
+	var keys []string
+	for _, key := range strings.Split(s, ",") {
+		if key = strings.TrimSpace(key); key != "" {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
@@ -0,0 +1,132 @@
+// Copyright 2016 Cory Robinson. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE.txt file.
+
+// loader.go runs the queries of the GUI in goroutines, so that a slow or
+// unreachable DB does not freeze the window. The results are handed back
+// to the GUI thread, where the views are updated, see MainWindow.load.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"sync"
+)
+
+// Loader runs queries in goroutines. Every query has a kind, i.e.
+// "invoices" for the invoices table, and starting a query cancels the one
+// of the same kind still running: its context is cancelled and its result
+// dropped, so switching vendors mid-query never shows the old vendor.
+type Loader struct {
+	// Notify is called from the goroutine of a query once it is done. It
+	// must have Deliver called with the id on the GUI thread, i.e. by
+	// emitting a signal.
+	Notify func(id int)
+
+	// Busy is called on the GUI thread with the number of queries running
+	// whenever it changes.
+	Busy func(running int)
+
+	mu      sync.Mutex
+	nextID  int
+	jobs    map[int]*loadJob
+	current map[string]int // id of the query running of each kind
+}
+
+// loadJob is a query started by Loader.Start.
+type loadJob struct {
+	kind   string
+	cancel context.CancelFunc
+	done   func(err error)
+	err    error
+}
+
+// Start runs a query in a goroutine, cancelling the query of the same kind
+// if one is running. Once run returns, done is called with its error on
+// the GUI thread, unless the query was cancelled. A panic in run, i.e. of
+// a repository method losing the DB, is returned as an error.
+func (l *Loader) Start(kind string, run func(ctx context.Context) error, done func(err error)) {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	l.mu.Lock()
+	if l.jobs == nil {
+		l.jobs = map[int]*loadJob{}
+		l.current = map[string]int{}
+	}
+	if id, ok := l.current[kind]; ok {
+		l.jobs[id].cancel()
+	}
+	l.nextID++
+	id := l.nextID
+	job := &loadJob{kind: kind, cancel: cancel, done: done}
+	l.jobs[id] = job
+	l.current[kind] = id
+	running := len(l.current)
+	l.mu.Unlock()
+
+	if l.Busy != nil {
+		l.Busy(running)
+	}
+
+	go func() {
+		err := runQuery(ctx, run)
+
+		l.mu.Lock()
+		job.err = err
+		l.mu.Unlock()
+		l.Notify(id)
+	}()
+}
+
+// runQuery calls run, recovering a panic as an error.
+func runQuery(ctx context.Context, run func(ctx context.Context) error) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("query failed: %v", r)
+		}
+	}()
+	return run(ctx)
+}
+
+// Deliver calls done for the query with the id, on the GUI thread, if it
+// has not been cancelled since.
+func (l *Loader) Deliver(id int) {
+	l.mu.Lock()
+	job, ok := l.jobs[id]
+	delete(l.jobs, id)
+	current := ok && l.current[job.kind] == id
+	if current {
+		delete(l.current, job.kind)
+	}
+	running := len(l.current)
+	var err error
+	if ok {
+		job.cancel()
+		err = job.err
+	}
+	l.mu.Unlock()
+
+	if !current {
+		return
+	}
+	if l.Busy != nil {
+		l.Busy(running)
+	}
+	job.done(err)
+}
+
+// CancelAll cancels all the queries running, i.e. before switching to
+// another profile, dropping their results.
+func (l *Loader) CancelAll() {
+	l.mu.Lock()
+	for _, id := range l.current {
+		l.jobs[id].cancel()
+	}
+	l.current = map[string]int{}
+	l.mu.Unlock()
+
+	if l.Busy != nil {
+		l.Busy(0)
+	}
+}
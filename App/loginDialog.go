@@ -0,0 +1,140 @@
+// Copyright 2016 Cory Robinson. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE.txt file.
+
+// loginDialog.go implements the Log In dialog, shown before the main
+// window and on switching the user or the connection profile, unless the
+// user is logged in as their OS account, see users.go.
+
+package main
+
+import (
+	"github.com/therecipe/qt/widgets"
+)
+
+type LoginDialog struct {
+	widgets.QDialog
+
+	nameEditor     *widgets.QLineEdit
+	passwordEditor *widgets.QLineEdit
+	messageLabel   *widgets.QLabel
+	okButton       *widgets.QPushButton
+	cancelButton   *widgets.QPushButton
+
+	user User
+}
+
+// initWith() initializes the dialog layout, with a message such as why the
+// DB could not be reached.
+func (d *LoginDialog) initWith(parent *widgets.QWidget, message string) {
+	d.nameEditor = widgets.NewQLineEdit(nil)
+	d.passwordEditor = widgets.NewQLineEdit(nil)
+	d.passwordEditor.SetEchoMode(widgets.QLineEdit__Password)
+	d.messageLabel = widgets.NewQLabel2(message, nil, 0)
+	d.messageLabel.SetWordWrap(true)
+	d.messageLabel.SetStyleSheet("QLabel { color: #c00000; }")
+	d.messageLabel.SetVisible(message != "")
+
+	formLayout := widgets.NewQFormLayout(nil)
+	formLayout.AddRow3("User:", d.nameEditor)
+	formLayout.AddRow3("Password:", d.passwordEditor)
+
+	buttonBox := widgets.NewQDialogButtonBox(nil)
+	d.okButton = widgets.NewQPushButton2("&Log In", nil)
+	d.cancelButton = widgets.NewQPushButton2("&Cancel", nil)
+	d.okButton.SetDefault(true)
+	d.okButton.ConnectClicked(func(bool) { d.accept() })
+	d.cancelButton.ConnectClicked(func(bool) { d.Reject() })
+	buttonBox.AddButton(d.okButton, widgets.QDialogButtonBox__AcceptRole)
+	buttonBox.AddButton(d.cancelButton, widgets.QDialogButtonBox__RejectRole)
+
+	layout := widgets.NewQVBoxLayout()
+	layout.AddWidget(widgets.NewQLabel2("Log in to the invoices of the profile "+activeProfile.Name+".", nil, 0), 0, 0)
+	layout.AddLayout(formLayout, 0)
+	layout.AddWidget(d.messageLabel, 0, 0)
+	layout.AddWidget(buttonBox, 0, 0)
+	d.SetLayout(layout)
+
+	d.SetWindowTitle("Log In")
+}
+
+// accept() closes the dialog once the user logged in, and says why not
+// otherwise. Without a user name, logging in as the OS account is tried
+// again, i.e. once the DB is back.
+func (d *LoginDialog) accept() {
+	var r Repository
+	var err error
+	if name := d.nameEditor.Text(); name != "" {
+		d.user, err = r.Login(name, d.passwordEditor.Text())
+	} else {
+		var ok bool
+		if d.user, ok, err = r.AutoLogin(); err == nil && !ok {
+			d.nameEditor.SetFocus2()
+			return
+		}
+	}
+	if err != nil {
+		d.passwordEditor.Clear()
+		d.messageLabel.SetText(err.Error())
+		d.messageLabel.Show()
+		return
+	}
+	d.Accept()
+}
+
+// logIn() logs the user in to the DB of the active profile: as their OS
+// account if it is mapped to a user, and else with the Log In dialog. It
+// returns false if the user cancelled.
+func logIn(parent *widgets.QWidget) bool {
+	var r Repository
+	u, ok, err := r.AutoLogin()
+	if err == nil && ok {
+		setCurrentUser(&u)
+		return true
+	}
+
+	message := ""
+	if err != nil {
+		message = err.Error()
+	}
+	dialog := NewLoginDialog(nil, 0)
+	dialog.initWith(parent, message)
+	if dialog.Exec() != int(widgets.QDialog__Accepted) {
+		return false
+	}
+	setCurrentUser(&dialog.user)
+	return true
+}
+
+// allowed() reports whether the current user may take the action, and
+// says why not otherwise.
+func (w *MainWindow) allowed(action Action, title string) bool {
+	if err := w.model.Authorize(action); err != nil {
+		widgets.QMessageBox_Warning(w, title, "You cannot do this: "+err.Error()+".",
+			widgets.QMessageBox__Ok, widgets.QMessageBox__Ok)
+		return false
+	}
+	return true
+}
+
+// switchUser() logs in as another user, staying the user logged in if the
+// Log In dialog is cancelled.
+func (w *MainWindow) switchUser() {
+	previous, _ := loggedInUser()
+	setCurrentUser(nil)
+	if !logIn(w.QWidget_PTR()) {
+		setCurrentUser(&previous)
+	}
+	w.updateTitle()
+}
+
+// manageUsers() opens the Users dialog, for admins only.
+func (w *MainWindow) manageUsers() {
+	if !w.allowed(ActionManageUsers, "Users") {
+		return
+	}
+	dialog := NewUsersDialog(nil, 0)
+	dialog.initWith(w.QWidget_PTR())
+	dialog.Exec()
+	w.updateTitle()
+}
@@ -3,11 +3,17 @@
 // license that can be found in the LICENSE.txt file.
 
 // main.go is the script that starts the GUI application and keeps it running.
+// Command line arguments naming a command (see commands.go) run that command
+// instead of the GUI, as does running the app as invoicectl (see ctl.go).
+// Either works on the database of the active connection profile, or of the
+// profile named by a leading -profile flag or $INVOICE_PROFILE.
 
 package main
 
 import (
+	"fmt"
 	"os"
+	"strings"
 
 	"github.com/therecipe/qt/widgets"
 )
@@ -15,16 +21,72 @@ import (
 var qApp *widgets.QApplication
 
 func main() {
-	qApp = widgets.NewQApplication(len(os.Args), os.Args)
+	args, profile := profileArgs(os.Args)
+	if profile == "" {
+		profile = os.Getenv("INVOICE_PROFILE")
+	}
+
+	if isCommand(args) {
+		p, err := findProfile(profile)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		if err := useProfile(p); err != nil {
+			fmt.Fprintln(os.Stderr, "warning:", err)
+		}
+		if code, ok := runCtl(args); ok {
+			os.Exit(code)
+		}
+		if code, ok := runCommand(args[1:]); ok {
+			os.Exit(code)
+		}
+	}
+
+	qApp = widgets.NewQApplication(len(args), args)
+
+	// the formats picked in the Preferences dialog, and the DB of the
+	// active profile
+	applyPreferences(readPreferences())
+	importConnectionPreferences()
+	p, profileErr := findProfile(profile)
+	if profileErr == nil {
+		profileErr = useProfile(p)
+	}
 
 	// if !createConnection() {
 	// 	return
 	// }
 
+	// the user logs in to the DB before seeing its invoices
+	if !logIn(nil) {
+		return
+	}
+
 	//albumDetails := core.NewQFile2("albumdetails.xml")
 	window := NewMainWindow(nil, 0)
 	window.initWith(nil)
 	window.Show()
+	if profileErr != nil {
+		widgets.QMessageBox_Warning(window, "Connection Profile", profileErr.Error(),
+			widgets.QMessageBox__Ok, widgets.QMessageBox__Ok)
+	}
 
 	qApp.Exec()
 }
+
+// profileArgs returns the command line without a leading -profile flag,
+// and the profile it names.
+func profileArgs(argv []string) (args []string, profile string) {
+	if len(argv) < 2 {
+		return argv, ""
+	}
+	switch arg := argv[1]; {
+	case (arg == "-profile" || arg == "--profile") && len(argv) > 2:
+		return append([]string{argv[0]}, argv[3:]...), argv[2]
+	case strings.HasPrefix(arg, "-profile=") || strings.HasPrefix(arg, "--profile="):
+		_, profile, _ = strings.Cut(arg, "=")
+		return append([]string{argv[0]}, argv[2:]...), profile
+	}
+	return argv, ""
+}
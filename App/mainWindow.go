@@ -8,12 +8,19 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"os"
+	"path/filepath"
 	"strconv"
+	"strings"
 
 	"github.com/therecipe/qt/core"
 	"github.com/therecipe/qt/gui"
+	"github.com/therecipe/qt/printsupport"
 	"github.com/therecipe/qt/widgets"
+	"gopkg.in/mgo.v2/bson"
 )
 
 type MainWindow struct {
@@ -23,10 +30,28 @@ type MainWindow struct {
 
 	_ func()                        `slot:"about"`
 	_ func()                        `slot:"addInvoice"`
+	_ func()                        `slot:"addInvoiceFromPDF"`
+	_ func()                        `slot:"importInvoices"`
+	_ func()                        `slot:"exportInvoices"`
+	_ func()                        `slot:"saveInvoicePDF"`
+	_ func()                        `slot:"saveInvoiceFacturX"`
+	_ func()                        `slot:"importEInvoices"`
+	_ func()                        `slot:"importEmails"`
+	_ func()                        `slot:"reviewDrafts"`
+	_ func()                        `slot:"saveInvoiceUBL"`
+	_ func()                        `slot:"pageSetup"`
+	_ func()                        `slot:"printInvoice"`
+	_ func()                        `slot:"printInvoicePreview"`
+	_ func()                        `slot:"printList"`
+	_ func()                        `slot:"printListPreview"`
 	_ func()                        `slot:"showAllVendorsProfile"`
 	_ func(index *core.QModelIndex) `slot:"showInvoiceProfile"`
 	_ func(text string)             `slot:"changeVendor"`
 
+	_ func(file string, imported int, failed bool) `signal:"inboxProcessed"`
+	_ func(id int)                                 `signal:"loaded"`
+	_ func()                                       `signal:"invoicesChanged"`
+
 	tableCase string
 
 	vendorView              *widgets.QComboBox
@@ -34,14 +59,59 @@ type MainWindow struct {
 	invoicesVendorTableView *widgets.QTableView
 	invoicesTableView       *widgets.QTableView
 	lineItemTableView       *widgets.QTableView
-	tableModel              *core.QAbstractTableModel
+	lineItemsModel          *TableModel
+	invoicesModel           *InvoiceTableModel
+
+	searchEdit  *widgets.QLineEdit
+	searchTimer *core.QTimer
+	search      SearchQuery
+
+	columnKeys []string // of the invoices table, see viewsToolBar.go
+	views      []invoiceView
+	viewsBox   *widgets.QComboBox
 
 	headerView *widgets.QHeaderView
 
-	vendorLabel             *widgets.QLabel
-	invoiceCountVendorLabel *widgets.QLabel
-	invoiceDetailsLabel     *widgets.QLabel
-	allVendorsLabel         *widgets.QLabel
+	splitter        *widgets.QSplitter
+	columnWidths    map[string]int // of the invoices table by column key, see windowState.go
+	adjustingHeader bool
+	restoreVendor   string // selected once the vendors are loaded
+
+	printer *printsupport.QPrinter
+
+	inbox        *Inbox
+	inboxAction  *widgets.QAction
+	profilesMenu *widgets.QMenu
+
+	loader        *Loader
+	busyBar       *widgets.QProgressBar
+	offlineBanner *widgets.QFrame
+	offlineLabel  *widgets.QLabel
+
+	changes      changeQueue
+	changesTimer *core.QTimer
+	stopWatching context.CancelFunc
+	shownInvoice int // ID of the invoice in the details, 0 if none
+
+	invoiceDetailsLabel *widgets.QLabel
+	allVendorsLabel     *widgets.QLabel
+
+	vendorPage          *widgets.QWidget
+	vendorLabel         *widgets.QLabel
+	vendorPeriodView    *widgets.QComboBox
+	vendorSummaryLabel  *widgets.QLabel
+	vendorSpendTable    *widgets.QTableWidget
+	vendorAlertLabel    *widgets.QLabel
+	vendorProductsTable *widgets.QTableWidget
+	vendorPriceTable    *widgets.QTableWidget
+	vendorAnalytics     VendorAnalytics
+
+	detailsTabs        *widgets.QTabWidget
+	attachmentsPage    *widgets.QWidget
+	attachmentsList    *widgets.QListWidget
+	attachmentImage    *widgets.QLabel
+	attachmentText     *widgets.QPlainTextEdit
+	attachmentsInvoice Invoice
 
 	model Repository
 }
@@ -50,58 +120,242 @@ type MainWindow struct {
 func (w *MainWindow) init() {
 	w.ConnectAbout(w.about)
 	w.ConnectAddInvoice(w.addInvoice)
+	w.ConnectAddInvoiceFromPDF(w.addInvoiceFromPDF)
+	w.ConnectImportInvoices(w.importInvoices)
+	w.ConnectExportInvoices(w.exportInvoices)
+	w.ConnectSaveInvoicePDF(w.saveInvoicePDF)
+	w.ConnectSaveInvoiceFacturX(w.saveInvoiceFacturX)
+	w.ConnectImportEInvoices(w.importEInvoices)
+	w.ConnectImportEmails(w.importEmails)
+	w.ConnectReviewDrafts(w.reviewDrafts)
+	w.ConnectSaveInvoiceUBL(w.saveInvoiceUBL)
+	w.ConnectPageSetup(w.pageSetup)
+	w.ConnectPrintInvoice(w.printInvoice)
+	w.ConnectPrintInvoicePreview(w.printInvoicePreview)
+	w.ConnectPrintList(w.printList)
+	w.ConnectPrintListPreview(w.printListPreview)
 	w.ConnectChangeVendor(w.changeVendor)
+	w.ConnectInboxProcessed(w.inboxProcessed)
+
+	// queries run in goroutines and their results come back through the
+	// loaded signal, which is delivered on the GUI thread
+	w.loader = &Loader{Notify: func(id int) { w.Loaded(id) }, Busy: w.showBusy}
+	w.ConnectLoaded(w.loader.Deliver)
+
+	// changes to the invoices are seen in a goroutine too, see changes.go
+	w.ConnectInvoicesChanged(w.invoicesChanged)
 	w.ConnectShowAllVendorsProfile(w.showAllVendorsProfile)
+
+	// the state of the window is saved as it is closed, see windowState.go
+	w.ConnectCloseEvent(w.closeEvent)
 }
 
 // initWith() initializes the layout views
 func (w *MainWindow) initWith(parent *widgets.QWidget) {
+	w.busyBar = widgets.NewQProgressBar(nil)
+	w.busyBar.SetRange(0, 0) // busy, no progress
+	w.busyBar.SetMaximumWidth(120)
+	w.busyBar.Hide()
+	w.StatusBar().AddPermanentWidget(w.busyBar, 0)
+	banner := w.createOfflineBanner()
+
 	//w.setVendorView()
+	w.restoreViews()
 	vendor := w.createVendorGroupBox()
 	invoices := w.createInvoicesGroupBox()
 	details := w.createDetailsGroupBox()
 	lineItems := w.createLineItemsGroupBox()
-	w.showLineItemsTableView("", "", "change")
+	w.showLineItemsTableView(nil, "change")
 
 	//w.vendorView.SetCurrentIndex(0)
 	w.vendorView.SetCurrentText("<all invoices>")
 	w.tableCase = "all"
 	w.showInvoicesTableView("<all invoices>")
 
-	layout := widgets.NewQGridLayout2()
-	layout.AddWidget(vendor, 0, 0, 0)
-	layout.AddWidget(invoices, 1, 0, 0)
-	layout.AddWidget(lineItems, 2, 0, 0)
-	layout.AddWidget3(details, 0, 1, 2, 1, 0)
-	layout.SetColumnStretch(1, 1)
-	layout.SetColumnMinimumWidth(0, 575)
+	leftLayout := widgets.NewQVBoxLayout()
+	leftLayout.SetContentsMargins(0, 0, 0, 0)
+	leftLayout.AddWidget(vendor, 0, 0)
+	leftLayout.AddWidget(invoices, 1, 0)
+	leftLayout.AddWidget(lineItems, 1, 0)
+	left := widgets.NewQWidget(nil, 0)
+	left.SetLayout(leftLayout)
+	left.SetMinimumWidth(450)
+
+	// the user sizes the panes, see windowState.go
+	w.splitter = widgets.NewQSplitter2(core.Qt__Horizontal, nil)
+	w.splitter.AddWidget(left)
+	w.splitter.AddWidget(details)
+	w.splitter.SetChildrenCollapsible(false)
+	w.splitter.SetStretchFactor(1, 1)
+	w.splitter.SetSizes([]int{575, windowWidth - 575})
+
+	central := widgets.NewQVBoxLayout()
+	central.AddWidget(banner, 0, 0)
+	central.AddWidget(w.splitter, 1, 0)
 
 	widget := widgets.NewQWidget(nil, 0)
-	widget.SetLayout(layout)
+	widget.SetLayout(central)
 	w.SetCentralWidget(widget)
 	w.createMenuBar()
+	w.createViewsToolBar()
+	w.restoreInbox()
 
-	w.Resize2(950, 600)
-	w.SetMinimumSize2(950, 600)
-	w.SetWindowTitle("Invoice Viewer (Demo)")
+	w.restoreWindowState()
+	w.updateTitle()
 
+	w.setVendorView()
 	w.showAllVendorsProfile()
+	w.watchChanges()
+}
+
+// watchChanges() has the views updated in place whenever the invoices are
+// changed, by this app, a second user or a bot, see changes.go.
+func (w *MainWindow) watchChanges() {
+	// changes come in bursts, i.e. from an import, and are applied at once
+	w.changesTimer = core.NewQTimer(nil)
+	w.changesTimer.SetSingleShot(true)
+	w.changesTimer.ConnectTimeout(w.applyChanges)
+	w.startWatching()
+}
+
+// startWatching() watches the invoices of the active profile for changes,
+// until stopWatching is called.
+func (w *MainWindow) startWatching() {
+	ctx, cancel := context.WithCancel(context.Background())
+	w.stopWatching = cancel
+	go w.model.WatchChanges(ctx, func(change Change) {
+		if w.changes.add(change) {
+			w.InvoicesChanged()
+		}
+	})
+}
+
+// invoicesChanged() is told of new changes from the goroutine watching
+// them, on the GUI thread.
+func (w *MainWindow) invoicesChanged() {
+	w.changesTimer.Start(500)
+}
+
+// applyChanges() updates the vendor list, the invoices table and the
+// details for the changes seen since it was last called.
+func (w *MainWindow) applyChanges() {
+	changes := w.changes.take()
+	if len(changes) == 0 {
+		return
+	}
+	w.setVendorView()
+	w.invoicesModel.applyChanges(changes)
+	if w.shownInvoice != 0 {
+		w.showInvoice(w.shownInvoice, true)
+	} else {
+		w.showListProfile()
+	}
+}
+
+// createOfflineBanner() sets up the banner shown above the app grid while
+// the DB cannot be reached.
+func (w *MainWindow) createOfflineBanner() *widgets.QFrame {
+	w.offlineBanner = widgets.NewQFrame(nil, 0)
+	w.offlineBanner.SetStyleSheet("QFrame { background: #f8d7da; border: 1px solid #f1aeb5; } " +
+		"QLabel { border: none; color: #58151c; }")
+
+	w.offlineLabel = widgets.NewQLabel(nil, 0)
+	w.offlineLabel.SetWordWrap(true)
+	retryButton := widgets.NewQPushButton2("&Retry", nil)
+	retryButton.ConnectClicked(func(bool) { w.reload() })
+
+	layout := widgets.NewQHBoxLayout()
+	layout.AddWidget(w.offlineLabel, 1, 0)
+	layout.AddWidget(retryButton, 0, 0)
+	w.offlineBanner.SetLayout(layout)
+	w.offlineBanner.Hide()
+
+	return w.offlineBanner
+}
+
+// load() runs a query in the background, see Loader, starting with a ping
+// so that it fails quickly while the DB is down. done is called on the GUI
+// thread once the query is done, with its error. If it failed, the offline
+// banner is shown before when the DB cannot be reached, or else the error.
+func (w *MainWindow) load(kind string, run func(ctx context.Context) error, done func(err error)) {
+	w.loader.Start(kind, func(ctx context.Context) error {
+		if err := w.model.Ping(); err != nil {
+			return offlineError{err}
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		err := runQuery(ctx, run)
+		if err != nil && ctx.Err() == nil {
+			// the repository methods fail the same way whether the DB
+			// was lost during the query or the query itself failed
+			if perr := w.model.Ping(); perr != nil {
+				return offlineError{perr}
+			}
+		}
+		return err
+	}, func(err error) {
+		var offline offlineError
+		switch {
+		case errors.As(err, &offline):
+			w.showOffline(offline.err)
+		case err != nil:
+			w.offlineBanner.Hide()
+			w.StatusBar().ShowMessage(fmt.Sprintf("Failed to load the %v: %v", kind, err), 0)
+		default:
+			w.offlineBanner.Hide()
+		}
+		done(err)
+	})
+}
+
+// offlineError is the error of a query which failed because the DB could
+// not be reached.
+type offlineError struct {
+	err error
+}
+
+func (e offlineError) Error() string {
+	return e.err.Error()
+}
+
+// showBusy() shows the busy indicator in the status bar while queries are
+// running.
+func (w *MainWindow) showBusy(running int) {
+	w.busyBar.SetVisible(running > 0)
+}
+
+// showOffline() shows the offline banner for a query which failed because
+// the DB could not be reached.
+func (w *MainWindow) showOffline(err error) {
+	w.offlineLabel.SetText(fmt.Sprintf("Cannot reach the invoice database of the profile %v at %v: %v",
+		activeProfile.Name, activeProfile.URI, err))
+	w.offlineBanner.Show()
+}
+
+// reload() queries the vendor list and the current view again, i.e. to
+// retry after the DB was offline.
+func (w *MainWindow) reload() {
+	w.offlineBanner.Hide()
+	w.setVendorView()
+	w.changeVendor(w.vendorView.CurrentText())
 }
 
 // changeVendor() a slot that changes the view depending on the
 // invoice that is selected in the combobox.
 func (w *MainWindow) changeVendor(text string) {
+	w.shownInvoice = 0
 	if text == "<all invoices>" {
 		w.showAllVendorsProfile()
 		w.tableCase = "all"
 		w.showInvoicesTableView(text)
-		w.showLineItemsTableView("", "", "change")
+		w.showLineItemsTableView(nil, "change")
 	} else {
 		//name := w.vendorView.CurrentText()
 		w.showVendorProfile(text)
 		w.tableCase = "individual"
 		w.showInvoicesTableView(text)
-		w.showLineItemsTableView("", "", "change")
+		w.showLineItemsTableView(nil, "change")
 		//w.lineItemTableView.Reset()
 	}
 }
@@ -109,54 +363,97 @@ func (w *MainWindow) changeVendor(text string) {
 // showVendorProfile() renders the display of vendor information
 // on the right hand side of the app grid.
 func (w *MainWindow) showVendorProfile(name string) {
-	record := w.model.GetInvoiceByString(name)[0]
-
-	vendor := record.Vendor
-	address := record.Address
-	street := address.Street
-	city := address.City
-	state := address.State
-	zipcode := address.Zipcode
-
-	numInvoices := w.model.CountInvoicesByVendorName(vendor)
+	var record Invoice
+	var found bool
+	w.load("details", func(ctx context.Context) error {
+		record, found = w.queryVendorProfile(name)
+		return nil
+	}, func(err error) {
+		if err != nil {
+			return
+		}
+		if found {
+			w.setVendorProfile(record)
+		}
+	})
+}
 
-	w.vendorLabel.SetText(fmt.Sprintf("Vendor: \t%v \n\nAddress: %v\n\t%v, %v %v",
-		vendor, street, city, state, zipcode))
-	//w.addressLabel.SetText(fmt.Sprintf("Address: %v\n\t%v, %v %v", street, city, state, zipcode))
-	w.invoiceCountVendorLabel.SetText(fmt.Sprintf("Number of Invoices: %d", numInvoices))
+// queryVendorProfile() queries the vendor information of the vendor
+// profile, in the background.
+func (w *MainWindow) queryVendorProfile(name string) (record Invoice, found bool) {
+	records := w.model.GetInvoicesByVendor(name)
+	if len(records) == 0 {
+		return record, false
+	}
+	return records[0], true
+}
 
-	w.vendorLabel.Show()
-	//w.addressLabel.Show()
-	w.invoiceCountVendorLabel.Show()
+// setVendorProfile() displays the vendor information queried by
+// queryVendorProfile() in the Vendor tab, and has its analytics queried.
+func (w *MainWindow) setVendorProfile(record Invoice) {
+	w.setVendorDetails(record)
+	w.showVendorAnalytics(record.Vendor)
 
+	w.invoiceDetailsLabel.SetText("Select an invoice to see its details, or the Vendor tab for the vendor's spend and prices.")
+	w.invoiceDetailsLabel.Show()
 	w.allVendorsLabel.Hide()
-	w.invoiceDetailsLabel.Hide()
+	w.shownInvoice = 0
 
-	//w.invoiceDetailsLabel.Hide()
+	w.clearAttachments()
 }
 
 // showInvoiceProfile renders the display of invoice information
 // on the right hand side of the app grid.
 func (w *MainWindow) showInvoiceProfile(index *core.QModelIndex) {
-	var record Invoice
-	var invNo, vend *core.QVariant
-	var statusStr, vendStr string
 	//index := w.invoicesTableView.SelectionModel().CurrentIndex()
-	switch w.tableCase {
-	case "all":
-		invNo = index.Sibling(index.Row(), 1).Data(0)
-		vend = index.Sibling(index.Row(), 0).Data(0)
-		record = w.model.GetInvoiceByInvoiceNoAndVendor(invNo.ToString(), vend.ToString())
-		w.showVendorProfile(vend.ToString())
-		w.showLineItemsTableView(invNo.ToString(), vend.ToString(), "nochange")
-	case "individual":
-		invNo = index.Sibling(index.Row(), 0).Data(0)
-		vendStr = w.vendorView.CurrentText()
-		record = w.model.GetInvoiceByInvoiceNoAndVendor(invNo.ToString(), vendStr)
-		w.showLineItemsTableView(invNo.ToString(), vendStr, "nochange")
-	}
-
-	date := record.Date
+	row, ok := w.invoicesModel.invoice(index.Row())
+	if !ok {
+		return
+	}
+	w.showInvoice(row.ID, w.tableCase == "all")
+}
+
+// showInvoice() renders the display of the invoice with the id, and of its
+// vendor if withVendor is set. If the invoice is gone, the profile of the
+// invoices listed is shown instead.
+func (w *MainWindow) showInvoice(id int, withVendor bool) {
+	var record, vendorRecord Invoice
+	var items Items
+	var found bool
+	w.load("details", func(ctx context.Context) error {
+		record = w.model.GetInvoiceById(id)
+		if record.ID != id {
+			return nil
+		}
+		items = w.model.GetTableLineItemView(record.InvoiceNo, record.Vendor)
+		if withVendor && ctx.Err() == nil {
+			vendorRecord, found = w.queryVendorProfile(record.Vendor)
+		}
+		return ctx.Err()
+	}, func(err error) {
+		if err != nil {
+			return
+		}
+		if record.ID != id {
+			// deleted
+			w.showLineItemsTableView(nil, "change")
+			w.showListProfile()
+			return
+		}
+		if found {
+			w.setVendorProfile(vendorRecord)
+		}
+		w.showLineItemsTableView(items, "nochange")
+		w.setInvoiceProfile(record)
+	})
+}
+
+// setInvoiceProfile() displays the invoice information queried by
+// showInvoiceProfile().
+func (w *MainWindow) setInvoiceProfile(record Invoice) {
+	var statusStr string
+
+	date := displayDate(record.Date)
 	invoiceno := record.InvoiceNo // same as value.ToString()
 	purchaseorder := record.PurchaseOrder
 	total := record.Total
@@ -176,210 +473,122 @@ func (w *MainWindow) showInvoiceProfile(index *core.QModelIndex) {
 
 	w.allVendorsLabel.Hide()
 
-	w.vendorLabel.Show()
 	w.invoiceDetailsLabel.Show()
-	w.invoiceCountVendorLabel.Show()
+	w.shownInvoice = record.ID
+
+	w.showAttachments(record)
+}
+
+// showListProfile() renders the display of the invoices listed, i.e. of
+// all vendors or of the vendor selected.
+func (w *MainWindow) showListProfile() {
+	if w.tableCase == "individual" {
+		w.showVendorProfile(w.vendorView.CurrentText())
+	} else {
+		w.showAllVendorsProfile()
+	}
 }
 
 // showAllVendorsProfile() renders the display of general stats
 // e.g. total number of invoices, etc. on the right hand side of the app grid.
 func (w *MainWindow) showAllVendorsProfile() {
-	countAllVendors := w.model.CountVendors()
-	countAllInvoices := w.model.RecordCount()
-	countPaid := w.model.CountPaidTrue()
-	countNotPaid := w.model.CountPaidFalse()
+	var countAllVendors, countAllInvoices, countPaid, countNotPaid int
+	w.load("details", func(ctx context.Context) error {
+		countAllVendors = w.model.CountVendors()
+		countAllInvoices = w.model.RecordCount()
+		countPaid = w.model.CountPaidTrue()
+		countNotPaid = w.model.CountPaidFalse()
+		return nil
+	}, func(err error) {
+		if err != nil {
+			return
+		}
+		w.setAllVendorsProfile(countAllVendors, countAllInvoices, countPaid, countNotPaid)
+	})
+}
 
+// setAllVendorsProfile() displays the stats queried by
+// showAllVendorsProfile().
+func (w *MainWindow) setAllVendorsProfile(countAllVendors, countAllInvoices, countPaid, countNotPaid int) {
 	w.allVendorsLabel.SetText(fmt.Sprintf("Vendor Count: %d \nInvoice Count: %d \nPaid/Not Paid Count: %d/%d",
 		countAllVendors, countAllInvoices, countPaid, countNotPaid))
 
 	w.allVendorsLabel.Show()
 
-	w.vendorLabel.Hide()
 	//w.addressLabel.Hide()
-	w.invoiceCountVendorLabel.Hide()
 	w.invoiceDetailsLabel.Hide()
+	w.clearVendorTab()
+	w.shownInvoice = 0
+	w.clearAttachments()
 }
 
-// showInvoicesTableView() generates the table displaying invoices
-// for either all vendors or each individual vendor. This is the top
-// table on the left hand side of the app grid.
+// showInvoicesTableView() lists the invoices of either all vendors or each
+// individual vendor, found by the search box, in the invoices table. This
+// is the top table on the left hand side of the app grid.
 func (w *MainWindow) showInvoicesTableView(vendor string) {
-	var table [][]string
-	//var w.tableModel *core.QAbstractTableModel
-
-	switch w.tableCase {
-	case "all":
-		table = w.tableForInvoicesAllTableView()
-
-		w.tableModel = core.NewQAbstractTableModel(nil)
-		w.tableModel.ConnectRowCount(func(parent *core.QModelIndex) int {
-			return len(table[0]) // row-col transposed - counts cols
-		})
-		w.tableModel.ConnectColumnCount(func(parent *core.QModelIndex) int {
-			return len(table) // row-col transposed - counts rows
-		})
-		w.tableModel.ConnectData(func(index *core.QModelIndex, role int) *core.QVariant {
-			if role != int(core.Qt__DisplayRole) {
-				return core.NewQVariant()
-			}
-			return core.NewQVariant14(table[index.Column()][index.Row()]) // row-col transposed
-		})
-		w.tableModel.ConnectHeaderData(w.headerdataAll)
-
-		//w.tableModel.Index(row, column, parent).Data(role) // see about changing paid/not paid colors.
-	case "individual":
-		table = w.tableForInvoicesVendorTableView(vendor)
-
-		w.tableModel = core.NewQAbstractTableModel(nil)
-		w.tableModel.ConnectRowCount(func(parent *core.QModelIndex) int {
-			return len(table[0]) // row-col transposed - counts cols
-		})
-		w.tableModel.ConnectColumnCount(func(parent *core.QModelIndex) int {
-			return len(table) // row-col transposed - counts rows
-		})
-		w.tableModel.ConnectData(func(index *core.QModelIndex, role int) *core.QVariant {
-			if role != int(core.Qt__DisplayRole) {
-				return core.NewQVariant()
-			}
-			return core.NewQVariant14(table[index.Column()][index.Row()]) // row-col transposed
-		})
-		w.tableModel.ConnectHeaderData(w.headerdataIndividual)
-
-	default:
-		table = w.tableForInvoicesAllTableView()
-
-		w.tableModel = core.NewQAbstractTableModel(nil)
-		w.tableModel.ConnectRowCount(func(parent *core.QModelIndex) int {
-			return len(table[0]) // row-col transposed - counts cols
-		})
-		w.tableModel.ConnectColumnCount(func(parent *core.QModelIndex) int {
-			return len(table) // row-col transposed - counts rows
-		})
-		w.tableModel.ConnectData(func(index *core.QModelIndex, role int) *core.QVariant {
-			if role != int(core.Qt__DisplayRole) {
-				return core.NewQVariant()
-			}
-			return core.NewQVariant14(table[index.Column()][index.Row()]) // row-col transposed
-		})
-		w.tableModel.ConnectHeaderData(w.headerdataAll)
-
-	}
-
-	w.invoicesTableView.SetModel(w.tableModel)
-	//w.invoicesTableView.SetHorizontalHeader(header)
-	w.adjustHeader()
+	w.invoicesModel.setQuery(w.invoicesTableQuery(vendor))
 
 	w.invoicesTableView.Show()
 }
 
+// invoicesTableQuery() returns the columns and the filter of the invoices
+// table, for the vendor when the table case is "individual".
+func (w *MainWindow) invoicesTableQuery(vendor string) ([]tableColumn[Invoice], bson.M) {
+	if w.tableCase == "individual" {
+		return invoiceColumnsOf(w.columnKeys, true), invoiceTableFilter(vendor, w.search)
+	}
+	return invoiceColumnsOf(w.columnKeys, false), invoiceTableFilter("", w.search)
+}
+
 // showLineItemsTableView() generates the table displaying line items
 // for the invoice selected from the top table or showInvoicesTableView.
 // This is the bottom table on the left hand side of the app grid.
-func (w *MainWindow) showLineItemsTableView(invoiceNo, ven, changeCase string) {
-	var table [][]string
+func (w *MainWindow) showLineItemsTableView(items Items, changeCase string) {
 	switch changeCase {
 	case "change":
-		table = [][]string{{}}
+		w.lineItemsModel.setSource(newSliceTable(Items(nil), itemColumnsNone))
 	case "nochange":
-		table = w.tableForLineItemsTableView(invoiceNo, ven)
+		w.lineItemsModel.setSource(newSliceTable(items, itemColumns))
 	}
 
-	Model := core.NewQAbstractTableModel(nil)
-	Model.ConnectRowCount(func(parent *core.QModelIndex) int {
-		return len(table[0]) // row-col transposed - counts cols
-	})
-	Model.ConnectColumnCount(func(parent *core.QModelIndex) int {
-		return len(table) // row-col transposed - counts rows
-	})
-	Model.ConnectData(func(index *core.QModelIndex, role int) *core.QVariant {
-		if role != int(core.Qt__DisplayRole) {
-			return core.NewQVariant()
-		}
-		return core.NewQVariant14(table[index.Column()][index.Row()]) // row-col transposed
-	})
-
-	switch changeCase {
-	case "change":
-		Model.ConnectHeaderData(w.headerdataLineItemsSelectInvoice)
-
-	case "nochange":
-		Model.ConnectHeaderData(w.headerdataLineItems)
-	}
-
-	w.lineItemTableView.SetModel(Model)
+	// line items keep the order of the invoice until a column is clicked
+	w.lineItemTableView.HorizontalHeader().SetSortIndicator(-1, core.Qt__AscendingOrder)
 	w.adjustLineItemsHeader()
 
 	w.lineItemTableView.Show()
 }
 
-// headerdataAll() displays the header in the showInvoicesTableView().
-// NOTE: These "header" function probably could have been implemented
-// better, they are kinda brute-forced, but it got the job done for now.
-func (w *MainWindow) headerdataAll(section int, orientation core.Qt__Orientation, role int) *core.QVariant {
-	if section == 0 && orientation == core.Qt__Horizontal && role == 0 { // Qt__Horizontal, Qt__DisplayRole
-		return core.NewQVariant14("Vendor")
-	} else if section == 1 && orientation == core.Qt__Horizontal && role == 0 {
-		return core.NewQVariant14("Invoice No.")
-	} else if section == 2 && orientation == core.Qt__Horizontal && role == 0 {
-		return core.NewQVariant14("Date")
-	} else if section == 3 && orientation == core.Qt__Horizontal && role == 0 {
-		return core.NewQVariant14("Total")
-	} else if section == 4 && orientation == core.Qt__Horizontal && role == 0 {
-		return core.NewQVariant14("Status")
-	}
-	return core.NewQVariant()
-}
-
-// headerdataIndividual() displays the header in the showInvoicesTableView().
-// NOTE: These "header" function probably could have been implemented
-// better, they are kinda brute-forced, but it got the job done for now.
-func (w *MainWindow) headerdataIndividual(section int, orientation core.Qt__Orientation, role int) *core.QVariant {
-	if section == 0 && orientation == core.Qt__Horizontal && role == 0 { // Qt__Horizontal, Qt__DisplayRole
-		return core.NewQVariant14("Invoice No.")
-	} else if section == 1 && orientation == core.Qt__Horizontal && role == 0 {
-		return core.NewQVariant14("Date")
-	} else if section == 2 && orientation == core.Qt__Horizontal && role == 0 {
-		return core.NewQVariant14("Total")
-	} else if section == 3 && orientation == core.Qt__Horizontal && role == 0 {
-		return core.NewQVariant14("Status")
-	}
-	return core.NewQVariant()
-}
-
-// headerdataLineItems() displays the header in the showLineItemsTableView().
-// NOTE: These "header" function probably could have been implemented
-// better, they are kinda brute-forced, but it got the job done for now.
-func (w *MainWindow) headerdataLineItems(section int, orientation core.Qt__Orientation, role int) *core.QVariant {
-	if section == 0 && orientation == core.Qt__Horizontal && role == 0 { // Qt__Horizontal, Qt__DisplayRole
-		return core.NewQVariant14("Product ID")
-	} else if section == 1 && orientation == core.Qt__Horizontal && role == 0 {
-		return core.NewQVariant14("Description")
-	} else if section == 2 && orientation == core.Qt__Horizontal && role == 0 {
-		return core.NewQVariant14("Quantity")
-	} else if section == 3 && orientation == core.Qt__Horizontal && role == 0 {
-		return core.NewQVariant14("Amount")
-	}
-	return core.NewQVariant()
-}
-
-// headerdataLineItemsSelectInvoice() on the bottom table, simply displays
-// 'Select An Invoice' if no invoice has been selected from the top table.
-func (w *MainWindow) headerdataLineItemsSelectInvoice(section int, orientation core.Qt__Orientation, role int) *core.QVariant {
-	if section == 0 && orientation == core.Qt__Horizontal && role == 0 { // Qt__Horizontal, Qt__DisplayRole
-		return core.NewQVariant14("Select An Invoice")
-	}
-	return core.NewQVariant()
-}
-
 // setVendorView() sets the vendorView model from a string array.
+// The vendor selected is kept, and if it is gone the view changes to all
+// invoices. On starting, the vendor selected last is selected again.
 func (w *MainWindow) setVendorView() {
-	stringList := w.model.GetInvoiceVendors()
-	stringList = append([]string{"<all invoices>"}, stringList...) // prepend to stringList
-	// a better prepend might be:
-	//     stringList = append(stringList, "")
-	//     copy(stringList[1:], stringList)
-	//     stringList[0] = "<all invoices>"
-	w.vendorView.SetModel(core.NewQStringListModel2(stringList, nil))
+	var stringList []string
+	w.load("vendors", func(ctx context.Context) error {
+		stringList = w.model.GetInvoiceVendors()
+		return nil
+	}, func(err error) {
+		if err != nil {
+			return
+		}
+		stringList = append([]string{"<all invoices>"}, stringList...) // prepend to stringList
+		// a better prepend might be:
+		//     stringList = append(stringList, "")
+		//     copy(stringList[1:], stringList)
+		//     stringList[0] = "<all invoices>"
+		current := w.vendorView.CurrentText()
+		wanted := current
+		if w.restoreVendor != "" {
+			// the vendor selected when the app was closed, see windowState.go
+			wanted, w.restoreVendor = w.restoreVendor, ""
+		}
+		w.vendorView.BlockSignals(true)
+		w.vendorView.SetModel(core.NewQStringListModel2(stringList, nil))
+		w.vendorView.SetCurrentText(wanted)
+		w.vendorView.BlockSignals(false)
+		if w.vendorView.CurrentText() != current {
+			w.changeVendor(w.vendorView.CurrentText())
+		}
+	})
 }
 
 // createVendorGroupBox() sets up the layout for the combobox section of the
@@ -387,11 +596,9 @@ func (w *MainWindow) setVendorView() {
 func (w *MainWindow) createVendorGroupBox() *widgets.QGroupBox {
 	box := widgets.NewQGroupBox2("Vendor", nil)
 
+	// the vendors are added by setVendorView() once they are loaded
 	w.vendorView = widgets.NewQComboBox(nil)
-
-	stringList := w.model.GetInvoiceVendors()
-	stringList = append([]string{"<all invoices>"}, stringList...) // prepend to stringList
-	w.vendorView.SetModel(core.NewQStringListModel2(stringList, nil))
+	w.vendorView.SetModel(core.NewQStringListModel2([]string{"<all invoices>"}, nil))
 
 	w.vendorView.ConnectCurrentTextChanged(w.changeVendor)
 
@@ -421,16 +628,83 @@ func (w *MainWindow) createInvoicesGroupBox() *widgets.QGroupBox {
 	locale.SetNumberOptions(core.QLocale__OmitGroupSeparator)
 	w.invoicesTableView.SetLocale(locale)
 
+	// the model is kept for good and only ever reset, see showInvoicesTableView
+	w.invoicesModel = NewInvoiceTableModel(nil)
+	w.invoicesModel.load = w.load
+	w.invoicesModel.reset = w.invoicesReset
+	w.invoicesTableView.SetModel(w.invoicesModel)
+
 	w.invoicesTableView.ConnectClicked(w.showInvoiceProfile)
 	w.invoicesTableView.ConnectActivated(w.showInvoiceProfile)
 
+	w.invoicesTableView.SetContextMenuPolicy(core.Qt__CustomContextMenu)
+	w.invoicesTableView.ConnectCustomContextMenuRequested(w.showInvoicesContextMenu)
+
+	// columns are shown and hidden from the header, see viewsToolBar.go
+	header := w.invoicesTableView.HorizontalHeader()
+	header.SetSectionsMovable(true)
+	header.ConnectSectionMoved(w.moveColumn)
+	header.ConnectSectionResized(w.recordColumnWidth)
+	header.SetContextMenuPolicy(core.Qt__CustomContextMenu)
+	header.ConnectCustomContextMenuRequested(w.showColumnsMenu)
+
+	w.searchEdit = widgets.NewQLineEdit(nil)
+	w.searchEdit.SetPlaceholderText(`Search, i.e. vendor:niche paid:false total>100 date:2018-01..2018-03 "hammer"`)
+	w.searchEdit.SetToolTip(searchHelp)
+	w.searchEdit.SetClearButtonEnabled(true)
+
+	// search once typing pauses rather than on every key
+	w.searchTimer = core.NewQTimer(nil)
+	w.searchTimer.SetSingleShot(true)
+	w.searchTimer.ConnectTimeout(w.applySearch)
+	w.searchEdit.ConnectTextChanged(func(text string) {
+		w.searchTimer.Start(300)
+	})
+
 	layout := widgets.NewQVBoxLayout()
+	layout.AddWidget(w.searchEdit, 0, 0)
 	layout.AddWidget(w.invoicesTableView, 0, 0)
 	box.SetLayout(layout)
 
 	return box
 }
 
+// searchHelp is the tool tip of the search box.
+const searchHelp = `Every term must match:
+  hammer, "claw hammer"   words in the vendor, invoice number, purchase order or line items
+  vendor:, invoice:, po:, currency:, item:, product:   text in a field
+  paid:true, paid:false
+  total>100, total<=50, total:100..250
+  date:2018, date:2018-01..2018-03, date>=03/15/2018`
+
+// applySearch() filters the invoices table by the query in the search box.
+// A query which does not parse is marked in red and the table is kept.
+func (w *MainWindow) applySearch() {
+	query, ok := w.checkSearch()
+	if !ok {
+		return
+	}
+
+	w.search = query
+	w.shownInvoice = 0
+	w.showInvoicesTableView(w.vendorView.CurrentText())
+	w.showLineItemsTableView(nil, "change")
+}
+
+// checkSearch() parses the query in the search box, marking it in red if
+// it does not parse.
+func (w *MainWindow) checkSearch() (SearchQuery, bool) {
+	query, err := ParseSearch(w.searchEdit.Text())
+	if err != nil {
+		w.searchEdit.SetStyleSheet("QLineEdit { color: red; }")
+		w.searchEdit.SetToolTip(err.Error())
+		return SearchQuery{}, false
+	}
+	w.searchEdit.SetStyleSheet("")
+	w.searchEdit.SetToolTip(searchHelp)
+	return query, true
+}
+
 // createLineItemsGroupBox() sets up the layout for the line-items table,
 // i.e. the bottom table on the left hand side of the app grid.
 func (w *MainWindow) createLineItemsGroupBox() *widgets.QGroupBox {
@@ -451,6 +725,10 @@ func (w *MainWindow) createLineItemsGroupBox() *widgets.QGroupBox {
 	locale.SetNumberOptions(core.QLocale__OmitGroupSeparator)
 	w.lineItemTableView.SetLocale(locale)
 
+	// the model is kept for good, see showLineItemsTableView
+	w.lineItemsModel = NewTableModel(nil)
+	w.lineItemTableView.SetModel(w.lineItemsModel)
+
 	layout := widgets.NewQVBoxLayout()
 	layout.AddWidget(w.lineItemTableView, 0, 0)
 	box.SetLayout(layout)
@@ -474,137 +752,78 @@ func (w *MainWindow) createDetailsGroupBox() *widgets.QGroupBox {
 	w.allVendorsLabel.SetWordWrap(true)
 	w.allVendorsLabel.SetAlignment(core.Qt__AlignTop)
 
-	w.vendorLabel = widgets.NewQLabel(nil, 0)
-	w.vendorLabel.SetWordWrap(false)
-	w.vendorLabel.SetAlignment(core.Qt__AlignTop)
-
 	// w.addressLabel = widgets.NewQLabel(nil, 0)
 	// w.addressLabel.SetWordWrap(true)
 	// w.addressLabel.SetAlignment(core.Qt__AlignBottom)
 
-	w.invoiceCountVendorLabel = widgets.NewQLabel(nil, 0)
-	w.invoiceCountVendorLabel.SetWordWrap(false)
-	w.invoiceCountVendorLabel.SetAlignment(core.Qt__AlignTop)
-
 	w.invoiceDetailsLabel = widgets.NewQLabel(nil, 0)
 	w.invoiceDetailsLabel.SetWordWrap(true)
 	w.invoiceDetailsLabel.SetAlignment(core.Qt__AlignTop)
 
 	layout := widgets.NewQGridLayout2()
 	layout.AddWidget(w.allVendorsLabel, 0, 0, 0)
-	layout.AddWidget(w.invoiceCountVendorLabel, 0, 1, 0)
-	layout.AddWidget(w.vendorLabel, 0, 0, 0)
 	layout.AddWidget(w.invoiceDetailsLabel, 1, 0, 0)
 	//layout.AddWidget(w.addressLabel, 1, 0, 0)
-	box.SetLayout(layout)
-
-	return box
-}
-
-// tableForInvoicesAllTableView() queries data and sets up the table model
-// for the InvoicesAllTableView.
-func (w *MainWindow) tableForInvoicesAllTableView() [][]string {
-	r := w.model.GetTableAllView()
-
-	var invoiceno, vendors, dates, totalsStr, status []string
-	var paid string
-
-	for _, vens := range r {
-		vendors = append(vendors, vens.Vendor)
-		invoiceno = append(invoiceno, vens.InvoiceNo)
-		dates = append(dates, vens.Date)
-		totalStr := strconv.FormatInt(vens.Total, 10)
-		totalStr = "$" + totalStr[:len(totalStr)-2] + "." + totalStr[len(totalStr)-2:]
-		totalsStr = append(totalsStr, totalStr)
-		if vens.Paid {
-			paid = "Paid"
-		} else {
-			paid = "Not Paid"
-		}
-		status = append(status, paid)
-	}
-
-	table := [][]string{
-		0: vendors,
-		1: invoiceno,
-		2: dates,
-		3: totalsStr,
-		4: status,
-	}
-
-	return table
-}
-
-// tableForInvoicesVendorTableView() queries data and sets up the table model
-// for the individual vendors InvoicesVendorTableView.
-func (w *MainWindow) tableForInvoicesVendorTableView(vendor string) [][]string {
-	r := w.model.GetTableVendorView(vendor)
-
-	var invoiceno, dates, totalsStr, status []string
-	var paid string
-
-	for _, vens := range r {
-		invoiceno = append(invoiceno, vens.InvoiceNo)
-		dates = append(dates, vens.Date)
-		totalStr := strconv.FormatInt(vens.Total, 10)
-		totalStr = "$" + totalStr[:len(totalStr)-2] + "." + totalStr[len(totalStr)-2:]
-		totalsStr = append(totalsStr, totalStr)
-		if vens.Paid {
-			paid = "Paid"
-		} else {
-			paid = "Not Paid"
-		}
-		status = append(status, paid)
-	}
-
-	table := [][]string{
-		0: invoiceno,
-		1: dates,
-		2: totalsStr,
-		3: status,
-	}
 
-	return table
-}
-
-// tableForLineItemsTableView() queries data and sets up the table model
-// for the individual vendor invoices line items LineItemsTableView.
-func (w *MainWindow) tableForLineItemsTableView(invoiceNo, vendor string) [][]string {
-	r := w.model.GetTableLineItemView(invoiceNo, vendor)
+	details := widgets.NewQWidget(nil, 0)
+	details.SetLayout(layout)
 
-	var prodId, description, quantityStr, amountsStr []string
+	w.detailsTabs = widgets.NewQTabWidget(nil)
+	w.detailsTabs.AddTab(details, "Details")
+	w.detailsTabs.AddTab(w.createVendorTab(), "Vendor")
+	w.detailsTabs.AddTab(w.createAttachmentsTab(), "Attachments")
 
-	for _, vens := range r {
-		prodId = append(prodId, vens.ProductID)
-		description = append(description, vens.Description)
-		quantityStr = append(quantityStr, strconv.FormatInt(int64(vens.Quantity), 10))
-		amountStr := strconv.FormatInt(vens.Amount, 10)
-		amountStr = "$" + amountStr[:len(amountStr)-2] + "." + amountStr[len(amountStr)-2:]
-		amountsStr = append(amountsStr, amountStr)
-	}
-
-	table := [][]string{
-		0: prodId,
-		1: description,
-		2: quantityStr,
-		3: amountsStr,
-	}
+	boxLayout := widgets.NewQVBoxLayout()
+	boxLayout.AddWidget(w.detailsTabs, 0, 0)
+	box.SetLayout(boxLayout)
 
-	return table
+	return box
 }
 
 // createMenuBar() sets up the menu bar in the main window.
 func (w *MainWindow) createMenuBar() {
 	addAction := widgets.NewQAction2("&Add Invoice...", w)
+	addFromPDFAction := widgets.NewQAction2("Add Invoice from P&DF...", w)
+	importAction := widgets.NewQAction2("&Import...", w)
+	importEInvoicesAction := widgets.NewQAction2("Import E-In&voices...", w)
+	importEmailsAction := widgets.NewQAction2("Import E&mail...", w)
+	reviewDraftsAction := widgets.NewQAction2("Review &Drafts...", w)
+	exportAction := widgets.NewQAction2("&Export...", w)
+	w.inboxAction = widgets.NewQAction2("Watch Inbo&x Folder...", w)
+	pageSetupAction := widgets.NewQAction2("Page Set&up...", w)
+	preferencesAction := widgets.NewQAction2("Pre&ferences...", w)
+	usersAction := widgets.NewQAction2("U&sers...", w)
+	switchUserAction := widgets.NewQAction2("S&witch User...", w)
+	printInvoiceAction := widgets.NewQAction2("&Invoice...", w)
+	printInvoicePreviewAction := widgets.NewQAction2("Invoice Pre&view...", w)
+	printListAction := widgets.NewQAction2("Invoice &List...", w)
+	printListPreviewAction := widgets.NewQAction2("Invoice List P&review...", w)
 	quitAction := widgets.NewQAction2("&Quit", w)
 	aboutAction := widgets.NewQAction2("&About", w)
 	aboutQtAction := widgets.NewQAction2("About &Qt", w)
 
 	addAction.SetShortcut(gui.QKeySequence_FromString("Ctrl+A", 0))
+	importAction.SetShortcut(gui.QKeySequence_FromString("Ctrl+I", 0))
+	exportAction.SetShortcut(gui.QKeySequence_FromString("Ctrl+E", 0))
+	printInvoiceAction.SetShortcuts2(gui.QKeySequence__Print)
 	quitAction.SetShortcuts2(gui.QKeySequence__Quit)
+	w.inboxAction.SetCheckable(true)
+	preferencesAction.SetMenuRole(widgets.QAction__PreferencesRole)
 
 	fileMenu := w.MenuBar().AddMenu2("&File")
-	fileMenu.AddActions([]*widgets.QAction{addAction})
+	fileMenu.AddActions([]*widgets.QAction{addAction, addFromPDFAction, importAction, importEInvoicesAction, exportAction})
+	fileMenu.AddSeparator()
+	fileMenu.AddActions([]*widgets.QAction{importEmailsAction, reviewDraftsAction, w.inboxAction})
+	fileMenu.AddSeparator()
+	printMenu := fileMenu.AddMenu2("&Print")
+	printMenu.AddActions([]*widgets.QAction{printInvoiceAction, printInvoicePreviewAction})
+	printMenu.AddSeparator()
+	printMenu.AddActions([]*widgets.QAction{printListAction, printListPreviewAction})
+	fileMenu.AddActions([]*widgets.QAction{pageSetupAction})
+	fileMenu.AddSeparator()
+	w.profilesMenu = fileMenu.AddMenu2("Connection P&rofile")
+	w.profilesMenu.ConnectAboutToShow(w.fillProfilesMenu)
+	fileMenu.AddActions([]*widgets.QAction{usersAction, switchUserAction, preferencesAction})
 	fileMenu.AddSeparator()
 	fileMenu.AddActions([]*widgets.QAction{quitAction})
 
@@ -612,6 +831,21 @@ func (w *MainWindow) createMenuBar() {
 	helpMenu.AddActions([]*widgets.QAction{aboutAction, aboutQtAction})
 
 	addAction.ConnectTriggered(func(bool) { w.addInvoice() })
+	addFromPDFAction.ConnectTriggered(func(bool) { w.addInvoiceFromPDF() })
+	importAction.ConnectTriggered(func(bool) { w.importInvoices() })
+	importEInvoicesAction.ConnectTriggered(func(bool) { w.importEInvoices() })
+	importEmailsAction.ConnectTriggered(func(bool) { w.importEmails() })
+	reviewDraftsAction.ConnectTriggered(func(bool) { w.reviewDrafts() })
+	exportAction.ConnectTriggered(func(bool) { w.exportInvoices() })
+	w.inboxAction.ConnectTriggered(w.watchInbox)
+	pageSetupAction.ConnectTriggered(func(bool) { w.pageSetup() })
+	preferencesAction.ConnectTriggered(func(bool) { w.editPreferences() })
+	usersAction.ConnectTriggered(func(bool) { w.manageUsers() })
+	switchUserAction.ConnectTriggered(func(bool) { w.switchUser() })
+	printInvoiceAction.ConnectTriggered(func(bool) { w.printInvoice() })
+	printInvoicePreviewAction.ConnectTriggered(func(bool) { w.printInvoicePreview() })
+	printListAction.ConnectTriggered(func(bool) { w.printList() })
+	printListPreviewAction.ConnectTriggered(func(bool) { w.printListPreview() })
 	quitAction.ConnectTriggered(func(bool) { w.Close() })
 	aboutAction.ConnectTriggered(func(bool) { w.about() })
 	aboutQtAction.ConnectTriggered(func(bool) { qApp.AboutQt() })
@@ -620,6 +854,9 @@ func (w *MainWindow) createMenuBar() {
 
 // addInvoice() slot to open the addInvoice dialog.
 func (w *MainWindow) addInvoice() {
+	if !w.allowed(ActionAdd, "Add Invoice") {
+		return
+	}
 	dialog := NewDialog(nil, 0)
 	//dialog.initWith(w.QWidget_PTR())
 	dialog.initWith(w.QWidget_PTR())
@@ -634,22 +871,521 @@ func (w *MainWindow) addInvoice() {
 	//dialog.Show()
 }
 
-// adjustHeader() will adjust the table headers in the QTableViews
+// addInvoiceFromPDF() slot to extract an invoice from the text of a PDF
+// and open the addInvoice dialog prefilled with it for review.
+func (w *MainWindow) addInvoiceFromPDF() {
+	if !w.allowed(ActionAdd, "Add Invoice from PDF") {
+		return
+	}
+	name := widgets.QFileDialog_GetOpenFileName(w, "Add Invoice from PDF", "", "PDF documents (*.pdf)", "", 0)
+	if name == "" {
+		return
+	}
+
+	templates, err := LoadExtractionTemplates("")
+	if err != nil {
+		widgets.QMessageBox_Warning(w, "Add Invoice from PDF", fmt.Sprintf("Failed to load the extraction templates: %v", err),
+			widgets.QMessageBox__Ok, widgets.QMessageBox__Ok)
+	}
+	result, err := ExtractPDFInvoice(name, templates)
+	if err != nil {
+		widgets.QMessageBox_Warning(w, "Add Invoice from PDF", err.Error(),
+			widgets.QMessageBox__Ok, widgets.QMessageBox__Ok)
+		return
+	}
+
+	note := fmt.Sprintf("Extracted from %v with the %v template. Check every field before submitting.",
+		filepath.Base(name), result.Template)
+	if len(result.Problems) > 0 {
+		note += "\n" + strings.Join(result.Problems, "\n")
+	}
+
+	dialog := NewDialog(nil, 0)
+	dialog.initWith(w.QWidget_PTR())
+	dialog.prefill(result.Invoice, "Add Invoice from PDF", note)
+	dialog.sourceFile = name
+	dialog.Exec()
+}
+
+// importInvoices() slot to open the CSV import wizard, and reload the
+// vendor list once invoices have been imported.
+func (w *MainWindow) importInvoices() {
+	if !w.allowed(ActionAdd, "Import") {
+		return
+	}
+	wizard := NewImportWizard(nil, 0)
+	wizard.initWith(w.QWidget_PTR())
+	wizard.Exec()
+
+	if wizard.imported > 0 {
+		w.setVendorView()
+		w.changeVendor(w.vendorView.CurrentText())
+	}
+}
+
+// exportInvoices() slot to open the export dialog and write the chosen
+// invoices to a file. The invoices are read in the background.
+func (w *MainWindow) exportInvoices() {
+	selected, hasSelection := w.selectedRow()
+
+	dialog := NewExportDialog(nil, 0)
+	dialog.initWith(w.QWidget_PTR(), hasSelection)
+	if dialog.Exec() != int(widgets.QDialog__Accepted) {
+		return
+	}
+
+	scope, format := dialog.scope(), dialog.format()
+	name := widgets.QFileDialog_GetSaveFileName(w, "Export Invoices", "",
+		exportFormatFilters[format], "", 0)
+	if name == "" {
+		return
+	}
+
+	// the list shown, read whole rather than with the columns of the table
+	filter := w.invoicesModel.filter()
+	var invoices Invoices
+	w.load("invoices to export", func(ctx context.Context) error {
+		switch scope {
+		case exportSelected:
+			invoice := w.model.GetInvoiceById(selected.ID)
+			if invoice.ID != selected.ID {
+				return fmt.Errorf("invoice %v from %v is gone", selected.InvoiceNo, selected.Vendor)
+			}
+			invoices = Invoices{invoice}
+		case exportList:
+			invoices = w.model.FindInvoices(filter)
+		case exportAll:
+			invoices = w.model.GetInvoices()
+		}
+		return nil
+	}, func(err error) {
+		if err != nil {
+			return
+		}
+		w.writeExport(name, invoices, format)
+	})
+}
+
+// writeExport() writes the invoices exported to the file.
+func (w *MainWindow) writeExport(name string, invoices Invoices, format string) {
+	file, err := os.Create(name)
+	if err == nil {
+		err = ExportInvoices(file, invoices, format)
+		if cerr := file.Close(); err == nil {
+			err = cerr
+		}
+	}
+	if err != nil {
+		widgets.QMessageBox_Critical(w, "Export Invoices", fmt.Sprintf("Failed to export: %v", err),
+			widgets.QMessageBox__Ok, widgets.QMessageBox__Ok)
+		return
+	}
+
+	w.StatusBar().ShowMessage(fmt.Sprintf("Exported %d invoices to %v", len(invoices), name), 5000)
+}
+
+// showInvoicesContextMenu() pops up the context menu for the invoice
+// under the mouse in the invoices table.
+func (w *MainWindow) showInvoicesContextMenu(pos *core.QPoint) {
+	index := w.invoicesTableView.IndexAt(pos)
+	if !index.IsValid() {
+		return
+	}
+	w.invoicesTableView.SelectRow(index.Row())
+	w.showInvoiceProfile(index)
+
+	menu := widgets.NewQMenu(w)
+	pdfAction := menu.AddAction("Save as &PDF...")
+	pdfAction.ConnectTriggered(func(bool) { w.saveInvoicePDF() })
+	facturXAction := menu.AddAction("Save as &Factur-X PDF...")
+	facturXAction.ConnectTriggered(func(bool) { w.saveInvoiceFacturX() })
+	ublAction := menu.AddAction("Save as &UBL...")
+	ublAction.ConnectTriggered(func(bool) { w.saveInvoiceUBL() })
+	printAction := menu.AddAction("&Print...")
+	printAction.ConnectTriggered(func(bool) { w.printInvoice() })
+	previewAction := menu.AddAction("Print Pre&view...")
+	previewAction.ConnectTriggered(func(bool) { w.printInvoicePreview() })
+
+	menu.Exec2(w.invoicesTableView.Viewport().MapToGlobal(pos), nil)
+}
+
+// saveInvoicePDF() slot to render the selected invoice to a PDF file.
+func (w *MainWindow) saveInvoicePDF() {
+	w.saveInvoicePDFAs("Save as PDF", false)
+}
+
+// saveInvoiceFacturX() slot to render the selected invoice to a PDF file
+// with the Factur-X XML attached.
+func (w *MainWindow) saveInvoiceFacturX() {
+	w.saveInvoicePDFAs("Save as Factur-X PDF", true)
+}
+
+// saveInvoicePDFAs() reads the selected invoice, see savePDF.
+func (w *MainWindow) saveInvoicePDFAs(title string, facturX bool) {
+	w.loadSelectedInvoice(func(invoice Invoice) {
+		w.savePDF(invoice, title, facturX)
+	})
+}
+
+// savePDF() asks for a file name and renders the invoice to it, attaching
+// the Factur-X XML if facturX is set or the template says so.
+func (w *MainWindow) savePDF(invoice Invoice, title string, facturX bool) {
+	template, err := LoadPDFTemplate("")
+	if err != nil {
+		widgets.QMessageBox_Warning(w, title, fmt.Sprintf("Failed to load PDF template: %v", err),
+			widgets.QMessageBox__Ok, widgets.QMessageBox__Ok)
+		return
+	}
+	if facturX {
+		template.FacturX = true
+	}
+
+	name := widgets.QFileDialog_GetSaveFileName(w, title, pdfFileName(invoice),
+		"PDF files (*.pdf)", "", 0)
+	if name == "" {
+		return
+	}
+
+	if err := WriteInvoicePDF(name, invoice, template); err != nil {
+		widgets.QMessageBox_Critical(w, title, fmt.Sprintf("Failed to save PDF: %v", err),
+			widgets.QMessageBox__Ok, widgets.QMessageBox__Ok)
+		return
+	}
+
+	w.StatusBar().ShowMessage(fmt.Sprintf("Saved %v", name), 5000)
+}
+
+// importEInvoices() slot to import UBL and CII documents and Factur-X /
+// ZUGFeRD PDFs, in the background. Documents failing the EN 16931 business
+// rules are listed with their errors and not imported.
+func (w *MainWindow) importEInvoices() {
+	if !w.allowed(ActionAdd, "Import E-Invoices") {
+		return
+	}
+	names := widgets.QFileDialog_GetOpenFileNames(w, "Import E-Invoices", "",
+		"E-invoices (*.xml *.pdf);;UBL and CII documents (*.xml);;Factur-X / ZUGFeRD PDFs (*.pdf);;All files (*)", "", 0)
+	if len(names) == 0 {
+		return
+	}
+
+	var report []string
+	imported := 0
+	w.load("e-invoices", func(ctx context.Context) error {
+		for _, name := range names {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			invoice, errs, err := ReadEInvoiceFile(name)
+			switch {
+			case err != nil:
+				report = append(report, fmt.Sprintf("%v: %v", name, err))
+			case len(errs) > 0:
+				report = append(report, fmt.Sprintf("%v: not imported", name))
+				for _, e := range errs {
+					report = append(report, "    "+e.Error())
+				}
+			case w.model.InvoiceExists(invoice.InvoiceNo, invoice.Vendor):
+				report = append(report, fmt.Sprintf("%v: invoice %v from %v already exists", name, invoice.InvoiceNo, invoice.Vendor))
+			case w.model.AddInvoice(invoice):
+				imported++
+			default:
+				report = append(report, fmt.Sprintf("%v: failed to add invoice %v from %v", name, invoice.InvoiceNo, invoice.Vendor))
+			}
+		}
+		return nil
+	}, func(err error) {
+		if imported > 0 {
+			w.setVendorView()
+			w.changeVendor(w.vendorView.CurrentText())
+		}
+		if err == nil {
+			w.showEInvoicesImported(len(names), imported, report)
+		}
+	})
+}
+
+// showEInvoicesImported() reports how many of the documents were imported,
+// with the problems of those which were not.
+func (w *MainWindow) showEInvoicesImported(documents, imported int, report []string) {
+	box := widgets.NewQMessageBox(w)
+	box.SetWindowTitle("Import E-Invoices")
+	box.SetText(fmt.Sprintf("Imported %d of %d documents.", imported, documents))
+	if len(report) > 0 {
+		box.SetIcon(widgets.QMessageBox__Warning)
+		box.SetDetailedText(strings.Join(report, "\n"))
+	}
+	box.Exec()
+}
+
+// importEmails() slot to read the invoices attached to .eml files or mbox
+// archives and queue them as drafts, then offer to review the drafts.
+func (w *MainWindow) importEmails() {
+	if !w.allowed(ActionAdd, "Import Email") {
+		return
+	}
+	names := widgets.QFileDialog_GetOpenFileNames(w, "Import Email", "",
+		"Email (*.eml *.mbox *.mbx);;All files (*)", "", 0)
+	if len(names) == 0 {
+		return
+	}
+
+	templates, err := LoadExtractionTemplates("")
+	if err != nil {
+		widgets.QMessageBox_Warning(w, "Import Email", fmt.Sprintf("Failed to load the extraction templates: %v", err),
+			widgets.QMessageBox__Ok, widgets.QMessageBox__Ok)
+	}
+	importer := NewEmailImporter(w.model, templates)
+
+	var report []string
+	messages, queued := 0, 0
+	for _, name := range names {
+		emails, err := ReadEmails(name)
+		if err != nil {
+			report = append(report, fmt.Sprintf("%v: %v", name, err))
+		}
+		for _, email := range emails {
+			messages++
+			result := importer.Import(email)
+			queued += result.Drafts
+			if result.Skipped != "" {
+				report = append(report, fmt.Sprintf("%v: %v", email.Subject, result.Skipped))
+			}
+			for _, problem := range result.Problems {
+				report = append(report, fmt.Sprintf("%v: %v", email.Subject, problem))
+			}
+		}
+	}
+
+	box := widgets.NewQMessageBox(w)
+	box.SetWindowTitle("Import Email")
+	box.SetText(fmt.Sprintf("Queued %d draft invoices from %d messages.", queued, messages))
+	if len(report) > 0 {
+		box.SetIcon(widgets.QMessageBox__Warning)
+		box.SetDetailedText(strings.Join(report, "\n"))
+	}
+	if queued > 0 {
+		box.SetInformativeText("Review the drafts now?")
+		box.SetStandardButtons(widgets.QMessageBox__Yes | widgets.QMessageBox__No)
+	}
+	if box.Exec() == int(widgets.QMessageBox__Yes) {
+		w.reviewDrafts()
+	}
+}
+
+// reviewDrafts() slot to open the list of draft invoices, and reload the
+// vendor list once invoices have been added from it.
+func (w *MainWindow) reviewDrafts() {
+	if !w.allowed(ActionAdd, "Review Drafts") {
+		return
+	}
+	dialog := NewDraftsDialog(nil, 0)
+	dialog.initWith(w.QWidget_PTR())
+	dialog.Exec()
+
+	if dialog.added > 0 {
+		w.setVendorView()
+		w.changeVendor(w.vendorView.CurrentText())
+	}
+}
+
+// watchInbox() asks for the inbox folder and starts watching it, or stops
+// watching it when the menu action is unchecked. The choice is remembered
+// for the next start of the app.
+func (w *MainWindow) watchInbox(checked bool) {
+	settings := core.NewQSettings("airpaio", "InvoiceViewer", nil)
+	if checked && !w.allowed(ActionAdd, "Watch Inbox Folder") {
+		w.inboxAction.SetChecked(false)
+		return
+	}
+	if !checked {
+		w.stopInbox()
+		settings.SetValue("inbox/enabled", core.NewQVariant14("false"))
+		w.StatusBar().ShowMessage("Stopped watching the inbox folder", 5000)
+		return
+	}
+
+	dir := widgets.QFileDialog_GetExistingDirectory(w, "Watch Inbox Folder",
+		settings.Value("inbox/dir", core.NewQVariant14("")).ToString(), widgets.QFileDialog__ShowDirsOnly)
+	if dir == "" || !w.startInbox(dir) {
+		w.inboxAction.SetChecked(false)
+		return
+	}
+	settings.SetValue("inbox/dir", core.NewQVariant14(dir))
+	settings.SetValue("inbox/enabled", core.NewQVariant14("true"))
+}
+
+// restoreInbox() starts watching the inbox folder if it was being watched
+// when the app was last closed, and the user may add invoices.
+func (w *MainWindow) restoreInbox() {
+	settings := core.NewQSettings("airpaio", "InvoiceViewer", nil)
+	dir := settings.Value("inbox/dir", core.NewQVariant14("")).ToString()
+	if dir != "" && settings.Value("inbox/enabled", core.NewQVariant14("false")).ToBool() && w.model.Authorize(ActionAdd) == nil {
+		w.inboxAction.SetChecked(w.startInbox(dir))
+	}
+}
+
+// startInbox() starts watching dir. The inbox reports every file it
+// processed through the inboxProcessed signal, which is delivered on the
+// GUI thread.
+func (w *MainWindow) startInbox(dir string) bool {
+	inbox := NewInbox(dir, 0)
+	inbox.Processed = func(result InboxResult) {
+		w.InboxProcessed(result.File, result.Imported, result.Failed())
+	}
+	if err := inbox.Start(); err != nil {
+		widgets.QMessageBox_Warning(w, "Watch Inbox Folder", fmt.Sprintf("Failed to watch %v: %v", dir, err),
+			widgets.QMessageBox__Ok, widgets.QMessageBox__Ok)
+		return false
+	}
+
+	w.inbox = inbox
+	w.StatusBar().ShowMessage(fmt.Sprintf("Watching %v", dir), 5000)
+	return true
+}
+
+// stopInbox() stops watching the inbox folder, and returns the folder, or
+// "" if it was not being watched.
+func (w *MainWindow) stopInbox() string {
+	if w.inbox == nil {
+		return ""
+	}
+	dir := w.inbox.Dir
+	w.inbox.Stop()
+	w.inbox = nil
+	return dir
+}
+
+// inboxProcessed() reloads the views after invoices were imported from
+// the inbox folder, keeping the selected vendor.
+func (w *MainWindow) inboxProcessed(file string, imported int, failed bool) {
+	if failed {
+		w.StatusBar().ShowMessage(fmt.Sprintf("Inbox: %v failed, see the %v folder", file, INBOXFAILED), 10000)
+		return
+	}
+
+	vendor := w.vendorView.CurrentText()
+	w.setVendorView()
+	w.vendorView.SetCurrentText(vendor)
+	w.changeVendor(w.vendorView.CurrentText())
+	w.StatusBar().ShowMessage(fmt.Sprintf("Inbox: imported %d invoices from %v", imported, file), 10000)
+}
+
+// saveInvoiceUBL() slot to save the selected invoice as a UBL document.
+func (w *MainWindow) saveInvoiceUBL() {
+	w.loadSelectedInvoice(w.saveUBL)
+}
+
+// saveUBL() asks for a file name and saves the invoice as a UBL document.
+func (w *MainWindow) saveUBL(invoice Invoice) {
+	name := widgets.QFileDialog_GetSaveFileName(w, "Save as UBL", ublFileName(invoice),
+		"UBL documents (*.xml)", "", 0)
+	if name == "" {
+		return
+	}
+
+	if errs := CheckUBL(invoice); len(errs) > 0 {
+		var msgs []string
+		for _, e := range errs {
+			msgs = append(msgs, e.Error())
+		}
+		answer := widgets.QMessageBox_Warning(w, "Save as UBL",
+			fmt.Sprintf("The UBL document fails these rules:\n\n%v\n\nSave it anyway?", strings.Join(msgs, "\n")),
+			widgets.QMessageBox__Yes|widgets.QMessageBox__No, widgets.QMessageBox__No)
+		if answer != widgets.QMessageBox__Yes {
+			return
+		}
+	}
+
+	if err := WriteUBLFile(name, invoice); err != nil {
+		widgets.QMessageBox_Critical(w, "Save as UBL", fmt.Sprintf("Failed to save UBL: %v", err),
+			widgets.QMessageBox__Ok, widgets.QMessageBox__Ok)
+		return
+	}
+
+	w.StatusBar().ShowMessage(fmt.Sprintf("Saved %v", name), 5000)
+}
+
+// selectedRow() returns the invoice selected in the invoices table, with
+// the fields of the table only. ok is false if no invoice is selected.
+func (w *MainWindow) selectedRow() (invoice Invoice, ok bool) {
+	if w.invoicesTableView.SelectionModel() == nil {
+		return invoice, false
+	}
+	rows := w.invoicesTableView.SelectionModel().SelectedRows(0)
+	if len(rows) == 0 {
+		return invoice, false
+	}
+	return w.invoicesModel.invoice(rows[0].Row())
+}
+
+// loadSelectedInvoice() reads the invoice selected in the invoices table
+// in the background, and calls done with it on the GUI thread unless it
+// is gone or cannot be read. It returns false if no invoice is selected.
+func (w *MainWindow) loadSelectedInvoice(done func(invoice Invoice)) bool {
+	row, ok := w.selectedRow()
+	if !ok {
+		return false
+	}
+
+	var invoice Invoice
+	w.load("selected invoice", func(ctx context.Context) error {
+		invoice = w.model.GetInvoiceById(row.ID)
+		if invoice.ID != row.ID {
+			return fmt.Errorf("invoice %v from %v is gone", row.InvoiceNo, row.Vendor)
+		}
+		return nil
+	}, func(err error) {
+		if err == nil {
+			done(invoice)
+		}
+	})
+	return true
+}
+
+// invoicesReset() adjusts the invoices table to a new query, showing its
+// sort order and selecting the invoice shown in the details again if it is
+// listed.
+func (w *MainWindow) invoicesReset() {
+	w.adjustHeader()
+
+	// the header would sort again on changing its indicator
+	column, order := w.invoicesModel.sortIndicator()
+	header := w.invoicesTableView.HorizontalHeader()
+	header.BlockSignals(true)
+	header.SetSortIndicator(column, order)
+	header.BlockSignals(false)
+
+	if row := w.invoicesModel.rowOf(w.shownInvoice); w.shownInvoice != 0 && row >= 0 {
+		w.invoicesTableView.SelectRow(row)
+	}
+}
+
+// adjustHeader() will adjust the table headers in the QTableViews:
+// the invoice number, or else the last column, takes the room left, and
+// the others are as wide as the user left them or else fit their contents.
 func (w *MainWindow) adjustHeader() {
-	switch w.tableCase {
-	case "all":
-		//w.invoicesAllTableView.HideColumn(0)
-		w.invoicesTableView.HorizontalHeader().SetSectionResizeMode2(1, widgets.QHeaderView__Stretch)
-		//w.invoicesAllTableView.ResizeColumnToContents(0)
-		w.invoicesTableView.ResizeColumnToContents(0)
-		w.invoicesTableView.ResizeColumnToContents(2)
-		w.invoicesTableView.ResizeColumnToContents(3)
-		w.invoicesTableView.ResizeColumnToContents(4)
-	case "individual":
-		w.invoicesTableView.HorizontalHeader().SetSectionResizeMode2(0, widgets.QHeaderView__Stretch)
-		w.invoicesTableView.ResizeColumnToContents(1)
-		w.invoicesTableView.ResizeColumnToContents(2)
-		w.invoicesTableView.ResizeColumnToContents(3)
+	w.adjustingHeader = true
+	defer func() { w.adjustingHeader = false }()
+
+	header := w.invoicesTableView.HorizontalHeader()
+	columns := w.invoicesModel.columns()
+	stretch := len(columns) - 1
+	for i, column := range columns {
+		if column.key == "invoiceno" {
+			stretch = i
+		}
+	}
+	for i := range columns {
+		if i == stretch {
+			header.SetSectionResizeMode2(i, widgets.QHeaderView__Stretch)
+		} else {
+			header.SetSectionResizeMode2(i, widgets.QHeaderView__Interactive)
+			if width, ok := w.columnWidths[columns[i].key]; ok {
+				header.ResizeSection(i, width)
+			} else {
+				w.invoicesTableView.ResizeColumnToContents(i)
+			}
+		}
 	}
 }
 
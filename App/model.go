@@ -18,6 +18,29 @@ type Invoice struct {
 	Total         int64    `json:"total"` // hold the values as integer cents, i.e. 7420 --> $74.20
 	Currency      string   `json:"currency"`
 	Paid          bool     `json:"paid"`
+
+	// fields used by e-invoicing formats such as UBL
+	VendorIDs  PartyIDs `json:"vendorids"`
+	Buyer      Party    `json:"buyer"`
+	DueDate    string   `json:"duedate,omitempty"`
+	TaxTotal   int64    `json:"taxtotal,omitempty"` // integer cents, included in Total
+	CreditNote bool     `json:"creditnote,omitempty"`
+
+	Attachments []Attachment `json:"attachments,omitempty"`
+
+	// the users who added the invoice and changed it last, kept by the
+	// repository, see users.go
+	CreatedBy  string `json:"createdby,omitempty"`
+	ModifiedBy string `json:"modifiedby,omitempty"`
+
+	// Date and DueDate as YYYY-MM-DD, kept by the repository so the DB can
+	// sort and compare dates, see dateKey
+	DateKey    string `json:"-"`
+	DueDateKey string `json:"-"`
+
+	// the number of LineItems, kept by the repository so the DB can sort
+	// by it without reading the line items
+	LineCount int `json:"-"`
 }
 
 // Location is a subfield containing address information.
@@ -26,6 +49,33 @@ type Location struct {
 	City    string `json:"city"`
 	State   string `json:"state"`
 	Zipcode string `json:"zipcode"`
+	Country string `json:"country,omitempty"` // ISO 3166-1 alpha-2 code, i.e. US
+}
+
+// Party is a subfield containing the buyer on an invoice.
+type Party struct {
+	Name    string   `json:"name"`
+	Address Location `json:"address"`
+	IDs     PartyIDs `json:"ids"`
+}
+
+// PartyIDs is a subfield containing the identifiers of a vendor or buyer.
+type PartyIDs struct {
+	EndpointID     string `json:"endpointid,omitempty"`     // electronic address, i.e. a Peppol participant ID
+	EndpointScheme string `json:"endpointscheme,omitempty"` // i.e. 0088 for a GLN
+	TaxID          string `json:"taxid,omitempty"`          // VAT identifier
+	LegalID        string `json:"legalid,omitempty"`        // company registration number
+	BankAccount    string `json:"bankaccount,omitempty"`    // IBAN or account number payments go to
+}
+
+// Attachment is a subfield describing a file attached to an invoice. The
+// content is kept in the attachment store, see attachments.go.
+type Attachment struct {
+	Name        string `json:"name"`
+	ContentType string `json:"contenttype"`
+	Size        int64  `json:"size"`
+	Hash        string `json:"hash"`  // hex SHA-256 of the content
+	Added       string `json:"added"` // MM/DD/YYYY
 }
 
 // Item is a subfield containing invoice line-item information.
@@ -34,6 +84,10 @@ type Item struct {
 	Description string `json:"description"`
 	Quantity    uint16 `json:"quantity"`
 	Amount      int64  `json:"amount"`
+
+	UnitCode    string  `json:"unitcode,omitempty"`    // UN/ECE rec 20 unit, i.e. C62 for "one"
+	TaxCategory string  `json:"taxcategory,omitempty"` // UNCL5305 code, i.e. S for standard rate
+	TaxPercent  float64 `json:"taxpercent,omitempty"`
 }
 
 // Items is an array of Item
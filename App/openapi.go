@@ -0,0 +1,259 @@
+// Copyright 2016 Cory Robinson. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE.txt file.
+
+// openapi.go holds the OpenAPI document of the API in api.go, served at
+// /api/v1/openapi.json. Keep it in step with the handlers.
+
+package main
+
+const apiOpenAPI = `{
+  "openapi": "3.0.3",
+  "info": {
+    "title": "Invoice Viewer API",
+    "version": "1.0.0",
+    "description": "Invoices, line items and vendors of the Invoice Viewer DB. Amounts are integer cents and dates MM/DD/YYYY. Requests log in with basic auth as an Invoice Viewer user and get 401 without valid credentials, or 403 if the role of the user does not allow the change."
+  },
+  "servers": [{"url": "/api/v1"}],
+  "security": [{"basicAuth": []}],
+  "paths": {
+    "/invoices": {
+      "get": {
+        "summary": "List invoices",
+        "description": "The invoices have the fields of the invoices table only: no line items, vendor IDs or buyer. Get those with /invoices/{id}.",
+        "parameters": [
+          {"name": "vendor", "in": "query", "schema": {"type": "string"}, "description": "Vendor name, not case sensitive"},
+          {"name": "paid", "in": "query", "schema": {"type": "boolean"}},
+          {"name": "from", "in": "query", "schema": {"type": "string"}, "description": "First invoice date, MM/DD/YYYY"},
+          {"name": "to", "in": "query", "schema": {"type": "string"}, "description": "Last invoice date, MM/DD/YYYY"},
+          {"name": "q", "in": "query", "schema": {"type": "string"}, "description": "Text in the vendor, invoice number or purchase order"},
+          {"$ref": "#/components/parameters/limit"},
+          {"$ref": "#/components/parameters/offset"}
+        ],
+        "responses": {
+          "200": {"description": "A page of invoices", "content": {"application/json": {"schema": {"$ref": "#/components/schemas/InvoicePage"}}}},
+          "304": {"description": "Not modified"},
+          "400": {"$ref": "#/components/responses/Error"}
+        }
+      },
+      "post": {
+        "summary": "Add an invoice",
+        "requestBody": {"required": true, "content": {"application/json": {"schema": {"$ref": "#/components/schemas/Invoice"}}}},
+        "responses": {
+          "201": {"description": "The invoice added, with its ID", "content": {"application/json": {"schema": {"$ref": "#/components/schemas/Invoice"}}}},
+          "400": {"$ref": "#/components/responses/Error"},
+          "409": {"$ref": "#/components/responses/Error"},
+          "422": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/invoices/{id}": {
+      "parameters": [{"$ref": "#/components/parameters/id"}],
+      "get": {
+        "summary": "Get an invoice",
+        "responses": {
+          "200": {"description": "The invoice", "content": {"application/json": {"schema": {"$ref": "#/components/schemas/Invoice"}}}},
+          "304": {"description": "Not modified"},
+          "404": {"$ref": "#/components/responses/Error"}
+        }
+      },
+      "put": {
+        "summary": "Replace an invoice",
+        "parameters": [{"$ref": "#/components/parameters/ifMatch"}],
+        "requestBody": {"required": true, "content": {"application/json": {"schema": {"$ref": "#/components/schemas/Invoice"}}}},
+        "responses": {
+          "200": {"description": "The invoice updated", "content": {"application/json": {"schema": {"$ref": "#/components/schemas/Invoice"}}}},
+          "400": {"$ref": "#/components/responses/Error"},
+          "404": {"$ref": "#/components/responses/Error"},
+          "409": {"$ref": "#/components/responses/Error"},
+          "412": {"$ref": "#/components/responses/Error"},
+          "422": {"$ref": "#/components/responses/Error"}
+        }
+      },
+      "delete": {
+        "summary": "Delete an invoice",
+        "parameters": [{"$ref": "#/components/parameters/ifMatch"}],
+        "responses": {
+          "204": {"description": "Deleted"},
+          "404": {"$ref": "#/components/responses/Error"},
+          "412": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/invoices/{id}/items": {
+      "parameters": [{"$ref": "#/components/parameters/id"}],
+      "get": {
+        "summary": "Line items of an invoice",
+        "responses": {
+          "200": {"description": "The line items", "content": {"application/json": {"schema": {"type": "array", "items": {"$ref": "#/components/schemas/Item"}}}}},
+          "404": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/vendors": {
+      "get": {
+        "summary": "List vendors with their number of invoices",
+        "responses": {
+          "200": {"description": "The vendors", "content": {"application/json": {"schema": {"type": "array", "items": {"$ref": "#/components/schemas/Vendor"}}}}}
+        }
+      }
+    },
+    "/vendors/{name}/invoices": {
+      "get": {
+        "summary": "List the invoices of a vendor, by ID",
+        "parameters": [
+          {"name": "name", "in": "path", "required": true, "schema": {"type": "string"}},
+          {"$ref": "#/components/parameters/limit"},
+          {"$ref": "#/components/parameters/offset"}
+        ],
+        "responses": {
+          "200": {"description": "A page of invoices", "content": {"application/json": {"schema": {"$ref": "#/components/schemas/InvoicePage"}}}}
+        }
+      }
+    },
+    "/counts": {
+      "get": {
+        "summary": "Invoice, vendor and paid counts",
+        "responses": {
+          "200": {"description": "The counts", "content": {"application/json": {"schema": {"$ref": "#/components/schemas/Counts"}}}}
+        }
+      }
+    },
+    "/search": {
+      "get": {
+        "summary": "List the invoices selected by a search query, by ID",
+        "parameters": [
+          {"name": "q", "in": "query", "required": true, "schema": {"type": "string"}, "example": "vendor:niche paid:false total>100 date:2018-01..2018-03 \"hammer\"",
+            "description": "Terms which must all match: text or a \"phrase\" in the vendor, invoice number, purchase order or line items, or vendor:, invoice:, po:, currency:, item:, product:, paid:, total and date with :, >, >=, <, <= or a range a..b"},
+          {"$ref": "#/components/parameters/limit"},
+          {"$ref": "#/components/parameters/offset"}
+        ],
+        "responses": {
+          "200": {"description": "A page of invoices", "content": {"application/json": {"schema": {"$ref": "#/components/schemas/InvoicePage"}}}},
+          "400": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    }
+  },
+  "components": {
+    "securitySchemes": {
+      "basicAuth": {"type": "http", "scheme": "basic"}
+    },
+    "parameters": {
+      "id": {"name": "id", "in": "path", "required": true, "schema": {"type": "integer"}},
+      "limit": {"name": "limit", "in": "query", "schema": {"type": "integer", "minimum": 1, "maximum": 500, "default": 50}},
+      "offset": {"name": "offset", "in": "query", "schema": {"type": "integer", "minimum": 0, "default": 0}},
+      "ifMatch": {"name": "If-Match", "in": "header", "schema": {"type": "string"}, "description": "ETag of the invoice as last read"}
+    },
+    "responses": {
+      "Error": {"description": "An error", "content": {"application/json": {"schema": {"$ref": "#/components/schemas/Error"}}}}
+    },
+    "schemas": {
+      "Invoice": {
+        "type": "object",
+        "required": ["vendor", "invoiceno", "date", "total"],
+        "properties": {
+          "ID": {"type": "integer", "readOnly": true},
+          "vendor": {"type": "string"},
+          "address": {"$ref": "#/components/schemas/Location"},
+          "items": {"type": "array", "items": {"$ref": "#/components/schemas/Item"}},
+          "invoiceno": {"type": "string"},
+          "date": {"type": "string", "example": "05/25/2018"},
+          "purchaseorder": {"type": "string"},
+          "total": {"type": "integer", "description": "Integer cents"},
+          "currency": {"type": "string", "example": "USD"},
+          "paid": {"type": "boolean"},
+          "vendorids": {"$ref": "#/components/schemas/PartyIDs"},
+          "buyer": {"$ref": "#/components/schemas/Party"},
+          "duedate": {"type": "string"},
+          "taxtotal": {"type": "integer", "description": "Integer cents, included in total"},
+          "creditnote": {"type": "boolean"},
+          "attachments": {"type": "array", "items": {"$ref": "#/components/schemas/Attachment"}}
+        }
+      },
+      "Location": {
+        "type": "object",
+        "properties": {
+          "street": {"type": "string"},
+          "city": {"type": "string"},
+          "state": {"type": "string"},
+          "zipcode": {"type": "string"},
+          "country": {"type": "string"}
+        }
+      },
+      "Party": {
+        "type": "object",
+        "properties": {
+          "name": {"type": "string"},
+          "address": {"$ref": "#/components/schemas/Location"},
+          "ids": {"$ref": "#/components/schemas/PartyIDs"}
+        }
+      },
+      "PartyIDs": {
+        "type": "object",
+        "properties": {
+          "endpointid": {"type": "string"},
+          "endpointscheme": {"type": "string"},
+          "taxid": {"type": "string"},
+          "legalid": {"type": "string"},
+          "bankaccount": {"type": "string"}
+        }
+      },
+      "Item": {
+        "type": "object",
+        "properties": {
+          "productid": {"type": "string"},
+          "description": {"type": "string"},
+          "quantity": {"type": "integer"},
+          "amount": {"type": "integer", "description": "Unit price in integer cents"},
+          "unitcode": {"type": "string"},
+          "taxcategory": {"type": "string"},
+          "taxpercent": {"type": "number"}
+        }
+      },
+      "Attachment": {
+        "type": "object",
+        "properties": {
+          "name": {"type": "string"},
+          "contenttype": {"type": "string"},
+          "size": {"type": "integer"},
+          "hash": {"type": "string"},
+          "added": {"type": "string"}
+        }
+      },
+      "InvoicePage": {
+        "type": "object",
+        "properties": {
+          "total": {"type": "integer"},
+          "limit": {"type": "integer"},
+          "offset": {"type": "integer"},
+          "items": {"type": "array", "items": {"$ref": "#/components/schemas/Invoice"}}
+        }
+      },
+      "Vendor": {
+        "type": "object",
+        "properties": {
+          "name": {"type": "string"},
+          "invoices": {"type": "integer"}
+        }
+      },
+      "Counts": {
+        "type": "object",
+        "properties": {
+          "invoices": {"type": "integer"},
+          "vendors": {"type": "integer"},
+          "paid": {"type": "integer"},
+          "unpaid": {"type": "integer"}
+        }
+      },
+      "Error": {
+        "type": "object",
+        "properties": {
+          "error": {"type": "string"},
+          "problems": {"type": "array", "items": {"type": "string"}}
+        }
+      }
+    }
+  }
+}
+`
@@ -0,0 +1,274 @@
+// Copyright 2016 Cory Robinson. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE.txt file.
+
+// pdf.go renders invoices to PDF. The layout is controlled by a PDFTemplate
+// which can be loaded from a JSON file, so the company name, logo, colors
+// and page size can be changed without recompiling. Rendering is pure Go
+// using gofpdf; no external tools are needed.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/jung-kurt/gofpdf"
+)
+
+// PDFTEMPLATE is the template file used if it exists in the working
+// directory and no other template is given.
+const PDFTEMPLATE = "pdfTemplate.json"
+
+// PDFTemplate holds the configurable parts of the PDF layout.
+type PDFTemplate struct {
+	Title          string   `json:"title"`          // heading at the top of the page
+	CompanyName    string   `json:"companyname"`    // printed under the logo
+	CompanyAddress []string `json:"companyaddress"` // one entry per line
+	Logo           string   `json:"logo"`           // path to a PNG, JPEG or GIF image
+	LogoWidth      float64  `json:"logowidth"`      // in mm, the height keeps the aspect ratio
+	PageSize       string   `json:"pagesize"`       // "Letter", "A4" or "Legal"
+	Font           string   `json:"font"`           // "Helvetica", "Times" or "Courier"
+	AccentColor    [3]int   `json:"accentcolor"`    // RGB of the table header
+	Footer         string   `json:"footer"`         // printed at the bottom of every page
+	FacturX        bool     `json:"facturx"`        // attach the invoice as Factur-X / ZUGFeRD XML
+}
+
+// defaultPDFTemplate is the template used when none is configured.
+var defaultPDFTemplate = PDFTemplate{
+	Title:       "INVOICE",
+	LogoWidth:   40,
+	PageSize:    "Letter",
+	Font:        "Helvetica",
+	AccentColor: [3]int{52, 101, 164},
+}
+
+// LoadPDFTemplate reads a template from a JSON file. Fields missing from the
+// file keep their default values. An empty path loads PDFTEMPLATE if it
+// exists, otherwise the default template is returned.
+func LoadPDFTemplate(path string) (PDFTemplate, error) {
+	template := defaultPDFTemplate
+	if path == "" {
+		if _, err := os.Stat(PDFTEMPLATE); err != nil {
+			return template, nil
+		}
+		path = PDFTEMPLATE
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return template, err
+	}
+	if err := json.Unmarshal(data, &template); err != nil {
+		return template, fmt.Errorf("%v: %v", path, err)
+	}
+
+	// a relative logo path is relative to the template file
+	if template.Logo != "" && !filepath.IsAbs(template.Logo) {
+		template.Logo = filepath.Join(filepath.Dir(path), template.Logo)
+	}
+
+	return template, nil
+}
+
+// pdfFileName returns a file name for an invoice's PDF, e.g.
+// "Niche Electronics-143356.pdf".
+func pdfFileName(invoice Invoice) string {
+	name := invoice.Vendor + "-" + invoice.InvoiceNo
+	name = strings.Map(func(c rune) rune {
+		if strings.ContainsRune(`/\:*?"<>|`, c) {
+			return '_'
+		}
+		return c
+	}, name)
+	return name + ".pdf"
+}
+
+// RenderInvoicePDF writes the invoice as a PDF document to w.
+func RenderInvoicePDF(w io.Writer, invoice Invoice, template PDFTemplate) error {
+	pdf := gofpdf.New("P", "mm", template.PageSize, "")
+	pdf.SetMargins(15, 15, 15)
+	pdf.SetAutoPageBreak(true, 20)
+	pdf.AliasNbPages("")
+	tr := pdf.UnicodeTranslatorFromDescriptor("")
+	font := template.Font
+
+	pageWidth, _ := pdf.GetPageSize()
+	left, _, right, _ := pdf.GetMargins()
+	width := pageWidth - left - right
+
+	pdf.SetFooterFunc(func() {
+		pdf.SetY(-15)
+		pdf.SetFont(font, "I", 8)
+		pdf.SetTextColor(128, 128, 128)
+		pdf.CellFormat(width/2, 10, tr(template.Footer), "", 0, "L", false, 0, "")
+		pdf.CellFormat(width/2, 10, fmt.Sprintf("Page %d of {nb}", pdf.PageNo()), "", 0, "R", false, 0, "")
+	})
+
+	pdf.AddPage()
+
+	// company block: logo and name on the left, title on the right
+	top := pdf.GetY()
+	if template.Logo != "" {
+		pdf.ImageOptions(template.Logo, left, top, template.LogoWidth, 0, true,
+			gofpdf.ImageOptions{ReadDpi: true}, 0, "")
+	}
+	pdf.SetFont(font, "B", 11)
+	if template.CompanyName != "" {
+		pdf.CellFormat(width/2, 5, tr(template.CompanyName), "", 1, "L", false, 0, "")
+	}
+	pdf.SetFont(font, "", 9)
+	for _, line := range template.CompanyAddress {
+		pdf.CellFormat(width/2, 4, tr(line), "", 1, "L", false, 0, "")
+	}
+	bottom := pdf.GetY()
+
+	pdf.SetXY(left+width/2, top)
+	pdf.SetFont(font, "B", 20)
+	pdf.SetTextColor(template.AccentColor[0], template.AccentColor[1], template.AccentColor[2])
+	pdf.CellFormat(width/2, 10, tr(template.Title), "", 2, "R", false, 0, "")
+	pdf.SetTextColor(0, 0, 0)
+
+	// invoice details under the title
+	details := [][2]string{
+		{"Invoice No.", invoice.InvoiceNo},
+		{"Date", invoice.Date},
+		{"Purchase Order", invoice.PurchaseOrder},
+		{"Status", paidString(invoice.Paid)},
+	}
+	for _, detail := range details {
+		pdf.SetX(left + width/2)
+		pdf.SetFont(font, "B", 9)
+		pdf.CellFormat(width/4, 5, detail[0]+":", "", 0, "R", false, 0, "")
+		pdf.SetFont(font, "", 9)
+		pdf.CellFormat(width/4, 5, tr(detail[1]), "", 1, "R", false, 0, "")
+	}
+	if pdf.GetY() > bottom {
+		bottom = pdf.GetY()
+	}
+
+	// vendor address
+	pdf.SetY(bottom + 10)
+	pdf.SetFont(font, "B", 9)
+	pdf.CellFormat(width, 5, "VENDOR:", "", 1, "L", false, 0, "")
+	pdf.SetFont(font, "", 10)
+	address := invoice.Address
+	for _, line := range []string{invoice.Vendor, address.Street,
+		strings.TrimSpace(fmt.Sprintf("%v, %v %v", address.City, address.State, address.Zipcode))} {
+		if strings.Trim(line, ", ") != "" {
+			pdf.CellFormat(width, 5, tr(line), "", 1, "L", false, 0, "")
+		}
+	}
+	pdf.Ln(8)
+
+	// line items table
+	colWidths := []float64{30, width - 30 - 18 - 28 - 28, 18, 28, 28}
+	header := []string{"Product ID", "Description", "Quantity", "Unit Price", "Amount"}
+	aligns := []string{"L", "L", "R", "R", "R"}
+
+	drawHeader := func() {
+		pdf.SetFont(font, "B", 9)
+		pdf.SetFillColor(template.AccentColor[0], template.AccentColor[1], template.AccentColor[2])
+		pdf.SetTextColor(255, 255, 255)
+		for i, title := range header {
+			pdf.CellFormat(colWidths[i], 7, title, "", 0, aligns[i], true, 0, "")
+		}
+		pdf.Ln(-1)
+		pdf.SetTextColor(0, 0, 0)
+		pdf.SetFont(font, "", 9)
+	}
+	drawHeader()
+
+	_, pageHeight := pdf.GetPageSize()
+	for i, item := range invoice.LineItems {
+		if pdf.GetY()+6 > pageHeight-25 {
+			pdf.AddPage()
+			drawHeader()
+		}
+		pdf.SetFillColor(240, 240, 240)
+		fill := i%2 == 1
+		values := []string{
+			item.ProductID,
+			item.Description,
+			strconv.Itoa(int(item.Quantity)),
+			formatCents(item.Amount),
+			formatCents(int64(item.Quantity) * item.Amount),
+		}
+		for j, value := range values {
+			pdf.CellFormat(colWidths[j], 6, tr(fitText(pdf, value, colWidths[j]-2)), "", 0, aligns[j], fill, 0, "")
+		}
+		pdf.Ln(-1)
+	}
+
+	// totals; anything on top of the line items is shown as tax
+	subtotal := lineItemsTotal(invoice.LineItems)
+	totals := [][2]string{{"Subtotal", formatCents(subtotal)}}
+	if tax := invoice.Total - subtotal; tax != 0 && len(invoice.LineItems) > 0 {
+		totals = append(totals, [2]string{"Tax", formatCents(tax)})
+	}
+	totals = append(totals, [2]string{"Total " + invoice.Currency, formatCents(invoice.Total)})
+
+	pdf.Ln(3)
+	labelWidth := colWidths[2] + colWidths[3]
+	for i, total := range totals {
+		style := ""
+		if i == len(totals)-1 {
+			style = "B"
+		}
+		pdf.SetFont(font, style, 10)
+		pdf.SetX(left + width - labelWidth - colWidths[4])
+		pdf.CellFormat(labelWidth, 6, total[0], "", 0, "R", false, 0, "")
+		pdf.CellFormat(colWidths[4], 6, total[1], "", 1, "R", false, 0, "")
+	}
+
+	if template.FacturX {
+		if err := embedFacturX(pdf, invoice); err != nil {
+			return err
+		}
+	}
+
+	return pdf.Output(w)
+}
+
+// WriteInvoicePDF renders the invoice as a PDF file.
+func WriteInvoicePDF(name string, invoice Invoice, template PDFTemplate) error {
+	file, err := os.Create(name)
+	if err != nil {
+		return err
+	}
+
+	err = RenderInvoicePDF(file, invoice, template)
+	if cerr := file.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(name)
+	}
+
+	return err
+}
+
+// fitText shortens s with "..." so that it fits in width.
+func fitText(pdf *gofpdf.Fpdf, s string, width float64) string {
+	if pdf.GetStringWidth(s) <= width {
+		return s
+	}
+	runes := []rune(s)
+	for len(runes) > 0 && pdf.GetStringWidth(string(runes)+"...") > width {
+		runes = runes[:len(runes)-1]
+	}
+	return string(runes) + "..."
+}
+
+// paidString returns the status text for the paid flag.
+func paidString(paid bool) string {
+	if paid {
+		return "Paid"
+	}
+	return "Not Paid"
+}
@@ -0,0 +1,500 @@
+// Copyright 2016 Cory Robinson. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE.txt file.
+
+// pdfAttachments.go reads the files embedded in a PDF document, such as the
+// XML invoice of a ZUGFeRD / Factur-X PDF. It is not a general PDF parser:
+// the file is scanned for its objects, including those packed in object
+// streams, and every file specification with an embedded file is
+// returned. Encrypted documents are not supported.
+
+package main
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strconv"
+	"unicode/utf16"
+)
+
+// PDFAttachment is a file embedded in a PDF document.
+type PDFAttachment struct {
+	Name string
+	Data []byte
+}
+
+// PDF object types, as returned by pdfLexer.object(). Strings are []byte,
+// numbers float64, booleans bool and null nil.
+type (
+	pdfName    string
+	pdfKeyword string
+	pdfArray   []interface{}
+	pdfDict    map[pdfName]interface{}
+	pdfRef     struct{ num, gen int }
+	pdfStream  struct {
+		dict pdfDict
+		raw  []byte // still encoded
+	}
+)
+
+// pdfObjectStart matches the "12 0 obj" starting an indirect object and
+// pdfTrailer the start of a trailer dictionary.
+var (
+	pdfObjectStart = regexp.MustCompile(`(\d+)\s+(\d+)\s+obj\b`)
+	pdfTrailer     = regexp.MustCompile(`trailer\s*<<`)
+)
+
+// errPDFEncrypted is returned for encrypted documents.
+var errPDFEncrypted = errors.New("encrypted PDF documents are not supported")
+
+// ReadPDFAttachments returns the files embedded in a PDF document.
+func ReadPDFAttachments(data []byte) ([]PDFAttachment, error) {
+	if !bytes.HasPrefix(bytes.TrimLeft(data, "\x00\t\n\r "), []byte("%PDF-")) {
+		return nil, errors.New("not a PDF document")
+	}
+
+	objects, err := readPDFObjects(data)
+	if err != nil {
+		return nil, err
+	}
+
+	var attachments []PDFAttachment
+	seen := map[pdfRef]bool{}
+	for _, object := range objects {
+		spec, ok := object.(pdfDict)
+		if !ok {
+			continue
+		}
+		ef, ok := resolvePDF(objects, spec["EF"]).(pdfDict)
+		if !ok {
+			continue
+		}
+
+		fileRef, ok := ef["UF"].(pdfRef)
+		if !ok {
+			fileRef, ok = ef["F"].(pdfRef)
+		}
+		if !ok || seen[fileRef] {
+			continue
+		}
+		seen[fileRef] = true
+
+		stream, ok := objects[fileRef].(pdfStream)
+		if !ok {
+			continue
+		}
+		content, err := decodePDFStream(stream)
+		if err != nil {
+			return nil, err
+		}
+
+		name := pdfTextString(resolvePDF(objects, spec["UF"]))
+		if name == "" {
+			name = pdfTextString(resolvePDF(objects, spec["F"]))
+		}
+		attachments = append(attachments, PDFAttachment{Name: name, Data: content})
+	}
+	sort.Slice(attachments, func(i, j int) bool { return attachments[i].Name < attachments[j].Name })
+
+	return attachments, nil
+}
+
+// readPDFObjects scans the document for its indirect objects. An object
+// defined more than once, as happens with incremental updates, keeps its
+// last definition.
+func readPDFObjects(data []byte) (map[pdfRef]interface{}, error) {
+	objects := map[pdfRef]interface{}{}
+
+	for _, trailer := range pdfTrailer.FindAllIndex(data, -1) {
+		lexer := &pdfLexer{data: data, pos: trailer[1] - 2}
+		if dict, ok := lexer.object().(pdfDict); ok && dict["Encrypt"] != nil {
+			return nil, errPDFEncrypted
+		}
+	}
+
+	next := 0
+	for _, match := range pdfObjectStart.FindAllSubmatchIndex(data, -1) {
+		if match[0] < next {
+			continue // inside the stream of the previous object
+		}
+		num, _ := strconv.Atoi(string(data[match[2]:match[3]]))
+		gen, _ := strconv.Atoi(string(data[match[4]:match[5]]))
+
+		lexer := &pdfLexer{data: data, pos: match[1]}
+		object := lexer.object()
+		next = lexer.pos
+
+		if dict, ok := object.(pdfDict); ok {
+			mark := lexer.pos
+			if lexer.object() == pdfKeyword("stream") {
+				stream := pdfStream{dict: dict, raw: lexer.streamData(dict)}
+				object = stream
+				next = lexer.pos
+				if dict["Type"] == pdfName("XRef") && dict["Encrypt"] != nil {
+					return nil, errPDFEncrypted
+				}
+			} else {
+				lexer.pos = mark
+			}
+		}
+		objects[pdfRef{num, gen}] = object
+
+		if stream, ok := object.(pdfStream); ok && stream.dict["Type"] == pdfName("ObjStm") {
+			if err := readPDFObjectStream(objects, stream); err != nil {
+				return nil, fmt.Errorf("object %d: %v", num, err)
+			}
+		}
+	}
+
+	if len(objects) == 0 {
+		return nil, errors.New("no objects found in PDF document")
+	}
+	return objects, nil
+}
+
+// readPDFObjectStream adds the objects packed in an object stream.
+func readPDFObjectStream(objects map[pdfRef]interface{}, stream pdfStream) error {
+	content, err := decodePDFStream(stream)
+	if err != nil {
+		return err
+	}
+	count, _ := stream.dict["N"].(float64)
+	first, _ := stream.dict["First"].(float64)
+	if int(first) > len(content) {
+		return errors.New("bad object stream")
+	}
+
+	header := &pdfLexer{data: content[:int(first)]}
+	for i := 0; i < int(count); i++ {
+		num, ok1 := header.object().(float64)
+		offset, ok2 := header.object().(float64)
+		if !ok1 || !ok2 || int(first+offset) > len(content) {
+			return errors.New("bad object stream header")
+		}
+		lexer := &pdfLexer{data: content, pos: int(first + offset)}
+		objects[pdfRef{int(num), 0}] = lexer.object()
+	}
+	return nil
+}
+
+// resolvePDF follows an indirect reference.
+func resolvePDF(objects map[pdfRef]interface{}, object interface{}) interface{} {
+	if ref, ok := object.(pdfRef); ok {
+		return objects[ref]
+	}
+	return object
+}
+
+// decodePDFStream applies the stream's filters. Only the filters used for
+// embedded files and object streams in practice are supported.
+func decodePDFStream(stream pdfStream) ([]byte, error) {
+	var filters []interface{}
+	switch filter := stream.dict["Filter"].(type) {
+	case pdfName:
+		filters = []interface{}{filter}
+	case pdfArray:
+		filters = filter
+	}
+
+	content := stream.raw
+	for _, filter := range filters {
+		switch filter {
+		case pdfName("FlateDecode"):
+			if params, ok := stream.dict["DecodeParms"].(pdfDict); ok && params["Predictor"] != nil {
+				if predictor, _ := params["Predictor"].(float64); predictor > 1 {
+					return nil, errors.New("FlateDecode predictors are not supported")
+				}
+			}
+			reader, err := zlib.NewReader(bytes.NewReader(content))
+			if err != nil {
+				return nil, err
+			}
+			content, err = io.ReadAll(reader)
+			if err != nil && err != io.ErrUnexpectedEOF {
+				return nil, err
+			}
+		case pdfName("ASCIIHexDecode"):
+			end := bytes.IndexByte(content, '>')
+			if end < 0 {
+				end = len(content)
+			}
+			content = decodePDFHex(content[:end])
+		default:
+			return nil, fmt.Errorf("unsupported stream filter %v", filter)
+		}
+	}
+
+	return content, nil
+}
+
+// pdfTextString decodes a PDF text string, which is either UTF-16BE with a
+// byte order mark or PDFDocEncoding, here read as Latin-1.
+func pdfTextString(object interface{}) string {
+	s, ok := object.([]byte)
+	if !ok {
+		return ""
+	}
+	if len(s) >= 2 && s[0] == 0xfe && s[1] == 0xff {
+		units := make([]uint16, (len(s)-2)/2)
+		for i := range units {
+			units[i] = uint16(s[2+2*i])<<8 | uint16(s[3+2*i])
+		}
+		return string(utf16.Decode(units))
+	}
+	runes := make([]rune, len(s))
+	for i, c := range s {
+		runes[i] = rune(c)
+	}
+	return string(runes)
+}
+
+// pdfLexer reads PDF objects from data.
+type pdfLexer struct {
+	data []byte
+	pos  int
+}
+
+// isPDFSpace reports whether c is PDF white space.
+func isPDFSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\r' || c == '\n' || c == '\f' || c == 0
+}
+
+// isPDFDelimiter reports whether c ends a name, number or keyword.
+func isPDFDelimiter(c byte) bool {
+	return isPDFSpace(c) || bytes.IndexByte([]byte("()<>[]{}/%"), c) >= 0
+}
+
+// skipSpace skips white space and comments.
+func (l *pdfLexer) skipSpace() {
+	for l.pos < len(l.data) {
+		c := l.data[l.pos]
+		if c == '%' {
+			for l.pos < len(l.data) && l.data[l.pos] != '\r' && l.data[l.pos] != '\n' {
+				l.pos++
+			}
+		} else if !isPDFSpace(c) {
+			return
+		}
+		l.pos++
+	}
+}
+
+// object reads the next object. Indirect references are returned as
+// pdfRef and anything else that is not an object as a pdfKeyword; nil is
+// returned at the end of the data.
+func (l *pdfLexer) object() interface{} {
+	l.skipSpace()
+	if l.pos >= len(l.data) {
+		return nil
+	}
+
+	switch c := l.data[l.pos]; {
+	case c == '/':
+		l.pos++
+		return pdfName(l.token())
+	case c == '(':
+		return l.literalString()
+	case c == '<' && l.pos+1 < len(l.data) && l.data[l.pos+1] == '<':
+		l.pos += 2
+		dict := pdfDict{}
+		for {
+			key := l.object()
+			name, ok := key.(pdfName)
+			if !ok {
+				return dict // ">>" or the end of the data
+			}
+			dict[name] = l.object()
+		}
+	case c == '<':
+		l.pos++
+		end := bytes.IndexByte(l.data[l.pos:], '>')
+		if end < 0 {
+			end = len(l.data) - l.pos
+		}
+		content := l.data[l.pos : l.pos+end]
+		l.pos += end + 1
+		return decodePDFHex(content)
+	case c == '>' && l.pos+1 < len(l.data) && l.data[l.pos+1] == '>':
+		l.pos += 2
+		return pdfKeyword(">>")
+	case c == '[':
+		l.pos++
+		array := pdfArray{}
+		for {
+			object := l.object()
+			if keyword, ok := object.(pdfKeyword); ok && keyword == "]" || object == nil && l.pos >= len(l.data) {
+				return array
+			}
+			array = append(array, object)
+		}
+	case c == ']' || c == '{' || c == '}' || c == ')' || c == '>':
+		l.pos++
+		return pdfKeyword(string(c))
+	}
+
+	token := l.token()
+	switch token {
+	case "true":
+		return true
+	case "false":
+		return false
+	case "null":
+		return nil
+	}
+	number, err := strconv.ParseFloat(token, 64)
+	if err != nil {
+		return pdfKeyword(token)
+	}
+
+	// an integer may start an indirect reference "12 0 R"
+	if number == float64(int(number)) && number >= 0 {
+		mark := l.pos
+		l.skipSpace()
+		gen, err := strconv.Atoi(l.token())
+		if err == nil {
+			l.skipSpace()
+			if l.token() == "R" {
+				return pdfRef{int(number), gen}
+			}
+		}
+		l.pos = mark
+	}
+	return number
+}
+
+// token reads a name, number or keyword, decoding #xx escapes.
+func (l *pdfLexer) token() string {
+	var b []byte
+	for l.pos < len(l.data) && !isPDFDelimiter(l.data[l.pos]) {
+		c := l.data[l.pos]
+		if c == '#' && l.pos+2 < len(l.data) {
+			if v, err := strconv.ParseUint(string(l.data[l.pos+1:l.pos+3]), 16, 8); err == nil {
+				b = append(b, byte(v))
+				l.pos += 3
+				continue
+			}
+		}
+		b = append(b, c)
+		l.pos++
+	}
+	if len(b) == 0 && l.pos < len(l.data) {
+		// a stray delimiter, skip it so the caller makes progress
+		l.pos++
+		return string(l.data[l.pos-1])
+	}
+	return string(b)
+}
+
+// literalString reads a "(...)" string with its escapes.
+func (l *pdfLexer) literalString() []byte {
+	var b []byte
+	depth := 0
+	l.pos++ // opening parenthesis
+	for l.pos < len(l.data) {
+		c := l.data[l.pos]
+		l.pos++
+		switch c {
+		case '(':
+			depth++
+		case ')':
+			if depth == 0 {
+				return b
+			}
+			depth--
+		case '\\':
+			if l.pos >= len(l.data) {
+				return b
+			}
+			e := l.data[l.pos]
+			l.pos++
+			switch e {
+			case 'n':
+				c = '\n'
+			case 'r':
+				c = '\r'
+			case 't':
+				c = '\t'
+			case 'b':
+				c = '\b'
+			case 'f':
+				c = '\f'
+			case '\r':
+				if l.pos < len(l.data) && l.data[l.pos] == '\n' {
+					l.pos++
+				}
+				continue // line continuation
+			case '\n':
+				continue
+			default:
+				if e >= '0' && e <= '7' {
+					v := int(e - '0')
+					for i := 0; i < 2 && l.pos < len(l.data) && l.data[l.pos] >= '0' && l.data[l.pos] <= '7'; i++ {
+						v = v*8 + int(l.data[l.pos]-'0')
+						l.pos++
+					}
+					c = byte(v)
+				} else {
+					c = e // \( \) \\ and unknown escapes
+				}
+			}
+		}
+		b = append(b, c)
+	}
+	return b
+}
+
+// decodePDFHex decodes the content of a "<...>" string.
+func decodePDFHex(content []byte) []byte {
+	var digits []byte
+	for _, c := range content {
+		if !isPDFSpace(c) {
+			digits = append(digits, c)
+		}
+	}
+	if len(digits)%2 == 1 {
+		digits = append(digits, '0')
+	}
+	decoded := make([]byte, hex.DecodedLen(len(digits)))
+	n, _ := hex.Decode(decoded, digits)
+	return decoded[:n]
+}
+
+// streamData returns the raw data of the stream starting at the current
+// position, after the "stream" keyword, and moves past "endstream". A
+// direct /Length is used if it is consistent, otherwise the data runs up
+// to the "endstream" keyword.
+func (l *pdfLexer) streamData(dict pdfDict) []byte {
+	if l.pos < len(l.data) && l.data[l.pos] == '\r' {
+		l.pos++
+	}
+	if l.pos < len(l.data) && l.data[l.pos] == '\n' {
+		l.pos++
+	}
+	start := l.pos
+
+	if length, ok := dict["Length"].(float64); ok && length >= 0 && start+int(length) <= len(l.data) {
+		end := start + int(length)
+		rest := bytes.TrimLeft(l.data[end:], "\r\n \t")
+		if bytes.HasPrefix(rest, []byte("endstream")) {
+			l.pos = len(l.data) - len(rest) + len("endstream")
+			return l.data[start:end]
+		}
+	}
+
+	end := bytes.Index(l.data[start:], []byte("endstream"))
+	if end < 0 {
+		l.pos = len(l.data)
+		return l.data[start:]
+	}
+	l.pos = start + end + len("endstream")
+	data := l.data[start : start+end]
+	data = bytes.TrimSuffix(data, []byte("\n"))
+	data = bytes.TrimSuffix(data, []byte("\r"))
+	return data
+}
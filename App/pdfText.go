@@ -0,0 +1,645 @@
+// Copyright 2016 Cory Robinson. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE.txt file.
+
+// pdfText.go extracts the text of PDF documents with a text layer, as
+// written by accounting software, using the object reader of
+// pdfAttachments.go. Scanned PDFs have no text to extract.
+//
+// The content streams of each page are interpreted just enough to know
+// where every string is drawn. The strings are then sorted into lines by
+// their position; a wide gap between two strings on a line, as between the
+// columns of a table, is kept as two or more spaces. Glyph widths come
+// from the font where given and are estimated otherwise, so the spacing is
+// approximate.
+
+package main
+
+import (
+	"bytes"
+	"errors"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+)
+
+// pdfMatrix is a PDF transformation matrix [a b c d e f].
+type pdfMatrix [6]float64
+
+// pdfIdentity is the identity matrix.
+var pdfIdentity = pdfMatrix{1, 0, 0, 1, 0, 0}
+
+// multiply returns m × n.
+func (m pdfMatrix) multiply(n pdfMatrix) pdfMatrix {
+	return pdfMatrix{
+		m[0]*n[0] + m[1]*n[2],
+		m[0]*n[1] + m[1]*n[3],
+		m[2]*n[0] + m[3]*n[2],
+		m[2]*n[1] + m[3]*n[3],
+		m[4]*n[0] + m[5]*n[2] + n[4],
+		m[4]*n[1] + m[5]*n[3] + n[5],
+	}
+}
+
+// pdfFont maps the character codes of a font to text and widths.
+type pdfFont struct {
+	codeLength int               // bytes per character code
+	toUnicode  map[uint32]string // from the ToUnicode CMap
+	encoding   [256]rune         // for simple fonts without ToUnicode
+	widths     map[uint32]float64
+	width      float64 // default width, in thousandths of the font size
+}
+
+// pdfTextRun is a string drawn on a page.
+type pdfTextRun struct {
+	x, y, end float64
+	size      float64
+	text      string
+}
+
+// pdfPage is a page of a document with the resources it inherits.
+type pdfPage struct {
+	dict      pdfDict
+	resources pdfDict
+}
+
+// pdfMaxFormDepth limits the nesting of form XObjects.
+const pdfMaxFormDepth = 8
+
+// ExtractPDFText returns the text of each page of a PDF document.
+func ExtractPDFText(data []byte) ([]string, error) {
+	if !bytes.HasPrefix(bytes.TrimLeft(data, "\x00\t\n\r "), []byte("%PDF-")) {
+		return nil, errors.New("not a PDF document")
+	}
+
+	objects, err := readPDFObjects(data)
+	if err != nil {
+		return nil, err
+	}
+
+	pages := pdfPages(objects)
+	if len(pages) == 0 {
+		return nil, errors.New("no pages found in PDF document")
+	}
+
+	texts := make([]string, len(pages))
+	for i, page := range pages {
+		e := &pdfTextExtractor{objects: objects, fonts: map[pdfRef]*pdfFont{}}
+		content := e.pageContent(page.dict)
+		e.run(content, page.resources, pdfIdentity, 0)
+		texts[i] = layoutPDFText(e.runs)
+	}
+
+	return texts, nil
+}
+
+// pdfPages returns the pages of the document in order, following the page
+// tree from the catalog. If there is no usable page tree, the page
+// objects are returned in the order of their object numbers.
+func pdfPages(objects map[pdfRef]interface{}) []pdfPage {
+	var pages []pdfPage
+	seen := map[pdfRef]bool{}
+
+	var walk func(node interface{}, resources pdfDict)
+	walk = func(node interface{}, resources pdfDict) {
+		if ref, ok := node.(pdfRef); ok {
+			if seen[ref] {
+				return
+			}
+			seen[ref] = true
+		}
+		dict, ok := resolvePDF(objects, node).(pdfDict)
+		if !ok {
+			return
+		}
+		if r, ok := resolvePDF(objects, dict["Resources"]).(pdfDict); ok {
+			resources = r
+		}
+		if dict["Type"] == pdfName("Page") {
+			pages = append(pages, pdfPage{dict, resources})
+			return
+		}
+		kids, _ := resolvePDF(objects, dict["Kids"]).(pdfArray)
+		for _, kid := range kids {
+			walk(kid, resources)
+		}
+	}
+
+	for _, object := range objects {
+		if catalog, ok := object.(pdfDict); ok && catalog["Type"] == pdfName("Catalog") {
+			walk(catalog["Pages"], nil)
+			break
+		}
+	}
+	if len(pages) > 0 {
+		return pages
+	}
+
+	var refs []pdfRef
+	for ref, object := range objects {
+		if dict, ok := object.(pdfDict); ok && dict["Type"] == pdfName("Page") {
+			refs = append(refs, ref)
+		}
+	}
+	sort.Slice(refs, func(i, j int) bool { return refs[i].num < refs[j].num })
+	for _, ref := range refs {
+		dict := objects[ref].(pdfDict)
+		resources, _ := resolvePDF(objects, dict["Resources"]).(pdfDict)
+		pages = append(pages, pdfPage{dict, resources})
+	}
+	return pages
+}
+
+// pdfTextExtractor collects the strings drawn by content streams.
+type pdfTextExtractor struct {
+	objects map[pdfRef]interface{}
+	fonts   map[pdfRef]*pdfFont
+	runs    []pdfTextRun
+}
+
+// pageContent returns the decoded content streams of a page.
+func (e *pdfTextExtractor) pageContent(page pdfDict) []byte {
+	var refs []interface{}
+	switch contents := resolvePDF(e.objects, page["Contents"]).(type) {
+	case pdfArray:
+		refs = contents
+	case pdfStream:
+		refs = []interface{}{contents}
+	}
+
+	var content []byte
+	for _, ref := range refs {
+		stream, ok := resolvePDF(e.objects, ref).(pdfStream)
+		if !ok {
+			continue
+		}
+		data, err := decodePDFStream(stream)
+		if err != nil {
+			continue
+		}
+		content = append(content, data...)
+		content = append(content, '\n')
+	}
+	return content
+}
+
+// run interprets a content stream drawn with the ctm and collects its
+// strings.
+func (e *pdfTextExtractor) run(content []byte, resources pdfDict, ctm pdfMatrix, depth int) {
+	fonts, _ := resolvePDF(e.objects, resources["Font"]).(pdfDict)
+	xobjects, _ := resolvePDF(e.objects, resources["XObject"]).(pdfDict)
+
+	var (
+		stack    []pdfMatrix
+		tm, tlm  = pdfIdentity, pdfIdentity
+		font     = e.font(nil)
+		size     float64
+		leading  float64
+		operands []interface{}
+	)
+
+	number := func(i int) float64 {
+		if i < len(operands) {
+			v, _ := operands[i].(float64)
+			return v
+		}
+		return 0
+	}
+	moveLine := func(tx, ty float64) {
+		tlm = pdfMatrix{1, 0, 0, 1, tx, ty}.multiply(tlm)
+		tm = tlm
+	}
+	show := func(items pdfArray) {
+		m := tm.multiply(ctm)
+		scale := math.Hypot(m[2], m[3])
+		run := pdfTextRun{x: m[4], y: m[5], size: size * scale}
+
+		var text strings.Builder
+		advance := 0.0
+		for _, item := range items {
+			switch v := item.(type) {
+			case []byte:
+				s, width := font.decode(v)
+				text.WriteString(s)
+				advance += width / 1000 * size
+			case float64:
+				advance -= v / 1000 * size
+				if v < -250 {
+					text.WriteByte(' ')
+				}
+			}
+		}
+		tm = pdfMatrix{1, 0, 0, 1, advance, 0}.multiply(tm)
+
+		run.text = text.String()
+		run.end = tm.multiply(ctm)[4]
+		if strings.TrimSpace(run.text) != "" {
+			e.runs = append(e.runs, run)
+		}
+	}
+
+	lexer := &pdfLexer{data: content}
+	for {
+		object := lexer.object()
+		if object == nil && lexer.pos >= len(lexer.data) {
+			return
+		}
+		op, ok := object.(pdfKeyword)
+		if !ok {
+			operands = append(operands, object)
+			continue
+		}
+
+		switch op {
+		case "q":
+			stack = append(stack, ctm)
+		case "Q":
+			if len(stack) > 0 {
+				ctm = stack[len(stack)-1]
+				stack = stack[:len(stack)-1]
+			}
+		case "cm":
+			ctm = pdfMatrix{number(0), number(1), number(2), number(3), number(4), number(5)}.multiply(ctm)
+		case "BT":
+			tm, tlm = pdfIdentity, pdfIdentity
+		case "Tf":
+			if len(operands) >= 2 {
+				name, _ := operands[0].(pdfName)
+				font = e.font(fonts[name])
+				size = number(1)
+			}
+		case "TL":
+			leading = number(0)
+		case "Td":
+			moveLine(number(0), number(1))
+		case "TD":
+			leading = -number(1)
+			moveLine(number(0), number(1))
+		case "Tm":
+			tlm = pdfMatrix{number(0), number(1), number(2), number(3), number(4), number(5)}
+			tm = tlm
+		case "T*":
+			moveLine(0, -leading)
+		case "Tj":
+			show(operands)
+		case "'":
+			moveLine(0, -leading)
+			show(operands)
+		case "\"":
+			moveLine(0, -leading)
+			if len(operands) == 3 {
+				show(operands[2:])
+			}
+		case "TJ":
+			if len(operands) > 0 {
+				items, _ := operands[0].(pdfArray)
+				show(items)
+			}
+		case "Do":
+			if len(operands) > 0 && depth < pdfMaxFormDepth {
+				name, _ := operands[0].(pdfName)
+				e.form(xobjects[name], resources, ctm, depth)
+			}
+		case "BI":
+			lexer.skipInlineImage()
+		}
+		operands = operands[:0]
+	}
+}
+
+// form runs the content of a form XObject.
+func (e *pdfTextExtractor) form(ref interface{}, resources pdfDict, ctm pdfMatrix, depth int) {
+	stream, ok := resolvePDF(e.objects, ref).(pdfStream)
+	if !ok || stream.dict["Subtype"] != pdfName("Form") {
+		return
+	}
+	content, err := decodePDFStream(stream)
+	if err != nil {
+		return
+	}
+	if r, ok := resolvePDF(e.objects, stream.dict["Resources"]).(pdfDict); ok {
+		resources = r
+	}
+	if matrix, ok := resolvePDF(e.objects, stream.dict["Matrix"]).(pdfArray); ok && len(matrix) == 6 {
+		var m pdfMatrix
+		for i := range m {
+			m[i], _ = matrix[i].(float64)
+		}
+		ctm = m.multiply(ctm)
+	}
+	e.run(content, resources, ctm, depth+1)
+}
+
+// skipInlineImage moves past the data of an inline image, after its "BI".
+func (l *pdfLexer) skipInlineImage() {
+	for {
+		object := l.object()
+		if object == pdfKeyword("ID") || object == nil && l.pos >= len(l.data) {
+			break
+		}
+	}
+	for l.pos < len(l.data) {
+		i := bytes.Index(l.data[l.pos:], []byte("EI"))
+		if i < 0 {
+			l.pos = len(l.data)
+			return
+		}
+		end := l.pos + i
+		l.pos = end + 2
+		if end > 0 && isPDFSpace(l.data[end-1]) && (l.pos >= len(l.data) || isPDFDelimiter(l.data[l.pos])) {
+			return
+		}
+	}
+}
+
+// font returns the font described by a font dictionary, reading it once.
+func (e *pdfTextExtractor) font(object interface{}) *pdfFont {
+	ref, isRef := object.(pdfRef)
+	if isRef && e.fonts[ref] != nil {
+		return e.fonts[ref]
+	}
+
+	font := &pdfFont{codeLength: 1, width: 500, widths: map[uint32]float64{}}
+	for c := range font.encoding {
+		font.encoding[c] = rune(c)
+	}
+	for c, r := range winAnsiHigh {
+		font.encoding[c] = r
+	}
+
+	dict, _ := resolvePDF(e.objects, object).(pdfDict)
+	if dict != nil {
+		if dict["Subtype"] == pdfName("Type0") {
+			font.codeLength = 2
+			e.readCIDWidths(font, dict)
+		} else {
+			e.readSimpleFont(font, dict)
+		}
+		if stream, ok := resolvePDF(e.objects, dict["ToUnicode"]).(pdfStream); ok {
+			if cmap, err := decodePDFStream(stream); err == nil {
+				font.readToUnicode(cmap)
+			}
+		}
+	}
+
+	if isRef {
+		e.fonts[ref] = font
+	}
+	return font
+}
+
+// readSimpleFont reads the encoding and widths of a single byte font.
+func (e *pdfTextExtractor) readSimpleFont(font *pdfFont, dict pdfDict) {
+	var differences pdfArray
+	switch encoding := resolvePDF(e.objects, dict["Encoding"]).(type) {
+	case pdfDict:
+		differences, _ = resolvePDF(e.objects, encoding["Differences"]).(pdfArray)
+	}
+	code := 0
+	for _, item := range differences {
+		switch v := item.(type) {
+		case float64:
+			code = int(v)
+		case pdfName:
+			if r, ok := pdfGlyphRune(string(v)); ok && code >= 0 && code < 256 {
+				font.encoding[code] = r
+			}
+			code++
+		}
+	}
+
+	first, _ := resolvePDF(e.objects, dict["FirstChar"]).(float64)
+	widths, _ := resolvePDF(e.objects, dict["Widths"]).(pdfArray)
+	for i, w := range widths {
+		if w, ok := resolvePDF(e.objects, w).(float64); ok {
+			font.widths[uint32(int(first)+i)] = w
+		}
+	}
+}
+
+// readCIDWidths reads the widths of a composite font from its descendant
+// CIDFont.
+func (e *pdfTextExtractor) readCIDWidths(font *pdfFont, dict pdfDict) {
+	descendants, _ := resolvePDF(e.objects, dict["DescendantFonts"]).(pdfArray)
+	if len(descendants) == 0 {
+		return
+	}
+	cidFont, _ := resolvePDF(e.objects, descendants[0]).(pdfDict)
+	if dw, ok := resolvePDF(e.objects, cidFont["DW"]).(float64); ok {
+		font.width = dw
+	} else {
+		font.width = 1000
+	}
+
+	// W is a sequence of "c [w1 w2 ...]" and "cfirst clast w"
+	w, _ := resolvePDF(e.objects, cidFont["W"]).(pdfArray)
+	for i := 0; i+1 < len(w); {
+		first, _ := w[i].(float64)
+		if widths, ok := resolvePDF(e.objects, w[i+1]).(pdfArray); ok {
+			for j, width := range widths {
+				if width, ok := width.(float64); ok {
+					font.widths[uint32(int(first)+j)] = width
+				}
+			}
+			i += 2
+			continue
+		}
+		if i+2 >= len(w) {
+			break
+		}
+		last, _ := w[i+1].(float64)
+		width, _ := w[i+2].(float64)
+		for c := first; c <= last && c-first < 0x10000; c++ {
+			font.widths[uint32(c)] = width
+		}
+		i += 3
+	}
+}
+
+// readToUnicode reads the bfchar and bfrange mappings of a ToUnicode CMap.
+// The code length is taken from the codespace range.
+func (font *pdfFont) readToUnicode(cmap []byte) {
+	font.toUnicode = map[uint32]string{}
+	lexer := &pdfLexer{data: cmap}
+	var operands []interface{}
+	for {
+		object := lexer.object()
+		if object == nil && lexer.pos >= len(lexer.data) {
+			return
+		}
+		keyword, ok := object.(pdfKeyword)
+		if !ok {
+			operands = append(operands, object)
+			continue
+		}
+
+		switch keyword {
+		case "endcodespacerange":
+			if len(operands) > 0 {
+				if lo, ok := operands[0].([]byte); ok && len(lo) > 0 {
+					font.codeLength = len(lo)
+				}
+			}
+		case "endbfchar":
+			for i := 0; i+1 < len(operands); i += 2 {
+				src, _ := operands[i].([]byte)
+				dst, _ := operands[i+1].([]byte)
+				font.toUnicode[pdfCode(src)] = utf16BEString(dst)
+			}
+		case "endbfrange":
+			for i := 0; i+2 < len(operands); i += 3 {
+				lo, _ := operands[i].([]byte)
+				hi, _ := operands[i+1].([]byte)
+				first, last := pdfCode(lo), pdfCode(hi)
+				if last < first || last-first > 0xffff {
+					continue
+				}
+				switch dst := operands[i+2].(type) {
+				case []byte:
+					// the last byte of the destination is incremented
+					for c := first; c <= last; c++ {
+						d := append([]byte(nil), dst...)
+						if len(d) > 0 {
+							d[len(d)-1] += byte(c - first)
+						}
+						font.toUnicode[c] = utf16BEString(d)
+					}
+				case pdfArray:
+					for j, item := range dst {
+						if d, ok := item.([]byte); ok && first+uint32(j) <= last {
+							font.toUnicode[first+uint32(j)] = utf16BEString(d)
+						}
+					}
+				}
+			}
+		}
+		operands = operands[:0]
+	}
+}
+
+// decode returns the text of a string shown in the font and its width in
+// thousandths of the font size.
+func (font *pdfFont) decode(s []byte) (string, float64) {
+	var text strings.Builder
+	width := 0.0
+	for i := 0; i+font.codeLength <= len(s); i += font.codeLength {
+		code := pdfCode(s[i : i+font.codeLength])
+		if w, ok := font.widths[code]; ok {
+			width += w
+		} else {
+			width += font.width
+		}
+
+		if t, ok := font.toUnicode[code]; ok {
+			text.WriteString(t)
+		} else if font.codeLength == 1 {
+			text.WriteRune(font.encoding[code])
+		}
+	}
+	return text.String(), width
+}
+
+// pdfCode returns the big-endian character code in b.
+func pdfCode(b []byte) uint32 {
+	var code uint32
+	for _, c := range b {
+		code = code<<8 | uint32(c)
+	}
+	return code
+}
+
+// utf16BEString decodes UTF-16BE text.
+func utf16BEString(b []byte) string {
+	units := make([]uint16, len(b)/2)
+	for i := range units {
+		units[i] = uint16(b[2*i])<<8 | uint16(b[2*i+1])
+	}
+	return string(utf16.Decode(units))
+}
+
+// winAnsiHigh are the characters of WinAnsiEncoding that differ from
+// Latin-1.
+var winAnsiHigh = map[int]rune{
+	0x80: '€', 0x82: '‚', 0x83: 'ƒ', 0x84: '„', 0x85: '…', 0x86: '†', 0x87: '‡',
+	0x88: 'ˆ', 0x89: '‰', 0x8a: 'Š', 0x8b: '‹', 0x8c: 'Œ', 0x8e: 'Ž', 0x91: '‘',
+	0x92: '’', 0x93: '“', 0x94: '”', 0x95: '•', 0x96: '–', 0x97: '—', 0x98: '˜',
+	0x99: '™', 0x9a: 'š', 0x9b: '›', 0x9c: 'œ', 0x9e: 'ž', 0x9f: 'Ÿ',
+}
+
+// pdfGlyphNames maps the glyph names used in encoding differences that
+// are not single letters or uniXXXX names.
+var pdfGlyphNames = map[string]rune{
+	"space": ' ', "exclam": '!', "quotedbl": '"', "numbersign": '#', "dollar": '$',
+	"percent": '%', "ampersand": '&', "quotesingle": '\'', "quoteright": '’',
+	"parenleft": '(', "parenright": ')', "asterisk": '*', "plus": '+', "comma": ',',
+	"hyphen": '-', "minus": '-', "period": '.', "slash": '/', "zero": '0', "one": '1',
+	"two": '2', "three": '3', "four": '4', "five": '5', "six": '6', "seven": '7',
+	"eight": '8', "nine": '9', "colon": ':', "semicolon": ';', "less": '<',
+	"equal": '=', "greater": '>', "question": '?', "at": '@', "bracketleft": '[',
+	"backslash": '\\', "bracketright": ']', "underscore": '_', "quoteleft": '‘',
+	"braceleft": '{', "bar": '|', "braceright": '}', "asciitilde": '~',
+	"bullet": '•', "endash": '–', "emdash": '—', "Euro": '€', "sterling": '£',
+	"yen": '¥', "section": '§', "degree": '°', "copyright": '©', "registered": '®',
+	"quotedblleft": '“', "quotedblright": '”', "ellipsis": '…', "fi": 'ﬁ', "fl": 'ﬂ',
+}
+
+// pdfGlyphRune returns the character of a glyph name.
+func pdfGlyphRune(name string) (rune, bool) {
+	if r, ok := pdfGlyphNames[name]; ok {
+		return r, true
+	}
+	if len(name) == 1 {
+		return rune(name[0]), true
+	}
+	if strings.HasPrefix(name, "uni") && len(name) == 7 {
+		if v, err := strconv.ParseUint(name[3:], 16, 16); err == nil {
+			return rune(v), true
+		}
+	}
+	return 0, false
+}
+
+// layoutPDFText sorts the strings of a page into lines, top to bottom and
+// left to right. Strings are joined by a space if there is a gap between
+// them, and by at least two spaces if the gap is as wide as a couple of
+// characters.
+func layoutPDFText(runs []pdfTextRun) string {
+	sort.SliceStable(runs, func(i, j int) bool { return runs[i].y > runs[j].y })
+
+	var lines [][]pdfTextRun
+	for _, run := range runs {
+		n := len(lines)
+		if n > 0 {
+			first := lines[n-1][0]
+			if math.Abs(first.y-run.y) < math.Max(math.Min(first.size, run.size)*0.5, 1) {
+				lines[n-1] = append(lines[n-1], run)
+				continue
+			}
+		}
+		lines = append(lines, []pdfTextRun{run})
+	}
+
+	var text strings.Builder
+	for _, line := range lines {
+		sort.SliceStable(line, func(i, j int) bool { return line[i].x < line[j].x })
+		for i, run := range line {
+			if i > 0 {
+				prev := line[i-1]
+				gap := run.x - prev.end
+				size := math.Max(math.Max(prev.size, run.size), 1)
+				switch {
+				case gap > size*2:
+					text.WriteString(strings.Repeat(" ", min(int(gap/size), 8)))
+				case gap > size*0.15 && !strings.HasSuffix(prev.text, " ") && !strings.HasPrefix(run.text, " "):
+					text.WriteByte(' ')
+				}
+			}
+			text.WriteString(run.text)
+		}
+		text.WriteByte('\n')
+	}
+
+	return text.String()
+}
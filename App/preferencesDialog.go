@@ -0,0 +1,157 @@
+// Copyright 2016 Cory Robinson. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE.txt file.
+
+// preferencesDialog.go implements the File > Preferences dialog and reads
+// and writes the preferences of prefs.go in the settings file.
+
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/therecipe/qt/core"
+	"github.com/therecipe/qt/widgets"
+)
+
+// readPreferences reads the preferences from the settings file, with the
+// defaults for those never set.
+func readPreferences() Preferences {
+	settings := core.NewQSettings("airpaio", "InvoiceViewer", nil)
+	p := defaultPreferences()
+	p.Currency = settings.Value("preferences/currency", core.NewQVariant14(p.Currency)).ToString()
+	p.DateFormat = settings.Value("preferences/dateFormat", core.NewQVariant14(p.DateFormat)).ToString()
+	if checked, err := p.check(); err == nil {
+		return checked
+	}
+	return defaultPreferences()
+}
+
+// storePreferences writes the preferences to the settings file.
+func storePreferences(p Preferences) {
+	settings := core.NewQSettings("airpaio", "InvoiceViewer", nil)
+	settings.SetValue("preferences/currency", core.NewQVariant14(p.Currency))
+	settings.SetValue("preferences/dateFormat", core.NewQVariant14(p.DateFormat))
+}
+
+// importConnectionPreferences moves the server and database set in the
+// Preferences dialog of earlier versions into the default profile, unless
+// there are profiles already.
+func importConnectionPreferences() {
+	settings := core.NewQSettings("airpaio", "InvoiceViewer", nil)
+	server := settings.Value("connection/server", core.NewQVariant14("")).ToString()
+	database := settings.Value("connection/database", core.NewQVariant14("")).ToString()
+	if server == "" && database == "" {
+		return
+	}
+	if name, err := profilesPath(); err != nil {
+		return
+	} else if _, err := os.Stat(name); err == nil {
+		return
+	}
+
+	p := defaultProfile()
+	if server != "" {
+		p.URI = server
+	}
+	if database != "" {
+		p.Database = database
+	}
+	ps, err := Profiles{}.save("", p)
+	if err == nil {
+		err = writeProfiles(ps)
+	}
+	if err != nil {
+		fmt.Println("Failed to import the connection preferences:", err)
+		return
+	}
+	settings.Remove("connection/server")
+	settings.Remove("connection/database")
+}
+
+type PreferencesDialog struct {
+	widgets.QDialog
+
+	currencyEditor   *widgets.QLineEdit
+	dateFormatView   *widgets.QComboBox
+	okButton         *widgets.QPushButton
+	cancelButton     *widgets.QPushButton
+	prefs            Preferences
+	resetWindowState bool
+}
+
+// initWith() initializes the dialog layout with the preferences in effect.
+func (d *PreferencesDialog) initWith(parent *widgets.QWidget, p Preferences) {
+	d.prefs = p
+
+	invoicesBox := widgets.NewQGroupBox2("INVOICES:", nil)
+	d.currencyEditor = widgets.NewQLineEdit2(p.Currency, nil)
+	d.currencyEditor.SetMaxLength(3)
+	d.currencyEditor.SetPlaceholderText("USD")
+	d.dateFormatView = widgets.NewQComboBox(nil)
+	for _, f := range dateFormats {
+		d.dateFormatView.AddItem(f.name, core.NewQVariant())
+	}
+	d.dateFormatView.SetCurrentText(p.DateFormat)
+
+	invoicesLayout := widgets.NewQFormLayout(nil)
+	invoicesLayout.AddRow3("Currency of new invoices:", d.currencyEditor)
+	invoicesLayout.AddRow3("Show dates as:", d.dateFormatView)
+	invoicesBox.SetLayout(invoicesLayout)
+
+	windowBox := widgets.NewQGroupBox2("WINDOW:", nil)
+	resetButton := widgets.NewQPushButton2("Reset &Window Layout", nil)
+	resetButton.SetToolTip("Forget the window size, pane sizes and column widths")
+	resetButton.ConnectClicked(func(bool) {
+		d.resetWindowState = true
+		resetButton.SetEnabled(false)
+	})
+	windowLayout := widgets.NewQVBoxLayout()
+	windowLayout.AddWidget(resetButton, 0, 0)
+	windowBox.SetLayout(windowLayout)
+
+	buttonBox := widgets.NewQDialogButtonBox(nil)
+	d.okButton = widgets.NewQPushButton2("&OK", nil)
+	d.cancelButton = widgets.NewQPushButton2("&Cancel", nil)
+	d.okButton.SetDefault(true)
+	d.okButton.ConnectClicked(func(bool) { d.accept() })
+	d.cancelButton.ConnectClicked(func(bool) { d.Reject() })
+	buttonBox.AddButton(d.okButton, widgets.QDialogButtonBox__AcceptRole)
+	buttonBox.AddButton(d.cancelButton, widgets.QDialogButtonBox__RejectRole)
+
+	layout := widgets.NewQVBoxLayout()
+	layout.AddWidget(invoicesBox, 0, 0)
+	layout.AddWidget(windowBox, 0, 0)
+	layout.AddWidget(buttonBox, 0, 0)
+	d.SetLayout(layout)
+
+	d.SetWindowTitle("Preferences")
+}
+
+// accept() closes the dialog if the preferences entered are valid, and
+// says what is wrong otherwise.
+func (d *PreferencesDialog) accept() {
+	p := Preferences{
+		Currency:   d.currencyEditor.Text(),
+		DateFormat: d.dateFormatView.CurrentText(),
+	}
+	checked, err := p.check()
+	if err != nil {
+		widgets.QMessageBox_Warning(d, "Preferences", err.Error(),
+			widgets.QMessageBox__Ok, widgets.QMessageBox__Ok)
+		return
+	}
+	d.prefs = checked
+	d.Accept()
+}
+
+// preferences() returns the preferences entered.
+func (d *PreferencesDialog) preferences() Preferences {
+	return d.prefs
+}
+
+// resetLayout() reports whether the user asked to forget the window layout.
+func (d *PreferencesDialog) resetLayout() bool {
+	return d.resetWindowState
+}
@@ -0,0 +1,156 @@
+// Copyright 2016 Cory Robinson. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE.txt file.
+
+// prefs.go holds the preferences of the app, set in the Preferences dialog
+// and kept in the settings file along with the state of the main window,
+// see preferencesDialog.go. Values are stored as strings, like the rest of
+// the settings of the app.
+
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Preferences are the settings the user picks in the Preferences dialog.
+// The DB connected to is picked from the connection profiles, see
+// profiles.go.
+type Preferences struct {
+	Currency   string // of new invoices, an ISO 4217 code
+	DateFormat string // of the dates shown, one of dateFormats
+}
+
+// dateFormats are the date formats the dates can be shown in, by name and
+// time layout. Dates are stored as MM/DD/YYYY whatever the format.
+var dateFormats = []struct {
+	name   string
+	layout string
+}{
+	{"MM/DD/YYYY", "01/02/2006"},
+	{"DD/MM/YYYY", "02/01/2006"},
+	{"DD.MM.YYYY", "02.01.2006"},
+	{"YYYY-MM-DD", "2006-01-02"},
+}
+
+// defaultPreferences returns the preferences of a new install.
+func defaultPreferences() Preferences {
+	return Preferences{
+		Currency:   "USD",
+		DateFormat: dateFormats[0].name,
+	}
+}
+
+// check returns the preferences cleaned up, or an error naming the first
+// preference which is not valid.
+func (p Preferences) check() (Preferences, error) {
+	p.Currency = strings.ToUpper(strings.TrimSpace(p.Currency))
+
+	if len(p.Currency) != 3 || strings.Trim(p.Currency, "ABCDEFGHIJKLMNOPQRSTUVWXYZ") != "" {
+		return p, fmt.Errorf("the currency must be a three letter code, i.e. USD")
+	}
+	if dateLayout(p.DateFormat) == "" {
+		return p, fmt.Errorf("unknown date format %q", p.DateFormat)
+	}
+	return p, nil
+}
+
+// dateLayout returns the time layout of a date format, or "" if the format
+// is not known.
+func dateLayout(format string) string {
+	for _, f := range dateFormats {
+		if f.name == format {
+			return f.layout
+		}
+	}
+	return ""
+}
+
+// The preferences in effect, see applyPreferences.
+var (
+	shownDateLayout = dateFormats[0].layout
+	newCurrency     = "USD"
+)
+
+// applyPreferences puts preferences into effect.
+func applyPreferences(p Preferences) {
+	if layout := dateLayout(p.DateFormat); layout != "" {
+		shownDateLayout = layout
+	}
+	if p.Currency != "" {
+		newCurrency = p.Currency
+	}
+}
+
+// displayDate returns a date of the DB in the date format of the
+// preferences. Dates which cannot be read are returned as they are.
+func displayDate(date string) string {
+	if shownDateLayout == "01/02/2006" || date == "" {
+		return date
+	}
+	normalized, err := normalizeDate(date)
+	if err != nil {
+		return date
+	}
+	t, _ := time.Parse("01/02/2006", normalized)
+	return t.Format(shownDateLayout)
+}
+
+// formatInts returns numbers, i.e. the sizes of the panes of a splitter,
+// as a comma separated list for the settings.
+func formatInts(numbers []int) string {
+	s := make([]string, len(numbers))
+	for i, n := range numbers {
+		s[i] = strconv.Itoa(n)
+	}
+	return strings.Join(s, ",")
+}
+
+// parseInts returns the numbers of a list written by formatInts, or nil if
+// it cannot be read.
+func parseInts(s string) []int {
+	if s == "" {
+		return nil
+	}
+	var numbers []int
+	for _, f := range strings.Split(s, ",") {
+		n, err := strconv.Atoi(strings.TrimSpace(f))
+		if err != nil {
+			return nil
+		}
+		numbers = append(numbers, n)
+	}
+	return numbers
+}
+
+// formatColumnWidths returns the widths of the columns of a table by
+// column key, as key=width pairs for the settings.
+func formatColumnWidths(widths map[string]int) string {
+	keys := make([]string, 0, len(widths))
+	for key := range widths {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	pairs := make([]string, len(keys))
+	for i, key := range keys {
+		pairs[i] = key + "=" + strconv.Itoa(widths[key])
+	}
+	return strings.Join(pairs, ",")
+}
+
+// parseColumnWidths returns the widths written by formatColumnWidths.
+// Pairs which cannot be read are dropped.
+func parseColumnWidths(s string) map[string]int {
+	widths := map[string]int{}
+	for _, pair := range strings.Split(s, ",") {
+		key, width, ok := strings.Cut(pair, "=")
+		if n, err := strconv.Atoi(width); ok && err == nil && n > 0 && key != "" {
+			widths[key] = n
+		}
+	}
+	return widths
+}
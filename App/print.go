@@ -0,0 +1,250 @@
+// Copyright 2016 Cory Robinson. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE.txt file.
+
+// print.go implements printing and print preview from the main window.
+// Either the selected invoice or the current invoice list table can be
+// printed. The content is laid out as HTML in a QTextDocument, which is
+// then painted page by page so every page gets a header and a footer with
+// the page number.
+
+package main
+
+import (
+	"fmt"
+	"html"
+	"strings"
+	"time"
+
+	"github.com/therecipe/qt/core"
+	"github.com/therecipe/qt/gui"
+	"github.com/therecipe/qt/printsupport"
+	"github.com/therecipe/qt/widgets"
+)
+
+// printJob is a document ready to be printed.
+type printJob struct {
+	title string // shown in the page header
+	html  string
+}
+
+// getPrinter() returns the printer shared by all print actions, so the
+// page setup is kept between prints.
+func (w *MainWindow) getPrinter() *printsupport.QPrinter {
+	if w.printer == nil {
+		w.printer = printsupport.NewQPrinter(printsupport.QPrinter__HighResolution)
+		w.printer.SetPageMargins(15, 15, 15, 15, printsupport.QPrinter__Millimeter)
+	}
+	return w.printer
+}
+
+// pageSetup() slot to open the page setup dialog.
+func (w *MainWindow) pageSetup() {
+	dialog := printsupport.NewQPageSetupDialog(w.getPrinter(), w)
+	dialog.Exec()
+}
+
+// printInvoice() slot to print the selected invoice.
+func (w *MainWindow) printInvoice() {
+	w.loadInvoicePrintJob(w.print)
+}
+
+// printInvoicePreview() slot to preview the selected invoice.
+func (w *MainWindow) printInvoicePreview() {
+	w.loadInvoicePrintJob(w.printPreview)
+}
+
+// printList() slot to print the invoice list table.
+func (w *MainWindow) printList() {
+	w.print(w.listPrintJob())
+}
+
+// printListPreview() slot to preview the invoice list table.
+func (w *MainWindow) printListPreview() {
+	w.printPreview(w.listPrintJob())
+}
+
+// print() shows the print dialog and prints the job.
+func (w *MainWindow) print(job printJob) {
+	printer := w.getPrinter()
+	dialog := printsupport.NewQPrintDialog(printer, w)
+	dialog.SetWindowTitle("Print " + job.title)
+	if dialog.Exec() != int(widgets.QDialog__Accepted) {
+		return
+	}
+	paintPrintJob(printer, job)
+}
+
+// printPreview() shows the print preview dialog for the job.
+func (w *MainWindow) printPreview(job printJob) {
+	dialog := printsupport.NewQPrintPreviewDialog(w.getPrinter(), w, 0)
+	dialog.SetWindowTitle("Print Preview - " + job.title)
+	dialog.ConnectPaintRequested(func(printer *printsupport.QPrinter) {
+		paintPrintJob(printer, job)
+	})
+	dialog.Resize2(800, 900)
+	dialog.Exec()
+}
+
+// loadInvoicePrintJob() builds the print job for the selected invoice,
+// read in the background, and calls done with it. If no invoice is
+// selected, it tells the user.
+func (w *MainWindow) loadInvoicePrintJob(done func(job printJob)) {
+	selected := w.loadSelectedInvoice(func(invoice Invoice) {
+		title := fmt.Sprintf("Invoice %v - %v", invoice.InvoiceNo, invoice.Vendor)
+		done(printJob{title, invoiceHTML(invoice)})
+	})
+	if !selected {
+		widgets.QMessageBox_Information(w, "Print", "Select an invoice to print first.",
+			widgets.QMessageBox__Ok, widgets.QMessageBox__Ok)
+	}
+}
+
+// listPrintJob() builds the print job for the invoice list table, taking
+// the rows and headers from the table model as they are displayed, after
+// fetching the rows not shown yet.
+func (w *MainWindow) listPrintJob() printJob {
+	w.invoicesModel.fetchAll()
+	model := w.invoicesTableView.Model()
+	root := core.NewQModelIndex()
+	display := int(core.Qt__DisplayRole)
+
+	columns := model.ColumnCount(root)
+	header := make([]string, columns)
+	for c := 0; c < columns; c++ {
+		header[c] = model.HeaderData(c, core.Qt__Horizontal, display).ToString()
+	}
+
+	rows := make([][]string, model.RowCount(root))
+	for r := range rows {
+		rows[r] = make([]string, columns)
+		for c := 0; c < columns; c++ {
+			rows[r][c] = model.Index(r, c, root).Data(display).ToString()
+		}
+	}
+
+	title := "Invoices - " + w.vendorView.CurrentText()
+	return printJob{title, tableHTML(title, header, rows)}
+}
+
+// paintPrintJob() lays out the job's HTML on the printer's pages and paints
+// each page with a header and a footer.
+func paintPrintJob(printer *printsupport.QPrinter, job printJob) {
+	rect := printer.PageLayout().PaintRectPixels(printer.Resolution())
+	width := float64(rect.Width())
+	height := float64(rect.Height())
+	band := float64(printer.Resolution()) * 0.4 // header/footer height, 0.4 inch
+
+	doc := gui.NewQTextDocument(nil)
+	doc.DocumentLayout().SetPaintDevice(printer)
+	doc.SetHtml(job.html)
+	doc.SetPageSize(core.NewQSizeF3(width, height-2*band))
+
+	painter := gui.NewQPainter2(printer)
+	defer painter.End()
+
+	font := gui.NewQFont2("Helvetica", 8, -1, false)
+	printed := time.Now().Format("01/02/2006 3:04 PM")
+	pages := doc.PageCount()
+	left := int(core.Qt__AlignLeft | core.Qt__AlignVCenter)
+	right := int(core.Qt__AlignRight | core.Qt__AlignVCenter)
+
+	for page := 0; page < pages; page++ {
+		if page > 0 {
+			printer.NewPage()
+		}
+
+		painter.SetFont(font)
+		painter.DrawText3(core.NewQRectF4(0, 0, width, band), left, "Invoice Viewer", nil)
+		painter.DrawText3(core.NewQRectF4(0, 0, width, band), right, job.title, nil)
+		painter.DrawLine3(0, int(band*0.9), int(width), int(band*0.9))
+
+		footer := height - band
+		painter.DrawLine3(0, int(footer+band*0.1), int(width), int(footer+band*0.1))
+		painter.DrawText3(core.NewQRectF4(0, footer, width, band), left, "Printed "+printed, nil)
+		painter.DrawText3(core.NewQRectF4(0, footer, width, band), right,
+			fmt.Sprintf("Page %d of %d", page+1, pages), nil)
+
+		// shift the document so the current page lands between header and footer
+		offset := float64(page) * (height - 2*band)
+		painter.Save()
+		painter.Translate3(0, band-offset)
+		doc.DrawContents(painter, core.NewQRectF4(0, offset, width, height-2*band))
+		painter.Restore()
+	}
+}
+
+// invoiceHTML returns the printable HTML for one invoice.
+func invoiceHTML(invoice Invoice) string {
+	var b strings.Builder
+	esc := html.EscapeString
+	address := invoice.Address
+
+	fmt.Fprintf(&b, "<h2>Invoice %v</h2>", esc(invoice.InvoiceNo))
+	b.WriteString(`<table width="100%"><tr><td valign="top">`)
+	fmt.Fprintf(&b, "<b>%v</b><br>%v<br>%v, %v %v", esc(invoice.Vendor), esc(address.Street),
+		esc(address.City), esc(address.State), esc(address.Zipcode))
+	b.WriteString(`</td><td valign="top" align="right"><table>`)
+	for _, detail := range [][2]string{
+		{"Date", invoice.Date},
+		{"Purchase Order", invoice.PurchaseOrder},
+		{"Currency", invoice.Currency},
+		{"Status", paidString(invoice.Paid)},
+	} {
+		fmt.Fprintf(&b, "<tr><td><b>%v:</b></td><td>%v</td></tr>", detail[0], esc(detail[1]))
+	}
+	b.WriteString("</table></td></tr></table><br>")
+
+	rows := make([][]string, len(invoice.LineItems))
+	for i, item := range invoice.LineItems {
+		rows[i] = []string{item.ProductID, item.Description, fmt.Sprint(item.Quantity),
+			formatCents(item.Amount), formatCents(int64(item.Quantity) * item.Amount)}
+	}
+	b.WriteString(tableHTML("", []string{"Product ID", "Description", "Quantity", "Unit Price", "Amount"}, rows))
+
+	subtotal := lineItemsTotal(invoice.LineItems)
+	b.WriteString(`<br><table align="right">`)
+	fmt.Fprintf(&b, "<tr><td>Subtotal:</td><td align=\"right\">%v</td></tr>", formatCents(subtotal))
+	if tax := invoice.Total - subtotal; tax != 0 && len(invoice.LineItems) > 0 {
+		fmt.Fprintf(&b, "<tr><td>Tax:</td><td align=\"right\">%v</td></tr>", formatCents(tax))
+	}
+	fmt.Fprintf(&b, "<tr><td><b>Total:</b></td><td align=\"right\"><b>%v</b></td></tr>", formatCents(invoice.Total))
+	b.WriteString("</table>")
+
+	return b.String()
+}
+
+// tableHTML returns an HTML table with a header row. Money cells are right
+// aligned.
+func tableHTML(title string, header []string, rows [][]string) string {
+	var b strings.Builder
+
+	if title != "" {
+		fmt.Fprintf(&b, "<h3>%v</h3>", html.EscapeString(title))
+	}
+	b.WriteString(`<table width="100%" cellspacing="0" cellpadding="3" border="0">`)
+	b.WriteString(`<tr bgcolor="#dddddd">`)
+	for _, h := range header {
+		fmt.Fprintf(&b, "<th align=\"left\">%v</th>", html.EscapeString(h))
+	}
+	b.WriteString("</tr>")
+
+	for i, row := range rows {
+		if i%2 == 1 {
+			b.WriteString(`<tr bgcolor="#f4f4f4">`)
+		} else {
+			b.WriteString("<tr>")
+		}
+		for _, cell := range row {
+			align := "left"
+			if strings.Contains(cell, "$") {
+				align = "right"
+			}
+			fmt.Fprintf(&b, "<td align=\"%v\">%v</td>", align, html.EscapeString(cell))
+		}
+		b.WriteString("</tr>")
+	}
+	b.WriteString("</table>")
+
+	return b.String()
+}
@@ -0,0 +1,362 @@
+// Copyright 2016 Cory Robinson. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE.txt file.
+
+// profiles.go implements the connection profiles of the app: named
+// databases, i.e. demo, staging and production, one of which is active.
+// The profiles are kept in profiles.json in the config directory of the
+// app, so that the GUI (see profilesDialog.go) and the command line (see
+// the profile command) share them. Passwords are not kept in the file but
+// looked up from the credentials reference of a profile.
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// PROFILES is the name of the file of the connection profiles.
+const PROFILES = "profiles.json"
+
+// defaultProfileName is the name of the profile used until others are set up.
+const defaultProfileName = "default"
+
+// backends are the kinds of DB servers a profile can connect to.
+var backends = []string{"mongodb"}
+
+// ConnectionProfile is a named connection to an invoices collection.
+type ConnectionProfile struct {
+	Name        string `json:"name"`
+	Backend     string `json:"backend"`
+	URI         string `json:"uri"` // without the password
+	Database    string `json:"database"`
+	Collection  string `json:"collection"`
+	Credentials string `json:"credentials,omitempty"` // env:VARIABLE or file:path, see password
+}
+
+// Profiles are the connection profiles and the name of the active one.
+type Profiles struct {
+	Active   string              `json:"active"`
+	Profiles []ConnectionProfile `json:"profiles"`
+}
+
+// defaultProfile returns the profile of a new install.
+func defaultProfile() ConnectionProfile {
+	return ConnectionProfile{
+		Name:       defaultProfileName,
+		Backend:    backends[0],
+		URI:        defaultServer,
+		Database:   defaultDatabase,
+		Collection: defaultCollection,
+	}
+}
+
+// check returns the profile cleaned up, or an error naming the first field
+// which is not valid.
+func (p ConnectionProfile) check() (ConnectionProfile, error) {
+	p.Name = strings.TrimSpace(p.Name)
+	p.Backend = strings.ToLower(strings.TrimSpace(p.Backend))
+	p.URI = strings.TrimSpace(p.URI)
+	p.Database = strings.TrimSpace(p.Database)
+	p.Collection = strings.TrimSpace(p.Collection)
+	p.Credentials = strings.TrimSpace(p.Credentials)
+	if p.Backend == "" {
+		p.Backend = backends[0]
+	}
+
+	if p.Name == "" {
+		return p, errors.New("the profile has no name")
+	}
+	if !containsString(backends, p.Backend) {
+		return p, fmt.Errorf("profile %s: unknown backend %q, use one of %s", p.Name, p.Backend, strings.Join(backends, ", "))
+	}
+	u, err := url.Parse(p.URI)
+	if err != nil || u.Scheme != "mongodb" || u.Host == "" {
+		return p, fmt.Errorf("profile %s: the URI must be a MongoDB URL, i.e. mongodb://localhost:27017", p.Name)
+	}
+	if _, ok := u.User.Password(); ok {
+		return p, fmt.Errorf("profile %s: put the password in the credentials, not the URI", p.Name)
+	}
+	if p.Database == "" || strings.ContainsAny(p.Database, ` /\."$`) {
+		return p, fmt.Errorf("profile %s: the database name must not be empty or contain spaces or any of /\\.\"$", p.Name)
+	}
+	if p.Collection == "" || strings.Contains(p.Collection, "$") || strings.HasPrefix(p.Collection, "system.") {
+		return p, fmt.Errorf("profile %s: the collection name must not be empty, contain $ or start with system.", p.Name)
+	}
+	if p.Credentials != "" && !strings.HasPrefix(p.Credentials, "env:") && !strings.HasPrefix(p.Credentials, "file:") {
+		return p, fmt.Errorf("profile %s: the credentials must be env:VARIABLE or file:path", p.Name)
+	}
+	return p, nil
+}
+
+// password returns the password the credentials reference of the profile
+// points to: the value of an environment variable, or the first line of a
+// file. A value of the form user:password names the user too.
+func (p ConnectionProfile) password() (user, password string, err error) {
+	var value string
+	switch {
+	case p.Credentials == "":
+		return "", "", nil
+	case strings.HasPrefix(p.Credentials, "env:"):
+		name := strings.TrimPrefix(p.Credentials, "env:")
+		var ok bool
+		if value, ok = os.LookupEnv(name); !ok {
+			return "", "", fmt.Errorf("profile %s: the environment variable %s is not set", p.Name, name)
+		}
+	case strings.HasPrefix(p.Credentials, "file:"):
+		data, err := os.ReadFile(strings.TrimPrefix(p.Credentials, "file:"))
+		if err != nil {
+			return "", "", fmt.Errorf("profile %s: %v", p.Name, err)
+		}
+		value, _, _ = strings.Cut(string(data), "\n")
+	default:
+		return "", "", fmt.Errorf("profile %s: unknown credentials %q", p.Name, p.Credentials)
+	}
+
+	value = strings.TrimRight(value, "\r")
+	if u, pw, ok := strings.Cut(value, ":"); ok && !strings.Contains(p.URI, "@") {
+		return u, pw, nil
+	}
+	return "", value, nil
+}
+
+// dialURL returns the URL to dial the server of the profile with, with the
+// password of its credentials.
+func (p ConnectionProfile) dialURL() (string, error) {
+	user, password, err := p.password()
+	if err != nil || password == "" {
+		return p.URI, err
+	}
+	u, err := url.Parse(p.URI)
+	if err != nil {
+		return "", err
+	}
+	if user == "" && u.User != nil {
+		user = u.User.Username()
+	}
+	if user == "" {
+		return "", fmt.Errorf("profile %s: the credentials name no user, put it in the URI or the credentials as user:password", p.Name)
+	}
+	u.User = url.UserPassword(user, password)
+	return u.String(), nil
+}
+
+// find returns the profile with the name, ignoring case.
+func (ps Profiles) find(name string) (ConnectionProfile, bool) {
+	for _, p := range ps.Profiles {
+		if strings.EqualFold(p.Name, name) {
+			return p, true
+		}
+	}
+	return ConnectionProfile{}, false
+}
+
+// active returns the active profile, or the first one if the active one is
+// gone.
+func (ps Profiles) active() ConnectionProfile {
+	if p, ok := ps.find(ps.Active); ok {
+		return p
+	}
+	if len(ps.Profiles) > 0 {
+		return ps.Profiles[0]
+	}
+	return defaultProfile()
+}
+
+// names returns the names of the profiles.
+func (ps Profiles) names() []string {
+	names := make([]string, len(ps.Profiles))
+	for i, p := range ps.Profiles {
+		names[i] = p.Name
+	}
+	return names
+}
+
+// save returns the profiles with p added, or replacing the profile named
+// old, sorted by name. The active profile follows a rename.
+func (ps Profiles) save(old string, p ConnectionProfile) (Profiles, error) {
+	p, err := p.check()
+	if err != nil {
+		return ps, err
+	}
+	if other, ok := ps.find(p.Name); ok && !strings.EqualFold(other.Name, old) {
+		return ps, fmt.Errorf("there is a profile named %s already", other.Name)
+	}
+
+	saved := Profiles{Active: ps.Active, Profiles: []ConnectionProfile{p}}
+	for _, q := range ps.Profiles {
+		if !strings.EqualFold(q.Name, old) && !strings.EqualFold(q.Name, p.Name) {
+			saved.Profiles = append(saved.Profiles, q)
+		}
+	}
+	sort.SliceStable(saved.Profiles, func(i, j int) bool {
+		return strings.ToLower(saved.Profiles[i].Name) < strings.ToLower(saved.Profiles[j].Name)
+	})
+	if old != "" && strings.EqualFold(ps.Active, old) || saved.Active == "" {
+		saved.Active = p.Name
+	}
+	return saved, nil
+}
+
+// remove returns the profiles without the profile with the name. The last
+// profile cannot be removed.
+func (ps Profiles) remove(name string) (Profiles, error) {
+	p, ok := ps.find(name)
+	if !ok {
+		return ps, fmt.Errorf("there is no profile named %s", name)
+	}
+	if len(ps.Profiles) == 1 {
+		return ps, errors.New("the last profile cannot be removed")
+	}
+
+	kept := Profiles{Active: ps.Active}
+	for _, q := range ps.Profiles {
+		if q.Name != p.Name {
+			kept.Profiles = append(kept.Profiles, q)
+		}
+	}
+	if strings.EqualFold(kept.Active, p.Name) {
+		kept.Active = kept.Profiles[0].Name
+	}
+	return kept, nil
+}
+
+// use returns the profiles with the profile with the name active.
+func (ps Profiles) use(name string) (Profiles, error) {
+	p, ok := ps.find(name)
+	if !ok {
+		return ps, fmt.Errorf("there is no profile named %s", name)
+	}
+	ps.Active = p.Name
+	return ps, nil
+}
+
+// profilesPath returns the path of the profiles file.
+func profilesPath() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "InvoiceViewer", PROFILES), nil
+}
+
+// readProfiles reads the profiles file. Without one there is the default
+// profile only.
+func readProfiles() (Profiles, error) {
+	ps := Profiles{Active: defaultProfileName, Profiles: []ConnectionProfile{defaultProfile()}}
+	name, err := profilesPath()
+	if err != nil {
+		return ps, err
+	}
+	data, err := os.ReadFile(name)
+	if os.IsNotExist(err) {
+		return ps, nil
+	}
+	if err != nil {
+		return ps, err
+	}
+
+	var read Profiles
+	if err := json.Unmarshal(data, &read); err != nil {
+		return ps, fmt.Errorf("%s: %v", name, err)
+	}
+	var kept []ConnectionProfile
+	for _, p := range read.Profiles {
+		p, err := p.check()
+		if err != nil {
+			fmt.Println("Failed to read profile:", err)
+			continue
+		}
+		kept = append(kept, p)
+	}
+	if len(kept) == 0 {
+		return ps, nil
+	}
+	read.Profiles = kept
+	return read, nil
+}
+
+// writeProfiles writes the profiles file.
+func writeProfiles(ps Profiles) error {
+	name, err := profilesPath()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(name), 0700); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(ps, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(name, append(data, '\n'), 0600)
+}
+
+// activeProfile is the profile the repository is connected with, see
+// useProfile. Only the GUI thread and the commands use it; the queries
+// read activeDB.
+var activeProfile = defaultProfile()
+
+// useProfile connects the repository with the profile: the queries started
+// from now on go to its collection. If its password cannot be looked up,
+// the error is returned and the server is dialed without it, so that the
+// queries fail rather than go to another DB.
+func useProfile(p ConnectionProfile) error {
+	server, err := p.dialURL()
+	if err != nil {
+		server = p.URI
+	}
+	activeProfile = p
+	activeDBMu.Lock()
+	activeDB = dbSettings{server, p.Database, p.Collection}
+	activeDBMu.Unlock()
+	return err
+}
+
+// findProfile returns the profile named, or the active profile if name is
+// "", i.e. on starting.
+func findProfile(name string) (ConnectionProfile, error) {
+	ps, err := readProfiles()
+	if err != nil {
+		return ConnectionProfile{}, err
+	}
+	if name == "" {
+		return ps.active(), nil
+	}
+	p, ok := ps.find(name)
+	if !ok {
+		return p, fmt.Errorf("there is no profile named %s", name)
+	}
+	return p, nil
+}
+
+// collectionOnce runs a function once per collection, as sync.Once does
+// once per process, so that it runs again for the collection of a profile
+// switched to.
+type collectionOnce struct {
+	mu   sync.Mutex
+	done map[string]bool
+}
+
+// Do calls f unless it was called for the collection of the DB.
+func (o *collectionOnce) Do(db dbSettings, f func()) {
+	key := db.Server + "\x00" + db.Name + "\x00" + db.Collection
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.done[key] {
+		return
+	}
+	if o.done == nil {
+		o.done = map[string]bool{}
+	}
+	o.done[key] = true
+	f()
+}
@@ -0,0 +1,371 @@
+// Copyright 2016 Cory Robinson. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE.txt file.
+
+// profilesDialog.go implements the Connection Profiles dialog, where the
+// profiles of profiles.go are added, changed and removed and the active
+// one is picked. The main window writes them and connects to the active
+// profile, see MainWindow.manageProfiles().
+
+package main
+
+import (
+	"strings"
+
+	"github.com/therecipe/qt/core"
+	"github.com/therecipe/qt/widgets"
+)
+
+type ProfilesDialog struct {
+	widgets.QDialog
+
+	profilesList      *widgets.QListWidget
+	nameEditor        *widgets.QLineEdit
+	backendView       *widgets.QComboBox
+	uriEditor         *widgets.QLineEdit
+	databaseEditor    *widgets.QLineEdit
+	collectionEditor  *widgets.QLineEdit
+	credentialsEditor *widgets.QLineEdit
+
+	newButton    *widgets.QPushButton
+	saveButton   *widgets.QPushButton
+	removeButton *widgets.QPushButton
+	activeButton *widgets.QPushButton
+	okButton     *widgets.QPushButton
+	cancelButton *widgets.QPushButton
+
+	ps      Profiles
+	editing string // name of the profile in the form, "" for a new one
+}
+
+// initWith() initializes the dialog layout with the profiles.
+func (d *ProfilesDialog) initWith(parent *widgets.QWidget, ps Profiles) {
+	d.ps = ps
+
+	d.profilesList = widgets.NewQListWidget(nil)
+	d.profilesList.ConnectCurrentTextChanged(d.showProfile)
+
+	d.nameEditor = widgets.NewQLineEdit(nil)
+	d.backendView = widgets.NewQComboBox(nil)
+	d.backendView.AddItems(backends)
+	d.uriEditor = widgets.NewQLineEdit(nil)
+	d.uriEditor.SetPlaceholderText(defaultServer)
+	d.databaseEditor = widgets.NewQLineEdit(nil)
+	d.collectionEditor = widgets.NewQLineEdit(nil)
+	d.credentialsEditor = widgets.NewQLineEdit(nil)
+	d.credentialsEditor.SetPlaceholderText("env:VARIABLE or file:path")
+	d.credentialsEditor.SetToolTip("Where the password is kept, as a password or user:password.\n" +
+		"Passwords are never written to the profiles file.")
+
+	formLayout := widgets.NewQFormLayout(nil)
+	formLayout.AddRow3("Name:", d.nameEditor)
+	formLayout.AddRow3("Backend:", d.backendView)
+	formLayout.AddRow3("URI:", d.uriEditor)
+	formLayout.AddRow3("Database:", d.databaseEditor)
+	formLayout.AddRow3("Collection:", d.collectionEditor)
+	formLayout.AddRow3("Credentials:", d.credentialsEditor)
+
+	d.newButton = widgets.NewQPushButton2("&New", nil)
+	d.saveButton = widgets.NewQPushButton2("&Save Profile", nil)
+	d.removeButton = widgets.NewQPushButton2("&Remove", nil)
+	d.activeButton = widgets.NewQPushButton2("Make &Active", nil)
+	d.newButton.ConnectClicked(func(bool) { d.newProfile() })
+	d.saveButton.ConnectClicked(func(bool) { d.saveProfile() })
+	d.removeButton.ConnectClicked(func(bool) { d.removeProfile() })
+	d.activeButton.ConnectClicked(func(bool) { d.makeActive() })
+
+	profileButtons := widgets.NewQHBoxLayout()
+	profileButtons.AddWidget(d.newButton, 0, 0)
+	profileButtons.AddWidget(d.saveButton, 0, 0)
+	profileButtons.AddWidget(d.removeButton, 0, 0)
+	profileButtons.AddStretch(1)
+	profileButtons.AddWidget(d.activeButton, 0, 0)
+
+	rightLayout := widgets.NewQVBoxLayout()
+	rightLayout.AddLayout(formLayout, 0)
+	rightLayout.AddLayout(profileButtons, 0)
+	rightLayout.AddStretch(1)
+
+	listLayout := widgets.NewQHBoxLayout()
+	listLayout.AddWidget(d.profilesList, 0, 0)
+	listLayout.AddLayout(rightLayout, 1)
+
+	buttonBox := widgets.NewQDialogButtonBox(nil)
+	d.okButton = widgets.NewQPushButton2("&OK", nil)
+	d.cancelButton = widgets.NewQPushButton2("&Cancel", nil)
+	d.okButton.SetDefault(true)
+	d.okButton.ConnectClicked(func(bool) { d.accept() })
+	d.cancelButton.ConnectClicked(func(bool) { d.Reject() })
+	buttonBox.AddButton(d.okButton, widgets.QDialogButtonBox__AcceptRole)
+	buttonBox.AddButton(d.cancelButton, widgets.QDialogButtonBox__RejectRole)
+
+	layout := widgets.NewQVBoxLayout()
+	layout.AddLayout(listLayout, 1)
+	layout.AddWidget(buttonBox, 0, 0)
+	d.SetLayout(layout)
+
+	d.fillProfiles(ps.active().Name)
+	d.SetWindowTitle("Connection Profiles")
+}
+
+// fillProfiles() lists the profiles, the active one marked, selecting the
+// profile with the name.
+func (d *ProfilesDialog) fillProfiles(selected string) {
+	active := d.ps.active().Name
+	d.profilesList.BlockSignals(true)
+	d.profilesList.Clear()
+	for _, name := range d.ps.names() {
+		d.profilesList.AddItem(name)
+		item := d.profilesList.Item(d.profilesList.Count() - 1)
+		if name == active {
+			font := item.Font()
+			font.SetBold(true)
+			item.SetFont(font)
+			item.SetToolTip("The active profile")
+		}
+		if strings.EqualFold(name, selected) {
+			d.profilesList.SetCurrentItem(item)
+		}
+	}
+	d.profilesList.BlockSignals(false)
+	d.showProfile(d.profilesList.CurrentText())
+}
+
+// showProfile() shows the profile with the name in the form.
+func (d *ProfilesDialog) showProfile(name string) {
+	p, ok := d.ps.find(name)
+	if !ok {
+		return
+	}
+	d.editing = p.Name
+	d.setForm(p)
+}
+
+// setForm() shows a profile in the form.
+func (d *ProfilesDialog) setForm(p ConnectionProfile) {
+	d.nameEditor.SetText(p.Name)
+	d.backendView.SetCurrentText(p.Backend)
+	d.uriEditor.SetText(p.URI)
+	d.databaseEditor.SetText(p.Database)
+	d.collectionEditor.SetText(p.Collection)
+	d.credentialsEditor.SetText(p.Credentials)
+}
+
+// form() returns the profile in the form.
+func (d *ProfilesDialog) form() ConnectionProfile {
+	return ConnectionProfile{
+		Name:        d.nameEditor.Text(),
+		Backend:     d.backendView.CurrentText(),
+		URI:         d.uriEditor.Text(),
+		Database:    d.databaseEditor.Text(),
+		Collection:  d.collectionEditor.Text(),
+		Credentials: d.credentialsEditor.Text(),
+	}
+}
+
+// changed() reports whether the form differs from the profile it shows.
+func (d *ProfilesDialog) changed() bool {
+	p, ok := d.ps.find(d.editing)
+	if !ok {
+		return true
+	}
+	checked, err := d.form().check()
+	return err != nil || checked != p
+}
+
+// newProfile() empties the form for a new profile, with the server and
+// collection of the default profile.
+func (d *ProfilesDialog) newProfile() {
+	p := defaultProfile()
+	p.Name = ""
+	d.editing = ""
+	d.profilesList.ClearSelection()
+	d.setForm(p)
+	d.nameEditor.SetFocus2()
+}
+
+// saveProfile() saves the profile in the form, and says what is wrong with
+// it if it is not valid.
+func (d *ProfilesDialog) saveProfile() bool {
+	ps, err := d.ps.save(d.editing, d.form())
+	if err != nil {
+		widgets.QMessageBox_Warning(d, "Connection Profiles", err.Error(),
+			widgets.QMessageBox__Ok, widgets.QMessageBox__Ok)
+		return false
+	}
+	d.ps = ps
+	p, _ := d.form().check()
+	d.fillProfiles(p.Name)
+	return true
+}
+
+// removeProfile() removes the profile selected.
+func (d *ProfilesDialog) removeProfile() {
+	name := d.profilesList.CurrentText()
+	if name == "" {
+		return
+	}
+	answer := widgets.QMessageBox_Question(d, "Remove Profile",
+		"Remove the profile "+name+"? The database is kept.",
+		widgets.QMessageBox__Yes|widgets.QMessageBox__No, widgets.QMessageBox__No)
+	if answer != widgets.QMessageBox__Yes {
+		return
+	}
+
+	ps, err := d.ps.remove(name)
+	if err != nil {
+		widgets.QMessageBox_Warning(d, "Connection Profiles", err.Error(),
+			widgets.QMessageBox__Ok, widgets.QMessageBox__Ok)
+		return
+	}
+	d.ps = ps
+	d.fillProfiles(ps.active().Name)
+}
+
+// makeActive() makes the profile selected the active one, saving the form
+// first.
+func (d *ProfilesDialog) makeActive() {
+	if d.changed() && !d.saveProfile() {
+		return
+	}
+	if ps, err := d.ps.use(d.profilesList.CurrentText()); err == nil {
+		d.ps = ps
+		d.fillProfiles(ps.Active)
+	}
+}
+
+// accept() closes the dialog, saving the form first if it was changed.
+func (d *ProfilesDialog) accept() {
+	if d.changed() && !d.saveProfile() {
+		return
+	}
+	d.Accept()
+}
+
+// profiles() returns the profiles as edited.
+func (d *ProfilesDialog) profiles() Profiles {
+	return d.ps
+}
+
+// fillProfilesMenu() lists the profiles in the Connection Profile menu, the
+// active one checked, followed by the Manage Profiles action.
+func (w *MainWindow) fillProfilesMenu() {
+	w.profilesMenu.Clear()
+	ps, err := readProfiles()
+	if err != nil {
+		w.StatusBar().ShowMessage(err.Error(), 5000)
+	}
+
+	group := widgets.NewQActionGroup(w.profilesMenu)
+	for _, p := range ps.Profiles {
+		name := p.Name
+		action := w.profilesMenu.AddAction(name)
+		action.SetCheckable(true)
+		action.SetChecked(strings.EqualFold(name, activeProfile.Name))
+		action.SetToolTip(p.URI + " " + p.Database + "." + p.Collection)
+		group.AddAction(action)
+		action.ConnectTriggered(func(bool) { w.switchProfile(name) })
+	}
+	w.profilesMenu.AddSeparator()
+	manageAction := w.profilesMenu.AddAction("&Manage Profiles...")
+	manageAction.ConnectTriggered(func(bool) { w.manageProfiles() })
+}
+
+// switchProfile() makes the profile with the name the active one and shows
+// its invoices.
+func (w *MainWindow) switchProfile(name string) {
+	ps, err := readProfiles()
+	if err == nil {
+		ps, err = ps.use(name)
+	}
+	if err != nil {
+		widgets.QMessageBox_Warning(w, "Connection Profile", err.Error(),
+			widgets.QMessageBox__Ok, widgets.QMessageBox__Ok)
+		return
+	}
+	if !w.connectProfile(ps.active()) {
+		return
+	}
+	if err := writeProfiles(ps); err != nil {
+		widgets.QMessageBox_Warning(w, "Connection Profile", err.Error(),
+			widgets.QMessageBox__Ok, widgets.QMessageBox__Ok)
+	}
+}
+
+// manageProfiles() opens the Connection Profiles dialog, and connects to
+// the active profile if it is another one now or was changed.
+func (w *MainWindow) manageProfiles() {
+	ps, err := readProfiles()
+	if err != nil {
+		widgets.QMessageBox_Warning(w, "Connection Profiles", err.Error(),
+			widgets.QMessageBox__Ok, widgets.QMessageBox__Ok)
+	}
+
+	dialog := NewProfilesDialog(nil, 0)
+	dialog.initWith(w.QWidget_PTR(), ps)
+	if dialog.Exec() != int(widgets.QDialog__Accepted) {
+		return
+	}
+	ps = dialog.profiles()
+	if err := writeProfiles(ps); err != nil {
+		widgets.QMessageBox_Warning(w, "Connection Profiles", err.Error(),
+			widgets.QMessageBox__Ok, widgets.QMessageBox__Ok)
+		return
+	}
+	if ps.active() != activeProfile {
+		w.connectProfile(ps.active())
+	}
+}
+
+// connectProfile() connects the repository with the profile, logging in
+// to its DB, and shows its invoices from scratch, watching them for changes
+// instead of those of the profile before. The watcher, the inbox and the
+// queries running are stopped first, so that nothing goes on with the DB
+// of the profile before, and started again afterwards. If the login is
+// cancelled, it stays with the profile before and returns false.
+func (w *MainWindow) connectProfile(p ConnectionProfile) bool {
+	previous := activeProfile
+	previousUser, _ := loggedInUser()
+	w.stopWatching()
+	w.loader.CancelAll()
+	inboxDir := w.stopInbox()
+
+	err := useProfile(p)
+	setCurrentUser(nil)
+	connected := logIn(w.QWidget_PTR())
+	if connected {
+		w.updateTitle()
+		w.changes.take()
+		w.shownInvoice = 0
+		w.vendorView.BlockSignals(true)
+		w.vendorView.SetModel(core.NewQStringListModel2([]string{"<all invoices>"}, nil))
+		w.vendorView.BlockSignals(false)
+	} else {
+		useProfile(previous)
+		setCurrentUser(&previousUser)
+	}
+
+	// the queries cancelled are run again
+	w.reload()
+	w.startWatching()
+	if inboxDir != "" {
+		// the user logged in may not add invoices
+		w.inboxAction.SetChecked(w.model.Authorize(ActionAdd) == nil && w.startInbox(inboxDir))
+	}
+
+	if connected && err != nil {
+		widgets.QMessageBox_Warning(w, "Connection Profile", err.Error(),
+			widgets.QMessageBox__Ok, widgets.QMessageBox__Ok)
+	}
+	return connected
+}
+
+// updateTitle() shows the active profile and the user logged in in the
+// title bar.
+func (w *MainWindow) updateTitle() {
+	title := "Invoice Viewer (Demo) - " + activeProfile.Name
+	if u, ok := loggedInUser(); ok {
+		title += " - " + u.Name + " (" + string(u.Role) + ")"
+	}
+	w.SetWindowTitle(title)
+}
@@ -11,30 +11,69 @@ package main
 
 import (
 	"fmt"
-	"log"
-	"strings"
+	"sync"
+	"time"
 
 	"gopkg.in/mgo.v2"
 	"gopkg.in/mgo.v2/bson"
 )
 
 // Repository ...
-type Repository struct{}
+type Repository struct {
+	as *User // the user to act as instead of the current user, see As
+}
 
-// SERVER the DB server
-const SERVER = "mongodb://localhost:27017"
+// The DB server, instance and collection of the default profile.
+const (
+	defaultServer     = "mongodb://localhost:27017"
+	defaultDatabase   = "dummyInvoice"
+	defaultCollection = "invoice"
+)
 
-// DBNAME the name of the DB instance
-const DBNAME = "dummyInvoice"
+// dbSettings are the DB the repository queries.
+type dbSettings struct {
+	Server     string // the DB server
+	Name       string // the name of the DB instance
+	Collection string // the name of the collection in DB
+}
 
-// COLLECTION is the name of the collection in DB
-const COLLECTION = "invoice"
+// activeDB is the DB of the active profile, see useProfile. It is changed
+// on the GUI thread while goroutines query the DB, so it is guarded by
+// activeDBMu.
+var (
+	activeDBMu sync.RWMutex
+	activeDB   = dbSettings{defaultServer, defaultDatabase, defaultCollection}
+)
+
+// currentDB returns the DB of the active profile. A method reads it once,
+// so that all its queries go to the same DB.
+func currentDB() dbSettings {
+	activeDBMu.RLock()
+	defer activeDBMu.RUnlock()
+	return activeDB
+}
 
 var invoiceId = 6 // TODO implement current invoiceID based on DB
 
+// pingTimeout is how long Ping waits for the DB server.
+const pingTimeout = 3 * time.Second
+
+// Ping checks that the DB server can be reached.
+func (r Repository) Ping() error {
+	db := currentDB()
+	session, err := mgo.DialWithTimeout(db.Server, pingTimeout)
+	if err != nil {
+		return err
+	}
+	defer session.Close()
+
+	return session.Ping()
+}
+
 // GetInvoices returns the list of whole Invoices
 func (r Repository) GetInvoices() Invoices {
-	session, err := mgo.Dial(SERVER)
+	db := currentDB()
+	session, err := mgo.Dial(db.Server)
 
 	if err != nil {
 		fmt.Println("Failed to establish connection to Mongo server:", err)
@@ -42,7 +81,7 @@ func (r Repository) GetInvoices() Invoices {
 
 	defer session.Close()
 
-	c := session.DB(DBNAME).C(COLLECTION)
+	c := session.DB(db.Name).C(db.Collection)
 	results := Invoices{}
 
 	if err := c.Find(nil).All(&results); err != nil {
@@ -52,9 +91,10 @@ func (r Repository) GetInvoices() Invoices {
 	return results
 }
 
-// GetTableAllView returns values for the invoicesAllTableView
-func (r Repository) GetTableAllView() Invoices {
-	session, err := mgo.Dial(SERVER)
+// GetInvoicesByVendor returns the list of whole Invoices for one vendor.
+func (r Repository) GetInvoicesByVendor(name string) Invoices {
+	db := currentDB()
+	session, err := mgo.Dial(db.Server)
 
 	if err != nil {
 		fmt.Println("Failed to establish connection to Mongo server:", err)
@@ -62,10 +102,10 @@ func (r Repository) GetTableAllView() Invoices {
 
 	defer session.Close()
 
-	c := session.DB(DBNAME).C(COLLECTION)
-	var results Invoices
+	c := session.DB(db.Name).C(db.Collection)
+	results := Invoices{}
 
-	if err := c.Find(nil).Select(bson.M{"vendor": 1, "invoiceno": 1, "date": 1, "total": 1, "paid": 1}).All(&results); err != nil {
+	if err := c.Find(bson.M{"vendor": name}).All(&results); err != nil {
 		fmt.Println("Failed to write results:", err)
 	}
 
@@ -74,7 +114,8 @@ func (r Repository) GetTableAllView() Invoices {
 
 // GetTableVendorView returns values for the invoicesVendorTableView
 func (r Repository) GetTableVendorView(name string) Invoices {
-	session, err := mgo.Dial(SERVER)
+	db := currentDB()
+	session, err := mgo.Dial(db.Server)
 
 	if err != nil {
 		fmt.Println("Failed to establish connection to Mongo server:", err)
@@ -82,7 +123,7 @@ func (r Repository) GetTableVendorView(name string) Invoices {
 
 	defer session.Close()
 
-	c := session.DB(DBNAME).C(COLLECTION)
+	c := session.DB(db.Name).C(db.Collection)
 	var results Invoices
 
 	if err := c.Find(bson.M{"vendor": name}).Select(bson.M{"invoiceno": 1, "date": 1, "total": 1, "paid": 1}).All(&results); err != nil {
@@ -94,7 +135,8 @@ func (r Repository) GetTableVendorView(name string) Invoices {
 
 // GetTableLineItemView returns values for the lineItemTableView
 func (r Repository) GetTableLineItemView(num, vendor string) Items {
-	session, err := mgo.Dial(SERVER)
+	db := currentDB()
+	session, err := mgo.Dial(db.Server)
 
 	if err != nil {
 		fmt.Println("Failed to establish connection to Mongo server:", err)
@@ -102,7 +144,7 @@ func (r Repository) GetTableLineItemView(num, vendor string) Items {
 
 	defer session.Close()
 
-	c := session.DB(DBNAME).C(COLLECTION)
+	c := session.DB(db.Name).C(db.Collection)
 	var results Invoice
 
 	if err := c.Find(bson.M{"invoiceno": num, "vendor": vendor}).Select(bson.M{
@@ -115,7 +157,8 @@ func (r Repository) GetTableLineItemView(num, vendor string) Items {
 
 // GetInvoiceVendors returns the list of vendors out of all of the invoices
 func (r Repository) GetInvoiceVendors() []string {
-	session, err := mgo.Dial(SERVER)
+	db := currentDB()
+	session, err := mgo.Dial(db.Server)
 
 	if err != nil {
 		fmt.Println("Failed to establish connection to Mongo server:", err)
@@ -123,7 +166,7 @@ func (r Repository) GetInvoiceVendors() []string {
 
 	defer session.Close()
 
-	c := session.DB(DBNAME).C(COLLECTION)
+	c := session.DB(db.Name).C(db.Collection)
 	var results []string
 
 	if err := c.Find(nil).Distinct("vendor", &results); err != nil {
@@ -143,7 +186,8 @@ func (r Repository) CountVendors() int {
 
 // GetInvoiceVendorIDs returns the list of unique DB vendor IDs
 func (r Repository) GetInvoiceVendorIDs() []int {
-	session, err := mgo.Dial(SERVER)
+	db := currentDB()
+	session, err := mgo.Dial(db.Server)
 
 	if err != nil {
 		fmt.Println("Failed to establish connection to Mongo server:", err)
@@ -151,7 +195,7 @@ func (r Repository) GetInvoiceVendorIDs() []int {
 
 	defer session.Close()
 
-	c := session.DB(DBNAME).C(COLLECTION)
+	c := session.DB(db.Name).C(db.Collection)
 	var results []int
 
 	if err := c.Find(nil).Distinct("id", &results); err != nil {
@@ -163,7 +207,8 @@ func (r Repository) GetInvoiceVendorIDs() []int {
 
 // GetInvoiceById returns a unique Invoice queried by ID.
 func (r Repository) GetInvoiceById(id int) Invoice {
-	session, err := mgo.Dial(SERVER)
+	db := currentDB()
+	session, err := mgo.Dial(db.Server)
 
 	if err != nil {
 		fmt.Println("Failed to establish connection to Mongo server:", err)
@@ -171,12 +216,10 @@ func (r Repository) GetInvoiceById(id int) Invoice {
 
 	defer session.Close()
 
-	c := session.DB(DBNAME).C(COLLECTION)
+	c := session.DB(db.Name).C(db.Collection)
 	var result Invoice
 
-	fmt.Println("ID in GetInvoiceById", id)
-
-	if err := c.FindId(id).One(&result); err != nil {
+	if err := c.Find(bson.M{"id": id}).One(&result); err != nil && err != mgo.ErrNotFound {
 		fmt.Println("Failed to write result:", err)
 	}
 
@@ -185,7 +228,8 @@ func (r Repository) GetInvoiceById(id int) Invoice {
 
 // GetInvoiceByInvoiceNoAndVendor returns a unique Invoice.
 func (r Repository) GetInvoiceByInvoiceNoAndVendor(num, vendor string) Invoice {
-	session, err := mgo.Dial(SERVER)
+	db := currentDB()
+	session, err := mgo.Dial(db.Server)
 
 	if err != nil {
 		fmt.Println("Failed to establish connection to Mongo server:", err)
@@ -193,19 +237,20 @@ func (r Repository) GetInvoiceByInvoiceNoAndVendor(num, vendor string) Invoice {
 
 	defer session.Close()
 
-	c := session.DB(DBNAME).C(COLLECTION)
+	c := session.DB(db.Name).C(db.Collection)
 	var result Invoice
 
-	if err := c.Find(bson.M{"invoiceno": num, "vendor": vendor}).One(&result); err != nil {
+	if err := c.Find(bson.M{"invoiceno": num, "vendor": vendor}).One(&result); err != nil && err != mgo.ErrNotFound {
 		fmt.Println("Failed to write result:", err)
 	}
 
 	return result
 }
 
-// GetInvoicesByString takes a search string as input and returns Invoices
-func (r Repository) GetInvoiceByString(query string) Invoices {
-	session, err := mgo.Dial(SERVER)
+// FindInvoices returns the whole invoices selected by the filter, by ID.
+func (r Repository) FindInvoices(filter bson.M) Invoices {
+	db := currentDB()
+	session, err := mgo.Dial(db.Server)
 
 	if err != nil {
 		fmt.Println("Failed to establish connection to Mongo server:", err)
@@ -213,30 +258,168 @@ func (r Repository) GetInvoiceByString(query string) Invoices {
 
 	defer session.Close()
 
-	c := session.DB(DBNAME).C(COLLECTION)
+	c := session.DB(db.Name).C(db.Collection)
 	var results Invoices
 
-	// Logic to create filter
-	qs := strings.Split(query, " ")
-	and := make([]bson.M, len(qs))
-	for i, q := range qs {
-		and[i] = bson.M{"vendor": bson.M{
-			"$regex": bson.RegEx{Pattern: ".*" + q + ".*", Options: "i"},
-		}}
+	r.ensureIndexes(session, db)
+	if err := c.Find(filter).Sort("id").All(&results); err != nil {
+		fmt.Println("Failed to write results:", err)
+	}
+
+	return results
+}
+
+// invoicePageFields are the fields of the invoices returned by
+// GetInvoicePage, those the columns of the invoices table show.
+var invoicePageFields = bson.M{
+	"id": 1, "vendor": 1, "invoiceno": 1, "purchaseorder": 1, "date": 1, "duedate": 1,
+	"total": 1, "paid": 1, "currency": 1, "address": 1, "linecount": 1,
+	"crypt": 1, // the data key of the address, see encryption.go
+}
+
+// GetInvoicePage returns limit invoices selected by the filter after
+// skipping the first skip, in the order of the sort fields, see
+// mgo.Query.Sort. Only the invoicePageFields are filled in.
+func (r Repository) GetInvoicePage(filter bson.M, sort []string, skip, limit int) Invoices {
+	db := currentDB()
+	session, err := mgo.Dial(db.Server)
+
+	if err != nil {
+		fmt.Println("Failed to establish connection to Mongo server:", err)
+		return nil
 	}
-	filter := bson.M{"$and": and}
 
-	if err := c.Find(&filter).Limit(5).All(&results); err != nil {
+	defer session.Close()
+
+	c := session.DB(db.Name).C(db.Collection)
+	var results Invoices
+
+	r.ensureIndexes(session, db)
+	if err := c.Find(filter).Select(invoicePageFields).Sort(sort...).Skip(skip).Limit(limit).All(&results); err != nil {
 		fmt.Println("Failed to write results:", err)
 	}
 
 	return results
 }
 
+// CountInvoices returns the number of invoices selected by the filter.
+func (r Repository) CountInvoices(filter bson.M) int {
+	db := currentDB()
+	session, err := mgo.Dial(db.Server)
+
+	if err != nil {
+		fmt.Println("Failed to establish connection to Mongo server:", err)
+		return 0
+	}
+
+	defer session.Close()
+
+	c := session.DB(db.Name).C(db.Collection)
+
+	r.ensureIndexes(session, db)
+	result, err := c.Find(filter).Count()
+	if err != nil {
+		fmt.Println("Failed to write results:", err)
+	}
+
+	return result
+}
+
+// invoiceIndexes are the fields the invoices are filtered and sorted by.
+var invoiceIndexes = [][]string{
+	{"id"}, {"vendor", "datekey"}, {"invoiceno"}, {"datekey"}, {"duedatekey"}, {"total"}, {"paid"},
+	{"purchaseorder"}, {"currency"}, {"linecount"},
+}
+
+// indexesOnce makes ensureIndexes run once per collection.
+var indexesOnce collectionOnce
+
+// ensureIndexes creates the indexes of the invoices and fills in the date
+// keys and line counts of invoices written without them, i.e. by createDummyData.go or a
+// version of the app before they were added. It runs once per collection,
+// before the first query relying on them.
+func (r Repository) ensureIndexes(session *mgo.Session, db dbSettings) {
+	indexesOnce.Do(db, func() {
+		c := session.DB(db.Name).C(db.Collection)
+		for _, key := range invoiceIndexes {
+			if err := c.EnsureIndexKey(key...); err != nil {
+				fmt.Println("Failed to create index:", err)
+			}
+		}
+		if err := c.EnsureIndex(searchTextIndex()); err != nil {
+			fmt.Println("Failed to create index:", err)
+		}
+		// the address is encrypted now, so an index created by an older
+		// version is of no use; there is none to drop on a new DB
+		c.DropIndex("address.street")
+
+		missing := bson.M{"$or": []bson.M{
+			{"datekey": bson.M{"$exists": false}},
+			{"linecount": bson.M{"$exists": false}},
+		}}
+		iter := c.Find(missing).Select(bson.M{"id": 1, "date": 1, "duedate": 1, "lineitems": 1}).Iter()
+		for {
+			// a new value each time, as decoding does not clear missing fields
+			var invoice Invoice
+			if !iter.Next(&invoice) {
+				break
+			}
+			err := c.Update(bson.M{"id": invoice.ID}, bson.M{"$set": bson.M{
+				"datekey":    dateKey(invoice.Date),
+				"duedatekey": dateKey(invoice.DueDate),
+				"linecount":  len(invoice.LineItems),
+			}})
+			if err != nil {
+				fmt.Println("Failed to update invoice:", err)
+			}
+		}
+		if err := iter.Close(); err != nil {
+			fmt.Println("Failed to write results:", err)
+		}
+	})
+}
+
+// dateKey returns a date of the DB as YYYY-MM-DD, which sorts in date
+// order, or "" if it is not a valid date.
+func dateKey(date string) string {
+	if date == "" {
+		return ""
+	}
+	normalized, err := normalizeDate(date)
+	if err != nil {
+		return ""
+	}
+	t, _ := time.Parse("01/02/2006", normalized)
+	return t.Format("2006-01-02")
+}
+
+// InvoiceExists reports whether an invoice with the given invoice number
+// and vendor is already in the DB.
+func (r Repository) InvoiceExists(num, vendor string) bool {
+	db := currentDB()
+	session, err := mgo.Dial(db.Server)
+
+	if err != nil {
+		fmt.Println("Failed to establish connection to Mongo server:", err)
+	}
+
+	defer session.Close()
+
+	c := session.DB(db.Name).C(db.Collection)
+
+	count, err := c.Find(bson.M{"invoiceno": num, "vendor": vendor}).Count()
+	if err != nil {
+		fmt.Println("Failed to write results:", err)
+	}
+
+	return count > 0
+}
+
 // CountInvoicesByVendorName returns the number of invoices for each unique
 // vendor name.
 func (r Repository) CountInvoicesByVendorName(name string) int {
-	session, err := mgo.Dial(SERVER)
+	db := currentDB()
+	session, err := mgo.Dial(db.Server)
 
 	if err != nil {
 		fmt.Println("Failed to establish connection to Mongo server:", err)
@@ -244,7 +427,7 @@ func (r Repository) CountInvoicesByVendorName(name string) int {
 
 	defer session.Close()
 
-	c := session.DB(DBNAME).C(COLLECTION)
+	c := session.DB(db.Name).C(db.Collection)
 	var result int
 
 	result, err = c.Find(bson.M{"vendor": name}).Count()
@@ -255,40 +438,56 @@ func (r Repository) CountInvoicesByVendorName(name string) int {
 	return result
 }
 
-// GetLineItemsByVendorID takes the DB vendor ID and returns a list of
-// LineItems from the invoice
-func (r Repository) GetLineItemsByVendorID(id int) []string {
-	session, err := mgo.Dial(SERVER)
+// GetLineItemsByVendorID takes the DB vendor ID and returns the LineItems
+// of the invoice
+func (r Repository) GetLineItemsByVendorID(id int) Items {
+	db := currentDB()
+	session, err := mgo.Dial(db.Server)
 
 	if err != nil {
 		fmt.Println("Failed to establish connection to Mongo server:", err)
+		return nil
 	}
 
 	defer session.Close()
 
-	c := session.DB(DBNAME).C(COLLECTION)
-	var results []string
+	c := session.DB(db.Name).C(db.Collection)
+	var results Invoice
 
-	if err := c.Find(bson.M{"id": id}).Distinct("lineitems", &results); err != nil {
+	if err := c.Find(bson.M{"id": id}).Select(bson.M{"lineitems": 1}).One(&results); err != nil {
 		fmt.Println("Failed to write results:", err)
 	}
 
-	return results
+	return results.LineItems
 }
 
 // AddInvoice adds an Invoice in the DB
 func (r Repository) AddInvoice(invoice Invoice) bool {
-	session, err := mgo.Dial(SERVER)
+	db := currentDB()
+	session, err := mgo.Dial(db.Server)
+	if err != nil {
+		fmt.Println("Failed to establish connection to Mongo server:", err)
+		return false
+	}
 	defer session.Close()
 
+	user, err := r.authorizeInvoice(invoice, nil)
+	if err != nil {
+		fmt.Println("Failed to add invoice:", err)
+		return false
+	}
+
 	invoiceId = r.incrementVendorID()
 	invoice.ID = invoiceId
-	session.DB(DBNAME).C(COLLECTION).Insert(invoice)
-	if err != nil {
-		log.Fatal(err)
+	invoice.DateKey, invoice.DueDateKey = dateKey(invoice.Date), dateKey(invoice.DueDate)
+	invoice.LineCount = len(invoice.LineItems)
+	invoice.CreatedBy, invoice.ModifiedBy = user.Name, user.Name
+	if err := session.DB(db.Name).C(db.Collection).Insert(invoice); err != nil {
+		fmt.Println("Failed to add invoice:", err)
 		return false
 	}
 
+	r.logChange(session, db, ChangeInsert, invoice.ID, user.Name)
 	fmt.Println("Added New Invoice ID- ", invoice.ID)
 
 	return true
@@ -296,32 +495,69 @@ func (r Repository) AddInvoice(invoice Invoice) bool {
 
 // UpdateInvoice updates an Invoice in the DB
 func (r Repository) UpdateInvoice(invoice Invoice) bool {
-	session, err := mgo.Dial(SERVER)
+	db := currentDB()
+	session, err := mgo.Dial(db.Server)
+	if err != nil {
+		fmt.Println("Failed to establish connection to Mongo server:", err)
+		return false
+	}
 	defer session.Close()
 
-	err = session.DB(DBNAME).C(COLLECTION).UpdateId(invoice.ID, invoice)
+	c := session.DB(db.Name).C(db.Collection)
+	var old Invoice
+	if err := c.Find(bson.M{"id": invoice.ID}).One(&old); err != nil {
+		fmt.Println("Failed to update invoice:", err)
+		return false
+	}
+	user, err := r.authorizeInvoice(invoice, &old)
+	if err != nil {
+		fmt.Println("Failed to update invoice:", err)
+		return false
+	}
+
+	invoice.DateKey, invoice.DueDateKey = dateKey(invoice.Date), dateKey(invoice.DueDate)
+	invoice.LineCount = len(invoice.LineItems)
+	invoice.CreatedBy, invoice.ModifiedBy = old.CreatedBy, user.Name
+	err = c.Update(bson.M{"id": invoice.ID}, invoice)
 
 	if err != nil {
-		log.Fatal(err)
+		fmt.Println("Failed to update invoice:", err)
 		return false
 	}
 
+	r.logChange(session, db, ChangeUpdate, invoice.ID, user.Name)
 	fmt.Println("Updated Invoice ID - ", invoice.ID)
 
 	return true
 }
 
-// DeleteInvoice deletes an Invoice by ID
+// DeleteInvoice deletes an Invoice by ID, and returns "OK", "NOT FOUND",
+// "FORBIDDEN" if the current user may not delete invoices or "INTERNAL ERR".
 func (r Repository) DeleteInvoice(id int) string {
-	session, err := mgo.Dial(SERVER)
+	db := currentDB()
+	user, err := r.authorize(ActionDelete)
+	if err != nil {
+		fmt.Println("Failed to delete invoice:", err)
+		return "FORBIDDEN"
+	}
+
+	session, err := mgo.Dial(db.Server)
+	if err != nil {
+		fmt.Println("Failed to establish connection to Mongo server:", err)
+		return "INTERNAL ERR"
+	}
 	defer session.Close()
 
 	// Remove Invoice
-	if err = session.DB(DBNAME).C(COLLECTION).RemoveId(id); err != nil {
-		log.Fatal(err)
+	if err = session.DB(db.Name).C(db.Collection).Remove(bson.M{"id": id}); err != nil {
+		if err == mgo.ErrNotFound {
+			return "NOT FOUND"
+		}
+		fmt.Println("Failed to delete invoice:", err)
 		return "INTERNAL ERR"
 	}
 
+	r.logChange(session, db, ChangeDelete, id, user.Name)
 	fmt.Println("Deleted Invoice ID - ", id)
 	// Write status
 	return "OK"
@@ -329,7 +565,8 @@ func (r Repository) DeleteInvoice(id int) string {
 
 // CountPaidTrue returns the number of paid invoices.
 func (r Repository) CountPaidTrue() int {
-	session, err := mgo.Dial(SERVER)
+	db := currentDB()
+	session, err := mgo.Dial(db.Server)
 
 	if err != nil {
 		fmt.Println("Failed to establish connection to Mongo server:", err)
@@ -337,7 +574,7 @@ func (r Repository) CountPaidTrue() int {
 
 	defer session.Close()
 
-	c := session.DB(DBNAME).C(COLLECTION)
+	c := session.DB(db.Name).C(db.Collection)
 	var result int
 
 	result, err = c.Find(bson.M{"paid": true}).Count()
@@ -350,7 +587,8 @@ func (r Repository) CountPaidTrue() int {
 
 // CountPaidFalse returns the number of not paid invoices
 func (r Repository) CountPaidFalse() int {
-	session, err := mgo.Dial(SERVER)
+	db := currentDB()
+	session, err := mgo.Dial(db.Server)
 
 	if err != nil {
 		fmt.Println("Failed to establish connection to Mongo server:", err)
@@ -358,7 +596,7 @@ func (r Repository) CountPaidFalse() int {
 
 	defer session.Close()
 
-	c := session.DB(DBNAME).C(COLLECTION)
+	c := session.DB(db.Name).C(db.Collection)
 	var result int
 
 	result, err = c.Find(bson.M{"paid": false}).Count()
@@ -371,7 +609,8 @@ func (r Repository) CountPaidFalse() int {
 
 // RecordCount returns the total number of records in the DB.
 func (r Repository) RecordCount() int {
-	session, err := mgo.Dial(SERVER)
+	db := currentDB()
+	session, err := mgo.Dial(db.Server)
 
 	if err != nil {
 		fmt.Println("Failed to establish connection to Mongo server:", err)
@@ -379,7 +618,7 @@ func (r Repository) RecordCount() int {
 
 	defer session.Close()
 
-	c := session.DB(DBNAME).C(COLLECTION)
+	c := session.DB(db.Name).C(db.Collection)
 	var result int
 
 	result, err = c.Find(nil).Count()
@@ -397,6 +636,9 @@ func (r Repository) maxID() int {
 	var ids []int
 
 	ids = r.GetInvoiceVendorIDs()
+	if len(ids) == 0 {
+		return 0
+	}
 	max := ids[0]
 	for _, value := range ids {
 		if value > max {
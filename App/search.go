@@ -0,0 +1,330 @@
+// Copyright 2016 Cory Robinson. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE.txt file.
+
+// search.go implements the search syntax of the search box, the search
+// API endpoints and invoicectl search. A query is a list of terms which
+// must all match:
+//
+//	vendor:niche paid:false total>100 date:2018-01..2018-03 "hammer"
+//
+// A term is either text, a word or "quoted phrase" found in the vendor,
+// invoice number, purchase order or in the description or product ID of
+// a line item, or a field, an operator and a value:
+//
+//	vendor:, invoice:, po:, currency:  text in the field
+//	item:, product:                    text in a line item description or product ID
+//	paid:true, paid:false              paid status, also yes/no
+//	total:, total>, total>=, ...       total in dollars, or a range 100..250
+//	date:, date>, date>=, ...          invoice date, YYYY, YYYY-MM, YYYY-MM-DD or
+//	due:, due>, ...                    MM/DD/YYYY, or a range 2018-01..2018-03
+//
+// Either end of a range can be left out. Text is matched ignoring case and
+// is never interpreted as a regular expression. Text without a field is
+// looked up in the text index of searchTextIndex, so that the search does
+// not scan every invoice, and is found as whole words only.
+
+package main
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"strings"
+	"time"
+	"unicode"
+
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// searchFields maps the field names of the syntax to the fields searched.
+var searchFields = map[string]string{
+	"vendor":        "vendor",
+	"invoice":       "invoiceno",
+	"invoiceno":     "invoiceno",
+	"no":            "invoiceno",
+	"po":            "purchaseorder",
+	"purchaseorder": "purchaseorder",
+	"currency":      "currency",
+	"item":          "lineitems.description",
+	"description":   "lineitems.description",
+	"product":       "lineitems.productid",
+	"productid":     "lineitems.productid",
+	"paid":          "paid",
+	"status":        "paid",
+	"total":         "total",
+	"amount":        "total",
+	"date":          "date",
+	"due":           "duedate",
+	"duedate":       "duedate",
+}
+
+// searchTextFields are the fields searched for text without a field.
+var searchTextFields = []string{"vendor", "invoiceno", "purchaseorder", "lineitems.description", "lineitems.productid"}
+
+// searchTextIndex returns the text index of the searchTextFields. Words
+// are not stemmed and there are no stop words, as the fields are names
+// and numbers rather than English.
+func searchTextIndex() mgo.Index {
+	key := make([]string, len(searchTextFields))
+	for i, field := range searchTextFields {
+		key[i] = "$text:" + field
+	}
+	return mgo.Index{Key: key, Name: "search", DefaultLanguage: "none"}
+}
+
+// SearchQuery is a parsed search query, see ParseSearch.
+type SearchQuery struct {
+	terms []searchTerm
+}
+
+// searchTerm is one term of a query. Totals and dates are matched as the
+// inclusive range min..max, of cents or days since 01/01/1970.
+type searchTerm struct {
+	field    string // DB field, "" for text in any of searchTextFields
+	text     string // lower case
+	paid     bool
+	min, max int64
+}
+
+// ParseSearch parses a query of the search syntax.
+func ParseSearch(query string) (SearchQuery, error) {
+	var q SearchQuery
+	s := []rune(query)
+	for i := 0; i < len(s); {
+		if unicode.IsSpace(s[i]) {
+			i++
+			continue
+		}
+
+		// a field name is a word followed by an operator
+		name, op := "", ""
+		j := i
+		for j < len(s) && unicode.IsLetter(s[j]) {
+			j++
+		}
+		if j > i && j < len(s) && strings.ContainsRune(":<>", s[j]) {
+			name = strings.ToLower(string(s[i:j]))
+			op = string(s[j])
+			j++
+			if op != ":" && j < len(s) && s[j] == '=' {
+				op += "="
+				j++
+			}
+			i = j
+		}
+
+		// the value runs to the next space outside quotes
+		var value strings.Builder
+		quoted := false
+		for ; i < len(s) && (quoted || !unicode.IsSpace(s[i])); i++ {
+			if s[i] == '"' {
+				quoted = !quoted
+				continue
+			}
+			value.WriteRune(s[i])
+		}
+		if quoted {
+			return q, fmt.Errorf("missing closing quote")
+		}
+
+		term, err := newSearchTerm(name, op, value.String())
+		if err != nil {
+			return q, err
+		}
+		if term.field != "" || term.text != "" {
+			q.terms = append(q.terms, term)
+		}
+	}
+	return q, nil
+}
+
+// newSearchTerm returns the term for a field, operator and value. An empty
+// name is a text term.
+func newSearchTerm(name, op, value string) (searchTerm, error) {
+	if name == "" {
+		return searchTerm{text: strings.ToLower(value)}, nil
+	}
+	field, ok := searchFields[name]
+	if !ok {
+		return searchTerm{}, fmt.Errorf("unknown search field %q, quote the text to search for it", name)
+	}
+	if value == "" {
+		return searchTerm{}, fmt.Errorf("%s%s needs a value", name, op)
+	}
+
+	term := searchTerm{field: field}
+	switch field {
+	case "paid":
+		if op != ":" {
+			return term, fmt.Errorf("%s can only be compared with :", name)
+		}
+		paid, err := parsePaid(value)
+		if err != nil {
+			return term, fmt.Errorf("%s must be true or false", name)
+		}
+		term.paid = paid
+	case "total":
+		err := term.parseRange(op, value, func(s string) (int64, int64, error) {
+			cents, err := parseCents(s)
+			return cents, cents, err
+		})
+		if err != nil {
+			return term, fmt.Errorf("%s: %v", name, err)
+		}
+	case "date", "duedate":
+		if err := term.parseRange(op, value, parseSearchDate); err != nil {
+			return term, fmt.Errorf("%s: %v", name, err)
+		}
+	default:
+		if op != ":" {
+			return term, fmt.Errorf("%s can only be compared with :", name)
+		}
+		term.text = strings.ToLower(value)
+	}
+	return term, nil
+}
+
+// parseRange sets the range of the term from an operator and a value, a
+// single value or a range a..b. parse returns the first and last of the
+// values denoted by a value, i.e. the days of a month.
+func (t *searchTerm) parseRange(op, value string, parse func(string) (int64, int64, error)) error {
+	t.min, t.max = math.MinInt64, math.MaxInt64
+
+	if from, to, ok := strings.Cut(value, ".."); ok {
+		if op != ":" {
+			return fmt.Errorf("a range can only be compared with :")
+		}
+		if from != "" {
+			first, _, err := parse(from)
+			if err != nil {
+				return err
+			}
+			t.min = first
+		}
+		if to != "" {
+			_, last, err := parse(to)
+			if err != nil {
+				return err
+			}
+			t.max = last
+		}
+		return nil
+	}
+
+	first, last, err := parse(value)
+	if err != nil {
+		return err
+	}
+	switch op {
+	case ":":
+		t.min, t.max = first, last
+	case ">":
+		t.min = last + 1
+	case ">=":
+		t.min = first
+	case "<":
+		t.max = first - 1
+	case "<=":
+		t.max = last
+	}
+	return nil
+}
+
+// parseSearchDate returns the first and last day of a date of the search
+// syntax, as days since 01/01/1970.
+func parseSearchDate(s string) (int64, int64, error) {
+	periods := []struct {
+		layout string
+		years  int
+		months int
+	}{{"2006", 1, 0}, {"2006-01", 0, 1}, {"2006-1", 0, 1}, {"2006-01-02", 0, 0}}
+	for _, p := range periods {
+		if t, err := time.Parse(p.layout, s); err == nil {
+			last := t.AddDate(p.years, p.months, 0)
+			if p.years == 0 && p.months == 0 {
+				last = last.AddDate(0, 0, 1)
+			}
+			return searchDay(t), searchDay(last) - 1, nil
+		}
+	}
+	date, err := normalizeDate(s)
+	if err != nil {
+		return 0, 0, fmt.Errorf("%q is not a date, use YYYY, YYYY-MM, YYYY-MM-DD or MM/DD/YYYY", s)
+	}
+	t, _ := time.Parse("01/02/2006", date)
+	return searchDay(t), searchDay(t), nil
+}
+
+// searchDay returns the day of t as days since 01/01/1970.
+func searchDay(t time.Time) int64 {
+	return t.Unix() / 86400
+}
+
+// IsEmpty reports whether the query has no terms and so selects every
+// invoice.
+func (q SearchQuery) IsEmpty() bool {
+	return len(q.terms) == 0
+}
+
+// Filter returns the MongoDB filter of the query. Dates are compared by
+// their date keys, see dateKey. Text without a field is searched for as
+// phrases in the text index, which narrows the invoices down to those with
+// the words, and every term is then matched by regular expressions.
+func (q SearchQuery) Filter() bson.M {
+	var and []bson.M
+	var phrases []string
+	for _, term := range q.terms {
+		switch term.field {
+		case "":
+			phrases = append(phrases, `"`+term.text+`"`)
+			or := make([]bson.M, len(searchTextFields))
+			for i, field := range searchTextFields {
+				or[i] = bson.M{field: searchRegex(term.text)}
+			}
+			and = append(and, bson.M{"$or": or})
+		case "paid":
+			and = append(and, bson.M{"paid": term.paid})
+		case "total":
+			if cmp := term.rangeFilter(func(cents int64) interface{} { return cents }); len(cmp) > 0 {
+				and = append(and, bson.M{"total": cmp})
+			}
+		case "date", "duedate":
+			cmp := term.rangeFilter(func(day int64) interface{} {
+				return time.Unix(day*86400, 0).UTC().Format("2006-01-02")
+			})
+			// invoices without a valid date have an empty key
+			cmp["$gt"] = ""
+			and = append(and, bson.M{term.field + "key": cmp})
+		default:
+			and = append(and, bson.M{term.field: searchRegex(term.text)})
+		}
+	}
+	if len(phrases) > 0 {
+		text := bson.M{"$text": bson.M{"$search": strings.Join(phrases, " ")}}
+		and = append([]bson.M{text}, and...)
+	}
+	if len(and) == 0 {
+		return bson.M{}
+	}
+	return bson.M{"$and": and}
+}
+
+// rangeFilter returns the comparisons of the range of a term, with the
+// ends converted to DB values by value.
+func (t searchTerm) rangeFilter(value func(int64) interface{}) bson.M {
+	cmp := bson.M{}
+	if t.min != math.MinInt64 {
+		cmp["$gte"] = value(t.min)
+	}
+	if t.max != math.MaxInt64 {
+		cmp["$lte"] = value(t.max)
+	}
+	return cmp
+}
+
+// searchRegex returns a regular expression finding text ignoring case.
+func searchRegex(text string) bson.RegEx {
+	return bson.RegEx{Pattern: regexp.QuoteMeta(text), Options: "i"}
+}
@@ -0,0 +1,91 @@
+// Copyright 2016 Cory Robinson. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE.txt file.
+
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"gopkg.in/mgo.v2/bson"
+)
+
+func TestParseSearch(t *testing.T) {
+	// text is also looked up in any of the searchTextFields
+	text := func(s string) bson.M {
+		or := make([]bson.M, len(searchTextFields))
+		for i, field := range searchTextFields {
+			or[i] = bson.M{field: bson.RegEx{Pattern: s, Options: "i"}}
+		}
+		return bson.M{"$or": or}
+	}
+	search := func(s string) bson.M {
+		return bson.M{"$text": bson.M{"$search": s}}
+	}
+
+	tests := []struct {
+		name, query string
+		want        []bson.M
+		wantError   string
+	}{
+		{"empty", "  ", nil, ""},
+		{"text", "Hammer", []bson.M{search(`"hammer"`), text("hammer")}, ""},
+		{"phrases", `"claw hammer" nails`,
+			[]bson.M{search(`"claw hammer" "nails"`), text("claw hammer"), text("nails")}, ""},
+		{"field", "vendor:Niche", []bson.M{{"vendor": bson.RegEx{Pattern: "niche", Options: "i"}}}, ""},
+		{"quoted field", `vendor:"niche tools"`,
+			[]bson.M{{"vendor": bson.RegEx{Pattern: "niche tools", Options: "i"}}}, ""},
+		{"line item field", "product:H-1", []bson.M{{"lineitems.productid": bson.RegEx{Pattern: "h-1", Options: "i"}}}, ""},
+		{"regex escaped", "vendor:a.b*", []bson.M{{"vendor": bson.RegEx{Pattern: `a\.b\*`, Options: "i"}}}, ""},
+		{"text regex escaped", "(a+b)", []bson.M{search(`"(a+b)"`), text(`\(a\+b\)`)}, ""},
+		{"fields", "currency:usd paid:no", []bson.M{
+			{"currency": bson.RegEx{Pattern: "usd", Options: "i"}}, {"paid": false}}, ""},
+		{"paid", "status:yes", []bson.M{{"paid": true}}, ""},
+		{"total", "total:12.50", []bson.M{{"total": bson.M{"$gte": int64(1250), "$lte": int64(1250)}}}, ""},
+		{"total greater", "total>100", []bson.M{{"total": bson.M{"$gte": int64(10001)}}}, ""},
+		{"total at most", "amount<=100", []bson.M{{"total": bson.M{"$lte": int64(10000)}}}, ""},
+		{"total range", "total:1..2", []bson.M{{"total": bson.M{"$gte": int64(100), "$lte": int64(200)}}}, ""},
+		{"open range", "total:..2", []bson.M{{"total": bson.M{"$lte": int64(200)}}}, ""},
+		{"date month range", "date:2018-01..2018-03",
+			[]bson.M{{"datekey": bson.M{"$gt": "", "$gte": "2018-01-01", "$lte": "2018-03-31"}}}, ""},
+		{"date year", "date:2016", []bson.M{{"datekey": bson.M{"$gt": "", "$gte": "2016-01-01", "$lte": "2016-12-31"}}}, ""},
+		{"date before", "date<2018-02", []bson.M{{"datekey": bson.M{"$gt": "", "$lte": "2018-01-31"}}}, ""},
+		{"due after", "due>01/31/2018", []bson.M{{"duedatekey": bson.M{"$gt": "", "$gte": "2018-02-01"}}}, ""},
+		{"unclosed quote", `vendor:"niche tools`, nil, "missing closing quote"},
+		{"unclosed text quote", `paid:true "hammer`, nil, "missing closing quote"},
+		{"unknown field", "colour:red", nil, `unknown search field "colour"`},
+		{"no value", "vendor:", nil, "vendor: needs a value"},
+		{"bad paid", "paid:maybe", nil, "paid must be true or false"},
+		{"paid compared", "paid>true", nil, "paid can only be compared with :"},
+		{"text compared", "vendor>a", nil, "vendor can only be compared with :"},
+		{"bad total", "total>lots", nil, "total:"},
+		{"bad date", "date:yesterday", nil, `"yesterday" is not a date`},
+		{"range compared", "total>1..2", nil, "a range can only be compared with :"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			query, err := ParseSearch(tt.query)
+			if tt.wantError != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantError) {
+					t.Errorf("ParseSearch: got %v, want an error containing %q", err, tt.wantError)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseSearch: %v", err)
+			}
+			want := bson.M{}
+			if tt.want != nil {
+				want = bson.M{"$and": tt.want}
+			}
+			if got := query.Filter(); !reflect.DeepEqual(got, want) {
+				t.Errorf("filter =\n%v\nwant\n%v", got, want)
+			}
+			if query.IsEmpty() != (tt.want == nil) {
+				t.Errorf("IsEmpty = %v", query.IsEmpty())
+			}
+		})
+	}
+}
@@ -0,0 +1,288 @@
+// Copyright 2016 Cory Robinson. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE.txt file.
+
+// tableColumn.go describes the columns of the tables of the main window
+// over Invoices and Items: the raw value of a cell, which is what a column
+// sorts by, its text, and how it is shown. The Qt side is TableModel, and
+// InvoiceTableModel for the invoices, which the DB sorts.
+
+package main
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// tableColumn is a column of a table of rows of type T.
+type tableColumn[T any] struct {
+	key   string // names the column in the settings
+	title string
+	sort  string // DB field sorted by, for tables sorted by the DB; "" if it cannot sort by the column
+
+	// value returns the raw value of a cell, a string, int64 or bool
+	value func(row T) interface{}
+	text  func(row T) string
+
+	numeric bool               // aligned right
+	color   func(row T) string // text color, "" for the default
+}
+
+// tableCell is a cell of a table, see tableColumn.
+type tableCell struct {
+	value   interface{}
+	text    string
+	numeric bool
+	color   string
+}
+
+// cell returns the cell of the column in a row.
+func (c tableColumn[T]) cell(row T) tableCell {
+	cell := tableCell{text: c.text(row), numeric: c.numeric}
+	if c.value != nil {
+		cell.value = c.value(row)
+	} else {
+		cell.value = cell.text
+	}
+	if c.color != nil {
+		cell.color = c.color(row)
+	}
+	return cell
+}
+
+// notPaidColor is the text color of invoices not paid.
+const notPaidColor = "#c00000"
+
+// invoiceColumns are the columns the invoices table can show, see
+// invoiceColumnsOf. Dates are shown in the date format of the preferences
+// and sort by their date keys, see dateKey.
+var invoiceColumns = []tableColumn[Invoice]{
+	{
+		key: "vendor", title: "Vendor", sort: "vendor",
+		text: func(invoice Invoice) string { return invoice.Vendor },
+	},
+	{
+		key: "invoiceno", title: "Invoice No.", sort: "invoiceno",
+		text: func(invoice Invoice) string { return invoice.InvoiceNo },
+	},
+	{
+		key: "po", title: "Purchase Order", sort: "purchaseorder",
+		text: func(invoice Invoice) string { return invoice.PurchaseOrder },
+	},
+	{
+		key: "date", title: "Date", sort: "datekey",
+		value: func(invoice Invoice) interface{} { return dateKey(invoice.Date) },
+		text:  func(invoice Invoice) string { return displayDate(invoice.Date) },
+	},
+	{
+		key: "duedate", title: "Due Date", sort: "duedatekey",
+		value: func(invoice Invoice) interface{} { return dateKey(invoice.DueDate) },
+		text:  func(invoice Invoice) string { return displayDate(invoice.DueDate) },
+	},
+	{
+		key: "total", title: "Total", sort: "total",
+		value:   func(invoice Invoice) interface{} { return invoice.Total },
+		text:    func(invoice Invoice) string { return formatCents(invoice.Total) },
+		numeric: true,
+	},
+	{
+		key: "currency", title: "Currency", sort: "currency",
+		text: func(invoice Invoice) string { return invoice.Currency },
+	},
+	{
+		key: "status", title: "Status", sort: "paid",
+		value: func(invoice Invoice) interface{} { return invoice.Paid },
+		text:  func(invoice Invoice) string { return paidString(invoice.Paid) },
+		color: invoiceColor,
+	},
+	{
+		// encrypted, see encryption.go, so the DB cannot sort by it
+		key: "address", title: "Address",
+		text: func(invoice Invoice) string { return addressString(invoice.Address) },
+	},
+	{
+		key: "lines", title: "Line Items", sort: "linecount",
+		value:   func(invoice Invoice) interface{} { return int64(invoice.LineCount) },
+		text:    func(invoice Invoice) string { return strconv.Itoa(invoice.LineCount) },
+		numeric: true,
+	},
+}
+
+// defaultInvoiceColumns are the keys of the columns shown until they are
+// configured.
+var defaultInvoiceColumns = []string{"vendor", "invoiceno", "date", "total", "status"}
+
+// invoiceColumnsOf returns the columns with the keys, in their order. The
+// vendor column is left out of the invoices of one vendor, and if none of
+// the keys is known the default columns are returned.
+func invoiceColumnsOf(keys []string, oneVendor bool) []tableColumn[Invoice] {
+	var columns []tableColumn[Invoice]
+	seen := map[string]bool{}
+	for _, key := range keys {
+		column, ok := invoiceColumn(key)
+		if !ok || seen[key] || (oneVendor && key == "vendor") {
+			continue
+		}
+		seen[key] = true
+		columns = append(columns, column)
+	}
+	if len(columns) == 0 {
+		return invoiceColumnsOf(defaultInvoiceColumns, oneVendor)
+	}
+	return columns
+}
+
+// invoiceColumn returns the column with the key.
+func invoiceColumn(key string) (tableColumn[Invoice], bool) {
+	for _, column := range invoiceColumns {
+		if column.key == key {
+			return column, true
+		}
+	}
+	return tableColumn[Invoice]{}, false
+}
+
+// columnKeys returns the keys of the columns.
+func columnKeys[T any](columns []tableColumn[T]) []string {
+	keys := make([]string, len(columns))
+	for i, column := range columns {
+		keys[i] = column.key
+	}
+	return keys
+}
+
+// addressString returns an address on one line.
+func addressString(address Location) string {
+	var parts []string
+	for _, part := range []string{address.Street, address.City, strings.TrimSpace(address.State + " " + address.Zipcode)} {
+		if part != "" {
+			parts = append(parts, part)
+		}
+	}
+	return strings.Join(parts, ", ")
+}
+
+// invoiceColor returns the text color of the status of an invoice.
+func invoiceColor(invoice Invoice) string {
+	if !invoice.Paid {
+		return notPaidColor
+	}
+	return ""
+}
+
+// The columns of the line items table, and of the table shown while no
+// invoice is selected.
+var (
+	itemColumns = []tableColumn[Item]{
+		{
+			title: "Product ID",
+			text:  func(item Item) string { return item.ProductID },
+		},
+		{
+			title: "Description",
+			text:  func(item Item) string { return item.Description },
+		},
+		{
+			title:   "Quantity",
+			value:   func(item Item) interface{} { return int64(item.Quantity) },
+			text:    func(item Item) string { return strconv.Itoa(int(item.Quantity)) },
+			numeric: true,
+		},
+		{
+			title:   "Amount",
+			value:   func(item Item) interface{} { return item.Amount },
+			text:    func(item Item) string { return formatCents(item.Amount) },
+			numeric: true,
+		},
+	}
+	itemColumnsNone = []tableColumn[Item]{
+		{title: "Select An Invoice"},
+	}
+)
+
+// tableSource is the rows and columns shown by a TableModel.
+type tableSource interface {
+	rowCount() int
+	columnCount() int
+	title(column int) string
+	cell(row, column int) tableCell
+	sort(column int, descending bool)
+}
+
+// sliceTable is a tableSource over rows held in memory, sorted in Go.
+type sliceTable[T any] struct {
+	rows    []T
+	columns []tableColumn[T]
+}
+
+// newSliceTable returns the table of the rows in the columns. Sorting the
+// table sorts the rows in place.
+func newSliceTable[T any](rows []T, columns []tableColumn[T]) *sliceTable[T] {
+	return &sliceTable[T]{rows: rows, columns: columns}
+}
+
+func (t *sliceTable[T]) rowCount() int    { return len(t.rows) }
+func (t *sliceTable[T]) columnCount() int { return len(t.columns) }
+
+func (t *sliceTable[T]) title(column int) string {
+	if column < 0 || column >= len(t.columns) {
+		return ""
+	}
+	return t.columns[column].title
+}
+
+func (t *sliceTable[T]) cell(row, column int) tableCell {
+	if row < 0 || row >= len(t.rows) || column < 0 || column >= len(t.columns) {
+		return tableCell{}
+	}
+	return t.columns[column].cell(t.rows[row])
+}
+
+// sort sorts the rows by the raw values of a column. Equal values keep
+// their order.
+func (t *sliceTable[T]) sort(column int, descending bool) {
+	if column < 0 || column >= len(t.columns) {
+		return
+	}
+	c := t.columns[column]
+	sort.SliceStable(t.rows, func(i, j int) bool {
+		a, b := c.cell(t.rows[i]).value, c.cell(t.rows[j]).value
+		if descending {
+			a, b = b, a
+		}
+		return compareValues(a, b) < 0
+	})
+}
+
+// compareValues compares two raw values of a column, strings ignoring
+// case, and returns -1, 0 or 1.
+func compareValues(a, b interface{}) int {
+	switch a := a.(type) {
+	case int64:
+		b, _ := b.(int64)
+		switch {
+		case a < b:
+			return -1
+		case a > b:
+			return 1
+		}
+		return 0
+	case bool:
+		b, _ := b.(bool)
+		switch {
+		case a == b:
+			return 0
+		case !a:
+			return -1
+		}
+		return 1
+	case string:
+		b, _ := b.(string)
+		if c := strings.Compare(strings.ToLower(a), strings.ToLower(b)); c != 0 {
+			return c
+		}
+		return strings.Compare(a, b)
+	}
+	return 0
+}
@@ -0,0 +1,104 @@
+// Copyright 2016 Cory Robinson. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE.txt file.
+
+// tableModel.go implements the Qt side of the tables of tableColumn.go:
+// TableModel shows a tableSource, i.e. the line items of an invoice, and
+// cellData is the data of a cell for each role, for TableModel and
+// InvoiceTableModel alike.
+
+package main
+
+import (
+	"fmt"
+
+	"github.com/therecipe/qt/core"
+	"github.com/therecipe/qt/gui"
+)
+
+type TableModel struct {
+	core.QAbstractTableModel
+
+	_ func() `constructor:"init"`
+
+	source tableSource
+}
+
+// init() connects the model to an empty source.
+func (m *TableModel) init() {
+	m.source = newSliceTable(Items(nil), itemColumnsNone)
+
+	m.ConnectRowCount(m.rowCount)
+	m.ConnectColumnCount(m.columnCount)
+	m.ConnectData(m.data)
+	m.ConnectHeaderData(m.headerData)
+	m.ConnectSort(m.sort)
+}
+
+// setSource() resets the model with the rows and columns of a new source.
+func (m *TableModel) setSource(source tableSource) {
+	m.BeginResetModel()
+	m.source = source
+	m.EndResetModel()
+}
+
+func (m *TableModel) rowCount(parent *core.QModelIndex) int {
+	if parent.IsValid() {
+		return 0
+	}
+	return m.source.rowCount()
+}
+
+func (m *TableModel) columnCount(parent *core.QModelIndex) int {
+	if parent.IsValid() {
+		return 0
+	}
+	return m.source.columnCount()
+}
+
+func (m *TableModel) data(index *core.QModelIndex, role int) *core.QVariant {
+	return cellData(m.source.cell(index.Row(), index.Column()), role)
+}
+
+func (m *TableModel) headerData(section int, orientation core.Qt__Orientation, role int) *core.QVariant {
+	if role != int(core.Qt__DisplayRole) || orientation != core.Qt__Horizontal {
+		return m.HeaderDataDefault(section, orientation, role)
+	}
+	return core.NewQVariant14(m.source.title(section))
+}
+
+// sort() sorts the rows by the raw values of a column.
+func (m *TableModel) sort(column int, order core.Qt__SortOrder) {
+	m.BeginResetModel()
+	m.source.sort(column, order == core.Qt__DescendingOrder)
+	m.EndResetModel()
+}
+
+// cellData returns the data of a cell for a role: its text for display,
+// its raw value, i.e. cents for an amount, for editing and for the user
+// role, and its alignment and color.
+func cellData(cell tableCell, role int) *core.QVariant {
+	switch role {
+	case int(core.Qt__DisplayRole):
+		return core.NewQVariant14(cell.text)
+	case int(core.Qt__EditRole), int(core.Qt__UserRole):
+		switch value := cell.value.(type) {
+		case int64:
+			return core.NewQVariant7(value)
+		case bool:
+			return core.NewQVariant9(value)
+		case string:
+			return core.NewQVariant14(value)
+		}
+	case int(core.Qt__TextAlignmentRole):
+		if cell.numeric {
+			return core.NewQVariant5(int(core.Qt__AlignRight | core.Qt__AlignVCenter))
+		}
+	case int(core.Qt__ForegroundRole):
+		var r, g, b int
+		if _, err := fmt.Sscanf(cell.color, "#%02x%02x%02x", &r, &g, &b); err == nil {
+			return gui.NewQColor3(r, g, b, 255).ToVariant()
+		}
+	}
+	return core.NewQVariant()
+}
@@ -0,0 +1,722 @@
+// Copyright 2016 Cory Robinson. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE.txt file.
+
+// ubl.go implements reading and writing UBL 2.1 Invoice and CreditNote
+// documents following the Peppol BIS Billing 3.0 profile. Documents are
+// mapped onto Invoice, with the vendor being the seller (the
+// AccountingSupplierParty) and Buyer the AccountingCustomerParty.
+//
+// ValidateUBL checks a document against a subset of the EN 16931 and Peppol
+// BIS 3.0 business rules, in the style of their schematron: each failed
+// rule is reported with its rule id and the path of the offending field.
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// UBL namespaces and Peppol BIS Billing 3.0 identifiers.
+const (
+	ublInvoiceNS    = "urn:oasis:names:specification:ubl:schema:xsd:Invoice-2"
+	ublCreditNoteNS = "urn:oasis:names:specification:ubl:schema:xsd:CreditNote-2"
+	ublCacNS        = "urn:oasis:names:specification:ubl:schema:xsd:CommonAggregateComponents-2"
+	ublCbcNS        = "urn:oasis:names:specification:ubl:schema:xsd:CommonBasicComponents-2"
+
+	peppolCustomizationID = "urn:cen.eu:en16931:2017#compliant#urn:fdc:peppol.eu:2017:poacc:billing:3.0"
+	peppolProfileID       = "urn:fdc:peppol.eu:2017:poacc:billing:01:1.0"
+)
+
+// ublTaxCategories are the UNCL5305 tax category codes allowed by Peppol.
+var ublTaxCategories = map[string]bool{
+	"S": true, "Z": true, "E": true, "AE": true, "K": true,
+	"G": true, "O": true, "L": true, "M": true,
+}
+
+// UBLError is a failed business rule or a mapping problem in a UBL
+// document. Field is the path of the element the rule applies to.
+type UBLError struct {
+	Rule  string
+	Field string
+	Msg   string
+}
+
+func (e UBLError) Error() string {
+	return fmt.Sprintf("[%s] %s: %s", e.Rule, e.Field, e.Msg)
+}
+
+// ReadUBL parses a UBL Invoice or CreditNote, validates it and maps it onto
+// an Invoice. Validation errors are returned alongside the invoice; err is
+// only set if the document could not be read at all.
+func ReadUBL(r io.Reader) (Invoice, []UBLError, error) {
+	doc, err := parseXML(r)
+	if err != nil {
+		return Invoice{}, nil, err
+	}
+	if doc.Local() != "Invoice" && doc.Local() != "CreditNote" {
+		return Invoice{}, nil, fmt.Errorf("not a UBL invoice: root element is %s", doc.Local())
+	}
+
+	errs := ValidateUBL(doc)
+	invoice, mapErrs := ublToInvoice(doc)
+
+	return invoice, append(errs, mapErrs...), nil
+}
+
+// ublToInvoice maps a UBL document onto an Invoice.
+func ublToInvoice(doc *xmlNode) (Invoice, []UBLError) {
+	var errs []UBLError
+	invoice := Invoice{CreditNote: doc.Local() == "CreditNote"}
+
+	amount := func(path string) int64 {
+		value := doc.Value(path)
+		if value == "" {
+			return 0
+		}
+		cents, err := parseDecimalCents(value)
+		if err != nil {
+			errs = append(errs, UBLError{"MAP", path, err.Error()})
+		}
+		return cents
+	}
+	date := func(path string) string {
+		value := doc.Value(path)
+		if value == "" {
+			return ""
+		}
+		t, err := time.Parse("2006-01-02", value)
+		if err != nil {
+			errs = append(errs, UBLError{"MAP", path, fmt.Sprintf("%q is not a valid date", value)})
+			return ""
+		}
+		return t.Format("01/02/2006")
+	}
+
+	invoice.InvoiceNo = doc.Value("cbc:ID")
+	invoice.Date = date("cbc:IssueDate")
+	invoice.DueDate = date("cbc:DueDate")
+	if invoice.DueDate == "" {
+		invoice.DueDate = date("cac:PaymentMeans/cbc:PaymentDueDate")
+	}
+	invoice.Currency = doc.Value("cbc:DocumentCurrencyCode")
+	invoice.PurchaseOrder = doc.Value("cac:OrderReference/cbc:ID")
+
+	seller := ublParty(doc.Find("cac:AccountingSupplierParty/cac:Party"))
+	invoice.Vendor = seller.Name
+	invoice.Address = seller.Address
+	invoice.VendorIDs = seller.IDs
+	invoice.VendorIDs.BankAccount = doc.Value("cac:PaymentMeans/cac:PayeeFinancialAccount/cbc:ID")
+	invoice.Buyer = ublParty(doc.Find("cac:AccountingCustomerParty/cac:Party"))
+
+	invoice.TaxTotal = amount("cac:TaxTotal/cbc:TaxAmount")
+	invoice.Total = amount("cac:LegalMonetaryTotal/cbc:TaxInclusiveAmount")
+	prepaid := amount("cac:LegalMonetaryTotal/cbc:PrepaidAmount")
+	invoice.Paid = invoice.Total != 0 && prepaid == invoice.Total
+
+	lineName, quantityName := "cac:InvoiceLine", "cbc:InvoicedQuantity"
+	if invoice.CreditNote {
+		lineName, quantityName = "cac:CreditNoteLine", "cbc:CreditedQuantity"
+	}
+	for i, line := range doc.FindAll(lineName) {
+		field := fmt.Sprintf("%s[%d]", lineName, i+1)
+		var item Item
+
+		item.ProductID = line.Value("cac:Item/cac:SellersItemIdentification/cbc:ID")
+		if item.ProductID == "" {
+			item.ProductID = line.Value("cac:Item/cac:StandardItemIdentification/cbc:ID")
+		}
+		item.Description = line.Value("cac:Item/cbc:Name")
+		if item.Description == "" {
+			item.Description = line.Value("cac:Item/cbc:Description")
+		}
+
+		item.UnitCode = line.Find(quantityName).Attr("unitCode")
+		err := setLineAmounts(&item, line.Value(quantityName), line.Value("cac:Price/cbc:PriceAmount"),
+			line.Value("cac:Price/cbc:BaseQuantity"), line.Value("cbc:LineExtensionAmount"))
+		if err != nil {
+			errs = append(errs, UBLError{"MAP", field, err.Error()})
+		}
+
+		item.TaxCategory = line.Value("cac:Item/cac:ClassifiedTaxCategory/cbc:ID")
+		if percent := line.Value("cac:Item/cac:ClassifiedTaxCategory/cbc:Percent"); percent != "" {
+			item.TaxPercent, _ = strconv.ParseFloat(percent, 64)
+		}
+
+		invoice.LineItems = append(invoice.LineItems, item)
+	}
+
+	return invoice, errs
+}
+
+// ublParty maps a cac:Party element onto a Party.
+func ublParty(party *xmlNode) Party {
+	if party == nil {
+		return Party{}
+	}
+
+	name := party.Value("cac:PartyName/cbc:Name")
+	if name == "" {
+		name = party.Value("cac:PartyLegalEntity/cbc:RegistrationName")
+	}
+
+	street := party.Value("cac:PostalAddress/cbc:StreetName")
+	if extra := party.Value("cac:PostalAddress/cbc:AdditionalStreetName"); extra != "" {
+		street += ", " + extra
+	}
+
+	return Party{
+		Name: name,
+		Address: Location{
+			Street:  street,
+			City:    party.Value("cac:PostalAddress/cbc:CityName"),
+			State:   party.Value("cac:PostalAddress/cbc:CountrySubentity"),
+			Zipcode: party.Value("cac:PostalAddress/cbc:PostalZone"),
+			Country: party.Value("cac:PostalAddress/cac:Country/cbc:IdentificationCode"),
+		},
+		IDs: PartyIDs{
+			EndpointID:     party.Value("cbc:EndpointID"),
+			EndpointScheme: party.Find("cbc:EndpointID").Attr("schemeID"),
+			TaxID:          party.Value("cac:PartyTaxScheme/cbc:CompanyID"),
+			LegalID:        party.Value("cac:PartyLegalEntity/cbc:CompanyID"),
+		},
+	}
+}
+
+// ublTaxSubtotal is the tax for one tax category and rate.
+type ublTaxSubtotal struct {
+	category string
+	percent  float64
+	taxable  int64
+	tax      int64
+}
+
+// ublTaxSubtotals groups the line items by tax category and rate. Items
+// without a category count as zero rated.
+func ublTaxSubtotals(items Items) []ublTaxSubtotal {
+	index := map[string]int{}
+	var subtotals []ublTaxSubtotal
+
+	for _, item := range items {
+		category := item.TaxCategory
+		if category == "" {
+			category = "Z"
+		}
+		key := fmt.Sprintf("%s/%g", category, item.TaxPercent)
+		i, ok := index[key]
+		if !ok {
+			i = len(subtotals)
+			index[key] = i
+			subtotals = append(subtotals, ublTaxSubtotal{category: category, percent: item.TaxPercent})
+		}
+		subtotals[i].taxable += int64(item.Quantity) * item.Amount
+	}
+
+	for i := range subtotals {
+		subtotals[i].tax = int64(math.Round(float64(subtotals[i].taxable) * subtotals[i].percent / 100))
+	}
+	sort.Slice(subtotals, func(i, j int) bool { return subtotals[i].category < subtotals[j].category })
+
+	return subtotals
+}
+
+// InvoiceToUBL builds a Peppol BIS 3.0 UBL document for the invoice. The
+// tax breakdown is computed from the line items' tax categories and rates.
+func InvoiceToUBL(invoice Invoice) *xmlNode {
+	root, lineName, quantityName, typeCode := "Invoice", "cac:InvoiceLine", "cbc:InvoicedQuantity", "cbc:InvoiceTypeCode"
+	namespace, code := ublInvoiceNS, "380"
+	if invoice.CreditNote {
+		root, lineName, quantityName, typeCode = "CreditNote", "cac:CreditNoteLine", "cbc:CreditedQuantity", "cbc:CreditNoteTypeCode"
+		namespace, code = ublCreditNoteNS, "381"
+	}
+
+	currency := invoice.Currency
+	if currency == "" {
+		currency = "USD"
+	}
+	money := func(cents int64) string { return centsString(cents) }
+
+	doc := &xmlNode{Name: root}
+	doc.Attrs = append(doc.Attrs,
+		xmlAttr("xmlns", namespace),
+		xmlAttr("xmlns:cac", ublCacNS),
+		xmlAttr("xmlns:cbc", ublCbcNS))
+
+	doc.Add("cbc:CustomizationID", peppolCustomizationID)
+	doc.Add("cbc:ProfileID", peppolProfileID)
+	doc.Add("cbc:ID", invoice.InvoiceNo)
+	doc.Add("cbc:IssueDate", isoDate(invoice.Date))
+	if !invoice.CreditNote {
+		doc.AddValue("cbc:DueDate", isoDate(invoice.DueDate))
+	}
+	doc.Add(typeCode, code)
+	doc.Add("cbc:DocumentCurrencyCode", currency)
+	if invoice.PurchaseOrder != "" {
+		doc.Add("cac:OrderReference", "").Add("cbc:ID", invoice.PurchaseOrder)
+	}
+
+	seller := Party{Name: invoice.Vendor, Address: invoice.Address, IDs: invoice.VendorIDs}
+	addUBLParty(doc.Add("cac:AccountingSupplierParty", ""), seller)
+	addUBLParty(doc.Add("cac:AccountingCustomerParty", ""), invoice.Buyer)
+
+	if invoice.CreditNote && invoice.DueDate != "" {
+		doc.Add("cac:PaymentMeans", "").Add("cbc:PaymentDueDate", isoDate(invoice.DueDate))
+	}
+
+	subtotal := lineItemsTotal(invoice.LineItems)
+	subtotals := ublTaxSubtotals(invoice.LineItems)
+	var tax int64
+	for _, s := range subtotals {
+		tax += s.tax
+	}
+
+	taxTotal := doc.Add("cac:TaxTotal", "")
+	taxTotal.Add("cbc:TaxAmount", money(tax), "currencyID", currency)
+	for _, s := range subtotals {
+		sub := taxTotal.Add("cac:TaxSubtotal", "")
+		sub.Add("cbc:TaxableAmount", money(s.taxable), "currencyID", currency)
+		sub.Add("cbc:TaxAmount", money(s.tax), "currencyID", currency)
+		category := sub.Add("cac:TaxCategory", "")
+		category.Add("cbc:ID", s.category)
+		if s.category != "O" {
+			category.Add("cbc:Percent", formatPercent(s.percent))
+		}
+		if s.category == "E" || s.category == "AE" || s.category == "K" || s.category == "G" || s.category == "O" {
+			category.Add("cbc:TaxExemptionReasonCode", "VATEX-EU-"+s.category)
+		}
+		category.Add("cac:TaxScheme", "").Add("cbc:ID", "VAT")
+	}
+
+	totals := doc.Add("cac:LegalMonetaryTotal", "")
+	totals.Add("cbc:LineExtensionAmount", money(subtotal), "currencyID", currency)
+	totals.Add("cbc:TaxExclusiveAmount", money(subtotal), "currencyID", currency)
+	totals.Add("cbc:TaxInclusiveAmount", money(subtotal+tax), "currencyID", currency)
+	payable := subtotal + tax
+	if invoice.Paid {
+		totals.Add("cbc:PrepaidAmount", money(payable), "currencyID", currency)
+		payable = 0
+	}
+	totals.Add("cbc:PayableAmount", money(payable), "currencyID", currency)
+
+	for i, item := range invoice.LineItems {
+		line := doc.Add(lineName, "")
+		line.Add("cbc:ID", strconv.Itoa(i+1))
+		unitCode := item.UnitCode
+		if unitCode == "" {
+			unitCode = "C62"
+		}
+		line.Add(quantityName, strconv.Itoa(int(item.Quantity)), "unitCode", unitCode)
+		line.Add("cbc:LineExtensionAmount", money(int64(item.Quantity)*item.Amount), "currencyID", currency)
+
+		ublItem := line.Add("cac:Item", "")
+		name := item.Description
+		if name == "" {
+			name = item.ProductID
+		}
+		ublItem.Add("cbc:Name", name)
+		if item.ProductID != "" {
+			ublItem.Add("cac:SellersItemIdentification", "").Add("cbc:ID", item.ProductID)
+		}
+		category := ublItem.Add("cac:ClassifiedTaxCategory", "")
+		taxCategory := item.TaxCategory
+		if taxCategory == "" {
+			taxCategory = "Z"
+		}
+		category.Add("cbc:ID", taxCategory)
+		if taxCategory != "O" {
+			category.Add("cbc:Percent", formatPercent(item.TaxPercent))
+		}
+		category.Add("cac:TaxScheme", "").Add("cbc:ID", "VAT")
+
+		line.Add("cac:Price", "").Add("cbc:PriceAmount", money(item.Amount), "currencyID", currency)
+	}
+
+	return doc
+}
+
+// addUBLParty adds a cac:Party element for the party to parent.
+func addUBLParty(parent *xmlNode, party Party) {
+	node := parent.Add("cac:Party", "")
+	if party.IDs.EndpointID != "" {
+		node.Add("cbc:EndpointID", party.IDs.EndpointID, "schemeID", party.IDs.EndpointScheme)
+	}
+	if party.Name != "" {
+		node.Add("cac:PartyName", "").Add("cbc:Name", party.Name)
+	}
+
+	address := node.Add("cac:PostalAddress", "")
+	address.AddValue("cbc:StreetName", party.Address.Street)
+	address.AddValue("cbc:CityName", party.Address.City)
+	address.AddValue("cbc:PostalZone", party.Address.Zipcode)
+	address.AddValue("cbc:CountrySubentity", party.Address.State)
+	if party.Address.Country != "" {
+		// left out otherwise, so the document fails BR-09 or BR-11
+		// rather than naming a country that may be wrong
+		address.Add("cac:Country", "").Add("cbc:IdentificationCode", party.Address.Country)
+	}
+
+	if party.IDs.TaxID != "" {
+		taxScheme := node.Add("cac:PartyTaxScheme", "")
+		taxScheme.Add("cbc:CompanyID", party.IDs.TaxID)
+		taxScheme.Add("cac:TaxScheme", "").Add("cbc:ID", "VAT")
+	}
+
+	legal := node.Add("cac:PartyLegalEntity", "")
+	legal.Add("cbc:RegistrationName", party.Name)
+	legal.AddValue("cbc:CompanyID", party.IDs.LegalID)
+}
+
+// WriteUBL writes the invoice as a UBL document.
+func WriteUBL(w io.Writer, invoice Invoice) error {
+	return InvoiceToUBL(invoice).Write(w)
+}
+
+// ReadUBLFile reads a UBL document from a file, see ReadUBL.
+func ReadUBLFile(name string) (Invoice, []UBLError, error) {
+	file, err := os.Open(name)
+	if err != nil {
+		return Invoice{}, nil, err
+	}
+	defer file.Close()
+
+	return ReadUBL(file)
+}
+
+// CheckUBL returns the business rules the UBL document of the invoice
+// fails, to check an invoice before sending it.
+func CheckUBL(invoice Invoice) []UBLError {
+	return ValidateUBL(InvoiceToUBL(invoice))
+}
+
+// WriteUBLFile writes the invoice as a UBL document file.
+func WriteUBLFile(name string, invoice Invoice) error {
+	file, err := os.Create(name)
+	if err != nil {
+		return err
+	}
+
+	err = WriteUBL(file, invoice)
+	if cerr := file.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(name)
+	}
+
+	return err
+}
+
+// ublFileName returns a file name for an invoice's UBL document.
+func ublFileName(invoice Invoice) string {
+	return strings.TrimSuffix(pdfFileName(invoice), ".pdf") + ".xml"
+}
+
+// ublRule is one business rule. test is run on every element matching
+// context and returns false if the rule fails; field is the path, relative
+// to the context element, reported for a failure.
+type ublRule struct {
+	id      string
+	context string
+	field   string
+	msg     string
+	test    func(ctx *xmlNode) bool
+}
+
+// exists returns a rule test checking that the path has a value.
+func exists(path string) func(*xmlNode) bool {
+	return func(ctx *xmlNode) bool { return ctx.Value(path) != "" }
+}
+
+// ublAmount parses the amount at path, treating a missing amount as zero.
+func ublAmount(ctx *xmlNode, path string) float64 {
+	value, _ := strconv.ParseFloat(ctx.Value(path), 64)
+	return value
+}
+
+// sameAmount compares two amounts to the cent.
+func sameAmount(a, b float64) bool {
+	return math.Abs(a-b) < 0.005
+}
+
+// ublRules is the subset of the EN 16931 and Peppol BIS 3.0 rules that is
+// checked. A context of "" is the document root; the line context is
+// filled in for invoices and credit notes.
+var ublRules = []ublRule{
+	{"BR-01", "", "cbc:CustomizationID", "specification identifier is required", exists("cbc:CustomizationID")},
+	{"PEPPOL-EN16931-R001", "", "cbc:ProfileID", "business process is required", exists("cbc:ProfileID")},
+	{"BR-02", "", "cbc:ID", "invoice number is required", exists("cbc:ID")},
+	{"BR-03", "", "cbc:IssueDate", "issue date is required", exists("cbc:IssueDate")},
+	{"PEPPOL-EN16931-F001", "", "cbc:IssueDate", "date must be formatted YYYY-MM-DD", func(ctx *xmlNode) bool {
+		_, err := time.Parse("2006-01-02", ctx.Value("cbc:IssueDate"))
+		return ctx.Value("cbc:IssueDate") == "" || err == nil
+	}},
+	{"BR-04", "", "cbc:InvoiceTypeCode", "invoice type code is required", func(ctx *xmlNode) bool {
+		return ctx.Value("cbc:InvoiceTypeCode") != "" || ctx.Value("cbc:CreditNoteTypeCode") != ""
+	}},
+	{"BR-05", "", "cbc:DocumentCurrencyCode", "invoice currency code is required", exists("cbc:DocumentCurrencyCode")},
+	{"PEPPOL-EN16931-R051", "", "@currencyID", "all amounts must be in the invoice currency", func(ctx *xmlNode) bool {
+		currency := ctx.Value("cbc:DocumentCurrencyCode")
+		return currency == "" || ublCurrenciesMatch(ctx, currency)
+	}},
+	{"BR-06", "cac:AccountingSupplierParty/cac:Party", "cac:PartyLegalEntity/cbc:RegistrationName",
+		"seller name is required", exists("cac:PartyLegalEntity/cbc:RegistrationName")},
+	{"PEPPOL-EN16931-R020", "cac:AccountingSupplierParty/cac:Party", "cbc:EndpointID",
+		"seller electronic address is required", exists("cbc:EndpointID")},
+	{"BR-62", "cac:AccountingSupplierParty/cac:Party", "cbc:EndpointID/@schemeID",
+		"seller electronic address must have a scheme identifier", func(ctx *xmlNode) bool {
+			return ctx.Find("cbc:EndpointID") == nil || ctx.Find("cbc:EndpointID").Attr("schemeID") != ""
+		}},
+	{"BR-08", "cac:AccountingSupplierParty/cac:Party", "cac:PostalAddress",
+		"seller postal address is required", func(ctx *xmlNode) bool { return ctx.Find("cac:PostalAddress") != nil }},
+	{"BR-09", "cac:AccountingSupplierParty/cac:Party", "cac:PostalAddress/cac:Country/cbc:IdentificationCode",
+		"seller country code is required", exists("cac:PostalAddress/cac:Country/cbc:IdentificationCode")},
+	{"BR-07", "cac:AccountingCustomerParty/cac:Party", "cac:PartyLegalEntity/cbc:RegistrationName",
+		"buyer name is required", exists("cac:PartyLegalEntity/cbc:RegistrationName")},
+	{"PEPPOL-EN16931-R010", "cac:AccountingCustomerParty/cac:Party", "cbc:EndpointID",
+		"buyer electronic address is required", exists("cbc:EndpointID")},
+	{"BR-63", "cac:AccountingCustomerParty/cac:Party", "cbc:EndpointID/@schemeID",
+		"buyer electronic address must have a scheme identifier", func(ctx *xmlNode) bool {
+			return ctx.Find("cbc:EndpointID") == nil || ctx.Find("cbc:EndpointID").Attr("schemeID") != ""
+		}},
+	{"BR-10", "cac:AccountingCustomerParty/cac:Party", "cac:PostalAddress",
+		"buyer postal address is required", func(ctx *xmlNode) bool { return ctx.Find("cac:PostalAddress") != nil }},
+	{"BR-11", "cac:AccountingCustomerParty/cac:Party", "cac:PostalAddress/cac:Country/cbc:IdentificationCode",
+		"buyer country code is required", exists("cac:PostalAddress/cac:Country/cbc:IdentificationCode")},
+	{"BR-12", "cac:LegalMonetaryTotal", "cbc:LineExtensionAmount", "sum of line net amounts is required", exists("cbc:LineExtensionAmount")},
+	{"BR-13", "cac:LegalMonetaryTotal", "cbc:TaxExclusiveAmount", "total without VAT is required", exists("cbc:TaxExclusiveAmount")},
+	{"BR-14", "cac:LegalMonetaryTotal", "cbc:TaxInclusiveAmount", "total with VAT is required", exists("cbc:TaxInclusiveAmount")},
+	{"BR-15", "cac:LegalMonetaryTotal", "cbc:PayableAmount", "amount due is required", exists("cbc:PayableAmount")},
+	{"BR-16", "", "cac:InvoiceLine", "at least one invoice line is required", func(ctx *xmlNode) bool {
+		return len(ctx.FindAll("cac:InvoiceLine"))+len(ctx.FindAll("cac:CreditNoteLine")) > 0
+	}},
+	{"BR-CO-10", "", "cac:LegalMonetaryTotal/cbc:LineExtensionAmount",
+		"must equal the sum of the line net amounts", func(ctx *xmlNode) bool {
+			var sum float64
+			for _, line := range append(ctx.FindAll("cac:InvoiceLine"), ctx.FindAll("cac:CreditNoteLine")...) {
+				sum += ublAmount(line, "cbc:LineExtensionAmount")
+			}
+			return sameAmount(sum, ublAmount(ctx, "cac:LegalMonetaryTotal/cbc:LineExtensionAmount"))
+		}},
+	{"BR-CO-15", "", "cac:LegalMonetaryTotal/cbc:TaxInclusiveAmount",
+		"must equal the total without VAT plus the VAT total", func(ctx *xmlNode) bool {
+			var tax float64
+			for _, total := range ctx.FindAll("cac:TaxTotal") {
+				if total.Find("cbc:TaxAmount").Attr("currencyID") == ctx.Value("cbc:DocumentCurrencyCode") {
+					tax += ublAmount(total, "cbc:TaxAmount")
+				}
+			}
+			return sameAmount(ublAmount(ctx, "cac:LegalMonetaryTotal/cbc:TaxExclusiveAmount")+tax,
+				ublAmount(ctx, "cac:LegalMonetaryTotal/cbc:TaxInclusiveAmount"))
+		}},
+	{"BR-CO-16", "cac:LegalMonetaryTotal", "cbc:PayableAmount",
+		"must equal the total with VAT minus the paid amount", func(ctx *xmlNode) bool {
+			return sameAmount(ublAmount(ctx, "cbc:TaxInclusiveAmount")-ublAmount(ctx, "cbc:PrepaidAmount")+
+				ublAmount(ctx, "cbc:PayableRoundingAmount"), ublAmount(ctx, "cbc:PayableAmount"))
+		}},
+	{"BR-CO-26", "cac:AccountingSupplierParty/cac:Party", "cac:PartyTaxScheme/cbc:CompanyID",
+		"seller VAT identifier, legal registration or identifier is required when a VAT category needs one",
+		func(ctx *xmlNode) bool {
+			return ctx.Value("cac:PartyTaxScheme/cbc:CompanyID") != "" ||
+				ctx.Value("cac:PartyLegalEntity/cbc:CompanyID") != "" ||
+				ctx.Value("cac:PartyIdentification/cbc:ID") != ""
+		}},
+	{"BR-CO-18", "", "cac:TaxTotal/cac:TaxSubtotal", "at least one VAT breakdown is required", exists("cac:TaxTotal/cac:TaxSubtotal/cbc:TaxAmount")},
+	{"BR-S-02", "", "cac:AccountingSupplierParty/cac:Party/cac:PartyTaxScheme/cbc:CompanyID",
+		"seller VAT identifier is required for standard rated items", ublVATIDRequired("S")},
+	{"BR-Z-02", "", "cac:AccountingSupplierParty/cac:Party/cac:PartyTaxScheme/cbc:CompanyID",
+		"seller VAT identifier is required for zero rated items", ublVATIDRequired("Z")},
+	{"BR-E-02", "", "cac:AccountingSupplierParty/cac:Party/cac:PartyTaxScheme/cbc:CompanyID",
+		"seller VAT identifier is required for exempt items", ublVATIDRequired("E")},
+	{"BR-21", "line", "cbc:ID", "line identifier is required", exists("cbc:ID")},
+	{"BR-22", "line", "quantity", "invoiced quantity is required", func(ctx *xmlNode) bool {
+		return ctx.Value("cbc:InvoicedQuantity") != "" || ctx.Value("cbc:CreditedQuantity") != ""
+	}},
+	{"BR-23", "line", "quantity/@unitCode", "unit of measure is required", func(ctx *xmlNode) bool {
+		return ctx.Find("cbc:InvoicedQuantity").Attr("unitCode") != "" ||
+			ctx.Find("cbc:CreditedQuantity").Attr("unitCode") != ""
+	}},
+	{"BR-24", "line", "cbc:LineExtensionAmount", "line net amount is required", exists("cbc:LineExtensionAmount")},
+	{"BR-25", "line", "cac:Item/cbc:Name", "item name is required", exists("cac:Item/cbc:Name")},
+	{"BR-26", "line", "cac:Price/cbc:PriceAmount", "item net price is required", exists("cac:Price/cbc:PriceAmount")},
+	{"BR-27", "line", "cac:Price/cbc:PriceAmount", "item net price must not be negative", func(ctx *xmlNode) bool {
+		return ublAmount(ctx, "cac:Price/cbc:PriceAmount") >= 0
+	}},
+	{"BR-CO-04", "line", "cac:Item/cac:ClassifiedTaxCategory/cbc:ID", "line VAT category is required",
+		exists("cac:Item/cac:ClassifiedTaxCategory/cbc:ID")},
+	{"PEPPOL-EN16931-CL006", "line", "cac:Item/cac:ClassifiedTaxCategory/cbc:ID", "VAT category code must be a UNCL5305 code",
+		func(ctx *xmlNode) bool {
+			category := ctx.Value("cac:Item/cac:ClassifiedTaxCategory/cbc:ID")
+			return category == "" || ublTaxCategories[category]
+		}},
+	{"PEPPOL-EN16931-R120", "line", "cbc:LineExtensionAmount",
+		"line net amount must equal quantity times net price", func(ctx *xmlNode) bool {
+			quantity := ublAmount(ctx, "cbc:InvoicedQuantity") + ublAmount(ctx, "cbc:CreditedQuantity")
+			price := ublAmount(ctx, "cac:Price/cbc:PriceAmount")
+			if base := ublAmount(ctx, "cac:Price/cbc:BaseQuantity"); base != 0 {
+				price /= base
+			}
+			return sameAmount(quantity*price, ublAmount(ctx, "cbc:LineExtensionAmount"))
+		}},
+}
+
+// ublVATIDRequired returns a rule test failing when a line uses the tax
+// category but the seller has no VAT identifier.
+func ublVATIDRequired(category string) func(*xmlNode) bool {
+	return func(ctx *xmlNode) bool {
+		used := false
+		for _, line := range append(ctx.FindAll("cac:InvoiceLine"), ctx.FindAll("cac:CreditNoteLine")...) {
+			if line.Value("cac:Item/cac:ClassifiedTaxCategory/cbc:ID") == category {
+				used = true
+			}
+		}
+		return !used || ctx.Value("cac:AccountingSupplierParty/cac:Party/cac:PartyTaxScheme/cbc:CompanyID") != ""
+	}
+}
+
+// ublCurrenciesMatch reports whether every currencyID outside of the tax
+// totals in another currency matches the invoice currency.
+func ublCurrenciesMatch(n *xmlNode, currency string) bool {
+	if id := n.Attr("currencyID"); id != "" && id != currency && n.Local() != "TaxAmount" {
+		return false
+	}
+	for _, child := range n.Children {
+		if !ublCurrenciesMatch(child, currency) {
+			return false
+		}
+	}
+	return true
+}
+
+// ValidateUBL checks a UBL document against ublRules.
+func ValidateUBL(doc *xmlNode) []UBLError {
+	lineName := "cac:InvoiceLine"
+	if doc.Local() == "CreditNote" {
+		lineName = "cac:CreditNoteLine"
+	}
+	return checkRules(doc, ublRules, lineName)
+}
+
+// checkRules runs the rules on a document, with lineName the path of the
+// elements used for the "line" context.
+func checkRules(doc *xmlNode, rules []ublRule, lineName string) []UBLError {
+	var errs []UBLError
+
+	for _, rule := range rules {
+		var contexts []*xmlNode
+		prefix := ""
+		switch rule.context {
+		case "":
+			contexts = []*xmlNode{doc}
+		case "line":
+			contexts = doc.FindAll(lineName)
+			prefix = lineName
+		default:
+			contexts = doc.FindAll(rule.context)
+			prefix = rule.context
+			if len(contexts) == 0 {
+				// a missing context element fails the rules on it
+				contexts = []*xmlNode{{}}
+			}
+		}
+
+		for i, ctx := range contexts {
+			if rule.test(ctx) {
+				continue
+			}
+			field := rule.field
+			if rule.context == "line" {
+				field = fmt.Sprintf("%s[%d]/%s", prefix, i+1, field)
+			} else if prefix != "" {
+				field = prefix + "/" + field
+			}
+			errs = append(errs, UBLError{rule.id, field, rule.msg})
+		}
+	}
+
+	return errs
+}
+
+// setLineAmounts sets the quantity and unit price of an item from those of
+// an e-invoice line. An Item holds a whole quantity of up to 65535 at a price
+// in whole cents; a line that does not fit, such as 2.5 hours or a price of
+// 0.125 per unit, becomes one unit at the line net amount, so the invoice
+// still adds up, and what was invoiced is added to the description.
+func setLineAmounts(item *Item, quantity, price, baseQuantity, lineAmount string) error {
+	q, err := strconv.ParseFloat(strings.TrimSpace(quantity), 64)
+	if err != nil {
+		return fmt.Errorf("%q is not a valid quantity", quantity)
+	}
+	p, err := strconv.ParseFloat(strings.TrimSpace(price), 64)
+	if err != nil {
+		return fmt.Errorf("%q is not a valid price", price)
+	}
+	if baseQuantity != "" {
+		if b, err := strconv.ParseFloat(strings.TrimSpace(baseQuantity), 64); err == nil && b != 0 {
+			p /= b
+		}
+	}
+
+	cents, whole := wholeCents(p)
+	if whole && q >= 0 && q <= math.MaxUint16 && q == math.Trunc(q) {
+		item.Quantity, item.Amount = uint16(q), cents
+		return nil
+	}
+
+	amount, err := strconv.ParseFloat(strings.TrimSpace(lineAmount), 64)
+	if err != nil {
+		return fmt.Errorf("%s at %s needs a valid line net amount, got %q", quantity, price, lineAmount)
+	}
+	cents, whole = wholeCents(amount)
+	if !whole {
+		return fmt.Errorf("line net amount %s is not a whole number of cents", lineAmount)
+	}
+	detail := quantity
+	if item.UnitCode != "" {
+		detail += " " + item.UnitCode
+	}
+	detail += " at " + price
+	if baseQuantity != "" {
+		detail += " per " + baseQuantity
+	}
+	item.Description = strings.TrimSpace(fmt.Sprintf("%s (%s)", item.Description, detail))
+	item.Quantity, item.Amount, item.UnitCode = 1, cents, "C62"
+	return nil
+}
+
+// wholeCents converts an amount to integer cents, and reports whether it
+// is a whole number of cents.
+func wholeCents(amount float64) (int64, bool) {
+	cents := math.Round(amount * 100)
+	return int64(cents), math.Abs(amount*100-cents) < 1e-6
+}
+
+// parseDecimalCents parses a decimal amount such as "12.5" or "0.4567" into
+// integer cents, rounding to the nearest cent.
+func parseDecimalCents(s string) (int64, error) {
+	value, err := strconv.ParseFloat(strings.TrimSpace(s), 64)
+	if err != nil {
+		return 0, fmt.Errorf("%q is not a valid amount", s)
+	}
+	return int64(math.Round(value * 100)), nil
+}
+
+// formatPercent formats a tax rate without trailing zeros, i.e. 25 or 12.5
+func formatPercent(percent float64) string {
+	return strconv.FormatFloat(percent, 'f', -1, 64)
+}
+
+// isoDate converts a MM/DD/YYYY date to YYYY-MM-DD. Dates in other formats
+// are returned unchanged.
+func isoDate(date string) string {
+	if t, err := time.Parse("01/02/2006", date); err == nil {
+		return t.Format("2006-01-02")
+	}
+	return date
+}
@@ -0,0 +1,102 @@
+// Copyright 2016 Cory Robinson. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE.txt file.
+
+package main
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// peppolInvoice returns an invoice with everything Peppol BIS 3.0 needs.
+func peppolInvoice() Invoice {
+	return Invoice{
+		Vendor:    "Niche Tools",
+		Address:   Location{Street: "1 Dock St", City: "Malmo", Zipcode: "21120", Country: "SE"},
+		VendorIDs: PartyIDs{EndpointID: "7300010000001", EndpointScheme: "0088", TaxID: "SE556677889901"},
+		Buyer: Party{Name: "Airpa Demo Co.", Address: Location{City: "Lund", Country: "SE"},
+			IDs: PartyIDs{EndpointID: "7300010000002", EndpointScheme: "0088"}},
+		InvoiceNo: "N-1", Date: "01/05/2018", DueDate: "02/04/2018", Currency: "SEK",
+		LineItems: Items{{ProductID: "H-1", Description: "hammer", Quantity: 2, Amount: 500,
+			UnitCode: "C62", TaxCategory: "S", TaxPercent: 25}},
+		TaxTotal: 250, Total: 1250,
+	}
+}
+
+func TestUBLRoundTrip(t *testing.T) {
+	invoice := peppolInvoice()
+	if errs := CheckUBL(invoice); len(errs) > 0 {
+		t.Fatalf("CheckUBL: %v", errs)
+	}
+
+	var doc bytes.Buffer
+	if err := WriteUBL(&doc, invoice); err != nil {
+		t.Fatalf("WriteUBL: %v", err)
+	}
+	got, errs, err := ReadUBL(&doc)
+	if err != nil || len(errs) > 0 {
+		t.Fatalf("ReadUBL: %v %v", err, errs)
+	}
+	if !reflect.DeepEqual(got, invoice) {
+		t.Errorf("read back\n%+v\nwant\n%+v", got, invoice)
+	}
+}
+
+func TestCheckUBLCountry(t *testing.T) {
+	invoice := peppolInvoice()
+	invoice.Address.Country = ""
+	invoice.Buyer.Address.Country = ""
+
+	var rules []string
+	for _, e := range CheckUBL(invoice) {
+		rules = append(rules, e.Rule)
+	}
+	if got := strings.Join(rules, ","); got != "BR-09,BR-11" {
+		t.Errorf("rules failed = %s, want BR-09,BR-11", got)
+	}
+}
+
+func TestSetLineAmounts(t *testing.T) {
+	tests := []struct {
+		name                              string
+		quantity, price, base, lineAmount string
+		want                              Item
+		wantError                         string
+	}{
+		{"whole", "3", "12.50", "", "37.50", Item{Description: "bolt", Quantity: 3, Amount: 1250, UnitCode: "HUR"}, ""},
+		{"base quantity", "10", "25.00", "100", "2.50", Item{Description: "bolt", Quantity: 10, Amount: 25, UnitCode: "HUR"}, ""},
+		{"fractional quantity", "2.5", "80.00", "", "200.00",
+			Item{Description: "bolt (2.5 HUR at 80.00)", Quantity: 1, Amount: 20000, UnitCode: "C62"}, ""},
+		{"sub-cent price", "12", "0.125", "", "1.50",
+			Item{Description: "bolt (12 HUR at 0.125)", Quantity: 1, Amount: 150, UnitCode: "C62"}, ""},
+		{"sub-cent base price", "7", "10.00", "12", "5.83",
+			Item{Description: "bolt (7 HUR at 10.00 per 12)", Quantity: 1, Amount: 583, UnitCode: "C62"}, ""},
+		{"huge quantity", "70000", "0.01", "", "700.00",
+			Item{Description: "bolt (70000 HUR at 0.01)", Quantity: 1, Amount: 70000, UnitCode: "C62"}, ""},
+		{"bad quantity", "two", "1.00", "", "2.00", Item{}, "not a valid quantity"},
+		{"bad price", "2", "", "", "2.00", Item{}, "not a valid price"},
+		{"no line amount", "2.5", "1.00", "", "", Item{}, "needs a valid line net amount"},
+		{"sub-cent line amount", "2.5", "0.001", "", "0.0025", Item{}, "not a whole number of cents"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			item := Item{Description: "bolt", UnitCode: "HUR"}
+			err := setLineAmounts(&item, tt.quantity, tt.price, tt.base, tt.lineAmount)
+			if tt.wantError != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantError) {
+					t.Errorf("setLineAmounts: got %v, want an error containing %q", err, tt.wantError)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("setLineAmounts: %v", err)
+			}
+			if item != tt.want {
+				t.Errorf("item = %+v, want %+v", item, tt.want)
+			}
+		})
+	}
+}
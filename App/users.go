@@ -0,0 +1,472 @@
+// Copyright 2016 Cory Robinson. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE.txt file.
+
+// users.go implements the user accounts of the app and the roles which
+// say what a user may change. Accounts are kept in the DB of a profile,
+// with bcrypt hashes of their passwords, or mapped to an account of the
+// operating system. The repository checks the role of the current user
+// before every change, and records the user on the invoices changed and
+// in the change log.
+//
+// Until the first account is added, the DB is open: everybody is an admin,
+// named after their OS account. Reading is not limited by the roles; who
+// may reach the DB at all is up to the DB server, see the credentials of
+// profiles.go.
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/user"
+	"strings"
+	"sync"
+
+	"golang.org/x/crypto/bcrypt"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// USERS is the name of the collection of user accounts in DB.
+const USERS = "users"
+
+// minPasswordLength is the length a password needs at least.
+const minPasswordLength = 8
+
+// Role says what a user may change.
+type Role string
+
+// The roles, each allowed what the role before it is, and more.
+const (
+	RoleViewer   Role = "viewer"   // reads only
+	RoleClerk    Role = "clerk"    // adds and changes invoices and drafts
+	RoleApprover Role = "approver" // marks invoices paid and deletes them
+	RoleAdmin    Role = "admin"    // manages the user accounts
+)
+
+// roles are the roles in order of what they are allowed.
+var roles = []Role{RoleViewer, RoleClerk, RoleApprover, RoleAdmin}
+
+// Action is a kind of change a role may be allowed.
+type Action string
+
+// The actions checked by the repository.
+const (
+	ActionAdd         Action = "add invoices"
+	ActionEdit        Action = "change invoices"
+	ActionPay         Action = "mark invoices paid"
+	ActionDelete      Action = "delete invoices"
+	ActionManageUsers Action = "manage users"
+	ActionManageKeys  Action = "manage the encryption keys"
+)
+
+// actionRoles are the least roles allowed the actions.
+var actionRoles = map[Action]Role{
+	ActionAdd:         RoleClerk,
+	ActionEdit:        RoleClerk,
+	ActionPay:         RoleApprover,
+	ActionDelete:      RoleApprover,
+	ActionManageUsers: RoleAdmin,
+	ActionManageKeys:  RoleAdmin,
+}
+
+// rank returns the place of the role in roles, or -1 for an unknown role.
+func (role Role) rank() int {
+	for i, r := range roles {
+		if r == role {
+			return i
+		}
+	}
+	return -1
+}
+
+// may reports whether the role is allowed the action.
+func (role Role) may(action Action) bool {
+	least, ok := actionRoles[action]
+	return ok && role.rank() >= least.rank()
+}
+
+// parseRole returns the role named s.
+func parseRole(s string) (Role, error) {
+	role := Role(strings.ToLower(strings.TrimSpace(s)))
+	if role.rank() < 0 {
+		return "", fmt.Errorf("unknown role %q, use one of viewer, clerk, approver, admin", s)
+	}
+	return role, nil
+}
+
+// User is a user account.
+type User struct {
+	Name         string `bson:"name" json:"name"`
+	Role         Role   `bson:"role" json:"role"`
+	OSUser       string `bson:"osuser,omitempty" json:"osuser,omitempty"` // logs in as this OS account without a password
+	PasswordHash []byte `bson:"passwordhash,omitempty" json:"-"`
+	Disabled     bool   `bson:"disabled,omitempty" json:"disabled,omitempty"`
+}
+
+// setPassword sets the hash of the user's password.
+func (u *User) setPassword(password string) error {
+	if len(password) < minPasswordLength {
+		return fmt.Errorf("the password must have at least %d characters", minPasswordLength)
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
+	u.PasswordHash = hash
+	return nil
+}
+
+// checkPassword reports whether password is the user's password.
+func (u User) checkPassword(password string) bool {
+	return len(u.PasswordHash) > 0 &&
+		bcrypt.CompareHashAndPassword(u.PasswordHash, []byte(password)) == nil
+}
+
+// check returns the user cleaned up, or an error naming the first field
+// which is not valid.
+func (u User) check() (User, error) {
+	u.Name = strings.TrimSpace(u.Name)
+	u.OSUser = strings.TrimSpace(u.OSUser)
+	if u.Name == "" || strings.ContainsAny(u.Name, " \t:") {
+		return u, errors.New("the user name must not be empty or contain spaces or colons")
+	}
+	role, err := parseRole(string(u.Role))
+	if err != nil {
+		return u, err
+	}
+	u.Role = role
+	if len(u.PasswordHash) == 0 && u.OSUser == "" {
+		return u, fmt.Errorf("user %s needs a password or an OS account", u.Name)
+	}
+	return u, nil
+}
+
+// PermissionError is the error of a user not allowed a change.
+type PermissionError struct {
+	User   string // "" if nobody could log in
+	Role   Role
+	Action Action
+	Err    error // why nobody could log in
+}
+
+func (e *PermissionError) Error() string {
+	if e.User == "" {
+		return fmt.Sprintf("log in to %s: %v", e.Action, e.Err)
+	}
+	return fmt.Sprintf("%s (%s) may not %s", e.User, e.Role, e.Action)
+}
+
+// The errors of logging in with a wrong or no password, as opposed to not
+// reaching the DB.
+var (
+	errWrongLogin = errors.New("wrong user name or password")
+	errNoLogin    = errors.New("log in with a user name and password")
+)
+
+// The user the repository makes changes as, see setCurrentUser. Commands
+// log in on the first change, see actor.
+var (
+	currentMu   sync.Mutex
+	currentUser *User
+)
+
+// setCurrentUser makes the user the current user, i.e. after logging in.
+// nil logs out.
+func setCurrentUser(u *User) {
+	currentMu.Lock()
+	defer currentMu.Unlock()
+	currentUser = u
+}
+
+// loggedInUser returns the current user, if one is logged in.
+func loggedInUser() (User, bool) {
+	currentMu.Lock()
+	defer currentMu.Unlock()
+	if currentUser == nil {
+		return User{}, false
+	}
+	return *currentUser, true
+}
+
+// osUserName returns the name of the OS account running the app.
+func osUserName() string {
+	if u, err := user.Current(); err == nil {
+		return u.Username
+	}
+	return os.Getenv("USER")
+}
+
+// openUser returns the user of an open DB, which has no accounts yet.
+func openUser() User {
+	return User{Name: osUserName(), Role: RoleAdmin}
+}
+
+// As returns the repository acting as the user instead of the current
+// user, i.e. for a request to the API.
+func (r Repository) As(u User) InvoiceStore {
+	r.as = &u
+	return r
+}
+
+// actor returns the user the repository acts as, see As, or else the
+// current user, logging in from the environment first if nobody has logged
+// in, i.e. for a command: with $INVOICE_USER and $INVOICE_PASSWORD, or else
+// as the OS account.
+func (r Repository) actor() (User, error) {
+	if r.as != nil {
+		return *r.as, nil
+	}
+	if u, ok := loggedInUser(); ok {
+		return u, nil
+	}
+
+	var u User
+	var err error
+	if name := os.Getenv("INVOICE_USER"); name != "" {
+		u, err = r.Login(name, os.Getenv("INVOICE_PASSWORD"))
+	} else {
+		var ok bool
+		u, ok, err = r.AutoLogin()
+		if err == nil && !ok {
+			err = errors.New("log in with $INVOICE_USER and $INVOICE_PASSWORD")
+		}
+	}
+	if err != nil {
+		return User{}, err
+	}
+	setCurrentUser(&u)
+	return u, nil
+}
+
+// Authorize returns an error unless the current user may take the action.
+func (r Repository) Authorize(action Action) error {
+	_, err := r.authorize(action)
+	return err
+}
+
+// authorize returns the current user if the user may take the action.
+func (r Repository) authorize(action Action) (User, error) {
+	u, err := r.actor()
+	if err != nil {
+		return u, &PermissionError{Action: action, Err: err}
+	}
+	if !u.Role.may(action) {
+		return u, &PermissionError{User: u.Name, Role: u.Role, Action: action}
+	}
+	return u, nil
+}
+
+// invoiceActions returns the actions of adding the invoice, or of changing
+// old into it. Marking an invoice paid, or not paid, takes an approver.
+func invoiceActions(invoice Invoice, old *Invoice) []Action {
+	actions := []Action{ActionAdd}
+	if old != nil {
+		actions[0] = ActionEdit
+	}
+	if old == nil && invoice.Paid || old != nil && old.Paid != invoice.Paid {
+		actions = append(actions, ActionPay)
+	}
+	return actions
+}
+
+// authorizeInvoice returns the current user if the user may add the
+// invoice, or change old into it.
+func (r Repository) authorizeInvoice(invoice Invoice, old *Invoice) (u User, err error) {
+	for _, action := range invoiceActions(invoice, old) {
+		if u, err = r.authorize(action); err != nil {
+			break
+		}
+	}
+	return u, err
+}
+
+// AutoLogin logs in without a password: as the account mapped to the OS
+// account running the app, or as an admin if the DB has no accounts yet.
+// ok is false if a password is needed.
+func (r Repository) AutoLogin() (u User, ok bool, err error) {
+	db := currentDB()
+	session, err := mgo.DialWithTimeout(db.Server, pingTimeout)
+	if err != nil {
+		return u, false, err
+	}
+	defer session.Close()
+
+	c := session.DB(db.Name).C(USERS)
+	n, err := c.Count()
+	if err != nil {
+		return u, false, err
+	}
+	if n == 0 {
+		return openUser(), true, nil
+	}
+
+	name := osUserName()
+	if name == "" {
+		return u, false, nil
+	}
+	err = c.Find(bson.M{"osuser": name, "disabled": bson.M{"$ne": true}}).One(&u)
+	if err == mgo.ErrNotFound {
+		return u, false, nil
+	}
+	return u, err == nil, err
+}
+
+// Login returns the user with the name if the password is right.
+func (r Repository) Login(name, password string) (User, error) {
+	db := currentDB()
+	session, err := mgo.DialWithTimeout(db.Server, pingTimeout)
+	if err != nil {
+		return User{}, err
+	}
+	defer session.Close()
+
+	var u User
+	err = session.DB(db.Name).C(USERS).Find(bson.M{"name": strings.TrimSpace(name)}).One(&u)
+	if err != nil && err != mgo.ErrNotFound {
+		return User{}, err
+	}
+	// the same answer for unknown users and wrong passwords
+	if err == mgo.ErrNotFound || u.Disabled || !u.checkPassword(password) {
+		return User{}, errWrongLogin
+	}
+	return u, nil
+}
+
+// Authenticate returns the user a client of the API logs in as: the user
+// with the name if the password is right, or without a name, the open user
+// while the DB has no accounts. The OS account running the app is not
+// used, as the client may be anybody.
+func (r Repository) Authenticate(name, password string) (User, error) {
+	db := currentDB()
+	if name != "" {
+		return r.Login(name, password)
+	}
+
+	session, err := mgo.DialWithTimeout(db.Server, pingTimeout)
+	if err != nil {
+		return User{}, err
+	}
+	defer session.Close()
+
+	n, err := session.DB(db.Name).C(USERS).Count()
+	if err != nil {
+		return User{}, err
+	}
+	if n > 0 {
+		return User{}, errNoLogin
+	}
+	return openUser(), nil
+}
+
+// GetUsers returns the user accounts by name.
+func (r Repository) GetUsers() ([]User, error) {
+	db := currentDB()
+	session, err := mgo.Dial(db.Server)
+	if err != nil {
+		return nil, err
+	}
+	defer session.Close()
+
+	var users []User
+	err = session.DB(db.Name).C(USERS).Find(nil).Sort("name").All(&users)
+	return users, err
+}
+
+// SaveUser adds a user account, or replaces the account named old. The
+// first account has to be an admin, and the last admin cannot lose the
+// role, so that the accounts can always be managed.
+func (r Repository) SaveUser(old string, u User) error {
+	db := currentDB()
+	u, err := u.check()
+	if err != nil {
+		return err
+	}
+	if _, err := r.authorize(ActionManageUsers); err != nil {
+		return err
+	}
+
+	session, err := mgo.Dial(db.Server)
+	if err != nil {
+		return err
+	}
+	defer session.Close()
+	c := session.DB(db.Name).C(USERS)
+	if err := c.EnsureIndex(mgo.Index{Key: []string{"name"}, Unique: true}); err != nil {
+		fmt.Println("Failed to create index:", err)
+	}
+
+	if n, err := c.Find(bson.M{"name": u.Name}).Count(); err != nil {
+		return err
+	} else if n > 0 && u.Name != old {
+		return fmt.Errorf("there is a user named %s already", u.Name)
+	}
+	if u.OSUser != "" {
+		n, err := c.Find(bson.M{"osuser": u.OSUser, "name": bson.M{"$ne": old}}).Count()
+		if err != nil {
+			return err
+		}
+		if n > 0 {
+			return fmt.Errorf("the OS account %s is mapped to another user", u.OSUser)
+		}
+	}
+	if u.Role != RoleAdmin || u.Disabled {
+		if err := r.checkAdminLeft(c, old); err != nil {
+			return err
+		}
+	}
+
+	if old == "" {
+		return c.Insert(u)
+	}
+	if err := c.Update(bson.M{"name": old}, u); err == mgo.ErrNotFound {
+		return fmt.Errorf("there is no user named %s", old)
+	} else if err != nil {
+		return err
+	}
+	if current, ok := loggedInUser(); ok && current.Name == old {
+		setCurrentUser(&u)
+	}
+	return nil
+}
+
+// DeleteUser deletes the user account with the name. The last admin
+// cannot be deleted.
+func (r Repository) DeleteUser(name string) error {
+	db := currentDB()
+	if _, err := r.authorize(ActionManageUsers); err != nil {
+		return err
+	}
+
+	session, err := mgo.Dial(db.Server)
+	if err != nil {
+		return err
+	}
+	defer session.Close()
+	c := session.DB(db.Name).C(USERS)
+
+	if err := r.checkAdminLeft(c, name); err != nil {
+		return err
+	}
+	if err := c.Remove(bson.M{"name": name}); err == mgo.ErrNotFound {
+		return fmt.Errorf("there is no user named %s", name)
+	} else if err != nil {
+		return err
+	}
+	return nil
+}
+
+// checkAdminLeft returns an error unless an admin other than the user with
+// the name, "" for a new user, is left to manage the accounts.
+func (r Repository) checkAdminLeft(c *mgo.Collection, name string) error {
+	n, err := c.Find(bson.M{"role": RoleAdmin, "disabled": bson.M{"$ne": true}, "name": bson.M{"$ne": name}}).Count()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return errors.New("there has to be an admin left to manage the users")
+	}
+	return nil
+}
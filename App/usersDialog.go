@@ -0,0 +1,213 @@
+// Copyright 2016 Cory Robinson. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE.txt file.
+
+// usersDialog.go implements the Users dialog, where admins add, change and
+// remove the user accounts of users.go. Changes are saved to the DB as they
+// are made, see MainWindow.manageUsers().
+
+package main
+
+import (
+	"github.com/therecipe/qt/widgets"
+)
+
+type UsersDialog struct {
+	widgets.QDialog
+
+	usersList      *widgets.QListWidget
+	nameEditor     *widgets.QLineEdit
+	roleView       *widgets.QComboBox
+	osUserEditor   *widgets.QLineEdit
+	passwordEditor *widgets.QLineEdit
+	disabledBox    *widgets.QCheckBox
+
+	newButton    *widgets.QPushButton
+	saveButton   *widgets.QPushButton
+	removeButton *widgets.QPushButton
+	closeButton  *widgets.QPushButton
+
+	users   []User
+	editing string // name of the user in the form, "" for a new one
+}
+
+// initWith() initializes the dialog layout with the user accounts.
+func (d *UsersDialog) initWith(parent *widgets.QWidget) {
+	d.usersList = widgets.NewQListWidget(nil)
+	d.usersList.ConnectCurrentTextChanged(d.showUser)
+
+	d.nameEditor = widgets.NewQLineEdit(nil)
+	d.roleView = widgets.NewQComboBox(nil)
+	for _, role := range roles {
+		d.roleView.AddItem(string(role), nil)
+	}
+	d.osUserEditor = widgets.NewQLineEdit(nil)
+	d.osUserEditor.SetToolTip("The OS account which logs in as this user without a password.")
+	d.passwordEditor = widgets.NewQLineEdit(nil)
+	d.passwordEditor.SetEchoMode(widgets.QLineEdit__Password)
+	d.disabledBox = widgets.NewQCheckBox2("&Disabled", nil)
+
+	formLayout := widgets.NewQFormLayout(nil)
+	formLayout.AddRow3("Name:", d.nameEditor)
+	formLayout.AddRow3("Role:", d.roleView)
+	formLayout.AddRow3("OS account:", d.osUserEditor)
+	formLayout.AddRow3("Password:", d.passwordEditor)
+	formLayout.AddRow3("", d.disabledBox)
+
+	d.newButton = widgets.NewQPushButton2("&New", nil)
+	d.saveButton = widgets.NewQPushButton2("&Save User", nil)
+	d.removeButton = widgets.NewQPushButton2("&Remove", nil)
+	d.newButton.ConnectClicked(func(bool) { d.newUser() })
+	d.saveButton.ConnectClicked(func(bool) { d.saveUser() })
+	d.removeButton.ConnectClicked(func(bool) { d.removeUser() })
+
+	userButtons := widgets.NewQHBoxLayout()
+	userButtons.AddWidget(d.newButton, 0, 0)
+	userButtons.AddWidget(d.saveButton, 0, 0)
+	userButtons.AddWidget(d.removeButton, 0, 0)
+	userButtons.AddStretch(1)
+
+	rightLayout := widgets.NewQVBoxLayout()
+	rightLayout.AddLayout(formLayout, 0)
+	rightLayout.AddLayout(userButtons, 0)
+	rightLayout.AddStretch(1)
+
+	listLayout := widgets.NewQHBoxLayout()
+	listLayout.AddWidget(d.usersList, 0, 0)
+	listLayout.AddLayout(rightLayout, 1)
+
+	buttonBox := widgets.NewQDialogButtonBox(nil)
+	d.closeButton = widgets.NewQPushButton2("&Close", nil)
+	d.closeButton.ConnectClicked(func(bool) { d.Accept() })
+	buttonBox.AddButton(d.closeButton, widgets.QDialogButtonBox__AcceptRole)
+
+	layout := widgets.NewQVBoxLayout()
+	layout.AddLayout(listLayout, 1)
+	layout.AddWidget(buttonBox, 0, 0)
+	d.SetLayout(layout)
+
+	d.fillUsers("")
+	d.SetWindowTitle("Users")
+}
+
+// fillUsers() reads the user accounts and lists them, selecting the user
+// with the name. Without accounts, the form is ready for the first admin.
+func (d *UsersDialog) fillUsers(selected string) {
+	var r Repository
+	users, err := r.GetUsers()
+	if err != nil {
+		d.warn(err)
+	}
+	d.users = users
+
+	d.usersList.BlockSignals(true)
+	d.usersList.Clear()
+	for _, u := range users {
+		d.usersList.AddItem(u.Name)
+		item := d.usersList.Item(d.usersList.Count() - 1)
+		if u.Disabled {
+			item.SetToolTip("Disabled")
+		}
+		if u.Name == selected || selected == "" && d.usersList.Count() == 1 {
+			d.usersList.SetCurrentItem(item)
+		}
+	}
+	d.usersList.BlockSignals(false)
+
+	if len(users) == 0 {
+		d.newUser()
+		d.roleView.SetCurrentText(string(RoleAdmin))
+		return
+	}
+	d.showUser(d.usersList.CurrentText())
+}
+
+// find() returns the user account with the name.
+func (d *UsersDialog) find(name string) (User, bool) {
+	for _, u := range d.users {
+		if u.Name == name {
+			return u, true
+		}
+	}
+	return User{}, false
+}
+
+// showUser() shows the user with the name in the form. The password is
+// never shown, only set.
+func (d *UsersDialog) showUser(name string) {
+	u, ok := d.find(name)
+	if !ok {
+		return
+	}
+	d.editing = u.Name
+	d.nameEditor.SetText(u.Name)
+	d.roleView.SetCurrentText(string(u.Role))
+	d.osUserEditor.SetText(u.OSUser)
+	d.passwordEditor.Clear()
+	d.passwordEditor.SetPlaceholderText("unchanged")
+	d.disabledBox.SetChecked(u.Disabled)
+}
+
+// newUser() empties the form for a new user.
+func (d *UsersDialog) newUser() {
+	d.editing = ""
+	d.usersList.ClearSelection()
+	d.nameEditor.Clear()
+	d.roleView.SetCurrentText(string(RoleViewer))
+	d.osUserEditor.Clear()
+	d.passwordEditor.Clear()
+	d.passwordEditor.SetPlaceholderText("")
+	d.disabledBox.SetChecked(false)
+	d.nameEditor.SetFocus2()
+}
+
+// saveUser() saves the user in the form, keeping the password of a user
+// changed unless a new one is given.
+func (d *UsersDialog) saveUser() {
+	u, _ := d.find(d.editing)
+	u.Name = d.nameEditor.Text()
+	u.Role = Role(d.roleView.CurrentText())
+	u.OSUser = d.osUserEditor.Text()
+	u.Disabled = d.disabledBox.IsChecked()
+	if password := d.passwordEditor.Text(); password != "" {
+		if err := u.setPassword(password); err != nil {
+			d.warn(err)
+			return
+		}
+	}
+
+	var r Repository
+	if err := r.SaveUser(d.editing, u); err != nil {
+		d.warn(err)
+		return
+	}
+	u, _ = u.check()
+	d.fillUsers(u.Name)
+}
+
+// removeUser() removes the user selected.
+func (d *UsersDialog) removeUser() {
+	name := d.usersList.CurrentText()
+	if name == "" {
+		return
+	}
+	answer := widgets.QMessageBox_Question(d, "Remove User",
+		"Remove the user "+name+"? The changes made by the user keep the name.",
+		widgets.QMessageBox__Yes|widgets.QMessageBox__No, widgets.QMessageBox__No)
+	if answer != widgets.QMessageBox__Yes {
+		return
+	}
+
+	var r Repository
+	if err := r.DeleteUser(name); err != nil {
+		d.warn(err)
+		return
+	}
+	d.fillUsers("")
+}
+
+// warn() says what went wrong.
+func (d *UsersDialog) warn(err error) {
+	widgets.QMessageBox_Warning(d, "Users", err.Error(),
+		widgets.QMessageBox__Ok, widgets.QMessageBox__Ok)
+}
@@ -0,0 +1,244 @@
+// Copyright 2016 Cory Robinson. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE.txt file.
+
+// vendorAnalytics.go computes the spend analytics of a vendor shown in the
+// Vendor tab: the spend by month, quarter or year, the number and average
+// size of the invoices, and the history of the unit price of every product
+// bought, flagging products whose price went up on their last invoice.
+
+package main
+
+import (
+	"fmt"
+	"sort"
+
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// The periods the spend of a vendor can be grouped by.
+var analyticsPeriods = []string{"month", "quarter", "year"}
+
+// priceAlertPercent is the rise of the unit price of a product, in percent
+// of the price before, which is flagged as a price increase.
+const priceAlertPercent = 5.0
+
+// VendorAnalytics is the spend with a vendor. Amounts are integer cents in
+// the currency of most of the vendor's invoices; invoices in other
+// currencies are counted in OtherCurrency but not in the amounts.
+type VendorAnalytics struct {
+	Vendor         string
+	Currency       string
+	InvoiceCount   int // without credit notes
+	CreditNotes    int
+	TotalSpend     int64 // invoices less credit notes
+	AverageInvoice int64
+	OtherCurrency  int
+	FirstDate      string // MM/DD/YYYY
+	LastDate       string
+	Periods        []PeriodSpend
+	Products       []ProductHistory
+}
+
+// PeriodSpend is the spend with a vendor in a month, quarter or year.
+type PeriodSpend struct {
+	Period   string // 2018-03, 2018-Q1 or 2018
+	Invoices int
+	Spend    int64
+}
+
+// ProductHistory is the unit price of a product over the invoices it was
+// bought on, oldest first.
+type ProductHistory struct {
+	ProductID   string
+	Description string // of the last invoice
+	Prices      []PricePoint
+	Change      float64 // percent from the price before the last
+	Alert       bool    // Change is at least priceAlertPercent
+}
+
+// PricePoint is the unit price of a product on an invoice.
+type PricePoint struct {
+	InvoiceID int
+	InvoiceNo string
+	Date      string // MM/DD/YYYY
+	UnitPrice int64
+	Quantity  uint16
+}
+
+// Last returns the last price of the product.
+func (h ProductHistory) Last() PricePoint {
+	return h.Prices[len(h.Prices)-1]
+}
+
+// Range returns the lowest and highest unit price of the product.
+func (h ProductHistory) Range() (min, max int64) {
+	min, max = h.Prices[0].UnitPrice, h.Prices[0].UnitPrice
+	for _, p := range h.Prices[1:] {
+		if p.UnitPrice < min {
+			min = p.UnitPrice
+		}
+		if p.UnitPrice > max {
+			max = p.UnitPrice
+		}
+	}
+	return min, max
+}
+
+// Alerts returns the number of products whose price went up.
+func (a VendorAnalytics) Alerts() int {
+	n := 0
+	for _, h := range a.Products {
+		if h.Alert {
+			n++
+		}
+	}
+	return n
+}
+
+// periodOf returns the period of a YYYY-MM-DD date key, "" if there is no
+// date.
+func periodOf(key, period string) string {
+	if len(key) < 7 {
+		return ""
+	}
+	switch period {
+	case "year":
+		return key[:4]
+	case "quarter":
+		month := (key[5]-'0')*10 + key[6] - '0'
+		return fmt.Sprintf("%s-Q%d", key[:4], (month+2)/3)
+	}
+	return key[:7]
+}
+
+// vendorAnalytics computes the analytics of a vendor from its invoices,
+// grouping the spend by period, see analyticsPeriods.
+func vendorAnalytics(vendor string, invoices Invoices, period string) VendorAnalytics {
+	a := VendorAnalytics{Vendor: vendor}
+
+	// the currency of most invoices
+	currencies := map[string]int{}
+	for _, invoice := range invoices {
+		currencies[invoice.Currency]++
+		if currencies[invoice.Currency] > currencies[a.Currency] ||
+			currencies[invoice.Currency] == currencies[a.Currency] && invoice.Currency < a.Currency {
+			a.Currency = invoice.Currency
+		}
+	}
+
+	// oldest first, so that the price histories are in order
+	invoices = append(Invoices(nil), invoices...)
+	sort.SliceStable(invoices, func(i, j int) bool {
+		ki, kj := dateKey(invoices[i].Date), dateKey(invoices[j].Date)
+		if ki != kj {
+			return ki < kj
+		}
+		return invoices[i].ID < invoices[j].ID
+	})
+
+	periods := map[string]*PeriodSpend{}
+	products := map[string]*ProductHistory{}
+	var invoiced int64
+	firstKey, lastKey := "", ""
+	for _, invoice := range invoices {
+		if invoice.Currency != a.Currency {
+			a.OtherCurrency++
+			continue
+		}
+		key := dateKey(invoice.Date)
+		if key != "" {
+			if firstKey == "" || key < firstKey {
+				firstKey, a.FirstDate = key, invoice.Date
+			}
+			if key >= lastKey {
+				lastKey, a.LastDate = key, invoice.Date
+			}
+		}
+
+		spend := invoice.Total
+		if invoice.CreditNote {
+			spend = -spend
+			a.CreditNotes++
+		} else {
+			a.InvoiceCount++
+			invoiced += invoice.Total
+		}
+		a.TotalSpend += spend
+		if p := periodOf(key, period); p != "" {
+			if periods[p] == nil {
+				periods[p] = &PeriodSpend{Period: p}
+			}
+			periods[p].Spend += spend
+			if !invoice.CreditNote {
+				periods[p].Invoices++
+			}
+		}
+
+		if invoice.CreditNote {
+			continue
+		}
+		for _, item := range invoice.LineItems {
+			if item.ProductID == "" {
+				continue
+			}
+			h := products[item.ProductID]
+			if h == nil {
+				h = &ProductHistory{ProductID: item.ProductID}
+				products[item.ProductID] = h
+			}
+			h.Description = item.Description
+			h.Prices = append(h.Prices, PricePoint{
+				InvoiceID: invoice.ID, InvoiceNo: invoice.InvoiceNo, Date: invoice.Date,
+				UnitPrice: item.Amount, Quantity: item.Quantity,
+			})
+		}
+	}
+	if a.InvoiceCount > 0 {
+		a.AverageInvoice = invoiced / int64(a.InvoiceCount)
+	}
+
+	for _, p := range periods {
+		a.Periods = append(a.Periods, *p)
+	}
+	sort.Slice(a.Periods, func(i, j int) bool { return a.Periods[i].Period < a.Periods[j].Period })
+
+	for _, h := range products {
+		if n := len(h.Prices); n > 1 && h.Prices[n-2].UnitPrice > 0 {
+			before, last := h.Prices[n-2].UnitPrice, h.Prices[n-1].UnitPrice
+			h.Change = float64(last-before) * 100 / float64(before)
+			h.Alert = h.Change >= priceAlertPercent
+		}
+		a.Products = append(a.Products, *h)
+	}
+	sort.Slice(a.Products, func(i, j int) bool {
+		if a.Products[i].Alert != a.Products[j].Alert {
+			return a.Products[i].Alert
+		}
+		return a.Products[i].ProductID < a.Products[j].ProductID
+	})
+	return a
+}
+
+// GetVendorAnalytics returns the analytics of the vendor with the name,
+// grouping the spend by period, see analyticsPeriods.
+func (r Repository) GetVendorAnalytics(name, period string) VendorAnalytics {
+	db := currentDB()
+	session, err := mgo.Dial(db.Server)
+	if err != nil {
+		fmt.Println("Failed to establish connection to Mongo server:", err)
+		return VendorAnalytics{Vendor: name}
+	}
+	defer session.Close()
+
+	c := session.DB(db.Name).C(db.Collection)
+	var results Invoices
+	if err := c.Find(bson.M{"vendor": name}).Select(bson.M{
+		"id": 1, "invoiceno": 1, "date": 1, "total": 1, "currency": 1, "creditnote": 1, "lineitems": 1,
+	}).All(&results); err != nil {
+		fmt.Println("Failed to write results:", err)
+	}
+
+	return vendorAnalytics(name, results, period)
+}
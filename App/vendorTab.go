@@ -0,0 +1,247 @@
+// Copyright 2016 Cory Robinson. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE.txt file.
+
+// vendorTab.go implements the Vendor tab of the details panel: the details
+// of the vendor of the invoices listed or selected, with the analytics of
+// vendorAnalytics.go, the spend by period and the unit price history of the
+// products bought, price increases shown in red.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"html"
+	"strconv"
+	"strings"
+
+	"github.com/therecipe/qt/core"
+	"github.com/therecipe/qt/gui"
+	"github.com/therecipe/qt/widgets"
+)
+
+// createVendorTab() sets up the Vendor tab of the details panel.
+func (w *MainWindow) createVendorTab() *widgets.QWidget {
+	w.vendorPage = widgets.NewQWidget(nil, 0)
+
+	w.vendorLabel = widgets.NewQLabel(nil, 0)
+	w.vendorLabel.SetWordWrap(true)
+	w.vendorLabel.SetAlignment(core.Qt__AlignTop)
+	w.vendorLabel.SetTextInteractionFlags(core.Qt__TextSelectableByMouse)
+
+	w.vendorPeriodView = widgets.NewQComboBox(nil)
+	for _, period := range analyticsPeriods {
+		w.vendorPeriodView.AddItem(strings.ToUpper(period[:1])+period[1:], core.NewQVariant14(period))
+	}
+	settings := core.NewQSettings("airpaio", "InvoiceViewer", nil)
+	period := settings.Value("vendor/period", core.NewQVariant14("month")).ToString()
+	if i := w.vendorPeriodView.FindData(core.NewQVariant14(period), int(core.Qt__UserRole), core.Qt__MatchExactly); i >= 0 {
+		w.vendorPeriodView.SetCurrentIndex(i)
+	}
+	w.vendorPeriodView.ConnectCurrentIndexChanged(func(int) {
+		settings := core.NewQSettings("airpaio", "InvoiceViewer", nil)
+		settings.SetValue("vendor/period", core.NewQVariant14(w.vendorPeriod()))
+		w.showVendorAnalytics(w.vendorAnalytics.Vendor)
+	})
+
+	w.vendorSummaryLabel = widgets.NewQLabel(nil, 0)
+	w.vendorSummaryLabel.SetWordWrap(true)
+
+	w.vendorSpendTable = newAnalyticsTable([]string{"Period", "Invoices", "Spend"})
+	w.vendorProductsTable = newAnalyticsTable([]string{"Product ID", "Description", "Last Price", "Change", "Low", "High", "Invoices"})
+	w.vendorProductsTable.HorizontalHeader().SetSectionResizeMode2(1, widgets.QHeaderView__Stretch)
+	w.vendorProductsTable.ConnectCurrentCellChanged(func(row, column, previousRow, previousColumn int) {
+		w.showPriceHistory(row)
+	})
+	w.vendorPriceTable = newAnalyticsTable([]string{"Date", "Invoice No.", "Unit Price", "Quantity"})
+
+	w.vendorAlertLabel = widgets.NewQLabel(nil, 0)
+	w.vendorAlertLabel.SetStyleSheet("QLabel { color: " + notPaidColor + "; }")
+	w.vendorAlertLabel.Hide()
+
+	periodLayout := widgets.NewQHBoxLayout()
+	periodLayout.AddWidget(widgets.NewQLabel2("Spend by:", nil, 0), 0, 0)
+	periodLayout.AddWidget(w.vendorPeriodView, 0, 0)
+	periodLayout.AddStretch(1)
+
+	pricesLayout := widgets.NewQHBoxLayout()
+	pricesLayout.AddWidget(w.vendorProductsTable, 3, 0)
+	pricesLayout.AddWidget(w.vendorPriceTable, 2, 0)
+
+	layout := widgets.NewQVBoxLayout()
+	layout.AddWidget(w.vendorLabel, 0, 0)
+	layout.AddWidget(w.vendorSummaryLabel, 0, 0)
+	layout.AddLayout(periodLayout, 0)
+	layout.AddWidget(w.vendorSpendTable, 1, 0)
+	layout.AddWidget(widgets.NewQLabel2("Unit prices:", nil, 0), 0, 0)
+	layout.AddWidget(w.vendorAlertLabel, 0, 0)
+	layout.AddLayout(pricesLayout, 2)
+	w.vendorPage.SetLayout(layout)
+	w.vendorPage.SetEnabled(false)
+
+	return w.vendorPage
+}
+
+// newAnalyticsTable() returns a read-only table with the columns.
+func newAnalyticsTable(columns []string) *widgets.QTableWidget {
+	table := widgets.NewQTableWidget2(0, len(columns), nil)
+	table.SetHorizontalHeaderLabels(columns)
+	table.SetSelectionBehavior(widgets.QAbstractItemView__SelectRows)
+	table.SetSelectionMode(widgets.QAbstractItemView__SingleSelection)
+	table.SetEditTriggers(widgets.QAbstractItemView__NoEditTriggers)
+	table.VerticalHeader().Hide()
+	return table
+}
+
+// setAnalyticsRow() fills a row of an analytics table. The columns from
+// textColumns on hold amounts or counts and are aligned right; the row of
+// an alert is shown in red.
+func setAnalyticsRow(table *widgets.QTableWidget, row int, values []string, textColumns int, alert bool) {
+	for column, value := range values {
+		item := widgets.NewQTableWidgetItem2(value, 0)
+		if column >= textColumns {
+			item.SetTextAlignment(int(core.Qt__AlignRight | core.Qt__AlignVCenter))
+		}
+		if alert {
+			item.SetForeground(gui.NewQBrush3(gui.NewQColor3(0xc0, 0, 0, 255), core.Qt__SolidPattern))
+		}
+		table.SetItem(row, column, item)
+	}
+}
+
+// vendorPeriod() returns the period the spend is grouped by.
+func (w *MainWindow) vendorPeriod() string {
+	return w.vendorPeriodView.CurrentData(int(core.Qt__UserRole)).ToString()
+}
+
+// setVendorDetails() shows the details of the vendor from one of its
+// invoices in the Vendor tab.
+func (w *MainWindow) setVendorDetails(record Invoice) {
+	address := record.Address
+	lines := []string{"<b>" + html.EscapeString(record.Vendor) + "</b>"}
+	for _, line := range []string{address.Street,
+		strings.TrimSpace(fmt.Sprintf("%v, %v %v", address.City, address.State, address.Zipcode)),
+		address.Country} {
+		if line = strings.Trim(line, ", "); line != "" {
+			lines = append(lines, html.EscapeString(line))
+		}
+	}
+	ids := record.VendorIDs
+	for _, id := range [][2]string{{"Tax ID", ids.TaxID}, {"Registration", ids.LegalID}, {"Bank account", ids.BankAccount}} {
+		if id[1] != "" {
+			lines = append(lines, id[0]+": "+html.EscapeString(id[1]))
+		}
+	}
+	w.vendorLabel.SetText(strings.Join(lines, "<br>"))
+	w.vendorPage.SetEnabled(true)
+}
+
+// showVendorAnalytics() queries the analytics of the vendor in the
+// background and shows them in the Vendor tab.
+func (w *MainWindow) showVendorAnalytics(vendor string) {
+	if vendor == "" {
+		return
+	}
+	period := w.vendorPeriod()
+	var a VendorAnalytics
+	w.load("vendor", func(ctx context.Context) error {
+		a = w.model.GetVendorAnalytics(vendor, period)
+		return ctx.Err()
+	}, func(err error) {
+		if err != nil {
+			return
+		}
+		w.setVendorAnalytics(a)
+	})
+}
+
+// setVendorAnalytics() displays the analytics queried by
+// showVendorAnalytics().
+func (w *MainWindow) setVendorAnalytics(a VendorAnalytics) {
+	w.vendorAnalytics = a
+
+	summary := fmt.Sprintf("Number of Invoices: %d", a.InvoiceCount)
+	if a.CreditNotes > 0 {
+		summary += fmt.Sprintf(" and %d credit notes", a.CreditNotes)
+	}
+	summary += fmt.Sprintf("\nTotal Spend: %v \tAverage Invoice: %v", formatCents(a.TotalSpend), formatCents(a.AverageInvoice))
+	if a.Currency != "" && a.Currency != "USD" {
+		summary += " (" + a.Currency + ")"
+	}
+	if a.FirstDate != "" {
+		summary += fmt.Sprintf("\nFrom %v to %v", displayDate(a.FirstDate), displayDate(a.LastDate))
+	}
+	if a.OtherCurrency > 0 {
+		summary += fmt.Sprintf("\n%d invoices in other currencies are not counted.", a.OtherCurrency)
+	}
+	w.vendorSummaryLabel.SetText(summary)
+
+	w.vendorSpendTable.ClearContents()
+	w.vendorSpendTable.SetRowCount(len(a.Periods))
+	for i := range a.Periods {
+		// latest first
+		p := a.Periods[len(a.Periods)-1-i]
+		setAnalyticsRow(w.vendorSpendTable, i, []string{p.Period, strconv.Itoa(p.Invoices), formatCents(p.Spend)}, 1, false)
+	}
+	w.vendorSpendTable.ResizeColumnsToContents()
+
+	if n := a.Alerts(); n > 0 {
+		w.vendorAlertLabel.SetText(fmt.Sprintf("The price of %d products went up by %v%% or more on their last invoice.", n, priceAlertPercent))
+		w.vendorAlertLabel.Show()
+	} else {
+		w.vendorAlertLabel.Hide()
+	}
+
+	w.vendorProductsTable.BlockSignals(true)
+	w.vendorProductsTable.ClearContents()
+	w.vendorProductsTable.SetRowCount(len(a.Products))
+	for i, h := range a.Products {
+		low, high := h.Range()
+		change := ""
+		if len(h.Prices) > 1 {
+			change = fmt.Sprintf("%+.1f%%", h.Change)
+		}
+		setAnalyticsRow(w.vendorProductsTable, i, []string{h.ProductID, h.Description,
+			formatCents(h.Last().UnitPrice), change, formatCents(low), formatCents(high), strconv.Itoa(len(h.Prices))}, 2, h.Alert)
+	}
+	w.vendorProductsTable.ResizeColumnToContents(0)
+	w.vendorProductsTable.BlockSignals(false)
+	if len(a.Products) > 0 {
+		w.vendorProductsTable.SelectRow(0)
+	}
+	w.showPriceHistory(w.vendorProductsTable.CurrentRow())
+}
+
+// showPriceHistory() lists the unit prices of the product in the row of
+// the products table, latest first.
+func (w *MainWindow) showPriceHistory(row int) {
+	w.vendorPriceTable.ClearContents()
+	w.vendorPriceTable.SetRowCount(0)
+	if row < 0 || row >= len(w.vendorAnalytics.Products) {
+		return
+	}
+	prices := w.vendorAnalytics.Products[row].Prices
+	w.vendorPriceTable.SetRowCount(len(prices))
+	for i := range prices {
+		p := prices[len(prices)-1-i]
+		// a price up on the one before
+		alert := len(prices)-1-i > 0 && p.UnitPrice > prices[len(prices)-2-i].UnitPrice
+		setAnalyticsRow(w.vendorPriceTable, i, []string{displayDate(p.Date), p.InvoiceNo,
+			formatCents(p.UnitPrice), strconv.Itoa(int(p.Quantity))}, 2, alert)
+	}
+	w.vendorPriceTable.ResizeColumnsToContents()
+}
+
+// clearVendorTab() empties the Vendor tab while the invoices of all vendors
+// are listed and none is selected.
+func (w *MainWindow) clearVendorTab() {
+	w.vendorAnalytics = VendorAnalytics{}
+	w.vendorLabel.SetText("Select a vendor, or an invoice, to see its spend and prices.")
+	w.vendorSummaryLabel.Clear()
+	w.vendorSpendTable.SetRowCount(0)
+	w.vendorProductsTable.SetRowCount(0)
+	w.vendorPriceTable.SetRowCount(0)
+	w.vendorAlertLabel.Hide()
+	w.vendorPage.SetEnabled(false)
+}
@@ -0,0 +1,250 @@
+// Copyright 2016 Cory Robinson. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE.txt file.
+
+// viewsToolBar.go implements the columns of the invoices table, shown and
+// hidden from the context menu of its header, ordered by dragging the
+// header or in the Columns dialog, and the Views tool bar, where the
+// vendor, search, columns and sort order of the table are saved by name.
+// Both are kept in the settings file, see invoiceViews.go.
+
+package main
+
+import (
+	"strings"
+
+	"github.com/therecipe/qt/core"
+	"github.com/therecipe/qt/widgets"
+)
+
+// noView is the first entry of the views combobox, selected while no saved
+// view is.
+const noView = "<no view>"
+
+// restoreViews() reads the columns of the invoices table and the saved
+// views from the settings.
+func (w *MainWindow) restoreViews() {
+	settings := core.NewQSettings("airpaio", "InvoiceViewer", nil)
+	keys := parseColumnKeys(settings.Value("invoices/columns", core.NewQVariant14("")).ToString())
+	w.columnKeys = columnKeys(invoiceColumnsOf(keys, false))
+	w.views = parseInvoiceViews(settings.Value("invoices/views", core.NewQVariant14("")).ToString())
+}
+
+// createViewsToolBar() sets up the Views tool bar.
+func (w *MainWindow) createViewsToolBar() {
+	toolBar := w.AddToolBar3("Views")
+
+	w.viewsBox = widgets.NewQComboBox(nil)
+	w.viewsBox.SetMinimumContentsLength(20)
+	w.viewsBox.SetToolTip("Saved views of the invoices table")
+	w.fillViews("")
+	w.viewsBox.ConnectCurrentTextChanged(w.selectView)
+
+	saveAction := widgets.NewQAction2("&Save View...", w)
+	deleteAction := widgets.NewQAction2("&Delete View", w)
+	saveAction.ConnectTriggered(func(bool) { w.saveView() })
+	deleteAction.ConnectTriggered(func(bool) { w.deleteView() })
+
+	toolBar.AddWidget(widgets.NewQLabel2("View: ", nil, 0))
+	toolBar.AddWidget(w.viewsBox)
+	toolBar.AddActions([]*widgets.QAction{saveAction, deleteAction})
+}
+
+// fillViews() lists the saved views in the views combobox, selecting the
+// view with the name.
+func (w *MainWindow) fillViews(selected string) {
+	names := []string{noView}
+	for _, view := range w.views {
+		names = append(names, view.Name)
+	}
+	w.viewsBox.BlockSignals(true)
+	w.viewsBox.Clear()
+	w.viewsBox.AddItems(names)
+	w.viewsBox.SetCurrentText(selected)
+	w.viewsBox.BlockSignals(false)
+}
+
+// selectView() applies the view picked in the views combobox.
+func (w *MainWindow) selectView(name string) {
+	if view, ok := findInvoiceView(w.views, name); ok {
+		w.applyView(view)
+	}
+}
+
+// applyView() shows the vendor, search, columns and sort order of a view.
+// A vendor no longer in the DB shows all invoices.
+func (w *MainWindow) applyView(view invoiceView) {
+	w.setColumnKeys(view.Columns)
+
+	w.searchTimer.Stop()
+	w.searchEdit.BlockSignals(true)
+	w.searchEdit.SetText(view.Search)
+	w.searchEdit.BlockSignals(false)
+	w.search, _ = w.checkSearch()
+
+	vendor := view.Vendor
+	if vendor == "" {
+		vendor = "<all invoices>"
+	}
+	w.vendorView.BlockSignals(true)
+	w.vendorView.SetCurrentText(vendor)
+	if w.vendorView.CurrentText() != vendor {
+		w.vendorView.SetCurrentText("<all invoices>")
+	}
+	w.vendorView.BlockSignals(false)
+	vendor = w.vendorView.CurrentText()
+
+	w.shownInvoice = 0
+	if vendor == "<all invoices>" {
+		w.tableCase = "all"
+	} else {
+		w.tableCase = "individual"
+	}
+	w.showListProfile()
+	columns, filter := w.invoicesTableQuery(vendor)
+	w.invoicesModel.setView(columns, filter, view.Sort, view.Descending)
+	w.showLineItemsTableView(nil, "change")
+}
+
+// currentView() returns the view shown, to save it under the name.
+func (w *MainWindow) currentView(name string) invoiceView {
+	view := invoiceView{Name: name, Search: w.searchEdit.Text(), Columns: w.columnKeys}
+	if w.tableCase == "individual" {
+		view.Vendor = w.vendorView.CurrentText()
+	}
+	view.Sort, view.Descending = w.invoicesModel.sortOrder()
+	return view
+}
+
+// saveView() asks for a name and saves the view shown under it, replacing
+// the saved view of the same name.
+func (w *MainWindow) saveView() {
+	current := w.viewsBox.CurrentText()
+	if current == noView {
+		current = ""
+	}
+	var ok bool
+	name := widgets.QInputDialog_GetText(w, "Save View", "Name of the view:",
+		widgets.QLineEdit__Normal, current, &ok, 0, 0)
+	name = strings.TrimSpace(name)
+	if !ok || name == "" || name == noView {
+		return
+	}
+
+	w.views = saveInvoiceView(w.views, w.currentView(name))
+	w.storeViews()
+	w.fillViews(name)
+}
+
+// deleteView() deletes the view selected in the views combobox.
+func (w *MainWindow) deleteView() {
+	view, ok := findInvoiceView(w.views, w.viewsBox.CurrentText())
+	if !ok {
+		return
+	}
+	answer := widgets.QMessageBox_Question(w, "Delete View",
+		"Delete the view "+view.Name+"?",
+		widgets.QMessageBox__Yes|widgets.QMessageBox__No, widgets.QMessageBox__No)
+	if answer != widgets.QMessageBox__Yes {
+		return
+	}
+
+	w.views = deleteInvoiceView(w.views, view.Name)
+	w.storeViews()
+	w.fillViews("")
+}
+
+// storeViews() writes the saved views to the settings.
+func (w *MainWindow) storeViews() {
+	settings := core.NewQSettings("airpaio", "InvoiceViewer", nil)
+	settings.SetValue("invoices/views", core.NewQVariant14(formatInvoiceViews(w.views)))
+}
+
+// setColumnKeys() sets the columns of the invoices table, without listing
+// the invoices again, and writes them to the settings.
+func (w *MainWindow) setColumnKeys(keys []string) {
+	w.columnKeys = columnKeys(invoiceColumnsOf(keys, false))
+	settings := core.NewQSettings("airpaio", "InvoiceViewer", nil)
+	settings.SetValue("invoices/columns", core.NewQVariant14(strings.Join(w.columnKeys, ",")))
+}
+
+// setColumns() shows the columns with the keys in the invoices table.
+func (w *MainWindow) setColumns(keys []string) {
+	w.setColumnKeys(keys)
+	w.showInvoicesTableView(w.vendorView.CurrentText())
+}
+
+// showColumnsMenu() shows the context menu of the header of the invoices
+// table, to show and hide columns.
+func (w *MainWindow) showColumnsMenu(pos *core.QPoint) {
+	shown := map[string]bool{}
+	for _, column := range w.invoicesModel.columns() {
+		shown[column.key] = true
+	}
+
+	menu := widgets.NewQMenu(w)
+	for _, column := range invoiceColumns {
+		if column.key == "vendor" && w.tableCase == "individual" {
+			continue
+		}
+		key := column.key
+		action := menu.AddAction(column.title)
+		action.SetCheckable(true)
+		action.SetChecked(shown[key])
+		action.ConnectTriggered(func(checked bool) { w.toggleColumn(key, checked) })
+	}
+	menu.AddSeparator()
+	columnsAction := menu.AddAction("&Columns...")
+	columnsAction.ConnectTriggered(func(bool) { w.configureColumns() })
+	resetAction := menu.AddAction("&Reset Columns")
+	resetAction.ConnectTriggered(func(bool) { w.setColumns(defaultInvoiceColumns) })
+
+	menu.Exec2(w.invoicesTableView.HorizontalHeader().MapToGlobal(pos), nil)
+}
+
+// toggleColumn() shows or hides the column with the key. The last column
+// shown cannot be hidden.
+func (w *MainWindow) toggleColumn(key string, show bool) {
+	var keys []string
+	for _, k := range w.columnKeys {
+		if k != key {
+			keys = append(keys, k)
+		}
+	}
+	if show {
+		keys = append(keys, key)
+	} else if len(w.invoicesModel.columns()) <= 1 {
+		return
+	}
+	w.setColumns(keys)
+}
+
+// configureColumns() opens the Columns dialog.
+func (w *MainWindow) configureColumns() {
+	dialog := NewColumnsDialog(nil, 0)
+	dialog.initWith(w.QWidget_PTR(), w.columnKeys)
+	if dialog.Exec() != int(widgets.QDialog__Accepted) {
+		return
+	}
+	if keys := dialog.keys(); len(keys) > 0 {
+		w.setColumns(keys)
+	}
+}
+
+// moveColumn() keeps the order of the columns after a header section was
+// dragged to a new place.
+func (w *MainWindow) moveColumn(logicalIndex, oldVisualIndex, newVisualIndex int) {
+	header := w.invoicesTableView.HorizontalHeader()
+	columns := w.invoicesModel.columns()
+	keys := make([]string, 0, len(w.columnKeys))
+	if w.tableCase == "individual" && containsString(w.columnKeys, "vendor") {
+		// the vendor column is hidden from the table of one vendor
+		keys = append(keys, "vendor")
+	}
+	for visual := 0; visual < len(columns); visual++ {
+		if logical := header.LogicalIndex(visual); logical >= 0 && logical < len(columns) {
+			keys = append(keys, columns[logical].key)
+		}
+	}
+	w.setColumns(keys)
+}
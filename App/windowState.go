@@ -0,0 +1,120 @@
+// Copyright 2016 Cory Robinson. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE.txt file.
+
+// windowState.go keeps the state of the main window in the settings file:
+// its size and place, the sizes of its panes, the widths of the columns of
+// the invoices table and the vendor selected. The state is saved when the
+// window is closed and restored when it is opened again.
+
+package main
+
+import (
+	"github.com/therecipe/qt/core"
+	"github.com/therecipe/qt/gui"
+	"github.com/therecipe/qt/widgets"
+)
+
+// The size of the main window of a new install, which is also its minimum.
+const (
+	windowWidth  = 950
+	windowHeight = 600
+)
+
+// restoreWindowState() sizes the main window, its panes and the columns of
+// the invoices table as they were, and has setVendorView() select the
+// vendor selected last.
+func (w *MainWindow) restoreWindowState() {
+	settings := core.NewQSettings("airpaio", "InvoiceViewer", nil)
+
+	w.SetMinimumSize2(windowWidth, windowHeight)
+	w.Resize2(windowWidth, windowHeight)
+	if geometry := parseInts(settings.Value("window/geometry", core.NewQVariant14("")).ToString()); len(geometry) == 4 {
+		w.Move2(geometry[0], geometry[1])
+		w.Resize2(max(geometry[2], windowWidth), max(geometry[3], windowHeight))
+	}
+	if settings.Value("window/maximized", core.NewQVariant14("false")).ToString() == "true" {
+		w.SetWindowState(core.Qt__WindowMaximized)
+	}
+	if sizes := parseInts(settings.Value("window/splitter", core.NewQVariant14("")).ToString()); len(sizes) == w.splitter.Count() {
+		w.splitter.SetSizes(sizes)
+	}
+
+	w.columnWidths = parseColumnWidths(settings.Value("invoices/widths", core.NewQVariant14("")).ToString())
+	w.restoreVendor = settings.Value("view/vendor", core.NewQVariant14("")).ToString()
+}
+
+// saveWindowState() writes the state of the main window to the settings.
+// The size and place of a maximized window are those it had before, so
+// they are left as they were.
+func (w *MainWindow) saveWindowState() {
+	settings := core.NewQSettings("airpaio", "InvoiceViewer", nil)
+
+	maximized := w.IsMaximized()
+	if !maximized && !w.IsMinimized() {
+		geometry := []int{w.X(), w.Y(), w.Width(), w.Height()}
+		settings.SetValue("window/geometry", core.NewQVariant14(formatInts(geometry)))
+	}
+	if maximized {
+		settings.SetValue("window/maximized", core.NewQVariant14("true"))
+	} else {
+		settings.SetValue("window/maximized", core.NewQVariant14("false"))
+	}
+	settings.SetValue("window/splitter", core.NewQVariant14(formatInts(w.splitter.Sizes())))
+	settings.SetValue("invoices/widths", core.NewQVariant14(formatColumnWidths(w.columnWidths)))
+	settings.SetValue("view/vendor", core.NewQVariant14(w.vendorView.CurrentText()))
+}
+
+// resetWindowState() forgets the state of the main window, and sizes the
+// window, its panes and the columns as on a new install.
+func (w *MainWindow) resetWindowState() {
+	settings := core.NewQSettings("airpaio", "InvoiceViewer", nil)
+	for _, key := range []string{"window/geometry", "window/maximized", "window/splitter", "invoices/widths"} {
+		settings.Remove(key)
+	}
+
+	w.SetWindowState(core.Qt__WindowNoState)
+	w.Resize2(windowWidth, windowHeight)
+	w.splitter.SetSizes([]int{575, windowWidth - 575})
+	w.columnWidths = map[string]int{}
+	w.adjustHeader()
+}
+
+// closeEvent() saves the state of the main window as it is closed.
+func (w *MainWindow) closeEvent(event *gui.QCloseEvent) {
+	w.saveWindowState()
+	w.CloseEventDefault(event)
+}
+
+// recordColumnWidth() remembers the width of a column of the invoices
+// table resized by the user. The column which takes the room left has no
+// width of its own, and neither do columns sized by adjustHeader().
+func (w *MainWindow) recordColumnWidth(logicalIndex, oldSize, newSize int) {
+	columns := w.invoicesModel.columns()
+	if w.adjustingHeader || newSize <= 0 || logicalIndex < 0 || logicalIndex >= len(columns) {
+		return
+	}
+	header := w.invoicesTableView.HorizontalHeader()
+	if header.SectionResizeMode(logicalIndex) == widgets.QHeaderView__Stretch {
+		return
+	}
+	w.columnWidths[columns[logicalIndex].key] = newSize
+}
+
+// editPreferences() opens the Preferences dialog and puts the preferences
+// into effect, showing the invoices again in the date format picked.
+func (w *MainWindow) editPreferences() {
+	dialog := NewPreferencesDialog(nil, 0)
+	dialog.initWith(w.QWidget_PTR(), readPreferences())
+	if dialog.Exec() != int(widgets.QDialog__Accepted) {
+		return
+	}
+
+	p := dialog.preferences()
+	storePreferences(p)
+	applyPreferences(p)
+	if dialog.resetLayout() {
+		w.resetWindowState()
+	}
+	w.reload()
+}
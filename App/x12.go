@@ -0,0 +1,821 @@
+// Copyright 2016 Cory Robinson. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE.txt file.
+
+// x12.go implements ANSI X12 EDI invoices: reading 810 invoice transaction
+// sets into Invoice records, writing outbound 810s and generating the 997
+// functional acknowledgment for a received interchange.
+//
+// An interchange is ISA ... IEA holding functional groups GS ... GE, which
+// hold the transaction sets ST ... SE. The separators are taken from the
+// ISA segment. Envelope and syntax problems are collected per group and
+// transaction set with their X12 error codes, so they can be reported back
+// in the 997; problems mapping a valid 810 onto an Invoice have no code.
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// X12 version written to outbound interchanges and groups.
+const (
+	x12InterchangeVersion = "00401"
+	x12GroupVersion       = "004010"
+)
+
+// x12Units maps X12 unit of measure codes to UN/ECE rec 20 codes, as used
+// by Item.UnitCode. Codes not listed are kept as they are.
+var x12Units = map[string]string{
+	"EA": "C62", "CA": "CS", "DZ": "DZN", "HR": "HUR", "LB": "LBR",
+	"KG": "KGM", "FT": "FOT", "GA": "GLL", "MO": "MON", "DA": "DAY",
+}
+
+// x12SegmentID matches a syntactically valid segment identifier.
+var x12SegmentID = regexp.MustCompile(`^[A-Z][A-Z0-9]{1,2}$`)
+
+// X12Error is a problem found in an X12 transaction set. Code is the X12
+// syntax error code reported in the 997: an AK304 segment code if Element
+// is 0, otherwise an AK403 element code. Errors without a code are
+// problems mapping the 810 onto an Invoice.
+type X12Error struct {
+	Segment  string // segment id, i.e. IT1
+	Position int    // position of the segment in the transaction set, ST is 1
+	Element  int    // position of the element in the segment, 0 for the segment
+	Code     string
+	Msg      string
+}
+
+func (e X12Error) Error() string {
+	if e.Element > 0 {
+		return fmt.Sprintf("segment %d %s%02d: %s", e.Position, e.Segment, e.Element, e.Msg)
+	}
+	return fmt.Sprintf("segment %d %s: %s", e.Position, e.Segment, e.Msg)
+}
+
+// X12Transaction is a transaction set. Codes are the AK5 transaction set
+// syntax error codes.
+type X12Transaction struct {
+	ID            string // ST01, i.e. 810
+	ControlNumber string // ST02
+	Invoice       Invoice
+	Errors        []X12Error
+	Codes         []string
+}
+
+// Accepted reports whether the transaction set has no syntax errors.
+func (t X12Transaction) Accepted() bool {
+	if len(t.Codes) > 0 {
+		return false
+	}
+	for _, e := range t.Errors {
+		if e.Code != "" {
+			return false
+		}
+	}
+	return true
+}
+
+// X12Group is a functional group. Codes are the AK9 functional group
+// syntax error codes.
+type X12Group struct {
+	FunctionalID  string // GS01, IN for invoices
+	Sender        string // GS02
+	Receiver      string // GS03
+	ControlNumber string // GS06
+	Version       string // GS08
+	Count         int    // GE01, the number of transaction sets included
+	Transactions  []X12Transaction
+	Codes         []string
+}
+
+// X12Interchange is a received interchange.
+type X12Interchange struct {
+	SenderQualifier   string // ISA05
+	SenderID          string // ISA06
+	ReceiverQualifier string // ISA07
+	ReceiverID        string // ISA08
+	ControlNumber     string // ISA13
+	Test              bool   // ISA15 is T
+	Groups            []X12Group
+}
+
+// Invoices returns the invoices of all transaction sets without errors.
+func (ic *X12Interchange) Invoices() Invoices {
+	var invoices Invoices
+	for _, group := range ic.Groups {
+		for _, t := range group.Transactions {
+			if t.ID == "810" && len(t.Errors) == 0 && len(t.Codes) == 0 {
+				invoices = append(invoices, t.Invoice)
+			}
+		}
+	}
+	return invoices
+}
+
+// x12Segment is a segment split into its elements; [0] is the segment id.
+type x12Segment []string
+
+// el returns element i of the segment, or "" if it is not present.
+func (s x12Segment) el(i int) string {
+	if i < len(s) {
+		return strings.TrimSpace(s[i])
+	}
+	return ""
+}
+
+// ReadX12 reads the interchanges in an X12 document.
+func ReadX12(r io.Reader) ([]*X12Interchange, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var interchanges []*X12Interchange
+	text := strings.TrimLeft(string(data), "\ufeff \t\r\n")
+	for text != "" {
+		segments, rest, err := splitX12Interchange(text)
+		if err != nil {
+			return interchanges, err
+		}
+		ic, err := readX12Interchange(segments)
+		if err != nil {
+			return interchanges, err
+		}
+		interchanges = append(interchanges, ic)
+		text = strings.TrimLeft(rest, " \t\r\n")
+	}
+
+	if len(interchanges) == 0 {
+		return nil, fmt.Errorf("no X12 interchange found")
+	}
+	return interchanges, nil
+}
+
+// splitX12Interchange splits the interchange at the start of text into its
+// segments, using the separators from the fixed length ISA segment, and
+// returns the text after its IEA segment.
+func splitX12Interchange(text string) ([]x12Segment, string, error) {
+	if !strings.HasPrefix(text, "ISA") || len(text) < 106 {
+		return nil, "", fmt.Errorf("not an X12 interchange: missing ISA segment")
+	}
+	element, component, terminator := text[3], text[104], text[105]
+	if element == component || element == terminator {
+		return nil, "", fmt.Errorf("invalid X12 separators in ISA segment")
+	}
+
+	var segments []x12Segment
+	for text != "" {
+		end := strings.IndexByte(text, terminator)
+		if end < 0 {
+			end = len(text)
+		}
+		raw := strings.Trim(text[:end], "\r\n")
+		text = text[min(end+1, len(text)):]
+		if raw == "" {
+			continue
+		}
+
+		segment := x12Segment(strings.Split(raw, string(element)))
+		segments = append(segments, segment)
+		if segment[0] == "IEA" {
+			return segments, text, nil
+		}
+	}
+
+	return nil, "", fmt.Errorf("interchange %s has no IEA trailer", segments[0].el(13))
+}
+
+// readX12Interchange checks the envelopes of an interchange and maps its
+// transaction sets. Problems with the interchange envelope itself, which a
+// 997 cannot report, are returned as an error.
+func readX12Interchange(segments []x12Segment) (*X12Interchange, error) {
+	isa := segments[0]
+	if len(isa) < 17 {
+		return nil, fmt.Errorf("ISA segment has %d elements, want 16", len(isa)-1)
+	}
+	ic := &X12Interchange{
+		SenderQualifier:   isa.el(5),
+		SenderID:          isa.el(6),
+		ReceiverQualifier: isa.el(7),
+		ReceiverID:        isa.el(8),
+		ControlNumber:     isa.el(13),
+		Test:              isa.el(15) == "T",
+	}
+
+	var group *X12Group
+	var transaction []x12Segment
+	closeTransaction := func(trailer bool) {
+		if transaction != nil {
+			group.Transactions = append(group.Transactions, readX12Transaction(transaction, trailer))
+			transaction = nil
+		}
+	}
+	closeGroup := func(ge x12Segment) {
+		if group == nil {
+			return
+		}
+		closeTransaction(false)
+		if ge == nil {
+			group.Codes = append(group.Codes, "3") // functional group trailer missing
+			group.Count = len(group.Transactions)
+		} else {
+			group.Count, _ = strconv.Atoi(ge.el(1))
+			if ge.el(2) != group.ControlNumber {
+				group.Codes = append(group.Codes, "4") // group control number mismatch
+			}
+			if group.Count != len(group.Transactions) {
+				group.Codes = append(group.Codes, "5") // number of transaction sets mismatch
+			}
+		}
+		ic.Groups = append(ic.Groups, *group)
+		group = nil
+	}
+
+	for _, segment := range segments[1:] {
+		switch segment[0] {
+		case "GS":
+			closeGroup(nil)
+			group = &X12Group{
+				FunctionalID:  segment.el(1),
+				Sender:        segment.el(2),
+				Receiver:      segment.el(3),
+				ControlNumber: segment.el(6),
+				Version:       segment.el(8),
+			}
+			if group.FunctionalID != "IN" {
+				group.Codes = append(group.Codes, "1") // functional group not supported
+			}
+			if !strings.HasPrefix(group.Version, "004") && !strings.HasPrefix(group.Version, "005") {
+				group.Codes = append(group.Codes, "2") // version not supported
+			}
+		case "GE":
+			closeGroup(segment)
+		case "IEA":
+			closeGroup(nil)
+			if segment.el(2) != ic.ControlNumber {
+				return ic, fmt.Errorf("interchange control number %s does not match IEA %s", ic.ControlNumber, segment.el(2))
+			}
+			if count, _ := strconv.Atoi(segment.el(1)); count != len(ic.Groups) {
+				return ic, fmt.Errorf("interchange %s has %d functional groups, IEA says %d",
+					ic.ControlNumber, len(ic.Groups), count)
+			}
+		default:
+			if group == nil {
+				return ic, fmt.Errorf("interchange %s: %s segment outside of a functional group",
+					ic.ControlNumber, segment[0])
+			}
+			if segment[0] == "ST" {
+				closeTransaction(false)
+				transaction = []x12Segment{segment}
+				continue
+			}
+			if transaction == nil {
+				continue // stray segment between transaction sets, reported with the group count
+			}
+			transaction = append(transaction, segment)
+			if segment[0] == "SE" {
+				closeTransaction(true)
+			}
+		}
+	}
+
+	return ic, nil
+}
+
+// readX12Transaction checks the ST/SE envelope of a transaction set and
+// maps it. trailer is false if the set ended without an SE segment.
+func readX12Transaction(segments []x12Segment, trailer bool) X12Transaction {
+	st := segments[0]
+	t := X12Transaction{ID: st.el(1), ControlNumber: st.el(2)}
+
+	body := segments[1:]
+	if !trailer {
+		t.Codes = append(t.Codes, "2") // transaction set trailer missing
+	} else {
+		se := segments[len(segments)-1]
+		body = segments[1 : len(segments)-1]
+		if se.el(2) != t.ControlNumber {
+			t.Codes = append(t.Codes, "3") // control number mismatch
+		}
+		if count, _ := strconv.Atoi(se.el(1)); count != len(segments) {
+			t.Codes = append(t.Codes, "4") // number of included segments mismatch
+		}
+	}
+
+	if t.ID != "810" {
+		t.Codes = append(t.Codes, "1") // transaction set not supported
+		return t
+	}
+
+	t.Invoice, t.Errors = readX12Invoice(body)
+	for _, e := range t.Errors {
+		if e.Code != "" {
+			t.Codes = append(t.Codes, "5") // one or more segments in error
+			break
+		}
+	}
+	return t
+}
+
+// readX12Invoice maps the segments of an 810 between ST and SE onto an
+// Invoice. Charges and allowances (SAC) become line items of their own, so
+// the line items and tax add up to the invoice total.
+func readX12Invoice(segments []x12Segment) (Invoice, []X12Error) {
+	var errs []X12Error
+	invoice := Invoice{Currency: "USD"}
+
+	var vendor Party
+	var party *Party // the party of the current N1 loop
+	var item *Item   // the item of the current IT1 loop
+	terms := -1      // ITD07 net days, if given
+	haveBIG, haveTDS := false, false
+	lines := 0
+
+	for i, segment := range segments {
+		position := i + 2 // ST is position 1
+		fail := func(element int, code, msg string) {
+			errs = append(errs, X12Error{segment[0], position, element, code, msg})
+		}
+		amount := func(element int, implied bool) int64 {
+			value := segment.el(element)
+			if value == "" {
+				return 0
+			}
+			if implied {
+				// N2: an integer with two implied decimals
+				cents, err := strconv.ParseInt(value, 10, 64)
+				if err != nil {
+					fail(element, "6", fmt.Sprintf("%q is not a valid amount", value))
+				}
+				return cents
+			}
+			cents, err := parseDecimalCents(value)
+			if err != nil {
+				fail(element, "6", err.Error())
+			}
+			return cents
+		}
+
+		if !x12SegmentID.MatchString(segment[0]) {
+			fail(0, "1", "unrecognized segment id")
+			continue
+		}
+		if segment[0] != "N2" && segment[0] != "N3" && segment[0] != "N4" && segment[0] != "REF" && segment[0] != "PER" {
+			party = nil
+		}
+
+		switch segment[0] {
+		case "BIG":
+			haveBIG = true
+			date, ok := x12Date(segment.el(1))
+			if !ok {
+				fail(1, "8", fmt.Sprintf("%q is not a valid date", segment.el(1)))
+			}
+			invoice.Date = date
+			invoice.InvoiceNo = segment.el(2)
+			if invoice.InvoiceNo == "" {
+				fail(2, "1", "invoice number is required")
+			}
+			invoice.PurchaseOrder = segment.el(4)
+			invoice.CreditNote = segment.el(7) == "CR"
+
+		case "CUR":
+			if currency := segment.el(2); currency != "" {
+				invoice.Currency = currency
+			}
+
+		case "N1":
+			switch segment.el(1) {
+			case "SE", "RI", "SU", "VN":
+				// selling party, remit to, supplier or vendor; the first one wins
+				if vendor.Name == "" {
+					party = &vendor
+				}
+			case "BT", "BY", "ST":
+				if invoice.Buyer.Name == "" {
+					party = &invoice.Buyer
+				}
+			case "":
+				fail(1, "1", "entity identifier code is required")
+			}
+			if party != nil {
+				party.Name = segment.el(2)
+				if segment.el(3) != "" {
+					party.IDs.EndpointScheme = segment.el(3)
+					party.IDs.EndpointID = segment.el(4)
+				}
+			}
+
+		case "N3":
+			if party != nil {
+				party.Address.Street = strings.Trim(segment.el(1)+", "+segment.el(2), ", ")
+			}
+
+		case "N4":
+			if party != nil {
+				party.Address.City = segment.el(1)
+				party.Address.State = segment.el(2)
+				party.Address.Zipcode = segment.el(3)
+				party.Address.Country = segment.el(4)
+			}
+
+		case "ITD":
+			if date, ok := x12Date(segment.el(6)); ok {
+				invoice.DueDate = date
+			} else if days, err := strconv.Atoi(segment.el(7)); err == nil {
+				terms = days
+			}
+
+		case "IT1":
+			lines++
+			invoice.LineItems = append(invoice.LineItems, Item{})
+			item = &invoice.LineItems[len(invoice.LineItems)-1]
+
+			quantity, err := strconv.ParseFloat(segment.el(2), 64)
+			switch {
+			case segment.el(2) == "":
+				fail(2, "1", "quantity invoiced is required")
+			case err != nil:
+				fail(2, "6", fmt.Sprintf("%q is not a valid quantity", segment.el(2)))
+			case quantity < 0 || quantity > math.MaxUint16 || quantity != math.Trunc(quantity):
+				fail(2, "", fmt.Sprintf("%q is not a whole number quantity", segment.el(2)))
+			default:
+				item.Quantity = uint16(quantity)
+			}
+			if segment.el(3) == "" {
+				fail(3, "1", "unit of measure is required")
+			}
+			item.UnitCode = x12Units[segment.el(3)]
+			if item.UnitCode == "" {
+				item.UnitCode = segment.el(3)
+			}
+			if segment.el(4) == "" {
+				fail(4, "1", "unit price is required")
+			}
+			item.Amount = amount(4, false)
+
+			// product ids come in qualifier, id pairs from IT106 on; the
+			// vendor's part number is preferred
+			for e := 6; e+1 < len(segment); e += 2 {
+				if id := segment.el(e + 1); id != "" && (item.ProductID == "" || segment.el(e) == "VP") {
+					item.ProductID = id
+				}
+			}
+
+		case "PID":
+			if item != nil && item.Description == "" {
+				item.Description = segment.el(5)
+			}
+
+		case "TXI":
+			// header taxes come after TDS, line taxes inside the IT1 loop;
+			// both add to the tax total
+			invoice.TaxTotal += amount(2, false)
+			if item != nil && !haveTDS {
+				item.TaxCategory = "S"
+				item.TaxPercent, _ = strconv.ParseFloat(segment.el(3), 64)
+			}
+
+		case "SAC":
+			cents := amount(5, true)
+			if segment.el(1) == "A" {
+				cents = -cents
+			}
+			description := segment.el(15)
+			if description == "" {
+				description = segment.el(2)
+			}
+			if cents != 0 {
+				invoice.LineItems = append(invoice.LineItems, Item{ProductID: "SAC-" + segment.el(2),
+					Description: description, Quantity: 1, Amount: cents, UnitCode: "C62"})
+				item = nil
+			}
+
+		case "TDS":
+			haveTDS = true
+			item = nil
+			if segment.el(1) == "" {
+				fail(1, "1", "total invoice amount is required")
+			}
+			invoice.Total = amount(1, true)
+
+		case "CTT":
+			if count, err := strconv.Atoi(segment.el(1)); err == nil && count != lines {
+				fail(1, "", fmt.Sprintf("%d line items, CTT says %d", lines, count))
+			}
+		}
+	}
+
+	invoice.Vendor = vendor.Name
+	invoice.Address = vendor.Address
+	invoice.VendorIDs = vendor.IDs
+
+	if !haveBIG {
+		errs = append(errs, X12Error{"BIG", 2, 0, "3", "mandatory segment missing"})
+	}
+	if !haveTDS {
+		errs = append(errs, X12Error{"TDS", len(segments) + 1, 0, "3", "mandatory segment missing"})
+	}
+	if invoice.DueDate == "" && terms >= 0 {
+		if date, err := time.Parse("01/02/2006", invoice.Date); err == nil {
+			invoice.DueDate = date.AddDate(0, 0, terms).Format("01/02/2006")
+		}
+	}
+
+	return invoice, errs
+}
+
+// ReadX12File reads the interchanges in an X12 file, see ReadX12.
+func ReadX12File(name string) ([]*X12Interchange, error) {
+	file, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	return ReadX12(file)
+}
+
+// x12Date parses a CCYYMMDD or YYMMDD date into MM/DD/YYYY.
+func x12Date(s string) (string, bool) {
+	layout := "20060102"
+	if len(s) == 6 {
+		layout = "060102"
+	}
+	t, err := time.Parse(layout, s)
+	if err != nil {
+		return "", false
+	}
+	return t.Format("01/02/2006"), true
+}
+
+// X12Config holds the envelope settings of outbound interchanges.
+type X12Config struct {
+	SenderQualifier   string    // ISA05, i.e. ZZ for a mutually defined id
+	SenderID          string    // ISA06 and GS02
+	ReceiverQualifier string    // ISA07
+	ReceiverID        string    // ISA08 and GS03
+	ControlNumber     int       // ISA13 and GS06
+	Test              bool      // mark the interchange as test data
+	Time              time.Time // envelope date and time, the zero time for now
+}
+
+// x12Writer writes an interchange with one functional group, using * as
+// the element separator, > for components and ~ to end a segment.
+type x12Writer struct {
+	w        io.Writer
+	config   X12Config
+	segments int // segments in the current transaction set
+	err      error
+}
+
+// x12Clean removes the separators from an element value.
+func x12Clean(s string) string {
+	return strings.TrimSpace(strings.Map(func(c rune) rune {
+		if c == '*' || c == '~' || c == '>' || c == '\r' || c == '\n' {
+			return ' '
+		}
+		return c
+	}, s))
+}
+
+// segment writes a segment, leaving out trailing empty elements.
+func (x *x12Writer) segment(id string, elements ...string) {
+	for len(elements) > 0 && elements[len(elements)-1] == "" {
+		elements = elements[:len(elements)-1]
+	}
+	for i := range elements {
+		elements[i] = x12Clean(elements[i])
+	}
+	x.write(strings.Join(append([]string{id}, elements...), "*") + "~\n")
+	x.segments++
+}
+
+// write writes raw text, keeping the first error.
+func (x *x12Writer) write(s string) {
+	if x.err == nil {
+		_, x.err = io.WriteString(x.w, s)
+	}
+}
+
+// begin writes the ISA and GS headers.
+func (x *x12Writer) begin(functionalID string) error {
+	config := x.config
+	for _, id := range []string{config.SenderID, config.ReceiverID} {
+		if id == "" || len(id) > 15 {
+			return fmt.Errorf("interchange sender and receiver ids must be 1 to 15 characters, got %q", id)
+		}
+	}
+	if config.ControlNumber < 0 || config.ControlNumber > 999999999 {
+		return fmt.Errorf("control number %d out of range", config.ControlNumber)
+	}
+	if config.Time.IsZero() {
+		x.config.Time = time.Now()
+	}
+	usage := "P"
+	if config.Test {
+		usage = "T"
+	}
+	t := x.config.Time
+
+	x.write(fmt.Sprintf("ISA*00*%-10s*00*%-10s*%-2s*%-15s*%-2s*%-15s*%s*%s*U*%s*%09d*0*%s*>~\n",
+		"", "", config.SenderQualifier, x12Clean(config.SenderID), config.ReceiverQualifier, x12Clean(config.ReceiverID),
+		t.Format("060102"), t.Format("1504"), x12InterchangeVersion, config.ControlNumber, usage))
+	x.segment("GS", functionalID, config.SenderID, config.ReceiverID, t.Format("20060102"), t.Format("1504"),
+		strconv.Itoa(config.ControlNumber), "X", x12GroupVersion)
+	return x.err
+}
+
+// startTransaction writes the ST header of transaction set n.
+func (x *x12Writer) startTransaction(id string, n int) {
+	x.segments = 0
+	x.segment("ST", id, fmt.Sprintf("%04d", n))
+}
+
+// endTransaction writes the SE trailer of transaction set n.
+func (x *x12Writer) endTransaction(n int) {
+	x.segment("SE", strconv.Itoa(x.segments+1), fmt.Sprintf("%04d", n))
+}
+
+// end writes the GE and IEA trailers for count transaction sets.
+func (x *x12Writer) end(count int) error {
+	x.segment("GE", strconv.Itoa(count), strconv.Itoa(x.config.ControlNumber))
+	x.segment("IEA", "1", fmt.Sprintf("%09d", x.config.ControlNumber))
+	return x.err
+}
+
+// WriteX12Invoices writes the invoices as one interchange of 810
+// transaction sets.
+func WriteX12Invoices(w io.Writer, invoices Invoices, config X12Config) error {
+	x := &x12Writer{w: w, config: config}
+	if err := x.begin("IN"); err != nil {
+		return err
+	}
+
+	units := map[string]string{}
+	for x12Unit, unit := range x12Units {
+		units[unit] = x12Unit
+	}
+
+	for n, invoice := range invoices {
+		x.startTransaction("810", n+1)
+
+		transactionType := ""
+		if invoice.CreditNote {
+			transactionType = "CR"
+		}
+		x.segment("BIG", ciiDate(invoice.Date), invoice.InvoiceNo, "", invoice.PurchaseOrder, "", "", transactionType)
+		if invoice.Currency != "" {
+			x.segment("CUR", "SE", invoice.Currency)
+		}
+
+		x12Party(x, "SE", Party{Name: invoice.Vendor, Address: invoice.Address, IDs: invoice.VendorIDs})
+		if invoice.Buyer.Name != "" {
+			x12Party(x, "BT", invoice.Buyer)
+		}
+		if invoice.DueDate != "" {
+			x.segment("ITD", "01", "3", "", "", "", ciiDate(invoice.DueDate))
+		}
+
+		for i, item := range invoice.LineItems {
+			unit := units[item.UnitCode]
+			if unit == "" {
+				unit = item.UnitCode
+			}
+			if unit == "" {
+				unit = "EA"
+			}
+			productQualifier := ""
+			if item.ProductID != "" {
+				productQualifier = "VP"
+			}
+			x.segment("IT1", strconv.Itoa(i+1), strconv.Itoa(int(item.Quantity)), unit,
+				centsString(item.Amount), "", productQualifier, item.ProductID)
+			if item.Description != "" {
+				x.segment("PID", "F", "", "", "", item.Description)
+			}
+		}
+
+		x.segment("TDS", strconv.FormatInt(invoice.Total, 10))
+		if invoice.TaxTotal != 0 {
+			x.segment("TXI", "TX", centsString(invoice.TaxTotal))
+		}
+		x.segment("CTT", strconv.Itoa(len(invoice.LineItems)))
+		x.endTransaction(n + 1)
+	}
+
+	return x.end(len(invoices))
+}
+
+// x12Party writes the N1 loop of a party.
+func x12Party(x *x12Writer, code string, party Party) {
+	if party.IDs.EndpointID != "" {
+		x.segment("N1", code, party.Name, party.IDs.EndpointScheme, party.IDs.EndpointID)
+	} else {
+		x.segment("N1", code, party.Name)
+	}
+	if party.Address.Street != "" {
+		x.segment("N3", party.Address.Street)
+	}
+	address := party.Address
+	if address.City != "" || address.State != "" || address.Zipcode != "" {
+		x.segment("N4", address.City, address.State, address.Zipcode, address.Country)
+	}
+}
+
+// WriteX12Acknowledgment writes a 997 functional acknowledgment for a
+// received interchange, with one transaction set per functional group.
+// Sender and receiver default to the receiver and sender of ic.
+func WriteX12Acknowledgment(w io.Writer, ic *X12Interchange, config X12Config) error {
+	if config.SenderID == "" {
+		config.SenderQualifier, config.SenderID = ic.ReceiverQualifier, ic.ReceiverID
+	}
+	if config.ReceiverID == "" {
+		config.ReceiverQualifier, config.ReceiverID = ic.SenderQualifier, ic.SenderID
+	}
+	config.Test = config.Test || ic.Test
+
+	x := &x12Writer{w: w, config: config}
+	if err := x.begin("FA"); err != nil {
+		return err
+	}
+
+	for n, group := range ic.Groups {
+		x.startTransaction("997", n+1)
+		x.segment("AK1", group.FunctionalID, group.ControlNumber)
+
+		supported := true
+		for _, code := range group.Codes {
+			if code == "1" || code == "2" {
+				supported = false
+			}
+		}
+
+		accepted := 0
+		for _, t := range group.Transactions {
+			x.segment("AK2", t.ID, t.ControlNumber)
+			lastPosition := 0
+			for _, e := range t.Errors {
+				if e.Code == "" {
+					continue
+				}
+				if e.Element == 0 {
+					x.segment("AK3", e.Segment, strconv.Itoa(e.Position), "", e.Code)
+					lastPosition = e.Position
+					continue
+				}
+				if e.Position != lastPosition {
+					x.segment("AK3", e.Segment, strconv.Itoa(e.Position), "", "8") // segment has data element errors
+					lastPosition = e.Position
+				}
+				x.segment("AK4", strconv.Itoa(e.Element), "", e.Code)
+			}
+
+			if supported && t.Accepted() {
+				accepted++
+				x.segment("AK5", "A")
+			} else {
+				x.segment("AK5", append([]string{"R"}, x12Codes(t.Codes)...)...)
+			}
+		}
+
+		status := "R"
+		received := len(group.Transactions)
+		switch {
+		case !supported:
+		case accepted == received && len(group.Codes) == 0:
+			status = "A"
+		case accepted == received:
+			status = "E"
+		case accepted > 0:
+			status = "P"
+		}
+		x.segment("AK9", append([]string{status, strconv.Itoa(group.Count), strconv.Itoa(received),
+			strconv.Itoa(accepted)}, x12Codes(group.Codes)...)...)
+		x.endTransaction(n + 1)
+	}
+
+	return x.end(len(ic.Groups))
+}
+
+// x12Codes returns the first five distinct codes, as many as an AK5 or AK9
+// segment holds.
+func x12Codes(codes []string) []string {
+	var distinct []string
+	seen := map[string]bool{}
+	for _, code := range codes {
+		if !seen[code] && len(distinct) < 5 {
+			seen[code] = true
+			distinct = append(distinct, code)
+		}
+	}
+	return distinct
+}
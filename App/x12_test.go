@@ -0,0 +1,219 @@
+// Copyright 2016 Cory Robinson. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE.txt file.
+
+package main
+
+import (
+	"bytes"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// x12Fixtures is the directory of the sample interchanges.
+const x12Fixtures = "../Data/x12/"
+
+// x12FixtureTime is the envelope time of the sample acknowledgments.
+var x12FixtureTime = time.Date(2020, 1, 15, 10, 0, 0, 0, time.UTC)
+
+func TestReadX12Fixtures(t *testing.T) {
+	tests := []struct {
+		file     string
+		test     bool
+		group    X12Group
+		accepted []bool
+		errors   [][]X12Error
+	}{
+		{
+			file: "invoices-810.edi",
+			group: X12Group{FunctionalID: "IN", Sender: "NICHEELEC", Receiver: "AIRPADEMO",
+				ControlNumber: "101", Version: "004010", Count: 2},
+			accepted: []bool{true, true},
+			errors:   [][]X12Error{nil, nil},
+		},
+		{
+			file: "invoices-810-errors.edi",
+			test: true,
+			group: X12Group{FunctionalID: "IN", Sender: "NICHEELEC", Receiver: "AIRPADEMO",
+				ControlNumber: "102", Version: "004010", Count: 2},
+			accepted: []bool{true, false},
+			errors: [][]X12Error{nil, {
+				{"BIG", 2, 1, "8", `"2020011" is not a valid date`},
+				{"BIG", 2, 2, "1", "invoice number is required"},
+				{"IT1", 4, 2, "1", "quantity invoiced is required"},
+				{"IT1", 4, 4, "6", `"abc" is not a valid amount`},
+				{"TDS", 5, 0, "3", "mandatory segment missing"},
+			}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.file, func(t *testing.T) {
+			interchanges, err := ReadX12File(x12Fixtures + tt.file)
+			if err != nil {
+				t.Fatalf("ReadX12File: %v", err)
+			}
+			if len(interchanges) != 1 || len(interchanges[0].Groups) != 1 {
+				t.Fatalf("got %d interchanges, want one with one group", len(interchanges))
+			}
+			ic := interchanges[0]
+			if ic.SenderID != "NICHEELEC" || ic.ReceiverID != "AIRPADEMO" || ic.Test != tt.test {
+				t.Errorf("interchange = %s to %s, test %v", ic.SenderID, ic.ReceiverID, ic.Test)
+			}
+
+			group := ic.Groups[0]
+			transactions := group.Transactions
+			group.Transactions = nil
+			if !reflect.DeepEqual(group, tt.group) {
+				t.Errorf("group = %+v, want %+v", group, tt.group)
+			}
+			if len(transactions) != len(tt.accepted) {
+				t.Fatalf("got %d transaction sets, want %d", len(transactions), len(tt.accepted))
+			}
+			for i, transaction := range transactions {
+				if transaction.Accepted() != tt.accepted[i] {
+					t.Errorf("transaction set %d: Accepted = %v", i+1, transaction.Accepted())
+				}
+				if !reflect.DeepEqual(transaction.Errors, tt.errors[i]) {
+					t.Errorf("transaction set %d: errors = %v, want %v", i+1, transaction.Errors, tt.errors[i])
+				}
+			}
+		})
+	}
+}
+
+func TestMapX12Invoices(t *testing.T) {
+	interchanges, err := ReadX12File(x12Fixtures + "invoices-810.edi")
+	if err != nil {
+		t.Fatalf("ReadX12File: %v", err)
+	}
+	niche := Location{Street: "4410 Industrial Pkwy", City: "Houston", State: "TX", Zipcode: "77041", Country: "US"}
+	buyer := Party{Name: "Airpa Demo Co.",
+		Address: Location{Street: "100 Main St.", City: "Smalltown", State: "TX", Zipcode: "77336", Country: "US"}}
+
+	want := Invoices{
+		{
+			Vendor: "Niche Electronics", Address: niche, VendorIDs: PartyIDs{EndpointID: "NE001", EndpointScheme: "92"},
+			InvoiceNo: "143356", Date: "01/14/2020", PurchaseOrder: "PO-7781", DueDate: "02/13/2020",
+			Currency: "USD", Buyer: buyer, Total: 46654, TaxTotal: 2656,
+			LineItems: Items{
+				{ProductID: "RES-220", Description: "Resistor kit 220 ohm", Quantity: 10, Amount: 1250, UnitCode: "C62"},
+				{ProductID: "OSC-100", Description: "Bench oscilloscope probe set", Quantity: 2, Amount: 14999, UnitCode: "C62"},
+				{ProductID: "SAC-D240", Description: "D240", Quantity: 1, Amount: 1500, UnitCode: "C62"},
+			},
+		},
+		{
+			// the due date follows from the net days of the terms
+			Vendor: "Niche Electronics", Address: niche,
+			InvoiceNo: "143357", Date: "01/14/2020", PurchaseOrder: "PO-7790", DueDate: "02/13/2020",
+			Currency: "USD", Buyer: Party{Name: "Airpa Demo Co."}, Total: 8800,
+			LineItems: Items{
+				{ProductID: "CAP-47U", Description: "Capacitor 47uF, case of 100", Quantity: 4, Amount: 2200, UnitCode: "CS"},
+			},
+		},
+	}
+	got := interchanges[0].Invoices()
+	if len(got) != len(want) {
+		t.Fatalf("got %d invoices, want %d", len(got), len(want))
+	}
+	for i := range want {
+		if !reflect.DeepEqual(got[i], want[i]) {
+			t.Errorf("invoice %d =\n%+v\nwant\n%+v", i+1, got[i], want[i])
+		}
+		if msgs := validateInvoice(got[i]); len(msgs) > 0 {
+			t.Errorf("invoice %d: %v", i+1, msgs)
+		}
+	}
+}
+
+func TestWriteX12Acknowledgment(t *testing.T) {
+	tests := []struct{ file, ack string }{
+		{"invoices-810.edi", "invoices-810-997.edi"},
+		{"invoices-810-errors.edi", "invoices-810-errors-997.edi"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.file, func(t *testing.T) {
+			interchanges, err := ReadX12File(x12Fixtures + tt.file)
+			if err != nil {
+				t.Fatalf("ReadX12File: %v", err)
+			}
+			want, err := os.ReadFile(x12Fixtures + tt.ack)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var ack bytes.Buffer
+			config := X12Config{ControlNumber: 501, Time: x12FixtureTime}
+			if err := WriteX12Acknowledgment(&ack, interchanges[0], config); err != nil {
+				t.Fatalf("WriteX12Acknowledgment: %v", err)
+			}
+			if ack.String() != string(want) {
+				t.Errorf("997 =\n%s\nwant\n%s", ack.String(), want)
+			}
+		})
+	}
+}
+
+func TestReadX12Errors(t *testing.T) {
+	isa := "ISA*00*          *00*          *ZZ*NICHEELEC      *ZZ*AIRPADEMO      *200115*0930*U*00401*000000101*0*P*>~"
+	group := "GS*IN*NICHEELEC*AIRPADEMO*20200115*0930*101*X*004010~ST*810*0001~BIG*20200114*1~TDS*100~SE*4*0001~GE*1*101~"
+
+	tests := []struct {
+		name, edi, want string
+	}{
+		{"empty", "", "no X12 interchange found"},
+		{"no ISA", "GS*IN*NICHEELEC~", "not an X12 interchange"},
+		{"short ISA", "ISA*00*~IEA*1*1~", "not an X12 interchange"},
+		{"bad separators", strings.Replace(isa, ">~", "**", 1) + "IEA*0*000000101*", "invalid X12 separators"},
+		{"no IEA", isa + group, "has no IEA trailer"},
+		{"IEA control number", isa + group + "IEA*1*000000999~", "does not match IEA"},
+		{"IEA group count", isa + group + "IEA*2*000000101~", "has 1 functional groups, IEA says 2"},
+		{"outside of a group", isa + "ST*810*0001~IEA*0*000000101~", "ST segment outside of a functional group"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ReadX12(strings.NewReader(tt.edi))
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("ReadX12: got %v, want an error containing %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestX12RoundTrip(t *testing.T) {
+	interchanges, err := ReadX12File(x12Fixtures + "invoices-810.edi")
+	if err != nil {
+		t.Fatalf("ReadX12File: %v", err)
+	}
+	invoices := interchanges[0].Invoices()
+
+	var edi bytes.Buffer
+	config := X12Config{SenderQualifier: "ZZ", SenderID: "NICHEELEC", ReceiverQualifier: "ZZ", ReceiverID: "AIRPADEMO",
+		ControlNumber: 7, Time: x12FixtureTime}
+	if err := WriteX12Invoices(&edi, invoices, config); err != nil {
+		t.Fatalf("WriteX12Invoices: %v", err)
+	}
+	again, err := ReadX12(&edi)
+	if err != nil {
+		t.Fatalf("ReadX12: %v", err)
+	}
+	for _, transaction := range again[0].Groups[0].Transactions {
+		if len(transaction.Errors) > 0 || len(transaction.Codes) > 0 {
+			t.Errorf("transaction set %s: %v %v", transaction.ControlNumber, transaction.Errors, transaction.Codes)
+		}
+	}
+
+	got := again[0].Invoices()
+	if len(got) != len(invoices) {
+		t.Fatalf("got %d invoices back, want %d", len(got), len(invoices))
+	}
+	for i := range invoices {
+		if got[i].InvoiceNo != invoices[i].InvoiceNo || got[i].Total != invoices[i].Total ||
+			got[i].TaxTotal != invoices[i].TaxTotal || got[i].DueDate != invoices[i].DueDate ||
+			!reflect.DeepEqual(got[i].LineItems, invoices[i].LineItems) {
+			t.Errorf("invoice %d =\n%+v\nwant\n%+v", i+1, got[i], invoices[i])
+		}
+	}
+}
@@ -0,0 +1,202 @@
+// Copyright 2016 Cory Robinson. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE.txt file.
+
+// xmlNode.go implements a small XML element tree used by the e-invoice
+// formats. Elements are looked up with slash separated paths of element
+// names such as "cac:Party/cbc:Name"; namespace prefixes in a path are
+// ignored when matching, so documents using other prefixes still match.
+// When building a document the names are written exactly as given, which
+// keeps the conventional prefixes (cbc:, cac:, ram:, ...) in the output.
+
+package main
+
+import (
+	"encoding/xml"
+	"io"
+	"strings"
+)
+
+// xmlNode is an XML element with its attributes, text and child elements.
+type xmlNode struct {
+	Name     string // local name when parsed, prefixed name when built
+	Attrs    []xml.Attr
+	Text     string
+	Children []*xmlNode
+}
+
+// parseXML reads an XML document into a tree and returns the root element.
+func parseXML(r io.Reader) (*xmlNode, error) {
+	decoder := xml.NewDecoder(r)
+	decoder.CharsetReader = func(charset string, input io.Reader) (io.Reader, error) {
+		return input, nil // treat everything as UTF-8
+	}
+
+	var stack []*xmlNode
+	var root *xmlNode
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		switch t := token.(type) {
+		case xml.StartElement:
+			node := &xmlNode{Name: t.Name.Local}
+			for _, attr := range t.Attr {
+				if attr.Name.Space == "xmlns" || attr.Name.Local == "xmlns" {
+					continue
+				}
+				node.Attrs = append(node.Attrs, xml.Attr{Name: xml.Name{Local: attr.Name.Local}, Value: attr.Value})
+			}
+			if len(stack) > 0 {
+				parent := stack[len(stack)-1]
+				parent.Children = append(parent.Children, node)
+			} else {
+				root = node
+			}
+			stack = append(stack, node)
+		case xml.EndElement:
+			stack = stack[:len(stack)-1]
+		case xml.CharData:
+			if len(stack) > 0 {
+				stack[len(stack)-1].Text += string(t)
+			}
+		}
+	}
+
+	if root == nil {
+		return nil, io.ErrUnexpectedEOF
+	}
+	return root, nil
+}
+
+// localName strips the namespace prefix from an element name.
+func localName(name string) string {
+	if i := strings.LastIndex(name, ":"); i >= 0 {
+		return name[i+1:]
+	}
+	return name
+}
+
+// Local returns the element name without its namespace prefix.
+func (n *xmlNode) Local() string {
+	return localName(n.Name)
+}
+
+// FindAll returns every element matching the path below n.
+func (n *xmlNode) FindAll(path string) []*xmlNode {
+	if n == nil {
+		return nil
+	}
+	nodes := []*xmlNode{n}
+	for _, step := range strings.Split(path, "/") {
+		step = localName(step)
+		var next []*xmlNode
+		for _, node := range nodes {
+			for _, child := range node.Children {
+				if child.Local() == step {
+					next = append(next, child)
+				}
+			}
+		}
+		nodes = next
+	}
+	return nodes
+}
+
+// Find returns the first element matching the path below n, or nil.
+func (n *xmlNode) Find(path string) *xmlNode {
+	if nodes := n.FindAll(path); len(nodes) > 0 {
+		return nodes[0]
+	}
+	return nil
+}
+
+// Value returns the trimmed text of the first element matching the path,
+// or "" if there is none. An empty path returns the text of n itself.
+func (n *xmlNode) Value(path string) string {
+	node := n
+	if path != "" {
+		node = n.Find(path)
+	}
+	if node == nil {
+		return ""
+	}
+	return strings.TrimSpace(node.Text)
+}
+
+// Attr returns the value of an attribute of n, or "".
+func (n *xmlNode) Attr(name string) string {
+	if n == nil {
+		return ""
+	}
+	for _, attr := range n.Attrs {
+		if attr.Name.Local == localName(name) {
+			return attr.Value
+		}
+	}
+	return ""
+}
+
+// Add appends a new child element with the given text and attributes,
+// given as name, value pairs, and returns it.
+func (n *xmlNode) Add(name, text string, attrs ...string) *xmlNode {
+	child := &xmlNode{Name: name, Text: text}
+	for i := 0; i+1 < len(attrs); i += 2 {
+		child.Attrs = append(child.Attrs, xmlAttr(attrs[i], attrs[i+1]))
+	}
+	n.Children = append(n.Children, child)
+	return child
+}
+
+// AddValue is like Add, but skips the element if text is empty.
+func (n *xmlNode) AddValue(name, text string, attrs ...string) {
+	if text != "" {
+		n.Add(name, text, attrs...)
+	}
+}
+
+// xmlAttr returns an attribute with the name written as given.
+func xmlAttr(name, value string) xml.Attr {
+	return xml.Attr{Name: xml.Name{Local: name}, Value: value}
+}
+
+// Write writes the tree as an indented XML document.
+func (n *xmlNode) Write(w io.Writer) error {
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	encoder := xml.NewEncoder(w)
+	encoder.Indent("", "  ")
+	if err := n.encode(encoder); err != nil {
+		return err
+	}
+	if err := encoder.Flush(); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+// encode writes n and its children to the encoder.
+func (n *xmlNode) encode(encoder *xml.Encoder) error {
+	start := xml.StartElement{Name: xml.Name{Local: n.Name}, Attr: n.Attrs}
+	if err := encoder.EncodeToken(start); err != nil {
+		return err
+	}
+	if n.Text != "" {
+		if err := encoder.EncodeToken(xml.CharData(n.Text)); err != nil {
+			return err
+		}
+	}
+	for _, child := range n.Children {
+		if err := child.encode(encoder); err != nil {
+			return err
+		}
+	}
+	return encoder.EncodeToken(start.End())
+}
@@ -7,13 +7,23 @@
 // before running this script. To run the script simply run the command
 // `go run createDummyData.go` in your console.
 //
+// The data goes to the server, database and collection of the flags, or of
+// a connection profile of the app with -profile, i.e.
+// `go run createDummyData.go -profile staging`. The password of a profile
+// is not looked up, put it in -server instead.
+//
 // Feel free to modify this script to meet your needs. You can easily add more data
 // with the err = c.Insert() code in the main() function below.
 
 package main
 
 import (
+	"encoding/json"
+	"flag"
 	"log"
+	"os"
+	"path/filepath"
+	"strings"
 
 	"gopkg.in/mgo.v2"
 )
@@ -22,13 +32,47 @@ import (
 type Repository struct{}
 
 // SERVER the DB server
-const SERVER = "mongodb://localhost:27017"
+var SERVER = "mongodb://localhost:27017"
 
 // DBNAME the name of the DB instance
-const DBNAME = "dummyInvoice"
+var DBNAME = "dummyInvoice"
 
 // COLLECTION is the name of the collection in DB
-const COLLECTION = "invoice"
+var COLLECTION = "invoice"
+
+// profile is a connection profile of the app, see App/profiles.go.
+type profile struct {
+	Name       string `json:"name"`
+	URI        string `json:"uri"`
+	Database   string `json:"database"`
+	Collection string `json:"collection"`
+}
+
+// useProfile sets SERVER, DBNAME and COLLECTION from the connection profile
+// of the app with the name.
+func useProfile(name string) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		log.Fatal(err)
+	}
+	data, err := os.ReadFile(filepath.Join(dir, "InvoiceViewer", "profiles.json"))
+	if err != nil {
+		log.Fatal(err)
+	}
+	var profiles struct {
+		Profiles []profile `json:"profiles"`
+	}
+	if err := json.Unmarshal(data, &profiles); err != nil {
+		log.Fatal(err)
+	}
+	for _, p := range profiles.Profiles {
+		if strings.EqualFold(p.Name, name) {
+			SERVER, DBNAME, COLLECTION = p.URI, p.Database, p.Collection
+			return
+		}
+	}
+	log.Fatalf("there is no profile named %s", name)
+}
 
 type Invoice struct {
 	ID            int      `bson:"id"`
@@ -60,6 +104,27 @@ type Item struct {
 type Items []Item
 
 func main() {
+	profileName := flag.String("profile", "", "connection profile of the app to insert into")
+	flag.StringVar(&SERVER, "server", SERVER, "URL of the MongoDB server")
+	flag.StringVar(&DBNAME, "db", DBNAME, "name of the database")
+	flag.StringVar(&COLLECTION, "collection", COLLECTION, "name of the invoices collection")
+	flag.Parse()
+	if *profileName != "" {
+		server, db, collection := SERVER, DBNAME, COLLECTION
+		useProfile(*profileName)
+		// flags given as well override the profile
+		flag.Visit(func(f *flag.Flag) {
+			switch f.Name {
+			case "server":
+				SERVER = server
+			case "db":
+				DBNAME = db
+			case "collection":
+				COLLECTION = collection
+			}
+		})
+	}
+
 	session, err := mgo.Dial(SERVER)
 	if err != nil {
 		panic(err)
@@ -0,0 +1,25 @@
+module github.com/airpaio/goinvoice
+
+go 1.22
+
+require (
+	github.com/jung-kurt/gofpdf v1.16.2
+	github.com/therecipe/qt v0.0.0-20200904063919-c0c124a5770d
+	github.com/xuri/excelize/v2 v2.9.0
+	golang.org/x/crypto v0.28.0
+	google.golang.org/grpc v1.65.0
+	google.golang.org/protobuf v1.36.11
+	gopkg.in/mgo.v2 v2.0.0-20190816093944-a6b53ec6cb22
+)
+
+require (
+	github.com/mohae/deepcopy v0.0.0-20170929034955-c48cc78d4826 // indirect
+	github.com/richardlehane/mscfb v1.0.4 // indirect
+	github.com/richardlehane/msoleps v1.0.4 // indirect
+	github.com/xuri/efp v0.0.0-20240408161823-9ad904a10d6d // indirect
+	github.com/xuri/nfp v0.0.0-20240318013403-ab9948c2c4a7 // indirect
+	golang.org/x/net v0.30.0 // indirect
+	golang.org/x/sys v0.26.0 // indirect
+	golang.org/x/text v0.19.0 // indirect
+	google.golang.org/genproto/googleapis/rpc v0.0.0-20240528184218-531527333157 // indirect
+)
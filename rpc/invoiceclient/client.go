@@ -0,0 +1,184 @@
+// Copyright 2016 Cory Robinson. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE.txt file.
+
+// Package invoiceclient is the Go client of the invoice gRPC service,
+// served by InvoiceViewer serve -grpc. It wraps the generated stub of
+// rpc/invoicepb, collecting the streamed lists and keeping the request
+// messages out of the way for the common calls:
+//
+//	client, err := invoiceclient.Dial("localhost:9090", invoiceclient.WithLogin("alice", password))
+//	if err != nil {
+//		...
+//	}
+//	defer client.Close()
+//	unpaid, err := client.Invoices(ctx, invoiceclient.Filter{Paid: invoiceclient.Bool(false)})
+//
+// To test against a server in the same process, serve it on a bufconn
+// listener and connect with DialListener.
+package invoiceclient
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"io"
+	"net"
+
+	"github.com/airpaio/goinvoice/rpc/invoicepb"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+// Client is a client of the invoice service.
+type Client struct {
+	conn *grpc.ClientConn // nil if the connection is not owned, see New
+	rpc  invoicepb.InvoiceServiceClient
+}
+
+// Filter selects the invoices listed by Invoices. Empty fields select
+// every invoice.
+type Filter struct {
+	Vendor   string
+	Paid     *bool
+	From, To string // MM/DD/YYYY, inclusive
+	Query    string // text in the vendor, invoice number or purchase order
+}
+
+// Bool returns a pointer to b, for Filter.Paid.
+func Bool(b bool) *bool {
+	return &b
+}
+
+// Dial connects to the service at target. The connection is not encrypted
+// unless the options set transport credentials, as the service is meant for
+// the local network.
+func Dial(target string, opts ...grpc.DialOption) (*Client, error) {
+	opts = append([]grpc.DialOption{grpc.WithTransportCredentials(insecure.NewCredentials())}, opts...)
+	conn, err := grpc.NewClient(target, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return &Client{conn: conn, rpc: invoicepb.NewInvoiceServiceClient(conn)}, nil
+}
+
+// DialListener connects to a service served on an in-process bufconn
+// listener.
+func DialListener(lis *bufconn.Listener, opts ...grpc.DialOption) (*Client, error) {
+	opts = append(opts, grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return lis.DialContext(ctx) }))
+	return Dial("passthrough:///bufconn", opts...)
+}
+
+// basicAuth sends a user name and password with every call, see WithLogin.
+type basicAuth struct {
+	name, password string
+}
+
+func (a basicAuth) GetRequestMetadata(ctx context.Context, uri ...string) (map[string]string, error) {
+	token := base64.StdEncoding.EncodeToString([]byte(a.name + ":" + a.password))
+	return map[string]string{"authorization": "Basic " + token}, nil
+}
+
+func (a basicAuth) RequireTransportSecurity() bool {
+	return false
+}
+
+// WithLogin returns the option of Dial logging in to the service as the
+// user with the name. Without it, calls are only allowed while the invoice
+// DB has no user accounts.
+func WithLogin(name, password string) grpc.DialOption {
+	return grpc.WithPerRPCCredentials(basicAuth{name, password})
+}
+
+// New returns a client using a connection owned by the caller.
+func New(conn grpc.ClientConnInterface) *Client {
+	return &Client{rpc: invoicepb.NewInvoiceServiceClient(conn)}
+}
+
+// Close closes the connection opened by Dial.
+func (c *Client) Close() error {
+	if c.conn == nil {
+		return nil
+	}
+	return c.conn.Close()
+}
+
+// Invoice returns the invoice with the ID.
+func (c *Client) Invoice(ctx context.Context, id int64) (*invoicepb.Invoice, error) {
+	return c.rpc.GetInvoice(ctx, &invoicepb.GetInvoiceRequest{Id: id})
+}
+
+// Invoices returns the invoices selected by the filter, by ID, without
+// their line items, see LineItems.
+func (c *Client) Invoices(ctx context.Context, filter Filter) ([]*invoicepb.Invoice, error) {
+	stream, err := c.rpc.ListInvoices(ctx, &invoicepb.ListInvoicesRequest{
+		Vendor: filter.Vendor,
+		Paid:   filter.Paid,
+		From:   filter.From,
+		To:     filter.To,
+		Query:  filter.Query,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return collect(stream)
+}
+
+// Search returns the invoices selected by a query in the search syntax of
+// the GUI search box, i.e. `vendor:niche paid:false total>100 "hammer"`.
+func (c *Client) Search(ctx context.Context, query string) ([]*invoicepb.Invoice, error) {
+	stream, err := c.rpc.SearchInvoices(ctx, &invoicepb.SearchInvoicesRequest{Query: query})
+	if err != nil {
+		return nil, err
+	}
+	return collect(stream)
+}
+
+// collect receives the invoices of a stream until it ends.
+func collect(stream grpc.ServerStreamingClient[invoicepb.Invoice]) ([]*invoicepb.Invoice, error) {
+	var invoices []*invoicepb.Invoice
+	for {
+		invoice, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			return invoices, nil
+		}
+		if err != nil {
+			return invoices, err
+		}
+		invoices = append(invoices, invoice)
+	}
+}
+
+// LineItems returns the line items of the invoice with the ID.
+func (c *Client) LineItems(ctx context.Context, id int64) ([]*invoicepb.Item, error) {
+	resp, err := c.rpc.ListLineItems(ctx, &invoicepb.ListLineItemsRequest{Id: id})
+	return resp.GetItems(), err
+}
+
+// Vendors returns the vendors with their number of invoices.
+func (c *Client) Vendors(ctx context.Context) ([]*invoicepb.Vendor, error) {
+	resp, err := c.rpc.ListVendors(ctx, &invoicepb.ListVendorsRequest{})
+	return resp.GetVendors(), err
+}
+
+// Counts returns the invoice, vendor and paid counts.
+func (c *Client) Counts(ctx context.Context) (*invoicepb.Counts, error) {
+	return c.rpc.GetCounts(ctx, &invoicepb.GetCountsRequest{})
+}
+
+// Add adds an invoice and returns it with its ID.
+func (c *Client) Add(ctx context.Context, invoice *invoicepb.Invoice) (*invoicepb.Invoice, error) {
+	return c.rpc.AddInvoice(ctx, &invoicepb.AddInvoiceRequest{Invoice: invoice})
+}
+
+// Update replaces the invoice with the ID of the one given.
+func (c *Client) Update(ctx context.Context, invoice *invoicepb.Invoice) (*invoicepb.Invoice, error) {
+	return c.rpc.UpdateInvoice(ctx, &invoicepb.UpdateInvoiceRequest{Invoice: invoice})
+}
+
+// Delete deletes the invoice with the ID.
+func (c *Client) Delete(ctx context.Context, id int64) error {
+	_, err := c.rpc.DeleteInvoice(ctx, &invoicepb.DeleteInvoiceRequest{Id: id})
+	return err
+}
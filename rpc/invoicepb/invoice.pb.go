@@ -0,0 +1,1170 @@
+// Copyright 2016 Cory Robinson. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE.txt file.
+
+// invoice.proto defines the gRPC contract of the invoice service. The
+// messages mirror Invoice, Location and Item of App/model.go; amounts are
+// integer cents and dates MM/DD/YYYY, as in the DB. After changing this
+// file, regenerate the Go code with `go generate` in this directory.
+
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.36.11
+// 	protoc        (unknown)
+// source: invoice.proto
+
+package invoicepb
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	reflect "reflect"
+	sync "sync"
+	unsafe "unsafe"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+type Location struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Street        string                 `protobuf:"bytes,1,opt,name=street,proto3" json:"street,omitempty"`
+	City          string                 `protobuf:"bytes,2,opt,name=city,proto3" json:"city,omitempty"`
+	State         string                 `protobuf:"bytes,3,opt,name=state,proto3" json:"state,omitempty"`
+	Zipcode       string                 `protobuf:"bytes,4,opt,name=zipcode,proto3" json:"zipcode,omitempty"`
+	Country       string                 `protobuf:"bytes,5,opt,name=country,proto3" json:"country,omitempty"` // ISO 3166-1 alpha-2 code, i.e. US
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Location) Reset() {
+	*x = Location{}
+	mi := &file_invoice_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Location) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Location) ProtoMessage() {}
+
+func (x *Location) ProtoReflect() protoreflect.Message {
+	mi := &file_invoice_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Location.ProtoReflect.Descriptor instead.
+func (*Location) Descriptor() ([]byte, []int) {
+	return file_invoice_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *Location) GetStreet() string {
+	if x != nil {
+		return x.Street
+	}
+	return ""
+}
+
+func (x *Location) GetCity() string {
+	if x != nil {
+		return x.City
+	}
+	return ""
+}
+
+func (x *Location) GetState() string {
+	if x != nil {
+		return x.State
+	}
+	return ""
+}
+
+func (x *Location) GetZipcode() string {
+	if x != nil {
+		return x.Zipcode
+	}
+	return ""
+}
+
+func (x *Location) GetCountry() string {
+	if x != nil {
+		return x.Country
+	}
+	return ""
+}
+
+type Item struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	ProductId     string                 `protobuf:"bytes,1,opt,name=product_id,json=productId,proto3" json:"product_id,omitempty"`
+	Description   string                 `protobuf:"bytes,2,opt,name=description,proto3" json:"description,omitempty"`
+	Quantity      uint32                 `protobuf:"varint,3,opt,name=quantity,proto3" json:"quantity,omitempty"`
+	Amount        int64                  `protobuf:"varint,4,opt,name=amount,proto3" json:"amount,omitempty"` // unit price in cents
+	UnitCode      string                 `protobuf:"bytes,5,opt,name=unit_code,json=unitCode,proto3" json:"unit_code,omitempty"`
+	TaxCategory   string                 `protobuf:"bytes,6,opt,name=tax_category,json=taxCategory,proto3" json:"tax_category,omitempty"`
+	TaxPercent    float64                `protobuf:"fixed64,7,opt,name=tax_percent,json=taxPercent,proto3" json:"tax_percent,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Item) Reset() {
+	*x = Item{}
+	mi := &file_invoice_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Item) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Item) ProtoMessage() {}
+
+func (x *Item) ProtoReflect() protoreflect.Message {
+	mi := &file_invoice_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Item.ProtoReflect.Descriptor instead.
+func (*Item) Descriptor() ([]byte, []int) {
+	return file_invoice_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *Item) GetProductId() string {
+	if x != nil {
+		return x.ProductId
+	}
+	return ""
+}
+
+func (x *Item) GetDescription() string {
+	if x != nil {
+		return x.Description
+	}
+	return ""
+}
+
+func (x *Item) GetQuantity() uint32 {
+	if x != nil {
+		return x.Quantity
+	}
+	return 0
+}
+
+func (x *Item) GetAmount() int64 {
+	if x != nil {
+		return x.Amount
+	}
+	return 0
+}
+
+func (x *Item) GetUnitCode() string {
+	if x != nil {
+		return x.UnitCode
+	}
+	return ""
+}
+
+func (x *Item) GetTaxCategory() string {
+	if x != nil {
+		return x.TaxCategory
+	}
+	return ""
+}
+
+func (x *Item) GetTaxPercent() float64 {
+	if x != nil {
+		return x.TaxPercent
+	}
+	return 0
+}
+
+type Invoice struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Id            int64                  `protobuf:"varint,1,opt,name=id,proto3" json:"id,omitempty"`
+	Vendor        string                 `protobuf:"bytes,2,opt,name=vendor,proto3" json:"vendor,omitempty"`
+	Address       *Location              `protobuf:"bytes,3,opt,name=address,proto3" json:"address,omitempty"`
+	Items         []*Item                `protobuf:"bytes,4,rep,name=items,proto3" json:"items,omitempty"`
+	InvoiceNo     string                 `protobuf:"bytes,5,opt,name=invoice_no,json=invoiceNo,proto3" json:"invoice_no,omitempty"`
+	Date          string                 `protobuf:"bytes,6,opt,name=date,proto3" json:"date,omitempty"`
+	PurchaseOrder string                 `protobuf:"bytes,7,opt,name=purchase_order,json=purchaseOrder,proto3" json:"purchase_order,omitempty"`
+	Total         int64                  `protobuf:"varint,8,opt,name=total,proto3" json:"total,omitempty"` // cents, i.e. 7420 --> $74.20
+	Currency      string                 `protobuf:"bytes,9,opt,name=currency,proto3" json:"currency,omitempty"`
+	Paid          bool                   `protobuf:"varint,10,opt,name=paid,proto3" json:"paid,omitempty"`
+	DueDate       string                 `protobuf:"bytes,11,opt,name=due_date,json=dueDate,proto3" json:"due_date,omitempty"`
+	TaxTotal      int64                  `protobuf:"varint,12,opt,name=tax_total,json=taxTotal,proto3" json:"tax_total,omitempty"` // cents, included in total
+	CreditNote    bool                   `protobuf:"varint,13,opt,name=credit_note,json=creditNote,proto3" json:"credit_note,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Invoice) Reset() {
+	*x = Invoice{}
+	mi := &file_invoice_proto_msgTypes[2]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Invoice) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Invoice) ProtoMessage() {}
+
+func (x *Invoice) ProtoReflect() protoreflect.Message {
+	mi := &file_invoice_proto_msgTypes[2]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Invoice.ProtoReflect.Descriptor instead.
+func (*Invoice) Descriptor() ([]byte, []int) {
+	return file_invoice_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *Invoice) GetId() int64 {
+	if x != nil {
+		return x.Id
+	}
+	return 0
+}
+
+func (x *Invoice) GetVendor() string {
+	if x != nil {
+		return x.Vendor
+	}
+	return ""
+}
+
+func (x *Invoice) GetAddress() *Location {
+	if x != nil {
+		return x.Address
+	}
+	return nil
+}
+
+func (x *Invoice) GetItems() []*Item {
+	if x != nil {
+		return x.Items
+	}
+	return nil
+}
+
+func (x *Invoice) GetInvoiceNo() string {
+	if x != nil {
+		return x.InvoiceNo
+	}
+	return ""
+}
+
+func (x *Invoice) GetDate() string {
+	if x != nil {
+		return x.Date
+	}
+	return ""
+}
+
+func (x *Invoice) GetPurchaseOrder() string {
+	if x != nil {
+		return x.PurchaseOrder
+	}
+	return ""
+}
+
+func (x *Invoice) GetTotal() int64 {
+	if x != nil {
+		return x.Total
+	}
+	return 0
+}
+
+func (x *Invoice) GetCurrency() string {
+	if x != nil {
+		return x.Currency
+	}
+	return ""
+}
+
+func (x *Invoice) GetPaid() bool {
+	if x != nil {
+		return x.Paid
+	}
+	return false
+}
+
+func (x *Invoice) GetDueDate() string {
+	if x != nil {
+		return x.DueDate
+	}
+	return ""
+}
+
+func (x *Invoice) GetTaxTotal() int64 {
+	if x != nil {
+		return x.TaxTotal
+	}
+	return 0
+}
+
+func (x *Invoice) GetCreditNote() bool {
+	if x != nil {
+		return x.CreditNote
+	}
+	return false
+}
+
+type GetInvoiceRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Id            int64                  `protobuf:"varint,1,opt,name=id,proto3" json:"id,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GetInvoiceRequest) Reset() {
+	*x = GetInvoiceRequest{}
+	mi := &file_invoice_proto_msgTypes[3]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetInvoiceRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetInvoiceRequest) ProtoMessage() {}
+
+func (x *GetInvoiceRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_invoice_proto_msgTypes[3]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetInvoiceRequest.ProtoReflect.Descriptor instead.
+func (*GetInvoiceRequest) Descriptor() ([]byte, []int) {
+	return file_invoice_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *GetInvoiceRequest) GetId() int64 {
+	if x != nil {
+		return x.Id
+	}
+	return 0
+}
+
+type ListInvoicesRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Vendor        string                 `protobuf:"bytes,1,opt,name=vendor,proto3" json:"vendor,omitempty"` // not case sensitive
+	Paid          *bool                  `protobuf:"varint,2,opt,name=paid,proto3,oneof" json:"paid,omitempty"`
+	From          string                 `protobuf:"bytes,3,opt,name=from,proto3" json:"from,omitempty"`   // first invoice date, MM/DD/YYYY
+	To            string                 `protobuf:"bytes,4,opt,name=to,proto3" json:"to,omitempty"`       // last invoice date, MM/DD/YYYY
+	Query         string                 `protobuf:"bytes,5,opt,name=query,proto3" json:"query,omitempty"` // text in the vendor, invoice number or purchase order
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ListInvoicesRequest) Reset() {
+	*x = ListInvoicesRequest{}
+	mi := &file_invoice_proto_msgTypes[4]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ListInvoicesRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListInvoicesRequest) ProtoMessage() {}
+
+func (x *ListInvoicesRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_invoice_proto_msgTypes[4]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListInvoicesRequest.ProtoReflect.Descriptor instead.
+func (*ListInvoicesRequest) Descriptor() ([]byte, []int) {
+	return file_invoice_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *ListInvoicesRequest) GetVendor() string {
+	if x != nil {
+		return x.Vendor
+	}
+	return ""
+}
+
+func (x *ListInvoicesRequest) GetPaid() bool {
+	if x != nil && x.Paid != nil {
+		return *x.Paid
+	}
+	return false
+}
+
+func (x *ListInvoicesRequest) GetFrom() string {
+	if x != nil {
+		return x.From
+	}
+	return ""
+}
+
+func (x *ListInvoicesRequest) GetTo() string {
+	if x != nil {
+		return x.To
+	}
+	return ""
+}
+
+func (x *ListInvoicesRequest) GetQuery() string {
+	if x != nil {
+		return x.Query
+	}
+	return ""
+}
+
+type SearchInvoicesRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Query         string                 `protobuf:"bytes,1,opt,name=query,proto3" json:"query,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *SearchInvoicesRequest) Reset() {
+	*x = SearchInvoicesRequest{}
+	mi := &file_invoice_proto_msgTypes[5]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *SearchInvoicesRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SearchInvoicesRequest) ProtoMessage() {}
+
+func (x *SearchInvoicesRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_invoice_proto_msgTypes[5]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SearchInvoicesRequest.ProtoReflect.Descriptor instead.
+func (*SearchInvoicesRequest) Descriptor() ([]byte, []int) {
+	return file_invoice_proto_rawDescGZIP(), []int{5}
+}
+
+func (x *SearchInvoicesRequest) GetQuery() string {
+	if x != nil {
+		return x.Query
+	}
+	return ""
+}
+
+type ListLineItemsRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Id            int64                  `protobuf:"varint,1,opt,name=id,proto3" json:"id,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ListLineItemsRequest) Reset() {
+	*x = ListLineItemsRequest{}
+	mi := &file_invoice_proto_msgTypes[6]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ListLineItemsRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListLineItemsRequest) ProtoMessage() {}
+
+func (x *ListLineItemsRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_invoice_proto_msgTypes[6]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListLineItemsRequest.ProtoReflect.Descriptor instead.
+func (*ListLineItemsRequest) Descriptor() ([]byte, []int) {
+	return file_invoice_proto_rawDescGZIP(), []int{6}
+}
+
+func (x *ListLineItemsRequest) GetId() int64 {
+	if x != nil {
+		return x.Id
+	}
+	return 0
+}
+
+type ListLineItemsResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Items         []*Item                `protobuf:"bytes,1,rep,name=items,proto3" json:"items,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ListLineItemsResponse) Reset() {
+	*x = ListLineItemsResponse{}
+	mi := &file_invoice_proto_msgTypes[7]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ListLineItemsResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListLineItemsResponse) ProtoMessage() {}
+
+func (x *ListLineItemsResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_invoice_proto_msgTypes[7]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListLineItemsResponse.ProtoReflect.Descriptor instead.
+func (*ListLineItemsResponse) Descriptor() ([]byte, []int) {
+	return file_invoice_proto_rawDescGZIP(), []int{7}
+}
+
+func (x *ListLineItemsResponse) GetItems() []*Item {
+	if x != nil {
+		return x.Items
+	}
+	return nil
+}
+
+type ListVendorsRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ListVendorsRequest) Reset() {
+	*x = ListVendorsRequest{}
+	mi := &file_invoice_proto_msgTypes[8]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ListVendorsRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListVendorsRequest) ProtoMessage() {}
+
+func (x *ListVendorsRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_invoice_proto_msgTypes[8]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListVendorsRequest.ProtoReflect.Descriptor instead.
+func (*ListVendorsRequest) Descriptor() ([]byte, []int) {
+	return file_invoice_proto_rawDescGZIP(), []int{8}
+}
+
+type Vendor struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Name          string                 `protobuf:"bytes,1,opt,name=name,proto3" json:"name,omitempty"`
+	InvoiceCount  int64                  `protobuf:"varint,2,opt,name=invoice_count,json=invoiceCount,proto3" json:"invoice_count,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Vendor) Reset() {
+	*x = Vendor{}
+	mi := &file_invoice_proto_msgTypes[9]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Vendor) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Vendor) ProtoMessage() {}
+
+func (x *Vendor) ProtoReflect() protoreflect.Message {
+	mi := &file_invoice_proto_msgTypes[9]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Vendor.ProtoReflect.Descriptor instead.
+func (*Vendor) Descriptor() ([]byte, []int) {
+	return file_invoice_proto_rawDescGZIP(), []int{9}
+}
+
+func (x *Vendor) GetName() string {
+	if x != nil {
+		return x.Name
+	}
+	return ""
+}
+
+func (x *Vendor) GetInvoiceCount() int64 {
+	if x != nil {
+		return x.InvoiceCount
+	}
+	return 0
+}
+
+type ListVendorsResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Vendors       []*Vendor              `protobuf:"bytes,1,rep,name=vendors,proto3" json:"vendors,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ListVendorsResponse) Reset() {
+	*x = ListVendorsResponse{}
+	mi := &file_invoice_proto_msgTypes[10]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ListVendorsResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListVendorsResponse) ProtoMessage() {}
+
+func (x *ListVendorsResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_invoice_proto_msgTypes[10]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListVendorsResponse.ProtoReflect.Descriptor instead.
+func (*ListVendorsResponse) Descriptor() ([]byte, []int) {
+	return file_invoice_proto_rawDescGZIP(), []int{10}
+}
+
+func (x *ListVendorsResponse) GetVendors() []*Vendor {
+	if x != nil {
+		return x.Vendors
+	}
+	return nil
+}
+
+type GetCountsRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GetCountsRequest) Reset() {
+	*x = GetCountsRequest{}
+	mi := &file_invoice_proto_msgTypes[11]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetCountsRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetCountsRequest) ProtoMessage() {}
+
+func (x *GetCountsRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_invoice_proto_msgTypes[11]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetCountsRequest.ProtoReflect.Descriptor instead.
+func (*GetCountsRequest) Descriptor() ([]byte, []int) {
+	return file_invoice_proto_rawDescGZIP(), []int{11}
+}
+
+type Counts struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Invoices      int64                  `protobuf:"varint,1,opt,name=invoices,proto3" json:"invoices,omitempty"`
+	Vendors       int64                  `protobuf:"varint,2,opt,name=vendors,proto3" json:"vendors,omitempty"`
+	Paid          int64                  `protobuf:"varint,3,opt,name=paid,proto3" json:"paid,omitempty"`
+	Unpaid        int64                  `protobuf:"varint,4,opt,name=unpaid,proto3" json:"unpaid,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Counts) Reset() {
+	*x = Counts{}
+	mi := &file_invoice_proto_msgTypes[12]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Counts) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Counts) ProtoMessage() {}
+
+func (x *Counts) ProtoReflect() protoreflect.Message {
+	mi := &file_invoice_proto_msgTypes[12]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Counts.ProtoReflect.Descriptor instead.
+func (*Counts) Descriptor() ([]byte, []int) {
+	return file_invoice_proto_rawDescGZIP(), []int{12}
+}
+
+func (x *Counts) GetInvoices() int64 {
+	if x != nil {
+		return x.Invoices
+	}
+	return 0
+}
+
+func (x *Counts) GetVendors() int64 {
+	if x != nil {
+		return x.Vendors
+	}
+	return 0
+}
+
+func (x *Counts) GetPaid() int64 {
+	if x != nil {
+		return x.Paid
+	}
+	return 0
+}
+
+func (x *Counts) GetUnpaid() int64 {
+	if x != nil {
+		return x.Unpaid
+	}
+	return 0
+}
+
+type AddInvoiceRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Invoice       *Invoice               `protobuf:"bytes,1,opt,name=invoice,proto3" json:"invoice,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *AddInvoiceRequest) Reset() {
+	*x = AddInvoiceRequest{}
+	mi := &file_invoice_proto_msgTypes[13]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *AddInvoiceRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*AddInvoiceRequest) ProtoMessage() {}
+
+func (x *AddInvoiceRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_invoice_proto_msgTypes[13]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use AddInvoiceRequest.ProtoReflect.Descriptor instead.
+func (*AddInvoiceRequest) Descriptor() ([]byte, []int) {
+	return file_invoice_proto_rawDescGZIP(), []int{13}
+}
+
+func (x *AddInvoiceRequest) GetInvoice() *Invoice {
+	if x != nil {
+		return x.Invoice
+	}
+	return nil
+}
+
+type UpdateInvoiceRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Invoice       *Invoice               `protobuf:"bytes,1,opt,name=invoice,proto3" json:"invoice,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *UpdateInvoiceRequest) Reset() {
+	*x = UpdateInvoiceRequest{}
+	mi := &file_invoice_proto_msgTypes[14]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *UpdateInvoiceRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*UpdateInvoiceRequest) ProtoMessage() {}
+
+func (x *UpdateInvoiceRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_invoice_proto_msgTypes[14]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use UpdateInvoiceRequest.ProtoReflect.Descriptor instead.
+func (*UpdateInvoiceRequest) Descriptor() ([]byte, []int) {
+	return file_invoice_proto_rawDescGZIP(), []int{14}
+}
+
+func (x *UpdateInvoiceRequest) GetInvoice() *Invoice {
+	if x != nil {
+		return x.Invoice
+	}
+	return nil
+}
+
+type DeleteInvoiceRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Id            int64                  `protobuf:"varint,1,opt,name=id,proto3" json:"id,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *DeleteInvoiceRequest) Reset() {
+	*x = DeleteInvoiceRequest{}
+	mi := &file_invoice_proto_msgTypes[15]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *DeleteInvoiceRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*DeleteInvoiceRequest) ProtoMessage() {}
+
+func (x *DeleteInvoiceRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_invoice_proto_msgTypes[15]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use DeleteInvoiceRequest.ProtoReflect.Descriptor instead.
+func (*DeleteInvoiceRequest) Descriptor() ([]byte, []int) {
+	return file_invoice_proto_rawDescGZIP(), []int{15}
+}
+
+func (x *DeleteInvoiceRequest) GetId() int64 {
+	if x != nil {
+		return x.Id
+	}
+	return 0
+}
+
+type DeleteInvoiceResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *DeleteInvoiceResponse) Reset() {
+	*x = DeleteInvoiceResponse{}
+	mi := &file_invoice_proto_msgTypes[16]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *DeleteInvoiceResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*DeleteInvoiceResponse) ProtoMessage() {}
+
+func (x *DeleteInvoiceResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_invoice_proto_msgTypes[16]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use DeleteInvoiceResponse.ProtoReflect.Descriptor instead.
+func (*DeleteInvoiceResponse) Descriptor() ([]byte, []int) {
+	return file_invoice_proto_rawDescGZIP(), []int{16}
+}
+
+var File_invoice_proto protoreflect.FileDescriptor
+
+const file_invoice_proto_rawDesc = "" +
+	"\n" +
+	"\rinvoice.proto\x12\n" +
+	"invoice.v1\"\x80\x01\n" +
+	"\bLocation\x12\x16\n" +
+	"\x06street\x18\x01 \x01(\tR\x06street\x12\x12\n" +
+	"\x04city\x18\x02 \x01(\tR\x04city\x12\x14\n" +
+	"\x05state\x18\x03 \x01(\tR\x05state\x12\x18\n" +
+	"\azipcode\x18\x04 \x01(\tR\azipcode\x12\x18\n" +
+	"\acountry\x18\x05 \x01(\tR\acountry\"\xdc\x01\n" +
+	"\x04Item\x12\x1d\n" +
+	"\n" +
+	"product_id\x18\x01 \x01(\tR\tproductId\x12 \n" +
+	"\vdescription\x18\x02 \x01(\tR\vdescription\x12\x1a\n" +
+	"\bquantity\x18\x03 \x01(\rR\bquantity\x12\x16\n" +
+	"\x06amount\x18\x04 \x01(\x03R\x06amount\x12\x1b\n" +
+	"\tunit_code\x18\x05 \x01(\tR\bunitCode\x12!\n" +
+	"\ftax_category\x18\x06 \x01(\tR\vtaxCategory\x12\x1f\n" +
+	"\vtax_percent\x18\a \x01(\x01R\n" +
+	"taxPercent\"\x82\x03\n" +
+	"\aInvoice\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\x03R\x02id\x12\x16\n" +
+	"\x06vendor\x18\x02 \x01(\tR\x06vendor\x12.\n" +
+	"\aaddress\x18\x03 \x01(\v2\x14.invoice.v1.LocationR\aaddress\x12&\n" +
+	"\x05items\x18\x04 \x03(\v2\x10.invoice.v1.ItemR\x05items\x12\x1d\n" +
+	"\n" +
+	"invoice_no\x18\x05 \x01(\tR\tinvoiceNo\x12\x12\n" +
+	"\x04date\x18\x06 \x01(\tR\x04date\x12%\n" +
+	"\x0epurchase_order\x18\a \x01(\tR\rpurchaseOrder\x12\x14\n" +
+	"\x05total\x18\b \x01(\x03R\x05total\x12\x1a\n" +
+	"\bcurrency\x18\t \x01(\tR\bcurrency\x12\x12\n" +
+	"\x04paid\x18\n" +
+	" \x01(\bR\x04paid\x12\x19\n" +
+	"\bdue_date\x18\v \x01(\tR\adueDate\x12\x1b\n" +
+	"\ttax_total\x18\f \x01(\x03R\btaxTotal\x12\x1f\n" +
+	"\vcredit_note\x18\r \x01(\bR\n" +
+	"creditNote\"#\n" +
+	"\x11GetInvoiceRequest\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\x03R\x02id\"\x89\x01\n" +
+	"\x13ListInvoicesRequest\x12\x16\n" +
+	"\x06vendor\x18\x01 \x01(\tR\x06vendor\x12\x17\n" +
+	"\x04paid\x18\x02 \x01(\bH\x00R\x04paid\x88\x01\x01\x12\x12\n" +
+	"\x04from\x18\x03 \x01(\tR\x04from\x12\x0e\n" +
+	"\x02to\x18\x04 \x01(\tR\x02to\x12\x14\n" +
+	"\x05query\x18\x05 \x01(\tR\x05queryB\a\n" +
+	"\x05_paid\"-\n" +
+	"\x15SearchInvoicesRequest\x12\x14\n" +
+	"\x05query\x18\x01 \x01(\tR\x05query\"&\n" +
+	"\x14ListLineItemsRequest\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\x03R\x02id\"?\n" +
+	"\x15ListLineItemsResponse\x12&\n" +
+	"\x05items\x18\x01 \x03(\v2\x10.invoice.v1.ItemR\x05items\"\x14\n" +
+	"\x12ListVendorsRequest\"A\n" +
+	"\x06Vendor\x12\x12\n" +
+	"\x04name\x18\x01 \x01(\tR\x04name\x12#\n" +
+	"\rinvoice_count\x18\x02 \x01(\x03R\finvoiceCount\"C\n" +
+	"\x13ListVendorsResponse\x12,\n" +
+	"\avendors\x18\x01 \x03(\v2\x12.invoice.v1.VendorR\avendors\"\x12\n" +
+	"\x10GetCountsRequest\"j\n" +
+	"\x06Counts\x12\x1a\n" +
+	"\binvoices\x18\x01 \x01(\x03R\binvoices\x12\x18\n" +
+	"\avendors\x18\x02 \x01(\x03R\avendors\x12\x12\n" +
+	"\x04paid\x18\x03 \x01(\x03R\x04paid\x12\x16\n" +
+	"\x06unpaid\x18\x04 \x01(\x03R\x06unpaid\"B\n" +
+	"\x11AddInvoiceRequest\x12-\n" +
+	"\ainvoice\x18\x01 \x01(\v2\x13.invoice.v1.InvoiceR\ainvoice\"E\n" +
+	"\x14UpdateInvoiceRequest\x12-\n" +
+	"\ainvoice\x18\x01 \x01(\v2\x13.invoice.v1.InvoiceR\ainvoice\"&\n" +
+	"\x14DeleteInvoiceRequest\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\x03R\x02id\"\x17\n" +
+	"\x15DeleteInvoiceResponse2\xab\x05\n" +
+	"\x0eInvoiceService\x12@\n" +
+	"\n" +
+	"GetInvoice\x12\x1d.invoice.v1.GetInvoiceRequest\x1a\x13.invoice.v1.Invoice\x12F\n" +
+	"\fListInvoices\x12\x1f.invoice.v1.ListInvoicesRequest\x1a\x13.invoice.v1.Invoice0\x01\x12J\n" +
+	"\x0eSearchInvoices\x12!.invoice.v1.SearchInvoicesRequest\x1a\x13.invoice.v1.Invoice0\x01\x12T\n" +
+	"\rListLineItems\x12 .invoice.v1.ListLineItemsRequest\x1a!.invoice.v1.ListLineItemsResponse\x12N\n" +
+	"\vListVendors\x12\x1e.invoice.v1.ListVendorsRequest\x1a\x1f.invoice.v1.ListVendorsResponse\x12=\n" +
+	"\tGetCounts\x12\x1c.invoice.v1.GetCountsRequest\x1a\x12.invoice.v1.Counts\x12@\n" +
+	"\n" +
+	"AddInvoice\x12\x1d.invoice.v1.AddInvoiceRequest\x1a\x13.invoice.v1.Invoice\x12F\n" +
+	"\rUpdateInvoice\x12 .invoice.v1.UpdateInvoiceRequest\x1a\x13.invoice.v1.Invoice\x12T\n" +
+	"\rDeleteInvoice\x12 .invoice.v1.DeleteInvoiceRequest\x1a!.invoice.v1.DeleteInvoiceResponseB,Z*github.com/airpaio/goinvoice/rpc/invoicepbb\x06proto3"
+
+var (
+	file_invoice_proto_rawDescOnce sync.Once
+	file_invoice_proto_rawDescData []byte
+)
+
+func file_invoice_proto_rawDescGZIP() []byte {
+	file_invoice_proto_rawDescOnce.Do(func() {
+		file_invoice_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_invoice_proto_rawDesc), len(file_invoice_proto_rawDesc)))
+	})
+	return file_invoice_proto_rawDescData
+}
+
+var file_invoice_proto_msgTypes = make([]protoimpl.MessageInfo, 17)
+var file_invoice_proto_goTypes = []any{
+	(*Location)(nil),              // 0: invoice.v1.Location
+	(*Item)(nil),                  // 1: invoice.v1.Item
+	(*Invoice)(nil),               // 2: invoice.v1.Invoice
+	(*GetInvoiceRequest)(nil),     // 3: invoice.v1.GetInvoiceRequest
+	(*ListInvoicesRequest)(nil),   // 4: invoice.v1.ListInvoicesRequest
+	(*SearchInvoicesRequest)(nil), // 5: invoice.v1.SearchInvoicesRequest
+	(*ListLineItemsRequest)(nil),  // 6: invoice.v1.ListLineItemsRequest
+	(*ListLineItemsResponse)(nil), // 7: invoice.v1.ListLineItemsResponse
+	(*ListVendorsRequest)(nil),    // 8: invoice.v1.ListVendorsRequest
+	(*Vendor)(nil),                // 9: invoice.v1.Vendor
+	(*ListVendorsResponse)(nil),   // 10: invoice.v1.ListVendorsResponse
+	(*GetCountsRequest)(nil),      // 11: invoice.v1.GetCountsRequest
+	(*Counts)(nil),                // 12: invoice.v1.Counts
+	(*AddInvoiceRequest)(nil),     // 13: invoice.v1.AddInvoiceRequest
+	(*UpdateInvoiceRequest)(nil),  // 14: invoice.v1.UpdateInvoiceRequest
+	(*DeleteInvoiceRequest)(nil),  // 15: invoice.v1.DeleteInvoiceRequest
+	(*DeleteInvoiceResponse)(nil), // 16: invoice.v1.DeleteInvoiceResponse
+}
+var file_invoice_proto_depIdxs = []int32{
+	0,  // 0: invoice.v1.Invoice.address:type_name -> invoice.v1.Location
+	1,  // 1: invoice.v1.Invoice.items:type_name -> invoice.v1.Item
+	1,  // 2: invoice.v1.ListLineItemsResponse.items:type_name -> invoice.v1.Item
+	9,  // 3: invoice.v1.ListVendorsResponse.vendors:type_name -> invoice.v1.Vendor
+	2,  // 4: invoice.v1.AddInvoiceRequest.invoice:type_name -> invoice.v1.Invoice
+	2,  // 5: invoice.v1.UpdateInvoiceRequest.invoice:type_name -> invoice.v1.Invoice
+	3,  // 6: invoice.v1.InvoiceService.GetInvoice:input_type -> invoice.v1.GetInvoiceRequest
+	4,  // 7: invoice.v1.InvoiceService.ListInvoices:input_type -> invoice.v1.ListInvoicesRequest
+	5,  // 8: invoice.v1.InvoiceService.SearchInvoices:input_type -> invoice.v1.SearchInvoicesRequest
+	6,  // 9: invoice.v1.InvoiceService.ListLineItems:input_type -> invoice.v1.ListLineItemsRequest
+	8,  // 10: invoice.v1.InvoiceService.ListVendors:input_type -> invoice.v1.ListVendorsRequest
+	11, // 11: invoice.v1.InvoiceService.GetCounts:input_type -> invoice.v1.GetCountsRequest
+	13, // 12: invoice.v1.InvoiceService.AddInvoice:input_type -> invoice.v1.AddInvoiceRequest
+	14, // 13: invoice.v1.InvoiceService.UpdateInvoice:input_type -> invoice.v1.UpdateInvoiceRequest
+	15, // 14: invoice.v1.InvoiceService.DeleteInvoice:input_type -> invoice.v1.DeleteInvoiceRequest
+	2,  // 15: invoice.v1.InvoiceService.GetInvoice:output_type -> invoice.v1.Invoice
+	2,  // 16: invoice.v1.InvoiceService.ListInvoices:output_type -> invoice.v1.Invoice
+	2,  // 17: invoice.v1.InvoiceService.SearchInvoices:output_type -> invoice.v1.Invoice
+	7,  // 18: invoice.v1.InvoiceService.ListLineItems:output_type -> invoice.v1.ListLineItemsResponse
+	10, // 19: invoice.v1.InvoiceService.ListVendors:output_type -> invoice.v1.ListVendorsResponse
+	12, // 20: invoice.v1.InvoiceService.GetCounts:output_type -> invoice.v1.Counts
+	2,  // 21: invoice.v1.InvoiceService.AddInvoice:output_type -> invoice.v1.Invoice
+	2,  // 22: invoice.v1.InvoiceService.UpdateInvoice:output_type -> invoice.v1.Invoice
+	16, // 23: invoice.v1.InvoiceService.DeleteInvoice:output_type -> invoice.v1.DeleteInvoiceResponse
+	15, // [15:24] is the sub-list for method output_type
+	6,  // [6:15] is the sub-list for method input_type
+	6,  // [6:6] is the sub-list for extension type_name
+	6,  // [6:6] is the sub-list for extension extendee
+	0,  // [0:6] is the sub-list for field type_name
+}
+
+func init() { file_invoice_proto_init() }
+func file_invoice_proto_init() {
+	if File_invoice_proto != nil {
+		return
+	}
+	file_invoice_proto_msgTypes[4].OneofWrappers = []any{}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_invoice_proto_rawDesc), len(file_invoice_proto_rawDesc)),
+			NumEnums:      0,
+			NumMessages:   17,
+			NumExtensions: 0,
+			NumServices:   1,
+		},
+		GoTypes:           file_invoice_proto_goTypes,
+		DependencyIndexes: file_invoice_proto_depIdxs,
+		MessageInfos:      file_invoice_proto_msgTypes,
+	}.Build()
+	File_invoice_proto = out.File
+	file_invoice_proto_goTypes = nil
+	file_invoice_proto_depIdxs = nil
+}
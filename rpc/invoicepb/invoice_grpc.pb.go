@@ -0,0 +1,459 @@
+// Copyright 2016 Cory Robinson. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE.txt file.
+
+// invoice.proto defines the gRPC contract of the invoice service. The
+// messages mirror Invoice, Location and Item of App/model.go; amounts are
+// integer cents and dates MM/DD/YYYY, as in the DB. After changing this
+// file, regenerate the Go code with `go generate` in this directory.
+
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.5.1
+// - protoc             (unknown)
+// source: invoice.proto
+
+package invoicepb
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.64.0 or later.
+const _ = grpc.SupportPackageIsVersion9
+
+const (
+	InvoiceService_GetInvoice_FullMethodName     = "/invoice.v1.InvoiceService/GetInvoice"
+	InvoiceService_ListInvoices_FullMethodName   = "/invoice.v1.InvoiceService/ListInvoices"
+	InvoiceService_SearchInvoices_FullMethodName = "/invoice.v1.InvoiceService/SearchInvoices"
+	InvoiceService_ListLineItems_FullMethodName  = "/invoice.v1.InvoiceService/ListLineItems"
+	InvoiceService_ListVendors_FullMethodName    = "/invoice.v1.InvoiceService/ListVendors"
+	InvoiceService_GetCounts_FullMethodName      = "/invoice.v1.InvoiceService/GetCounts"
+	InvoiceService_AddInvoice_FullMethodName     = "/invoice.v1.InvoiceService/AddInvoice"
+	InvoiceService_UpdateInvoice_FullMethodName  = "/invoice.v1.InvoiceService/UpdateInvoice"
+	InvoiceService_DeleteInvoice_FullMethodName  = "/invoice.v1.InvoiceService/DeleteInvoice"
+)
+
+// InvoiceServiceClient is the client API for InvoiceService service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+//
+// InvoiceService exposes the operations of the invoice repository.
+type InvoiceServiceClient interface {
+	GetInvoice(ctx context.Context, in *GetInvoiceRequest, opts ...grpc.CallOption) (*Invoice, error)
+	// ListInvoices streams the invoices selected by the request, by ID,
+	// without their line items, see ListLineItems.
+	ListInvoices(ctx context.Context, in *ListInvoicesRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[Invoice], error)
+	// SearchInvoices streams the invoices selected by a query in the search
+	// syntax of the GUI search box, by ID, without their line items, i.e.
+	// vendor:niche paid:false total>100 date:2018-01..2018-03 "hammer".
+	SearchInvoices(ctx context.Context, in *SearchInvoicesRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[Invoice], error)
+	ListLineItems(ctx context.Context, in *ListLineItemsRequest, opts ...grpc.CallOption) (*ListLineItemsResponse, error)
+	ListVendors(ctx context.Context, in *ListVendorsRequest, opts ...grpc.CallOption) (*ListVendorsResponse, error)
+	GetCounts(ctx context.Context, in *GetCountsRequest, opts ...grpc.CallOption) (*Counts, error)
+	// AddInvoice adds an invoice and returns it with the ID assigned.
+	AddInvoice(ctx context.Context, in *AddInvoiceRequest, opts ...grpc.CallOption) (*Invoice, error)
+	// UpdateInvoice replaces the invoice with the ID of the one given.
+	UpdateInvoice(ctx context.Context, in *UpdateInvoiceRequest, opts ...grpc.CallOption) (*Invoice, error)
+	DeleteInvoice(ctx context.Context, in *DeleteInvoiceRequest, opts ...grpc.CallOption) (*DeleteInvoiceResponse, error)
+}
+
+type invoiceServiceClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewInvoiceServiceClient(cc grpc.ClientConnInterface) InvoiceServiceClient {
+	return &invoiceServiceClient{cc}
+}
+
+func (c *invoiceServiceClient) GetInvoice(ctx context.Context, in *GetInvoiceRequest, opts ...grpc.CallOption) (*Invoice, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(Invoice)
+	err := c.cc.Invoke(ctx, InvoiceService_GetInvoice_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *invoiceServiceClient) ListInvoices(ctx context.Context, in *ListInvoicesRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[Invoice], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &InvoiceService_ServiceDesc.Streams[0], InvoiceService_ListInvoices_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[ListInvoicesRequest, Invoice]{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type InvoiceService_ListInvoicesClient = grpc.ServerStreamingClient[Invoice]
+
+func (c *invoiceServiceClient) SearchInvoices(ctx context.Context, in *SearchInvoicesRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[Invoice], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &InvoiceService_ServiceDesc.Streams[1], InvoiceService_SearchInvoices_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[SearchInvoicesRequest, Invoice]{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type InvoiceService_SearchInvoicesClient = grpc.ServerStreamingClient[Invoice]
+
+func (c *invoiceServiceClient) ListLineItems(ctx context.Context, in *ListLineItemsRequest, opts ...grpc.CallOption) (*ListLineItemsResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ListLineItemsResponse)
+	err := c.cc.Invoke(ctx, InvoiceService_ListLineItems_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *invoiceServiceClient) ListVendors(ctx context.Context, in *ListVendorsRequest, opts ...grpc.CallOption) (*ListVendorsResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ListVendorsResponse)
+	err := c.cc.Invoke(ctx, InvoiceService_ListVendors_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *invoiceServiceClient) GetCounts(ctx context.Context, in *GetCountsRequest, opts ...grpc.CallOption) (*Counts, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(Counts)
+	err := c.cc.Invoke(ctx, InvoiceService_GetCounts_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *invoiceServiceClient) AddInvoice(ctx context.Context, in *AddInvoiceRequest, opts ...grpc.CallOption) (*Invoice, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(Invoice)
+	err := c.cc.Invoke(ctx, InvoiceService_AddInvoice_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *invoiceServiceClient) UpdateInvoice(ctx context.Context, in *UpdateInvoiceRequest, opts ...grpc.CallOption) (*Invoice, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(Invoice)
+	err := c.cc.Invoke(ctx, InvoiceService_UpdateInvoice_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *invoiceServiceClient) DeleteInvoice(ctx context.Context, in *DeleteInvoiceRequest, opts ...grpc.CallOption) (*DeleteInvoiceResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(DeleteInvoiceResponse)
+	err := c.cc.Invoke(ctx, InvoiceService_DeleteInvoice_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// InvoiceServiceServer is the server API for InvoiceService service.
+// All implementations must embed UnimplementedInvoiceServiceServer
+// for forward compatibility.
+//
+// InvoiceService exposes the operations of the invoice repository.
+type InvoiceServiceServer interface {
+	GetInvoice(context.Context, *GetInvoiceRequest) (*Invoice, error)
+	// ListInvoices streams the invoices selected by the request, by ID,
+	// without their line items, see ListLineItems.
+	ListInvoices(*ListInvoicesRequest, grpc.ServerStreamingServer[Invoice]) error
+	// SearchInvoices streams the invoices selected by a query in the search
+	// syntax of the GUI search box, by ID, without their line items, i.e.
+	// vendor:niche paid:false total>100 date:2018-01..2018-03 "hammer".
+	SearchInvoices(*SearchInvoicesRequest, grpc.ServerStreamingServer[Invoice]) error
+	ListLineItems(context.Context, *ListLineItemsRequest) (*ListLineItemsResponse, error)
+	ListVendors(context.Context, *ListVendorsRequest) (*ListVendorsResponse, error)
+	GetCounts(context.Context, *GetCountsRequest) (*Counts, error)
+	// AddInvoice adds an invoice and returns it with the ID assigned.
+	AddInvoice(context.Context, *AddInvoiceRequest) (*Invoice, error)
+	// UpdateInvoice replaces the invoice with the ID of the one given.
+	UpdateInvoice(context.Context, *UpdateInvoiceRequest) (*Invoice, error)
+	DeleteInvoice(context.Context, *DeleteInvoiceRequest) (*DeleteInvoiceResponse, error)
+	mustEmbedUnimplementedInvoiceServiceServer()
+}
+
+// UnimplementedInvoiceServiceServer must be embedded to have
+// forward compatible implementations.
+//
+// NOTE: this should be embedded by value instead of pointer to avoid a nil
+// pointer dereference when methods are called.
+type UnimplementedInvoiceServiceServer struct{}
+
+func (UnimplementedInvoiceServiceServer) GetInvoice(context.Context, *GetInvoiceRequest) (*Invoice, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetInvoice not implemented")
+}
+func (UnimplementedInvoiceServiceServer) ListInvoices(*ListInvoicesRequest, grpc.ServerStreamingServer[Invoice]) error {
+	return status.Errorf(codes.Unimplemented, "method ListInvoices not implemented")
+}
+func (UnimplementedInvoiceServiceServer) SearchInvoices(*SearchInvoicesRequest, grpc.ServerStreamingServer[Invoice]) error {
+	return status.Errorf(codes.Unimplemented, "method SearchInvoices not implemented")
+}
+func (UnimplementedInvoiceServiceServer) ListLineItems(context.Context, *ListLineItemsRequest) (*ListLineItemsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListLineItems not implemented")
+}
+func (UnimplementedInvoiceServiceServer) ListVendors(context.Context, *ListVendorsRequest) (*ListVendorsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListVendors not implemented")
+}
+func (UnimplementedInvoiceServiceServer) GetCounts(context.Context, *GetCountsRequest) (*Counts, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetCounts not implemented")
+}
+func (UnimplementedInvoiceServiceServer) AddInvoice(context.Context, *AddInvoiceRequest) (*Invoice, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method AddInvoice not implemented")
+}
+func (UnimplementedInvoiceServiceServer) UpdateInvoice(context.Context, *UpdateInvoiceRequest) (*Invoice, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method UpdateInvoice not implemented")
+}
+func (UnimplementedInvoiceServiceServer) DeleteInvoice(context.Context, *DeleteInvoiceRequest) (*DeleteInvoiceResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method DeleteInvoice not implemented")
+}
+func (UnimplementedInvoiceServiceServer) mustEmbedUnimplementedInvoiceServiceServer() {}
+func (UnimplementedInvoiceServiceServer) testEmbeddedByValue()                        {}
+
+// UnsafeInvoiceServiceServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to InvoiceServiceServer will
+// result in compilation errors.
+type UnsafeInvoiceServiceServer interface {
+	mustEmbedUnimplementedInvoiceServiceServer()
+}
+
+func RegisterInvoiceServiceServer(s grpc.ServiceRegistrar, srv InvoiceServiceServer) {
+	// If the following call pancis, it indicates UnimplementedInvoiceServiceServer was
+	// embedded by pointer and is nil.  This will cause panics if an
+	// unimplemented method is ever invoked, so we test this at initialization
+	// time to prevent it from happening at runtime later due to I/O.
+	if t, ok := srv.(interface{ testEmbeddedByValue() }); ok {
+		t.testEmbeddedByValue()
+	}
+	s.RegisterService(&InvoiceService_ServiceDesc, srv)
+}
+
+func _InvoiceService_GetInvoice_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetInvoiceRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(InvoiceServiceServer).GetInvoice(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: InvoiceService_GetInvoice_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(InvoiceServiceServer).GetInvoice(ctx, req.(*GetInvoiceRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _InvoiceService_ListInvoices_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(ListInvoicesRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(InvoiceServiceServer).ListInvoices(m, &grpc.GenericServerStream[ListInvoicesRequest, Invoice]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type InvoiceService_ListInvoicesServer = grpc.ServerStreamingServer[Invoice]
+
+func _InvoiceService_SearchInvoices_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(SearchInvoicesRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(InvoiceServiceServer).SearchInvoices(m, &grpc.GenericServerStream[SearchInvoicesRequest, Invoice]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type InvoiceService_SearchInvoicesServer = grpc.ServerStreamingServer[Invoice]
+
+func _InvoiceService_ListLineItems_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListLineItemsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(InvoiceServiceServer).ListLineItems(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: InvoiceService_ListLineItems_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(InvoiceServiceServer).ListLineItems(ctx, req.(*ListLineItemsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _InvoiceService_ListVendors_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListVendorsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(InvoiceServiceServer).ListVendors(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: InvoiceService_ListVendors_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(InvoiceServiceServer).ListVendors(ctx, req.(*ListVendorsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _InvoiceService_GetCounts_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetCountsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(InvoiceServiceServer).GetCounts(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: InvoiceService_GetCounts_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(InvoiceServiceServer).GetCounts(ctx, req.(*GetCountsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _InvoiceService_AddInvoice_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(AddInvoiceRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(InvoiceServiceServer).AddInvoice(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: InvoiceService_AddInvoice_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(InvoiceServiceServer).AddInvoice(ctx, req.(*AddInvoiceRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _InvoiceService_UpdateInvoice_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(UpdateInvoiceRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(InvoiceServiceServer).UpdateInvoice(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: InvoiceService_UpdateInvoice_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(InvoiceServiceServer).UpdateInvoice(ctx, req.(*UpdateInvoiceRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _InvoiceService_DeleteInvoice_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(DeleteInvoiceRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(InvoiceServiceServer).DeleteInvoice(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: InvoiceService_DeleteInvoice_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(InvoiceServiceServer).DeleteInvoice(ctx, req.(*DeleteInvoiceRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// InvoiceService_ServiceDesc is the grpc.ServiceDesc for InvoiceService service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var InvoiceService_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "invoice.v1.InvoiceService",
+	HandlerType: (*InvoiceServiceServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "GetInvoice",
+			Handler:    _InvoiceService_GetInvoice_Handler,
+		},
+		{
+			MethodName: "ListLineItems",
+			Handler:    _InvoiceService_ListLineItems_Handler,
+		},
+		{
+			MethodName: "ListVendors",
+			Handler:    _InvoiceService_ListVendors_Handler,
+		},
+		{
+			MethodName: "GetCounts",
+			Handler:    _InvoiceService_GetCounts_Handler,
+		},
+		{
+			MethodName: "AddInvoice",
+			Handler:    _InvoiceService_AddInvoice_Handler,
+		},
+		{
+			MethodName: "UpdateInvoice",
+			Handler:    _InvoiceService_UpdateInvoice_Handler,
+		},
+		{
+			MethodName: "DeleteInvoice",
+			Handler:    _InvoiceService_DeleteInvoice_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "ListInvoices",
+			Handler:       _InvoiceService_ListInvoices_Handler,
+			ServerStreams: true,
+		},
+		{
+			StreamName:    "SearchInvoices",
+			Handler:       _InvoiceService_SearchInvoices_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "invoice.proto",
+}